@@ -0,0 +1,89 @@
+// Command import loads reservations from a CSV file, the same way as the import page of the admin tool.
+//
+//	import -dbname bookings -dbuser tcs -file bookings.csv -map last_name=Surname -dry-run
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/tsawler/bookings-app/internal/config"
+	"github.com/tsawler/bookings-app/internal/driver"
+	"github.com/tsawler/bookings-app/internal/importer"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/repository/dbrepo"
+)
+
+func main() {
+	dbHost := flag.String("dbhost", "localhost", "Database host")
+	dbName := flag.String("dbname", "", "Database name")
+	dbUser := flag.String("dbuser", "", "Database user")
+	dbPass := flag.String("dbpass", "", "Database password")
+	dbPort := flag.String("dbport", "5432", "Database port")
+	dbSSL := flag.String("dbssl", "disable", "Database ssl settings (disable, prefer, require)")
+	fileName := flag.String("file", "", "CSV file to import")
+	mapping := flag.String("map", "", "Columns holding the fields, as field=column pairs separated by commas")
+	dateLayout := flag.String("date-layout", importer.DateLayouts[0], "Format of dates in the file, as a Go time layout")
+	dryRun := flag.Bool("dry-run", false, "Check the file without saving anything")
+
+	flag.Parse()
+
+	if *dbName == "" || *dbUser == "" || *fileName == "" {
+		fmt.Println("Missing required flags")
+		os.Exit(1)
+	}
+
+	m, err := importer.ParseMapping(*mapping)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	file, err := os.Open(*fileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	connectionString := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s", *dbHost, *dbPort, *dbName, *dbUser, *dbPass, *dbSSL)
+	db, err := driver.ConnectSQL(connectionString)
+	if err != nil {
+		log.Fatal("Cannot connect to database! Dying...")
+	}
+	defer db.SQL.Close()
+
+	// imports are recorded in the audit log without a user
+	repo := dbrepo.NewPostgresRepo(db.SQL, &config.AppConfig{}).WithActor(models.Actor{})
+
+	rooms, err := repo.AllRooms()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rows, err := importer.Read(file, importer.Options{Mapping: m, DateLayout: *dateLayout}, rooms)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	result, err := importer.Import(repo, rows, *dryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, row := range result.Failed() {
+		for _, e := range row.Errors {
+			fmt.Printf("line %d: %s\n", row.Line, e)
+		}
+	}
+
+	if result.DryRun {
+		fmt.Printf("Dry run: %d of %d rows would be imported\n", result.Imported, len(result.Rows))
+	} else {
+		fmt.Printf("%d of %d rows imported\n", result.Imported, len(result.Rows))
+	}
+
+	if len(result.Failed()) > 0 {
+		os.Exit(1)
+	}
+}
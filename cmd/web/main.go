@@ -16,6 +16,8 @@ import (
 	"github.com/tsawler/bookings-app/internal/handlers"
 	"github.com/tsawler/bookings-app/internal/helpers"
 	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/money"
+	"github.com/tsawler/bookings-app/internal/payments"
 	"github.com/tsawler/bookings-app/internal/render"
 )
 
@@ -38,6 +40,12 @@ func main() {
 	fmt.Println("Starting mail listener...")
 	listenForMail()
 
+	fmt.Println("Starting room hold sweeper...")
+	sweepExpiredHolds()
+
+	fmt.Println("Starting trash purger...")
+	purgeTrash()
+
 	fmt.Println(fmt.Sprintf("Staring application on port %s", portNumber))
 
 	srv := &http.Server{
@@ -57,6 +65,7 @@ func run() (*driver.DB, error) {
 	gob.Register(models.User{})
 	gob.Register(models.Room{})
 	gob.Register(models.Restriction{})
+	gob.Register(models.RoomRestriction{})
 
 	// read flags
 	inProduction := flag.Bool("production", true, "Application is in production")
@@ -67,6 +76,9 @@ func run() (*driver.DB, error) {
 	dbPass := flag.String("dbpass", "", "Database password")
 	dbPort := flag.String("dbport", "5432", "Database port")
 	dbSSL := flag.String("dbssl", "disable", "Database ssl settings (disable, prefer, require)")
+	siteURL := flag.String("url", "http://localhost:8080", "Public URL of the site, used for links in emails")
+	currency := flag.String("currency", "USD", "Currency exchange rates are kept against, and prices are charged in unless a property has its own")
+	phoneCountry := flag.String("phone-country", "", "Country calling code for phone numbers entered without one (kept as typed if empty)")
 
 	flag.Parse()
 
@@ -81,6 +93,13 @@ func run() (*driver.DB, error) {
 	// change this to true when in production
 	app.InProduction = *inProduction
 	app.UseCache = *useCache
+	app.SiteURL = *siteURL
+	app.Currency = *currency
+	app.Rates = money.NewRates(app.Currency)
+	app.PhoneCountry = *phoneCountry
+
+	// swap in a real gateway here; the handlers only see the payments.Provider interface
+	app.Payments = payments.NewFakeProvider()
 
 	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate | log.Ltime)
 	app.InfoLog = infoLog
@@ -115,6 +134,9 @@ func run() (*driver.DB, error) {
 
 	repo := handlers.NewRepo(&app, db)
 	handlers.NewHandlers(repo)
+	if err = repo.LoadExchangeRates(); err != nil {
+		log.Println("cannot load exchange rates, prices are only shown in", app.Currency, err)
+	}
 	render.NewRenderer(&app)
 	helpers.NewHelpers(&app)
 	return db, nil
@@ -2,10 +2,13 @@ package main
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/justinas/nosurf"
 
 	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/i18n"
+	"github.com/tsawler/bookings-app/internal/money"
 )
 
 // NoSurf is the csrf protection middleware
@@ -26,6 +29,68 @@ func SessionLoad(next http.Handler) http.Handler {
 	return session.LoadAndSave(next)
 }
 
+// Locale picks the language of the page: a locale prefix on the path such as /ko/, then the
+// language the guest chose before, then the languages of their browser. A prefix is taken off
+// the path before routing and remembered in a cookie.
+func Locale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale, rest := i18n.SplitPath(r.URL.Path)
+		if locale != "" {
+			r.URL.Path = rest
+			r.URL.RawPath = ""
+			r.RequestURI = strings.TrimPrefix(r.RequestURI, "/"+locale)
+			if !strings.HasPrefix(r.RequestURI, "/") {
+				r.RequestURI = "/" + r.RequestURI
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     i18n.CookieName,
+				Value:    locale,
+				Path:     "/",
+				MaxAge:   365 * 24 * 60 * 60,
+				HttpOnly: true,
+				Secure:   app.InProduction,
+				SameSite: http.SameSiteLaxMode,
+			})
+		} else if c, err := r.Cookie(i18n.CookieName); err == nil && i18n.IsSupported(c.Value) {
+			locale = c.Value
+		} else {
+			locale = i18n.Match(r.Header.Get("Accept-Language"))
+		}
+
+		next.ServeHTTP(w, r.WithContext(i18n.WithLocale(r.Context(), locale)))
+	})
+}
+
+// currencyCookie remembers the currency a guest chose to see prices in
+const currencyCookie = "currency"
+
+// Currency picks the currency prices are shown in: one chosen with ?currency=EUR, which is
+// remembered in a cookie, then the one chosen before. Guests who haven't chosen one see the
+// currency of the property they are booking, or of the site. Guests are still charged in the
+// currency of the property.
+func Currency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		currency := strings.ToUpper(r.URL.Query().Get("currency"))
+		if currency != "" && app.Rates.Has(currency) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     currencyCookie,
+				Value:    currency,
+				Path:     "/",
+				MaxAge:   365 * 24 * 60 * 60,
+				HttpOnly: true,
+				Secure:   app.InProduction,
+				SameSite: http.SameSiteLaxMode,
+			})
+		} else if c, err := r.Cookie(currencyCookie); err == nil && app.Rates.Has(c.Value) {
+			currency = strings.ToUpper(c.Value)
+		} else {
+			currency = ""
+		}
+
+		next.ServeHTTP(w, r.WithContext(money.WithCurrency(r.Context(), currency)))
+	})
+}
+
 func Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !helpers.IsAuthenticated(r) {
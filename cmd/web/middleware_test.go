@@ -3,7 +3,11 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/tsawler/bookings-app/internal/i18n"
+	"github.com/tsawler/bookings-app/internal/money"
 )
 
 func TestNoSurf(t *testing.T) {
@@ -26,4 +30,102 @@ func TestSessionLoad(t *testing.T) {
 	default:
 		t.Error(fmt.Sprintf("type is not http.Handler, but is %T", v))
 	}
-}
\ No newline at end of file
+}
+func TestLocale(t *testing.T) {
+	var tests = []struct {
+		name           string
+		path           string
+		cookie         string
+		acceptLanguage string
+		expectedLocale string
+		expectedPath   string
+		expectedCookie string
+	}{
+		{"default", "/search-availability", "", "", "en", "/search-availability", ""},
+		{"accept-language", "/search-availability", "", "ja-JP,ja;q=0.9,en;q=0.8", "ja", "/search-availability", ""},
+		{"cookie", "/search-availability", "ko", "ja", "ko", "/search-availability", ""},
+		{"unknown-cookie", "/search-availability", "fr", "ja", "ja", "/search-availability", ""},
+		{"prefix", "/ko/search-availability", "ja", "ja", "ko", "/search-availability", "ko"},
+		{"prefix-only", "/ja", "", "", "ja", "/", "ja"},
+		{"not-a-prefix", "/kopi", "", "", "en", "/kopi", ""},
+	}
+
+	for _, e := range tests {
+		var locale, path string
+		h := Locale(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			locale = i18n.FromContext(r.Context())
+			path = r.URL.Path
+		}))
+
+		req := httptest.NewRequest("GET", e.path, nil)
+		if e.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: i18n.CookieName, Value: e.cookie})
+		}
+		if e.acceptLanguage != "" {
+			req.Header.Set("Accept-Language", e.acceptLanguage)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if locale != e.expectedLocale || path != e.expectedPath {
+			t.Errorf("Locale for %s gave locale %q and path %q, wanted %q and %q", e.name, locale, path, e.expectedLocale, e.expectedPath)
+		}
+
+		cookie := ""
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == i18n.CookieName {
+				cookie = c.Value
+			}
+		}
+		if cookie != e.expectedCookie {
+			t.Errorf("Locale for %s set the cookie to %q, wanted %q", e.name, cookie, e.expectedCookie)
+		}
+	}
+}
+
+func TestCurrency(t *testing.T) {
+	app.Rates = money.NewRates("USD")
+	app.Rates.Set(map[string]float64{"EUR": 0.9, "JPY": 150})
+
+	var tests = []struct {
+		name             string
+		query            string
+		cookie           string
+		expectedCurrency string
+		expectedCookie   string
+	}{
+		{"default", "", "", "", ""},
+		{"query", "?currency=eur", "JPY", "EUR", "EUR"},
+		{"unknown-query", "?currency=GBP", "JPY", "JPY", ""},
+		{"cookie", "", "JPY", "JPY", ""},
+		{"unknown-cookie", "", "GBP", "", ""},
+	}
+
+	for _, e := range tests {
+		var currency string
+		h := Currency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			currency = money.FromContext(r.Context())
+		}))
+
+		req := httptest.NewRequest("GET", "/search-availability"+e.query, nil)
+		if e.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: currencyCookie, Value: e.cookie})
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if currency != e.expectedCurrency {
+			t.Errorf("Currency for %s gave %q, wanted %q", e.name, currency, e.expectedCurrency)
+		}
+
+		cookie := ""
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == currencyCookie {
+				cookie = c.Value
+			}
+		}
+		if cookie != e.expectedCookie {
+			t.Errorf("Currency for %s set the cookie to %q, wanted %q", e.name, cookie, e.expectedCookie)
+		}
+	}
+}
@@ -16,6 +16,8 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.Use(middleware.Recoverer)
 	mux.Use(NoSurf)
 	mux.Use(SessionLoad)
+	mux.Use(Locale)
+	mux.Use(Currency)
 
 	mux.Get("/", handlers.Repo.Home)
 	mux.Get("/about", handlers.Repo.About)
@@ -29,9 +31,17 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.Get("/book-room", handlers.Repo.BookRoom)
 	mux.Get("/contact", handlers.Repo.Contact)
 
+	mux.Get("/waitlist", handlers.Repo.Waitlist)
+	mux.Post("/waitlist", handlers.Repo.PostWaitlist)
+	mux.Get("/waitlist/book/{token}", handlers.Repo.WaitlistBook)
+
 	mux.Get("/make-reservation", handlers.Repo.Reservation)
 	mux.Post("/make-reservation", handlers.Repo.PostReservation)
 	mux.Get("/reservation-summary",handlers.Repo.ReservationSummary)
+	mux.Get("/reservation/{token}/invoice", handlers.Repo.Invoice)
+	mux.Get("/reservation/{token}/invoice.pdf", handlers.Repo.InvoicePDF)
+	mux.Get("/reservation/{token}/cancel", handlers.Repo.CancelReservation)
+	mux.Post("/reservation/{token}/cancel", handlers.Repo.PostCancelReservation)
 
 	mux.Get("/user/login", handlers.Repo.ShowLogin)
 	mux.Post("/user/login", handlers.Repo.PostShowLogin)
@@ -40,16 +50,89 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
 	mux.Route("/admin", func(mux chi.Router){
-		//mux.Use(Auth)
+		mux.Use(Auth)
+		mux.Use(handlers.Repo.StaffProperties)
+
 		mux.Get("/dashboard", handlers.Repo.AdminDashboard)
+		mux.Get("/dashboard.json", handlers.Repo.AdminDashboardJSON)
 
 		mux.Get("/reservations-new", handlers.Repo.AdminNewReservations)
 		mux.Get("/reservations-all", handlers.Repo.AdminAllReservations)
+		mux.Get("/reservations-trash", handlers.Repo.AdminTrash)
+		mux.Get("/reservations-export/{src}", handlers.Repo.AdminExportReservations)
+		mux.Get("/add-reservation", handlers.Repo.AdminAddReservation)
+		mux.Post("/add-reservation", handlers.Repo.AdminPostAddReservation)
 		mux.Get("/reservations-calendar", handlers.Repo.AdminReservationsCalendar)
-		mux.Get("/process-reservation/{src}/{id}", handlers.Repo.AdminProcessReservation)
-		mux.Get("/delete-reservation/{src}/{id}", handlers.Repo.AdminDeleteReservation)
-		mux.Get("/reservations/{src}/{id}", handlers.Repo.AdminShowReservation)
-		mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminPostShowReservation)
+
+		// staff limited to some properties only get at the reservations of those
+		mux.Group(func(mux chi.Router) {
+			mux.Use(handlers.Repo.ReservationAccess)
+
+			mux.Get("/reservation-status/{src}/{id}/{status}", handlers.Repo.AdminReservationStatus)
+			mux.Get("/delete-reservation/{src}/{id}", handlers.Repo.AdminDeleteReservation)
+			mux.Get("/restore-reservation/{id}", handlers.Repo.AdminRestoreReservation)
+			mux.Get("/reservations/{src}/{id}", handlers.Repo.AdminShowReservation)
+			mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminPostShowReservation)
+			mux.Post("/reservations/{src}/{id}/payments", handlers.Repo.AdminPostPayment)
+			mux.Post("/reservations/{src}/{id}/notes", handlers.Repo.AdminPostReservationNote)
+			mux.Post("/reservations/{src}/{id}/notes/{noteID}/important", handlers.Repo.AdminReservationNoteImportant)
+			mux.Get("/reservations/{src}/{id}/invoice", handlers.Repo.AdminInvoice)
+			mux.Post("/reservations/{src}/{id}/invoice", handlers.Repo.AdminIssueInvoice)
+			mux.Get("/reservations/{src}/{id}/invoice.pdf", handlers.Repo.AdminInvoicePDF)
+		})
+
+		mux.Get("/reports", handlers.Repo.AdminReports)
+		mux.Get("/reports/export", handlers.Repo.AdminExportReport)
+
+		mux.Get("/occupancy", handlers.Repo.AdminOccupancy)
+		mux.Get("/occupancy/export", handlers.Repo.AdminExportOccupancy)
+
+		mux.Get("/waitlist", handlers.Repo.AdminWaitlist)
+
+		// guests and the settings of the site are shared by every property
+		mux.Group(func(mux chi.Router) {
+			mux.Use(handlers.Repo.AllProperties)
+
+			mux.Get("/import", handlers.Repo.AdminImport)
+			mux.Post("/import", handlers.Repo.AdminPostImport)
+
+			mux.Get("/audit", handlers.Repo.AdminAudit)
+
+			mux.Get("/guests", handlers.Repo.AdminGuests)
+			mux.Get("/guests/{id}", handlers.Repo.AdminShowGuest)
+			mux.Post("/guests/{id}", handlers.Repo.AdminPostGuest)
+			mux.Post("/guests/{id}/merge", handlers.Repo.AdminMergeGuest)
+
+			mux.Get("/custom-fields", handlers.Repo.AdminCustomFields)
+			mux.Get("/custom-fields/{id}", handlers.Repo.AdminShowCustomField)
+			mux.Post("/custom-fields/{id}", handlers.Repo.AdminPostCustomField)
+			mux.Get("/delete-custom-field/{id}", handlers.Repo.AdminDeleteCustomField)
+
+			mux.Get("/promo-codes", handlers.Repo.AdminPromoCodes)
+			mux.Get("/promo-codes/{id}", handlers.Repo.AdminShowPromoCode)
+			mux.Post("/promo-codes/{id}", handlers.Repo.AdminPostPromoCode)
+			mux.Get("/delete-promo-code/{id}", handlers.Repo.AdminDeletePromoCode)
+
+			mux.Get("/tax-rules", handlers.Repo.AdminTaxRules)
+			mux.Get("/tax-rules/{id}", handlers.Repo.AdminShowTaxRule)
+			mux.Post("/tax-rules/{id}", handlers.Repo.AdminPostTaxRule)
+			mux.Get("/delete-tax-rule/{id}", handlers.Repo.AdminDeleteTaxRule)
+
+			mux.Get("/cancellation-policies", handlers.Repo.AdminCancellationPolicies)
+			mux.Get("/cancellation-policies/{id}", handlers.Repo.AdminShowCancellationPolicy)
+			mux.Post("/cancellation-policies/{id}", handlers.Repo.AdminPostCancellationPolicy)
+			mux.Get("/delete-cancellation-policy/{id}", handlers.Repo.AdminDeleteCancellationPolicy)
+
+			mux.Get("/properties", handlers.Repo.AdminProperties)
+			mux.Get("/properties/{id}", handlers.Repo.AdminShowProperty)
+			mux.Post("/properties/{id}", handlers.Repo.AdminPostProperty)
+			mux.Get("/delete-property/{id}", handlers.Repo.AdminDeleteProperty)
+
+			mux.Get("/exchange-rates", handlers.Repo.AdminExchangeRates)
+			mux.Post("/exchange-rates", handlers.Repo.AdminPostExchangeRate)
+			mux.Post("/exchange-rates/import", handlers.Repo.AdminImportExchangeRates)
+			mux.Get("/delete-exchange-rate/{currency}", handlers.Repo.AdminDeleteExchangeRate)
+		})
 	})
 	return mux
 }
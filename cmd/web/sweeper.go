@@ -0,0 +1,59 @@
+package main
+
+import (
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/handlers"
+)
+
+// holdSweepInterval is how often expired room holds are released
+const holdSweepInterval = time.Minute
+
+// trashPurgeInterval is how often deleted reservations past their retention period are purged
+const trashPurgeInterval = time.Hour
+
+// sweepExpiredHolds periodically deletes room holds whose checkout window has run out, and moves
+// the waitlist on past booking links that ran out unused
+func sweepExpiredHolds() {
+	go func() {
+		ticker := time.NewTicker(holdSweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := handlers.Repo.DB.DeleteExpiredHolds()
+			if err != nil {
+				app.ErrorLog.Println(err)
+				continue
+			}
+			if n > 0 {
+				app.InfoLog.Printf("Released %d expired room holds", n)
+			}
+
+			offers, err := handlers.Repo.OfferExpiredWaitlistDates()
+			if err != nil {
+				app.ErrorLog.Println(err)
+				continue
+			}
+			if offers > 0 {
+				app.InfoLog.Printf("Moved the waitlist on past %d expired offers", offers)
+			}
+		}
+	}()
+}
+
+// purgeTrash periodically removes reservations that have been in the trash longer than the retention period
+func purgeTrash() {
+	go func() {
+		ticker := time.NewTicker(trashPurgeInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := handlers.Repo.DB.PurgeDeletedReservations(time.Now().Add(-handlers.TrashRetention))
+			if err != nil {
+				app.ErrorLog.Println(err)
+				continue
+			}
+			if n > 0 {
+				app.InfoLog.Printf("Purged %d deleted reservations", n)
+			}
+		}
+	}()
+}
@@ -4,9 +4,10 @@ go 1.15
 
 require (
 	github.com/alexedwards/scs/v2 v2.4.0
-	github.com/asaskevich/govalidator v0.0.0-20210307081110-f21760c49a8d // indirect
+	github.com/asaskevich/govalidator v0.0.0-20210307081110-f21760c49a8d
 	github.com/cockroachdb/cockroach-go v2.0.1+incompatible // indirect
 	github.com/go-chi/chi v1.5.1
+	github.com/go-pdf/fpdf v0.6.0
 	github.com/gobuffalo/fizz v1.14.0 // indirect
 	github.com/gobuffalo/genny v0.6.0 // indirect
 	github.com/gobuffalo/packr/v2 v2.8.3 // indirect
@@ -14,11 +15,12 @@ require (
 	github.com/gobuffalo/pop/v6 v6.0.1 // indirect
 	github.com/gobuffalo/validate v2.0.4+incompatible // indirect
 	github.com/gofrs/uuid v4.2.0+incompatible // indirect
-	github.com/jackc/pgconn v1.10.1 // indirect
-	github.com/jackc/pgx/v4 v4.14.1 // indirect
+	github.com/jackc/pgconn v1.10.1
+	github.com/jackc/pgx/v4 v4.14.1
 	github.com/justinas/nosurf v1.1.1
 	github.com/mattn/go-sqlite3 v1.14.11 // indirect
 	github.com/spf13/cobra v1.3.0 // indirect
-	github.com/xhit/go-simple-mail/v2 v2.10.0 // indirect
-	golang.org/x/crypto v0.0.0-20220131195533-30dcbda58838 // indirect
+	github.com/xhit/go-simple-mail/v2 v2.10.0
+	github.com/xuri/excelize/v2 v2.4.1
+	golang.org/x/crypto v0.0.0-20220131195533-30dcbda58838
 )
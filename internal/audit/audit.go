@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+// actions recorded in the audit log
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionStatus  = "status"
+	ActionMerge   = "merge"
+)
+
+// kinds of records the audit log refers to
+const (
+	EntityReservation  = "reservation"
+	EntityPromoCode    = "promo_code"
+	EntityPayment      = "payment"
+	EntityGuest        = "guest"
+	EntityCustomField  = "custom_field"
+	EntityExchangeRate = "exchange_rate"
+	EntityTaxRule      = "tax_rule"
+	EntityPolicy       = "cancellation_policy"
+	EntityProperty     = "property"
+)
+
+// Actions lists every action, for filters
+var Actions = []string{ActionCreate, ActionUpdate, ActionDelete, ActionRestore, ActionStatus, ActionMerge}
+
+// Entities lists every entity, for filters
+var Entities = []string{EntityReservation, EntityPromoCode, EntityPayment, EntityGuest, EntityCustomField, EntityExchangeRate,
+	EntityTaxRule, EntityPolicy, EntityProperty}
+
+// Snapshot returns the JSON form of v, or nil if v is nil
+func Snapshot(v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+// Diff compares two snapshots field by field and returns the fields that differ. Either
+// snapshot may be nil, for records that were created or deleted.
+func Diff(before, after []byte) (map[string]models.AuditChange, error) {
+	b, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]models.AuditChange)
+	for k, v := range b {
+		if to, ok := a[k]; !ok || !reflect.DeepEqual(v, to) {
+			changes[k] = models.AuditChange{From: v, To: a[k]}
+		}
+	}
+	for k, v := range a {
+		if _, ok := b[k]; !ok {
+			changes[k] = models.AuditChange{From: nil, To: v}
+		}
+	}
+	return changes, nil
+}
+
+func fields(snapshot []byte) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	if len(snapshot) == 0 {
+		return m, nil
+	}
+	err := json.Unmarshal(snapshot, &m)
+	return m, err
+}
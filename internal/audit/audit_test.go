@@ -0,0 +1,51 @@
+package audit
+
+import (
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	type record struct {
+		Name  string
+		Email string
+		Rooms []int
+	}
+
+	var tests = []struct {
+		name     string
+		before   interface{}
+		after    interface{}
+		expected []string
+	}{
+		{"unchanged", record{"a", "a@b.com", []int{1}}, record{"a", "a@b.com", []int{1}}, nil},
+		{"one-field", record{"a", "a@b.com", []int{1}}, record{"a", "c@d.com", []int{1}}, []string{"Email"}},
+		{"slice", record{"a", "a@b.com", []int{1}}, record{"a", "a@b.com", []int{1, 2}}, []string{"Rooms"}},
+		{"created", nil, record{"a", "", nil}, []string{"Name", "Email", "Rooms"}},
+		{"deleted", record{"a", "", nil}, nil, []string{"Name", "Email", "Rooms"}},
+	}
+
+	for _, e := range tests {
+		before, _ := Snapshot(e.before)
+		after, _ := Snapshot(e.after)
+
+		changes, err := Diff(before, after)
+		if err != nil {
+			t.Fatalf("%s: %s", e.name, err)
+		}
+		if len(changes) != len(e.expected) {
+			t.Errorf("%s: got %d changes, wanted %d", e.name, len(changes), len(e.expected))
+		}
+		for _, f := range e.expected {
+			if _, ok := changes[f]; !ok {
+				t.Errorf("%s: expected a change to %s", e.name, f)
+			}
+		}
+	}
+
+	before, _ := Snapshot(record{Name: "a"})
+	after, _ := Snapshot(record{Name: "b"})
+	changes, _ := Diff(before, after)
+	if changes["Name"].From != "a" || changes["Name"].To != "b" {
+		t.Errorf("got change %v, wanted a to b", changes["Name"])
+	}
+}
@@ -0,0 +1,135 @@
+// Package cancellations works out what is refunded when a stay is cancelled, going by the
+// cancellation policy it was booked under, and which payments the refund goes back to.
+package cancellations
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/payments"
+)
+
+// Refund is the outcome of cancelling a stay. Fee is the part of the total the guest keeps
+// owing, Amount is what is refunded of what they paid and Owed is the part of the fee they
+// haven't paid yet. Amounts are in cents.
+type Refund struct {
+	Percent int
+	Fee     int
+	Amount  int
+	Owed    int
+}
+
+// DaysBefore returns the number of days from at to the arrival on start, by calendar date, so
+// cancelling on the day before arrival is 1 day before whatever the time
+func DaysBefore(start, at time.Time) int {
+	y, m, d := at.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	y, m, d = start.Date()
+	arrival := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	return int(arrival.Sub(day).Hours() / 24)
+}
+
+// Compute returns the refund for cancelling res at, when paid has been collected for it. A stay
+// booked without a policy has nothing worked out, and is left to staff.
+func Compute(res models.Reservation, paid int, at time.Time) Refund {
+	var r Refund
+	if len(res.CancellationPolicy.Tiers) == 0 {
+		return r
+	}
+
+	total := res.Total()
+	r.Percent = res.CancellationPolicy.RefundPercent(DaysBefore(res.StartDate, at))
+	r.Fee = total - (total*r.Percent+50)/100
+	if paid > r.Fee {
+		r.Amount = paid - r.Fee
+	} else {
+		r.Owed = r.Fee - paid
+	}
+	return r
+}
+
+// Allocation is the part of a refund that goes back to one charge
+type Allocation struct {
+	Charge models.PaymentTransaction
+	Amount int
+}
+
+// Allocate spreads a refund of amount over the charges in the ledger entries, latest charge
+// first. It returns less than amount if the charges don't cover it.
+func Allocate(entries []models.PaymentTransaction, amount int) []Allocation {
+	var charges []models.PaymentTransaction
+	for _, e := range entries {
+		if e.Kind == payments.KindCharge {
+			charges = append(charges, e)
+		}
+	}
+	sort.SliceStable(charges, func(i, j int) bool { return charges[i].ID > charges[j].ID })
+
+	var allocations []Allocation
+	for _, c := range charges {
+		if amount <= 0 {
+			break
+		}
+		left := payments.Refundable(entries, c.ID)
+		if left <= 0 {
+			continue
+		}
+		if left > amount {
+			left = amount
+		}
+		allocations = append(allocations, Allocation{Charge: c, Amount: left})
+		amount -= left
+	}
+	return allocations
+}
+
+// ParseTiers reads refund tiers from lines of days and percentage, such as "14,100" for a full
+// refund at least 14 days before arrival, and returns them with the most days first
+func ParseTiers(s string) ([]models.RefundTier, error) {
+	var tiers []models.RefundTier
+	seen := make(map[int]bool)
+
+	for i, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: enter the days and the percentage, such as 14,100", i+1)
+		}
+		days, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil || days < 0 {
+			return nil, fmt.Errorf("line %d: the days must be a whole number, 0 or more", i+1)
+		}
+		percent, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(fields[1], "%")))
+		if err != nil || percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("line %d: the percentage must be a whole number from 0 to 100", i+1)
+		}
+		if seen[days] {
+			return nil, fmt.Errorf("line %d: there is already a tier for %d days", i+1, days)
+		}
+		seen[days] = true
+		tiers = append(tiers, models.RefundTier{DaysBefore: days, Percent: percent})
+	}
+
+	if len(tiers) == 0 {
+		return nil, errors.New("enter at least one tier")
+	}
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].DaysBefore > tiers[j].DaysBefore })
+	return tiers, nil
+}
+
+// FormatTiers writes refund tiers the way ParseTiers reads them
+func FormatTiers(tiers []models.RefundTier) string {
+	var lines []string
+	for _, t := range tiers {
+		lines = append(lines, fmt.Sprintf("%d,%d", t.DaysBefore, t.Percent))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,134 @@
+package cancellations
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+var moderate = models.CancellationPolicy{
+	ID:   2,
+	Name: "Moderate",
+	Tiers: []models.RefundTier{
+		{DaysBefore: 7, Percent: 100},
+		{DaysBefore: 2, Percent: 50},
+	},
+}
+
+func TestDaysBefore(t *testing.T) {
+	start := time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		at       time.Time
+		expected int
+	}{
+		{time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC), 7},
+		{time.Date(2050, 1, 9, 23, 59, 0, 0, time.UTC), 1},
+		{time.Date(2050, 1, 10, 12, 0, 0, 0, time.UTC), 0},
+		{time.Date(2050, 1, 12, 8, 0, 0, 0, time.UTC), -2},
+	}
+
+	for _, e := range tests {
+		if got := DaysBefore(start, e.at); got != e.expected {
+			t.Errorf("DaysBefore at %s is %d, wanted %d", e.at, got, e.expected)
+		}
+	}
+}
+
+func TestCompute(t *testing.T) {
+	// two nights at 100.00
+	res := models.Reservation{
+		StartDate:          time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+		EndDate:            time.Date(2050, 1, 12, 0, 0, 0, 0, time.UTC),
+		NightlyRate:        10000,
+		CancellationPolicy: moderate,
+	}
+
+	var tests = []struct {
+		name     string
+		at       time.Time
+		paid     int
+		expected Refund
+	}{
+		{"full-refund", time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), 5000, Refund{Percent: 100, Amount: 5000}},
+		{"half-paid-in-full", time.Date(2050, 1, 5, 0, 0, 0, 0, time.UTC), 20000, Refund{Percent: 50, Fee: 10000, Amount: 10000}},
+		{"half-deposit-kept", time.Date(2050, 1, 5, 0, 0, 0, 0, time.UTC), 5000, Refund{Percent: 50, Fee: 10000, Owed: 5000}},
+		{"too-late", time.Date(2050, 1, 9, 0, 0, 0, 0, time.UTC), 5000, Refund{Fee: 20000, Owed: 15000}},
+	}
+
+	for _, e := range tests {
+		if got := Compute(res, e.paid, e.at); got != e.expected {
+			t.Errorf("%s: got %+v, wanted %+v", e.name, got, e.expected)
+		}
+	}
+
+	res.CancellationPolicy = models.CancellationPolicy{}
+	if got := Compute(res, 5000, time.Date(2050, 1, 9, 0, 0, 0, 0, time.UTC)); got != (Refund{}) {
+		t.Errorf("a stay without a policy has a refund worked out: %+v", got)
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	entries := []models.PaymentTransaction{
+		{ID: 1, Kind: "charge", Amount: 5000},
+		{ID: 2, Kind: "charge", Amount: 15000},
+		{ID: 3, Kind: "refund", ChargeID: 2, Amount: 5000},
+	}
+
+	got := Allocate(entries, 12000)
+	expected := []Allocation{
+		{Charge: entries[1], Amount: 10000},
+		{Charge: entries[0], Amount: 2000},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v, wanted %+v", got, expected)
+	}
+
+	got = Allocate(entries, 50000)
+	if len(got) != 2 || got[0].Amount+got[1].Amount != 15000 {
+		t.Errorf("allocating more than was paid gave %+v, wanted what is left of the charges", got)
+	}
+
+	if got := Allocate(nil, 1000); got != nil {
+		t.Errorf("allocating without charges gave %+v", got)
+	}
+}
+
+func TestParseTiers(t *testing.T) {
+	var tests = []struct {
+		name          string
+		input         string
+		expected      []models.RefundTier
+		expectedError string
+	}{
+		{"sorted", "2,50\r\n7, 100%\n", moderate.Tiers, ""},
+		{"no-refund", "0,0", []models.RefundTier{{DaysBefore: 0, Percent: 0}}, ""},
+		{"empty", "\n", nil, "at least one tier"},
+		{"one-field", "7", nil, "line 1"},
+		{"bad-days", "7,100\n-1,50", nil, "line 2: the days"},
+		{"bad-percent", "7,150", nil, "line 1: the percentage"},
+		{"duplicate", "7,100\n7,50", nil, "already a tier for 7 days"},
+	}
+
+	for _, e := range tests {
+		tiers, err := ParseTiers(e.input)
+		if e.expectedError != "" {
+			if err == nil || !strings.Contains(err.Error(), e.expectedError) {
+				t.Errorf("%s: expected error %q, got %v", e.name, e.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+		}
+		if !reflect.DeepEqual(tiers, e.expected) {
+			t.Errorf("%s: got %+v, wanted %+v", e.name, tiers, e.expected)
+		}
+	}
+
+	if got := FormatTiers(moderate.Tiers); got != "7,100\n2,50" {
+		t.Errorf("FormatTiers is %q", got)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/alexedwards/scs/v2"
 
 	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/money"
+	"github.com/tsawler/bookings-app/internal/payments"
 )
 
 // AppConfig holds the application config
@@ -18,4 +20,9 @@ type AppConfig struct {
 	InProduction  bool
 	Session       *scs.SessionManager
 	MailChan      chan models.MailData
+	SiteURL       string
+	Currency      string
+	Rates         *money.Rates
+	PhoneCountry  string
+	Payments      payments.Provider
 }
@@ -0,0 +1,177 @@
+// Package customfields validates the admin-defined questions on the booking form and the
+// answers guests give to them
+package customfields
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tsawler/bookings-app/internal/forms"
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+// Checked is the answer stored for a ticked checkbox
+const Checked = "yes"
+
+var validName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// Answer is a custom field's answer on a reservation, as shown to staff
+type Answer struct {
+	Label string
+	Value string
+}
+
+// Active returns the fields shown on the booking form
+func Active(fields []models.CustomField) []models.CustomField {
+	var active []models.CustomField
+	for _, f := range fields {
+		if f.Active {
+			active = append(active, f)
+		}
+	}
+	return active
+}
+
+// ParseOptions splits the choices of a select field, one per line
+func ParseOptions(s string) []string {
+	var options []string
+	for _, line := range strings.Split(s, "\n") {
+		if o := strings.TrimSpace(line); o != "" {
+			options = append(options, o)
+		}
+	}
+	return options
+}
+
+// CheckDefinition adds an error to form for every problem with a field's definition. Errors are
+// added against the inputs of the admin form.
+func CheckDefinition(form *forms.Form, f models.CustomField) {
+	if !validName.MatchString(f.Name) {
+		form.Errors.Add("name", "Use lowercase letters, digits and underscores, starting with a letter")
+	}
+	if strings.TrimSpace(f.Label) == "" {
+		form.Errors.Add("label", "This field cannot be blank")
+	}
+
+	if !contains(models.CustomFieldTypes, f.Type) {
+		form.Errors.Add("type", "Invalid field type")
+	}
+	if f.Type == models.FieldSelect && len(f.Options) == 0 {
+		form.Errors.Add("options", "A select field needs at least one option")
+	}
+
+	if f.Pattern != "" {
+		if _, err := regexp.Compile(f.Pattern); err != nil {
+			form.Errors.Add("pattern", "Invalid regular expression")
+		}
+	}
+	if f.MaxLength < 0 {
+		form.Errors.Add("max_length", "The maximum length must not be negative")
+	}
+}
+
+// Validate checks the answers posted in form to fields, adding an error to form against the
+// input of every answer that is missing or wrong. It returns the answers given, by field name.
+func Validate(form *forms.Form, fields []models.CustomField) map[string]string {
+	values := make(map[string]string)
+	for _, f := range fields {
+		input := f.InputName()
+		value := strings.TrimSpace(form.Get(input))
+
+		if f.Type == models.FieldCheckbox && value != "" {
+			value = Checked
+		}
+		if value == "" {
+			if f.Required {
+				form.AddError(input, "This field cannot be blank")
+			}
+			continue
+		}
+
+		if !check(form, input, f, value) {
+			continue
+		}
+		values[f.Name] = value
+	}
+	return values
+}
+
+// check adds an error against input if a non-empty answer to f is wrong, and reports whether
+// the answer is right. Messages are translated for guests.
+func check(form *forms.Form, input string, f models.CustomField, value string) bool {
+	msg := ""
+	switch f.Type {
+	case models.FieldNumber:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			msg = "Please enter a number"
+		}
+	case models.FieldDate:
+		if _, err := time.Parse(forms.DateLayout, value); err != nil {
+			msg = "Please enter a date"
+		}
+	case models.FieldTime:
+		if _, err := time.Parse("15:04", value); err != nil {
+			msg = "Please enter a time, such as 18:30"
+		}
+	case models.FieldSelect:
+		if !contains(f.Options, value) {
+			msg = "Please choose one of the options"
+		}
+	}
+	if msg != "" {
+		form.AddError(input, msg)
+		return false
+	}
+
+	if f.MaxLength > 0 && utf8.RuneCountInString(value) > f.MaxLength {
+		form.AddError(input, "This field must be at most %d characters long", f.MaxLength)
+		return false
+	}
+	if f.Pattern != "" {
+		// definitions are checked when they are saved, so a bad pattern only means nothing matches
+		re, err := regexp.Compile(f.Pattern)
+		if err != nil || !re.MatchString(value) {
+			form.AddError(input, "This field is not in the expected format")
+			return false
+		}
+	}
+	return true
+}
+
+// Answers returns the answers on a reservation in the order of fields, labelled. Answers to
+// fields that have since been deleted come last, under their field name.
+func Answers(fields []models.CustomField, values map[string]string) []Answer {
+	var answers []Answer
+	seen := make(map[string]bool)
+	for _, f := range fields {
+		seen[f.Name] = true
+		if v, ok := values[f.Name]; ok {
+			answers = append(answers, Answer{Label: f.Label, Value: v})
+		}
+	}
+
+	var rest []string
+	for name := range values {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		answers = append(answers, Answer{Label: name, Value: values[name]})
+	}
+	return answers
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
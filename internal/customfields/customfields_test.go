@@ -0,0 +1,166 @@
+package customfields
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/tsawler/bookings-app/internal/forms"
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+var fields = []models.CustomField{
+	{Name: "arrival_time", Label: "Estimated arrival", Type: models.FieldTime, Required: true, Active: true},
+	{Name: "diet", Label: "Dietary needs", Type: models.FieldSelect, Options: []string{"None", "Vegetarian", "Vegan"}, Active: true},
+	{Name: "plate", Label: "Vehicle plate", Type: models.FieldText, Pattern: `^[A-Z0-9 -]+$`, MaxLength: 10, Active: true},
+	{Name: "guests", Label: "Number of guests", Type: models.FieldNumber, Active: true},
+	{Name: "birthday", Label: "Birthday", Type: models.FieldDate, Active: true},
+	{Name: "terms", Label: "I accept the house rules", Type: models.FieldCheckbox, Required: true, Active: true},
+	{Name: "old", Label: "No longer asked", Type: models.FieldText},
+}
+
+func TestActive(t *testing.T) {
+	active := Active(fields)
+	if len(active) != len(fields)-1 {
+		t.Errorf("Active returned %d fields, wanted %d", len(active), len(fields)-1)
+	}
+	for _, f := range active {
+		if f.Name == "old" {
+			t.Error("Active returned an inactive field")
+		}
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	var tests = []struct {
+		options  string
+		expected []string
+	}{
+		{"", nil},
+		{"None\nVegetarian", []string{"None", "Vegetarian"}},
+		{" None \r\n\r\n Vegan\n", []string{"None", "Vegan"}},
+	}
+
+	for _, e := range tests {
+		if got := ParseOptions(e.options); !reflect.DeepEqual(got, e.expected) {
+			t.Errorf("ParseOptions(%q) is %q, wanted %q", e.options, got, e.expected)
+		}
+	}
+}
+
+func TestCheckDefinition(t *testing.T) {
+	var tests = []struct {
+		name          string
+		field         models.CustomField
+		expectedError string
+	}{
+		{"valid", models.CustomField{Name: "plate", Label: "Plate", Type: models.FieldText, Pattern: `^\w+$`}, ""},
+		{"bad-name", models.CustomField{Name: "Vehicle Plate", Label: "Plate", Type: models.FieldText}, "name"},
+		{"no-label", models.CustomField{Name: "plate", Type: models.FieldText}, "label"},
+		{"bad-type", models.CustomField{Name: "plate", Label: "Plate", Type: "color"}, "type"},
+		{"select-without-options", models.CustomField{Name: "diet", Label: "Diet", Type: models.FieldSelect}, "options"},
+		{"bad-pattern", models.CustomField{Name: "plate", Label: "Plate", Type: models.FieldText, Pattern: "("}, "pattern"},
+		{"negative-length", models.CustomField{Name: "plate", Label: "Plate", Type: models.FieldText, MaxLength: -1}, "max_length"},
+	}
+
+	for _, e := range tests {
+		form := forms.New(url.Values{})
+		CheckDefinition(form, e.field)
+		if e.expectedError == "" && !form.Valid() {
+			t.Errorf("CheckDefinition for %s gave errors %v, wanted none", e.name, form.Errors)
+		}
+		if e.expectedError != "" && form.Errors.Get(e.expectedError) == "" {
+			t.Errorf("CheckDefinition for %s gave errors %v, wanted one on %s", e.name, form.Errors, e.expectedError)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var tests = []struct {
+		name           string
+		posted         url.Values
+		expectedErrors []string
+		expected       map[string]string
+	}{
+		{
+			"valid",
+			url.Values{
+				"custom_arrival_time": {"18:30"},
+				"custom_diet":         {"Vegan"},
+				"custom_plate":        {" AB-123 "},
+				"custom_guests":       {"2"},
+				"custom_birthday":     {"1980-05-01"},
+				"custom_terms":        {"on"},
+				"custom_old":          {"ignored"},
+			},
+			nil,
+			map[string]string{"arrival_time": "18:30", "diet": "Vegan", "plate": "AB-123", "guests": "2", "birthday": "1980-05-01", "terms": "yes"},
+		},
+		{
+			"only-required",
+			url.Values{"custom_arrival_time": {"09:00"}, "custom_terms": {"1"}},
+			nil,
+			map[string]string{"arrival_time": "09:00", "terms": "yes"},
+		},
+		{
+			"missing-required",
+			url.Values{},
+			[]string{"custom_arrival_time", "custom_terms"},
+			map[string]string{},
+		},
+		{
+			"invalid",
+			url.Values{
+				"custom_arrival_time": {"evening"},
+				"custom_diet":         {"Paleo"},
+				"custom_plate":        {"ab-123"},
+				"custom_guests":       {"two"},
+				"custom_birthday":     {"01/05/1980"},
+				"custom_terms":        {"on"},
+			},
+			[]string{"custom_arrival_time", "custom_diet", "custom_plate", "custom_guests", "custom_birthday"},
+			map[string]string{"terms": "yes"},
+		},
+		{
+			"too-long",
+			url.Values{"custom_arrival_time": {"09:00"}, "custom_terms": {"on"}, "custom_plate": {"ABCDEFGHIJK"}},
+			[]string{"custom_plate"},
+			map[string]string{"arrival_time": "09:00", "terms": "yes"},
+		},
+	}
+
+	for _, e := range tests {
+		form := forms.New(e.posted)
+		values := Validate(form, Active(fields))
+
+		if len(form.Errors) != len(e.expectedErrors) {
+			t.Errorf("Validate for %s gave errors %v, wanted them on %v", e.name, form.Errors, e.expectedErrors)
+		}
+		for _, input := range e.expectedErrors {
+			if form.Errors.Get(input) == "" {
+				t.Errorf("Validate for %s gave no error on %s", e.name, input)
+			}
+		}
+		if !reflect.DeepEqual(values, e.expected) {
+			t.Errorf("Validate for %s returned %v, wanted %v", e.name, values, e.expected)
+		}
+	}
+}
+
+func TestAnswers(t *testing.T) {
+	values := map[string]string{"plate": "AB-123", "arrival_time": "18:30", "parking": "yes", "cot": "no"}
+
+	expected := []Answer{
+		{Label: "Estimated arrival", Value: "18:30"},
+		{Label: "Vehicle plate", Value: "AB-123"},
+		{Label: "cot", Value: "no"},
+		{Label: "parking", Value: "yes"},
+	}
+	if got := Answers(fields, values); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Answers returned %v, wanted %v", got, expected)
+	}
+
+	if got := Answers(fields, nil); got != nil {
+		t.Errorf("Answers for no values returned %v, wanted nil", got)
+	}
+}
@@ -0,0 +1,59 @@
+// Package export writes tables, such as lists of reservations, as spreadsheets
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// formats a table can be written in
+const (
+	CSV  = "csv"
+	XLSX = "xlsx"
+)
+
+// ErrUnknownFormat is returned for a format other than CSV or XLSX
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Cents is an amount of money in cents. It is written with two decimals.
+type Cents int
+
+func (c Cents) String() string {
+	sign := ""
+	if c < 0 {
+		sign = "-"
+		c = -c
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, c/100, c%100)
+}
+
+// Writer writes a table a row at a time. Cells may be strings, ints, Cents or time.Time, which is
+// written as a date. Close must be called once all rows are written.
+type Writer interface {
+	WriteRow(cells ...interface{}) error
+	Close() error
+}
+
+// NewWriter returns a Writer writing to w in the format. sheet names the worksheet, for formats
+// that have them.
+func NewWriter(w io.Writer, format, sheet string) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSVWriter(w), nil
+	case XLSX:
+		return newXLSXWriter(w, sheet)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// ContentType returns the MIME type of the format
+func ContentType(format string) string {
+	switch format {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
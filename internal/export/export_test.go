@@ -0,0 +1,141 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestCents(t *testing.T) {
+	var tests = []struct {
+		cents    Cents
+		expected string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{12345, "123.45"},
+		{-250, "-2.50"},
+	}
+
+	for _, e := range tests {
+		if got := e.cents.String(); got != e.expected {
+			t.Errorf("Cents(%d) is %q, wanted %q", int(e.cents), got, e.expected)
+		}
+	}
+}
+
+func TestNewWriter_unknownFormat(t *testing.T) {
+	_, err := NewWriter(&bytes.Buffer{}, "pdf", "")
+	if err != ErrUnknownFormat {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, CSV, "Reservations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = w.WriteRow("ID", "Name", "Arrival", "Total")
+	_ = w.WriteRow(1, "Smith, John", time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), Cents(27000))
+	_ = w.WriteRow(2, "Jane", time.Time{}, Cents(0))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "ID,Name,Arrival,Total\n1,\"Smith, John\",2050-01-01,270.00\n2,Jane,,0.00\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected CSV:\n%s\nwanted:\n%s", buf.String(), expected)
+	}
+}
+
+func TestCSV_formulas(t *testing.T) {
+	var tests = []struct {
+		cell     string
+		expected string
+	}{
+		{"=1+2", "'=1+2"},
+		{"+1 555 1234", "'+1 555 1234"},
+		{"-2", "'-2"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tx", "'\tx"},
+		{"\rx", "'\rx"},
+		{"Smith", "Smith"},
+	}
+
+	for _, e := range tests {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, CSV, "Reservations")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = w.WriteRow(e.cell)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		records, err := csv.NewReader(&buf).Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if records[0] != e.expected {
+			t.Errorf("cell %q was written as %q, wanted %q", e.cell, records[0], e.expected)
+		}
+	}
+
+	// amounts aren't text, so a negative one stays a number
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, CSV, "Reservations")
+	_ = w.WriteRow(Cents(-250))
+	_ = w.Close()
+	if buf.String() != "-2.50\n" {
+		t.Errorf("Cents(-250) was written as %q", buf.String())
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, XLSX, "Reservations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = w.WriteRow("ID", "Name", "Arrival", "Total")
+	_ = w.WriteRow(1, "Smith, John", time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), Cents(27000))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := excelize.OpenReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := f.GetRows("Reservations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	var tests = []struct {
+		cell     string
+		got      string
+		expected string
+	}{
+		{"A1", rows[0][0], "ID"},
+		{"B2", rows[1][1], "Smith, John"},
+		{"C2", rows[1][2], "2050-01-01"},
+		{"D2", rows[1][3], "270.00"},
+	}
+	for _, e := range tests {
+		if e.got != e.expected {
+			t.Errorf("cell %s is %q, wanted %q", e.cell, e.got, e.expected)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package export
+
+import (
+	"io"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// xlsxWriter streams rows into a single worksheet. The workbook is written out on Close, as the
+// zip file it is stored in can't be finished before then.
+type xlsxWriter struct {
+	w      io.Writer
+	f      *excelize.File
+	sw     *excelize.StreamWriter
+	row    int
+	date   int
+	amount int
+}
+
+func newXLSXWriter(w io.Writer, sheet string) (*xlsxWriter, error) {
+	f := excelize.NewFile()
+	if sheet != "" {
+		f.SetSheetName("Sheet1", sheet)
+	} else {
+		sheet = "Sheet1"
+	}
+
+	date, err := f.NewStyle(&excelize.Style{CustomNumFmt: stringPtr("yyyy-mm-dd")})
+	if err != nil {
+		return nil, err
+	}
+	amount, err := f.NewStyle(&excelize.Style{NumFmt: 4}) // #,##0.00
+	if err != nil {
+		return nil, err
+	}
+
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	return &xlsxWriter{w: w, f: f, sw: sw, date: date, amount: amount}, nil
+}
+
+func (x *xlsxWriter) WriteRow(cells ...interface{}) error {
+	x.row++
+
+	values := make([]interface{}, len(cells))
+	for i, cell := range cells {
+		switch v := cell.(type) {
+		case Cents:
+			values[i] = excelize.Cell{StyleID: x.amount, Value: float64(v) / 100}
+		case time.Time:
+			if !v.IsZero() {
+				values[i] = excelize.Cell{StyleID: x.date, Value: v}
+			}
+		default:
+			values[i] = v
+		}
+	}
+
+	axis, err := excelize.CoordinatesToCellName(1, x.row)
+	if err != nil {
+		return err
+	}
+	return x.sw.SetRow(axis, values)
+}
+
+func (x *xlsxWriter) Close() error {
+	if err := x.sw.Flush(); err != nil {
+		return err
+	}
+	return x.f.Write(x.w)
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
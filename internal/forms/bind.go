@@ -0,0 +1,217 @@
+package forms
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Binder decodes posted forms and JSON bodies into structs, validating them on the way.
+//
+// Struct fields are bound when they have a form tag naming their input, and are checked
+// against the comma separated rules in their validate tag:
+//
+//	FirstName string    `form:"first_name" validate:"required,min=3"`
+//	EndDate   time.Time `form:"end_date" validate:"required,after=start_date"`
+//
+// The rules are required, min=N and max=N (characters for strings, values for numbers), email,
+// phone, oneof=a|b|c, after=<input> and notpast. Fields of type string, int, bool, time.Time
+// (in DateLayout) and slices of string or int can be bound.
+type Binder struct {
+	// PhoneCountry is the country calling code for phone numbers given without one
+	PhoneCountry string
+
+	// Locale is the language of the error messages, see i18n
+	Locale string
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Bind decodes the request into dst, which must be a pointer to a struct. JSON bodies are read
+// when the request says so, otherwise the posted form, or the query string of a GET. The
+// returned form holds the input and any validation errors, for rendering back to the user. The
+// error is only for input that could not be read at all.
+func (b Binder) Bind(r *http.Request, dst interface{}) (*Form, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		values, err := jsonValues(r)
+		if err != nil {
+			return nil, err
+		}
+		return b.BindValues(values, dst), nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	if r.Method == http.MethodGet {
+		return b.BindValues(r.URL.Query(), dst), nil
+	}
+	return b.BindValues(r.PostForm, dst), nil
+}
+
+// BindValues decodes values into dst, which must be a pointer to a struct. Fields whose input
+// is missing from values keep what they held, so a form can be bound onto a record loaded from
+// the database; mind that an unticked checkbox is missing too.
+func (b Binder) BindValues(values url.Values, dst interface{}) *Form {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("forms: cannot bind to %T, need a pointer to a struct", dst))
+	}
+	v = v.Elem()
+
+	f := New(values)
+	f.Locale = b.Locale
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := sf.Tag.Get("form")
+		if name == "" || name == "-" || sf.PkgPath != "" {
+			continue
+		}
+
+		b.check(f, name, sf.Type, sf.Tag.Get("validate"))
+
+		if _, ok := values[name]; ok {
+			set(f, name, v.Field(i))
+		}
+	}
+	return f
+}
+
+// check runs the type check for a field and the rules in its validate tag
+func (b Binder) check(f *Form, name string, typ reflect.Type, rules string) {
+	switch {
+	case typ == timeType:
+		f.IsDate(name)
+	case typ.Kind() == reflect.Int:
+		f.IsInt(name)
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Int:
+		for _, s := range f.Values[name] {
+			if _, err := strconv.Atoi(strings.TrimSpace(s)); err != nil {
+				f.addOnce(name, "This field must be a whole number")
+			}
+		}
+	}
+
+	isInt := typ.Kind() == reflect.Int
+	min, max := math.MinInt32, math.MaxInt32
+	hasRange := false
+
+	for _, rule := range strings.Split(rules, ",") {
+		key, arg := strings.TrimSpace(rule), ""
+		if i := strings.Index(key, "="); i >= 0 {
+			key, arg = key[:i], key[i+1:]
+		}
+
+		switch key {
+		case "":
+		case "required":
+			f.Required(name)
+		case "min", "max":
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				panic(fmt.Sprintf("forms: bad %s rule %q on %s", key, arg, name))
+			}
+			switch {
+			case isInt && key == "min":
+				min, hasRange = n, true
+			case isInt:
+				max, hasRange = n, true
+			case key == "min" && !f.blank(name):
+				f.MinLength(name, n)
+			case key == "max":
+				f.MaxLength(name, n)
+			}
+		case "email":
+			if !f.blank(name) {
+				f.IsEmail(name)
+			}
+		case "phone":
+			f.IsPhone(name, b.PhoneCountry)
+		case "oneof":
+			f.OneOf(name, strings.Split(arg, "|")...)
+		case "after":
+			f.DateRange(arg, name)
+		case "notpast":
+			f.NotInPast(name, time.Now())
+		default:
+			panic(fmt.Sprintf("forms: unknown rule %q on %s", key, name))
+		}
+	}
+
+	if hasRange {
+		f.IntRange(name, min, max)
+	}
+}
+
+// set stores the input of a field in fv. Numbers and dates that failed their check are stored as
+// zero, while text is kept as typed so it can be shown again.
+func set(f *Form, name string, fv reflect.Value) {
+	switch {
+	case fv.Type() == timeType:
+		fv.Set(reflect.ValueOf(f.Date(name)))
+	case fv.Kind() == reflect.String:
+		fv.SetString(f.Trimmed(name))
+	case fv.Kind() == reflect.Int:
+		fv.SetInt(int64(f.Int(name)))
+	case fv.Kind() == reflect.Bool:
+		fv.SetBool(f.Bool(name))
+	case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.String:
+		fv.Set(reflect.ValueOf(append([]string(nil), f.Values[name]...)))
+	case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Int:
+		var ints []int
+		for _, s := range f.Values[name] {
+			n, _ := strconv.Atoi(strings.TrimSpace(s))
+			ints = append(ints, n)
+		}
+		fv.Set(reflect.ValueOf(ints))
+	default:
+		panic(fmt.Sprintf("forms: cannot bind %s to a field of type %s", name, fv.Type()))
+	}
+}
+
+// jsonValues reads a JSON object from the request body as form values, so JSON and posted forms
+// are validated the same way. Arrays become repeated values and false becomes blank.
+func jsonValues(r *http.Request) (url.Values, error) {
+	var body map[string]interface{}
+	d := json.NewDecoder(r.Body)
+	d.UseNumber()
+	if err := d.Decode(&body); err != nil {
+		return nil, err
+	}
+
+	values := url.Values{}
+	for key, raw := range body {
+		items, ok := raw.([]interface{})
+		if !ok {
+			items = []interface{}{raw}
+		}
+		for _, item := range items {
+			switch x := item.(type) {
+			case nil:
+				values.Add(key, "")
+			case bool:
+				if x {
+					values.Add(key, "true")
+				} else {
+					values.Add(key, "")
+				}
+			case string:
+				values.Add(key, x)
+			case json.Number:
+				values.Add(key, x.String())
+			default:
+				return nil, fmt.Errorf("forms: %s holds an object, which cannot be bound", key)
+			}
+		}
+	}
+	return values, nil
+}
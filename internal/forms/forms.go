@@ -1,11 +1,12 @@
 package forms
 
 import (
-	"fmt"
 	"net/url"
 	"strings"
 
 	"github.com/asaskevich/govalidator"
+
+	"github.com/tsawler/bookings-app/internal/i18n"
 )
 
 // Valid returns true if there are no errors, otherwise false
@@ -17,22 +18,31 @@ func (f *Form) Valid() bool {
 type Form struct {
 	url.Values
 	Errors errors
+
+	// Locale is the language the error messages are written in, see i18n
+	Locale string
 }
 
 // New initializes a form struct
 func New(data url.Values) *Form {
 	return &Form{
-		data,
-		errors(map[string][]string{}),
+		Values: data,
+		Errors: errors(map[string][]string{}),
 	}
 }
 
+// AddError adds an error message for a field, translated into the locale of the form. The
+// message is formatted with args like fmt.Sprintf.
+func (f *Form) AddError(field, message string, args ...interface{}) {
+	f.Errors.Add(field, i18n.T(f.Locale, message, args...))
+}
+
 // Required checks for required fields
 func (f *Form) Required(fields ...string) {
 	for _, field := range fields {
 		value := f.Get(field)
 		if strings.TrimSpace(value) == "" {
-			f.Errors.Add(field,"This field cannot be blank")
+			f.AddError(field, "This field cannot be blank")
 		}
 	}
 }
@@ -50,12 +60,12 @@ func (f *Form) Has(field string) bool {
 func (f *Form) MinLength(field string, length int) {
 	x := f.Get(field)
 	if len(x) < length {
-		f.Errors.Add(field,fmt.Sprintf("This field must be at least %d characters long", length))
+		f.AddError(field, "This field must be at least %d characters long", length)
 	}
 }
 
 func (f *Form) IsEmail(field string) {
 	if !govalidator.IsEmail(f.Get(field)) {
-		f.Errors.Add(field, "Invalid email address")
+		f.AddError(field, "Invalid email address")
 	}
 }
\ No newline at end of file
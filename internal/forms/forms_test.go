@@ -4,7 +4,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestForm_Has(t *testing.T) {
@@ -98,3 +102,343 @@ func TestForm_Required(t *testing.T) {
 		t.Error("shows does not have required fields when it does")
 	}
 }
+
+func TestForm_MaxLength(t *testing.T) {
+	var tests = []struct {
+		value string
+		valid bool
+	}{
+		{"", true},
+		{"abcd", true},
+		{"ünïç", true},
+		{"abcde", false},
+	}
+
+	for _, e := range tests {
+		form := New(url.Values{"a": {e.value}})
+		form.MaxLength("a", 4)
+		if form.Valid() != e.valid {
+			t.Errorf("MaxLength for %q is valid %v, wanted %v", e.value, form.Valid(), e.valid)
+		}
+	}
+}
+
+func TestNormalizePhone(t *testing.T) {
+	var tests = []struct {
+		phone       string
+		countryCode string
+		expected    string
+		ok          bool
+	}{
+		{"+1 (555) 123-4567", "", "+15551234567", true},
+		{"0044 20 7946 0958", "1", "+442079460958", true},
+		{"555.123.4567", "1", "+15551234567", true},
+		{"020 7946 0958", "44", "+442079460958", true},
+		{"555 123 4567", "", "555 123 4567", true},
+		{" 010-1234-5678 ", "", "010-1234-5678", true},
+		{"0082 10 1234 5678", "", "+821012345678", true},
+		{"12345", "", "", false},
+		{"+0 555 123 4567", "", "", false},
+		{"+1 555 1234 5678 9012", "", "", false},
+		{"123", "1", "", false},
+		{"call me", "1", "", false},
+		{"555-123-4567 ext 8", "1", "", false},
+	}
+
+	for _, e := range tests {
+		got, ok := NormalizePhone(e.phone, e.countryCode)
+		if got != e.expected || ok != e.ok {
+			t.Errorf("NormalizePhone(%q, %q) is %q, %v, wanted %q, %v", e.phone, e.countryCode, got, ok, e.expected, e.ok)
+		}
+	}
+}
+
+func TestForm_IsPhone(t *testing.T) {
+	form := New(url.Values{"phone": {"(555) 123-4567"}, "fax": {"n/a"}, "mobile": {""}})
+	form.IsPhone("phone", "1")
+	form.IsPhone("fax", "1")
+	form.IsPhone("mobile", "1")
+
+	if form.Get("phone") != "+15551234567" {
+		t.Errorf("IsPhone did not normalize the phone number, got %q", form.Get("phone"))
+	}
+	if form.Errors.Get("phone") != "" || form.Errors.Get("mobile") != "" {
+		t.Errorf("IsPhone gave errors for a valid or blank number: %v", form.Errors)
+	}
+	if form.Errors.Get("fax") == "" {
+		t.Error("IsPhone gave no error for an invalid number")
+	}
+
+	// without a site country, local numbers can't be placed, so they stay as the guest wrote them
+	form = New(url.Values{"phone": {"010-1234-5678"}})
+	form.IsPhone("phone", "")
+	if form.Get("phone") != "010-1234-5678" || !form.Valid() {
+		t.Errorf("IsPhone without a country changed a local number to %q, errors %v", form.Get("phone"), form.Errors)
+	}
+}
+
+func TestForm_IntRange(t *testing.T) {
+	var tests = []struct {
+		value    string
+		valid    bool
+		expected int
+	}{
+		{"", true, 0},
+		{"1", true, 1},
+		{" 10 ", true, 10},
+		{"0", false, 0},
+		{"11", false, 11},
+		{"2.5", false, 0},
+		{"two", false, 0},
+	}
+
+	for _, e := range tests {
+		form := New(url.Values{"n": {e.value}})
+		form.IsInt("n")
+		form.IntRange("n", 1, 10)
+		if form.Valid() != e.valid {
+			t.Errorf("IntRange for %q is valid %v, wanted %v", e.value, form.Valid(), e.valid)
+		}
+		if len(form.Errors["n"]) > 1 {
+			t.Errorf("IntRange for %q gave more than one error: %v", e.value, form.Errors["n"])
+		}
+		if got := form.Int("n"); got != e.expected {
+			t.Errorf("Int for %q is %d, wanted %d", e.value, got, e.expected)
+		}
+	}
+}
+
+func TestForm_Dates(t *testing.T) {
+	now := time.Date(2050, 6, 15, 13, 30, 0, 0, time.UTC)
+	jan := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	dec := time.Date(2050, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		name           string
+		start          string
+		end            string
+		expectedErrors []string
+	}{
+		{"valid", "2050-06-15", "2050-06-20", nil},
+		{"blank", "", "", nil},
+		{"in-past", "2050-06-14", "2050-06-20", []string{"start"}},
+		{"reversed", "2050-06-20", "2050-06-20", []string{"end"}},
+		{"too-late", "2050-06-20", "2051-01-01", []string{"end"}},
+		{"not-a-date", "tomorrow", "2050-06-20", []string{"start"}},
+	}
+
+	for _, e := range tests {
+		form := New(url.Values{"start": {e.start}, "end": {e.end}})
+		form.IsDate("start")
+		form.NotInPast("start", now)
+		form.DateAfter("start", jan)
+		form.DateBefore("end", dec)
+		form.DateRange("start", "end")
+
+		if len(form.Errors) != len(e.expectedErrors) {
+			t.Errorf("date validators for %s gave errors %v, wanted them on %v", e.name, form.Errors, e.expectedErrors)
+		}
+		for _, field := range e.expectedErrors {
+			if len(form.Errors[field]) != 1 {
+				t.Errorf("date validators for %s gave errors %v on %s, wanted one", e.name, form.Errors[field], field)
+			}
+		}
+	}
+
+	form := New(url.Values{"start": {"2050-06-15"}, "end": {"x"}})
+	if got := form.Date("start"); !got.Equal(time.Date(2050, 6, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Date returned %v", got)
+	}
+	if got := form.Date("end"); !got.IsZero() {
+		t.Errorf("Date for an invalid date returned %v, wanted the zero time", got)
+	}
+}
+
+func TestForm_MatchesField(t *testing.T) {
+	form := New(url.Values{"password": {"secret"}, "confirm": {"secret"}})
+	form.MatchesField("confirm", "password")
+	if !form.Valid() {
+		t.Error("MatchesField gave an error for matching fields")
+	}
+
+	form = New(url.Values{"password": {"secret"}, "confirm": {"Secret"}})
+	form.MatchesField("confirm", "password")
+	if form.Errors.Get("confirm") == "" {
+		t.Error("MatchesField gave no error for different fields")
+	}
+}
+
+func TestForm_OneOf(t *testing.T) {
+	var tests = []struct {
+		value string
+		valid bool
+	}{
+		{"", true},
+		{"percent", true},
+		{"fixed", true},
+		{"Percent", false},
+		{"free", false},
+	}
+
+	for _, e := range tests {
+		form := New(url.Values{"type": {e.value}})
+		form.OneOf("type", "percent", "fixed")
+		if form.Valid() != e.valid {
+			t.Errorf("OneOf for %q is valid %v, wanted %v", e.value, form.Valid(), e.valid)
+		}
+	}
+}
+
+func TestForm_MatchesPattern(t *testing.T) {
+	re := regexp.MustCompile(`^[A-Z0-9]+$`)
+	var tests = []struct {
+		value string
+		valid bool
+	}{
+		{"", true},
+		{"SUMMER50", true},
+		{"summer50", false},
+		{"SUMMER 50", false},
+	}
+
+	for _, e := range tests {
+		form := New(url.Values{"code": {e.value}})
+		form.MatchesPattern("code", re)
+		if form.Valid() != e.valid {
+			t.Errorf("MatchesPattern for %q is valid %v, wanted %v", e.value, form.Valid(), e.valid)
+		}
+	}
+}
+
+func TestForm_Getters(t *testing.T) {
+	form := New(url.Values{"name": {"  John "}, "on": {"1"}, "off": {"0"}, "checked": {"on"}})
+
+	if got := form.Trimmed("name"); got != "John" {
+		t.Errorf("Trimmed returned %q, wanted %q", got, "John")
+	}
+	for field, expected := range map[string]bool{"on": true, "off": false, "checked": true, "missing": false} {
+		if got := form.Bool(field); got != expected {
+			t.Errorf("Bool for %s returned %v, wanted %v", field, got, expected)
+		}
+	}
+}
+
+type booking struct {
+	Name    string    `form:"name" validate:"required,min=3,max=20"`
+	Email   string    `form:"email" validate:"email"`
+	Phone   string    `form:"phone" validate:"phone"`
+	Start   time.Time `form:"start" validate:"required"`
+	End     time.Time `form:"end" validate:"required,after=start"`
+	Guests  int       `form:"guests" validate:"min=1,max=4"`
+	Type    string    `form:"type" validate:"oneof=room|suite"`
+	Pets    bool      `form:"pets"`
+	RoomIDs []int     `form:"room_ids"`
+	Notes   string
+}
+
+func TestBinder_BindValues(t *testing.T) {
+	var tests = []struct {
+		name           string
+		posted         url.Values
+		expectedErrors []string
+	}{
+		{"valid", url.Values{"name": {" John "}, "start": {"2050-01-01"}, "end": {"2050-01-03"}, "guests": {"2"}, "type": {"suite"}}, nil},
+		{"missing-required", url.Values{"guests": {"2"}}, []string{"name", "start", "end"}},
+		{"too-short", url.Values{"name": {"Jo"}, "start": {"2050-01-01"}, "end": {"2050-01-03"}}, []string{"name"}},
+		{"bad-email-and-phone", url.Values{"name": {"John"}, "email": {"john"}, "phone": {"call me"}, "start": {"2050-01-01"}, "end": {"2050-01-03"}}, []string{"email", "phone"}},
+		{"end-before-start", url.Values{"name": {"John"}, "start": {"2050-01-03"}, "end": {"2050-01-01"}}, []string{"end"}},
+		{"bad-date", url.Values{"name": {"John"}, "start": {"tomorrow"}, "end": {"2050-01-03"}}, []string{"start"}},
+		{"out-of-range", url.Values{"name": {"John"}, "start": {"2050-01-01"}, "end": {"2050-01-03"}, "guests": {"5"}}, []string{"guests"}},
+		{"not-a-number", url.Values{"name": {"John"}, "start": {"2050-01-01"}, "end": {"2050-01-03"}, "guests": {"two"}, "room_ids": {"1", "x"}}, []string{"guests", "room_ids"}},
+		{"bad-choice", url.Values{"name": {"John"}, "start": {"2050-01-01"}, "end": {"2050-01-03"}, "type": {"villa"}}, []string{"type"}},
+	}
+
+	for _, e := range tests {
+		var b booking
+		form := Binder{PhoneCountry: "1"}.BindValues(e.posted, &b)
+		if len(form.Errors) != len(e.expectedErrors) {
+			t.Errorf("BindValues for %s gave errors %v, wanted them on %v", e.name, form.Errors, e.expectedErrors)
+		}
+		for _, field := range e.expectedErrors {
+			if form.Errors.Get(field) == "" {
+				t.Errorf("BindValues for %s gave no error on %s", e.name, field)
+			}
+		}
+	}
+}
+
+func TestBinder_BindValuesDecodes(t *testing.T) {
+	b := booking{Email: "old@here.com", Notes: "kept"}
+	posted := url.Values{
+		"name":     {" John "},
+		"phone":    {"(555) 123-4567"},
+		"start":    {"2050-01-01"},
+		"end":      {"2050-01-03"},
+		"guests":   {"2"},
+		"pets":     {"on"},
+		"room_ids": {"1", "3"},
+		"Notes":    {"ignored"},
+	}
+	form := Binder{PhoneCountry: "1"}.BindValues(posted, &b)
+	if !form.Valid() {
+		t.Fatalf("BindValues gave errors %v", form.Errors)
+	}
+
+	expected := booking{
+		Name:    "John",
+		Email:   "old@here.com",
+		Phone:   "+15551234567",
+		Start:   time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:     time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		Guests:  2,
+		Pets:    true,
+		RoomIDs: []int{1, 3},
+		Notes:   "kept",
+	}
+	if !reflect.DeepEqual(b, expected) {
+		t.Errorf("BindValues decoded %+v, wanted %+v", b, expected)
+	}
+}
+
+func TestBinder_Bind(t *testing.T) {
+	body := `{"name": "John", "start": "2050-01-01", "end": "2050-01-03", "guests": 2, "pets": true, "room_ids": [1, 3]}`
+	r := httptest.NewRequest("POST", "/whatever", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	var b booking
+	form, err := Binder{}.Bind(r, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !form.Valid() {
+		t.Errorf("Bind of JSON gave errors %v", form.Errors)
+	}
+	if b.Name != "John" || b.Guests != 2 || !b.Pets || !reflect.DeepEqual(b.RoomIDs, []int{1, 3}) {
+		t.Errorf("Bind of JSON decoded %+v", b)
+	}
+
+	r = httptest.NewRequest("POST", "/whatever", strings.NewReader(`{"name": {"first": "John"}}`))
+	r.Header.Set("Content-Type", "application/json")
+	if _, err := (Binder{}).Bind(r, &b); err == nil {
+		t.Error("Bind of a nested JSON object gave no error")
+	}
+
+	r = httptest.NewRequest("POST", "/whatever", strings.NewReader("name=Jo&start=2050-01-01&end=2050-01-03"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	form, err = Binder{}.Bind(r, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.Errors.Get("name") == "" || form.Get("name") != "Jo" {
+		t.Errorf("Bind of a posted form gave errors %v and values %v", form.Errors, form.Values)
+	}
+
+	r = httptest.NewRequest("GET", "/whatever?name=Jane&start=2050-01-01&end=2050-01-03", nil)
+	form, err = Binder{}.Bind(r, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !form.Valid() || b.Name != "Jane" {
+		t.Errorf("Bind of a query string gave errors %v and decoded %+v", form.Errors, b)
+	}
+}
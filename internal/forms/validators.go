@@ -0,0 +1,159 @@
+package forms
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tsawler/bookings-app/internal/i18n"
+)
+
+// The validators in this file leave blank fields alone, so optional fields can be checked the
+// same way as required ones. Use Required for fields that must be filled in.
+
+// MaxLength checks for string maximum length, in characters
+func (f *Form) MaxLength(field string, length int) {
+	if utf8.RuneCountInString(f.Get(field)) > length {
+		f.AddError(field, "This field must be at most %d characters long", length)
+	}
+}
+
+// IsPhone checks for a phone number and rewrites it in E.164 form, see NormalizePhone
+func (f *Form) IsPhone(field, countryCode string) {
+	if f.blank(field) {
+		return
+	}
+	phone, ok := NormalizePhone(f.Get(field), countryCode)
+	if !ok {
+		f.AddError(field, "Invalid phone number")
+		return
+	}
+	f.Set(field, phone)
+}
+
+// IsInt checks for a whole number
+func (f *Form) IsInt(field string) {
+	f.int(field)
+}
+
+// IntRange checks for a whole number from min to max
+func (f *Form) IntRange(field string, min, max int) {
+	n, ok := f.int(field)
+	if ok && (n < min || n > max) {
+		f.AddError(field, "This field must be from %d to %d", min, max)
+	}
+}
+
+// IsDate checks for a date in DateLayout
+func (f *Form) IsDate(field string) {
+	f.date(field)
+}
+
+// DateAfter checks for a date later than t
+func (f *Form) DateAfter(field string, t time.Time) {
+	d, ok := f.date(field)
+	if ok && !d.After(t) {
+		f.AddError(field, "This date must be after %s", i18n.Date(f.Locale, t))
+	}
+}
+
+// DateBefore checks for a date earlier than t
+func (f *Form) DateBefore(field string, t time.Time) {
+	d, ok := f.date(field)
+	if ok && !d.Before(t) {
+		f.AddError(field, "This date must be before %s", i18n.Date(f.Locale, t))
+	}
+}
+
+// NotInPast checks for a date no earlier than the day of now
+func (f *Form) NotInPast(field string, now time.Time) {
+	d, ok := f.date(field)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if ok && d.Before(today) {
+		f.AddError(field, "This date is in the past")
+	}
+}
+
+// DateRange checks that the date in endField is later than the one in startField. The error goes
+// on endField.
+func (f *Form) DateRange(startField, endField string) {
+	start, okStart := f.date(startField)
+	end, okEnd := f.date(endField)
+	if okStart && okEnd && !end.After(start) {
+		f.AddError(endField, "This date must be after the start date")
+	}
+}
+
+// MatchesField checks that field holds the same value as other, such as a repeated password
+func (f *Form) MatchesField(field, other string) {
+	if f.Get(field) != f.Get(other) {
+		f.AddError(field, "The values do not match")
+	}
+}
+
+// OneOf checks that the field holds one of the allowed values
+func (f *Form) OneOf(field string, allowed ...string) {
+	if f.blank(field) {
+		return
+	}
+	v := f.Get(field)
+	for _, a := range allowed {
+		if v == a {
+			return
+		}
+	}
+	f.AddError(field, "Invalid choice")
+}
+
+// MatchesPattern checks that the field matches re
+func (f *Form) MatchesPattern(field string, re *regexp.Regexp) {
+	if !f.blank(field) && !re.MatchString(f.Get(field)) {
+		f.AddError(field, "This field is not in the expected format")
+	}
+}
+
+func (f *Form) blank(field string) bool {
+	return strings.TrimSpace(f.Get(field)) == ""
+}
+
+// int parses a field for the integer validators. ok is false if the field is blank or invalid,
+// in which case the error has been added, once.
+func (f *Form) int(field string) (int, bool) {
+	if f.blank(field) {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(f.Get(field)))
+	if err != nil {
+		f.addOnce(field, "This field must be a whole number")
+		return 0, false
+	}
+	return n, true
+}
+
+// date parses a field for the date validators. ok is false if the field is blank or invalid, in
+// which case the error has been added, once.
+func (f *Form) date(field string) (time.Time, bool) {
+	if f.blank(field) {
+		return time.Time{}, false
+	}
+	d, err := time.Parse(DateLayout, strings.TrimSpace(f.Get(field)))
+	if err != nil {
+		f.addOnce(field, "Invalid date")
+		return time.Time{}, false
+	}
+	return d, true
+}
+
+// addOnce adds an error for a field unless it already has that error, so several validators
+// parsing the same field report a bad value only once
+func (f *Form) addOnce(field, message string) {
+	message = i18n.T(f.Locale, message)
+	for _, e := range f.Errors[field] {
+		if e == message {
+			return
+		}
+	}
+	f.Errors.Add(field, message)
+}
@@ -0,0 +1,84 @@
+package forms
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateLayout is the layout dates are posted in, as sent by date inputs
+const DateLayout = "2006-01-02"
+
+// Int returns the field as an integer, or 0 if it is blank or not an integer. Check it with
+// IsInt or IntRange first.
+func (f *Form) Int(field string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(f.Get(field)))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// Date returns the field as a date, or the zero time if it is blank or not a date. Check it with
+// IsDate or the other date validators first.
+func (f *Form) Date(field string) time.Time {
+	d, err := time.Parse(DateLayout, strings.TrimSpace(f.Get(field)))
+	if err != nil {
+		return time.Time{}
+	}
+	return d
+}
+
+// Bool returns whether a checkbox was ticked
+func (f *Form) Bool(field string) bool {
+	switch strings.ToLower(strings.TrimSpace(f.Get(field))) {
+	case "", "0", "false", "off", "no":
+		return false
+	}
+	return true
+}
+
+// Trimmed returns the field without surrounding whitespace
+func (f *Form) Trimmed(field string) string {
+	return strings.TrimSpace(f.Get(field))
+}
+
+// NormalizePhone returns a phone number in E.164 form, such as +15551234567. Numbers written
+// without a country code, with or without a leading trunk 0, get countryCode. Without one they
+// can't be told apart from numbers abroad, so they are kept as typed. ok is false if the result
+// is not a plausible phone number.
+func NormalizePhone(phone, countryCode string) (normalized string, ok bool) {
+	phone = strings.TrimSpace(phone)
+
+	var digits strings.Builder
+	for i, r := range phone {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", false
+		}
+	}
+
+	d := digits.String()
+	switch {
+	case strings.HasPrefix(phone, "+"):
+	case strings.HasPrefix(d, "00"):
+		d = d[2:]
+	case countryCode != "":
+		d = countryCode + strings.TrimPrefix(d, "0")
+	default:
+		if len(d) < 7 || len(d) > 15 {
+			return "", false
+		}
+		return phone, true
+	}
+
+	// E.164 numbers have at most 15 digits, and no country code starts with 0
+	if len(d) < 8 || len(d) > 15 || d[0] == '0' {
+		return "", false
+	}
+	return "+" + d, true
+}
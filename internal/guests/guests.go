@@ -0,0 +1,48 @@
+// Package guests holds the rules for telling that two bookings were made by the same guest
+package guests
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// minPhoneDigits is how many digits a phone number needs before it is used to match guests, so
+// that placeholders such as "0" or "n/a" don't tie strangers together
+const minPhoneDigits = 7
+
+// NormalizeEmail returns the form of an email address guests are matched on
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizePhone returns the form of a phone number guests are matched on: its digits, or nothing
+// if it has too few of them to tell guests apart
+func NormalizePhone(phone string) string {
+	var b strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() < minPhoneDigits {
+		return ""
+	}
+	return b.String()
+}
+
+// ParseTags splits a comma separated list of tags, dropping blanks and repeats and sorting the rest
+func ParseTags(s string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		t = strings.ToLower(strings.Join(strings.FieldsFunc(t, unicode.IsSpace), " "))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	return tags
+}
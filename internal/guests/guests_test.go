@@ -0,0 +1,60 @@
+package guests
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	var tests = []struct {
+		email    string
+		expected string
+	}{
+		{"john@smith.com", "john@smith.com"},
+		{"  John@Smith.COM ", "john@smith.com"},
+		{"", ""},
+	}
+
+	for _, e := range tests {
+		if got := NormalizeEmail(e.email); got != e.expected {
+			t.Errorf("NormalizeEmail(%q) is %q, wanted %q", e.email, got, e.expected)
+		}
+	}
+}
+
+func TestNormalizePhone(t *testing.T) {
+	var tests = []struct {
+		phone    string
+		expected string
+	}{
+		{"555-123-4567", "5551234567"},
+		{"(555) 123 4567", "5551234567"},
+		{"+1 555.123.4567", "15551234567"},
+		{"0", ""},
+		{"n/a", ""},
+		{"", ""},
+	}
+
+	for _, e := range tests {
+		if got := NormalizePhone(e.phone); got != e.expected {
+			t.Errorf("NormalizePhone(%q) is %q, wanted %q", e.phone, got, e.expected)
+		}
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	var tests = []struct {
+		tags     string
+		expected []string
+	}{
+		{"", nil},
+		{"VIP", []string{"vip"}},
+		{"vip, allergies ,, VIP,  late   arrival", []string{"allergies", "late arrival", "vip"}},
+	}
+
+	for _, e := range tests {
+		if got := ParseTags(e.tags); !reflect.DeepEqual(got, e.expected) {
+			t.Errorf("ParseTags(%q) is %q, wanted %q", e.tags, got, e.expected)
+		}
+	}
+}
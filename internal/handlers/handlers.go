@@ -1,29 +1,57 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-chi/chi"
 
+	"github.com/tsawler/bookings-app/internal/audit"
+	"github.com/tsawler/bookings-app/internal/cancellations"
 	"github.com/tsawler/bookings-app/internal/config"
+	"github.com/tsawler/bookings-app/internal/customfields"
 	"github.com/tsawler/bookings-app/internal/driver"
+	"github.com/tsawler/bookings-app/internal/export"
 	"github.com/tsawler/bookings-app/internal/forms"
+	"github.com/tsawler/bookings-app/internal/guests"
 	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/i18n"
+	"github.com/tsawler/bookings-app/internal/importer"
+	"github.com/tsawler/bookings-app/internal/invoices"
 	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/money"
+	"github.com/tsawler/bookings-app/internal/payments"
 	"github.com/tsawler/bookings-app/internal/render"
+	"github.com/tsawler/bookings-app/internal/reports"
 	"github.com/tsawler/bookings-app/internal/repository"
 	"github.com/tsawler/bookings-app/internal/repository/dbrepo"
+	"github.com/tsawler/bookings-app/internal/taxes"
 )
 
 // Repo the repository used by the handlers
 var Repo *Repository
 
+// roomHoldDuration is how long a chosen room stays reserved while the guest fills in the form
+const roomHoldDuration = 10 * time.Minute
+
+// waitlistOfferDuration is how long a booking link emailed to a waitlisted guest stays valid
+const waitlistOfferDuration = 24 * time.Hour
+
+// TrashRetention is how long a deleted reservation can still be restored before it is purged
+const TrashRetention = 30 * 24 * time.Hour
+
 // Repository is the repository type
 type Repository struct {
 	App *config.AppConfig
@@ -51,6 +79,93 @@ func NewHandlers(r *Repository) {
 	Repo = r
 }
 
+// actingDB returns the database repository with the logged in user and their address as the
+// actor, so that changes made through it end up in the audit log
+func (m *Repository) actingDB(r *http.Request) repository.DatabaseRepo {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return m.DB.WithActor(models.Actor{
+		UserID: m.App.Session.GetInt(r.Context(), "user_id"),
+		IP:     ip,
+	})
+}
+
+// propertiesKey is the context key of the properties the signed in user is limited to
+type propertiesKey struct{}
+
+// StaffProperties is middleware that looks up the properties the signed in user manages, which
+// the admin tool is then limited to. Users who manage none see every property, and signed out
+// users see none.
+func (m *Repository) StaffProperties(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := m.App.Session.GetInt(r.Context(), "user_id")
+		if userID == 0 {
+			helpers.ClientError(w, http.StatusForbidden)
+			return
+		}
+
+		u, err := m.DB.GetUserByID(userID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), propertiesKey{}, u.PropertyIDs)))
+	})
+}
+
+// staffProperties returns the properties the signed in user is limited to, or nil if they
+// see every property
+func staffProperties(r *http.Request) []int {
+	ids, _ := r.Context().Value(propertiesKey{}).([]int)
+	return ids
+}
+
+// scopedDB returns the database repository with its reads limited to the properties of the
+// signed in user
+func (m *Repository) scopedDB(r *http.Request) repository.DatabaseRepo {
+	return m.DB.WithProperties(staffProperties(r))
+}
+
+// AllProperties is middleware that keeps pages about every property, such as guests and the
+// settings of the site, to users who see every property
+func (m *Repository) AllProperties(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(staffProperties(r)) > 0 {
+			helpers.ClientError(w, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ReservationAccess is middleware that lets a user at the reservation in the id url parameter
+// only if its room is in one of their properties
+func (m *Repository) ReservationAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(staffProperties(r)) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		_, err = m.scopedDB(r).GetReservationByID(id)
+		if err == sql.ErrNoRows {
+			helpers.ClientError(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // Home is the handler for the home page
 func (m *Repository) Home(w http.ResponseWriter, r *http.Request) {
 	m.DB.AllUser()
@@ -77,8 +192,31 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
+	property, err := m.DB.GetPropertyByID(room.PropertyID)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't find property")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
 
 	res.Room.RoomName = room.RoomName
+	res.Room.PropertyID = room.PropertyID
+	res.NightlyRate = room.Price
+	if res.Guests < 1 {
+		res.Guests = 1
+	}
+	err = m.quoteCharges(&res)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't get taxes and fees")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	err = m.bookingPolicy(&res, room, property)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't get cancellation policy")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
 
 	m.App.Session.Put(r.Context(), "reservation", res)
 	sd := res.StartDate.Format("2006-01-02")
@@ -87,107 +225,288 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 	stringMap["start_date"] = sd
 	stringMap["end_date"] = ed
 
+	if hold, ok := m.App.Session.Get(r.Context(), "hold").(models.RoomRestriction); ok {
+		stringMap["hold_expires_at"] = hold.ExpiresAt.Format(time.RFC3339)
+	}
+
+	fields, err := m.DB.AllCustomFields()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't get booking form fields")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
 	data := make(map[string]interface{})
 	data["reservation"] = res
+	data["property"] = property
+	data["custom_fields"] = customfields.Active(fields)
 	render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
-		Form:      forms.New(nil),
-		Data:      data,
-		StringMap: stringMap,
+		Form:           forms.New(nil),
+		Data:           data,
+		StringMap:      stringMap,
+		ChargeCurrency: property.Currency,
 	})
 }
 
+// binder returns the form binder, set up for the phone numbers of the site and the language of
+// the request
+func (m *Repository) binder(r *http.Request) forms.Binder {
+	return forms.Binder{PhoneCountry: m.App.PhoneCountry, Locale: i18n.FromContext(r.Context())}
+}
+
+// quoteCharges works out the taxes and fees on res from the current rules. It is done whenever
+// a stay is priced, and the charges are then kept with the reservation.
+func (m *Repository) quoteCharges(res *models.Reservation) error {
+	rules, err := m.DB.AllTaxRules()
+	if err != nil {
+		return err
+	}
+	res.Charges = taxes.Quote(*res, rules)
+	return nil
+}
+
+// bookingPolicy gives res the cancellation policy of room, or of the room's property if it has
+// none of its own, which the stay is then booked under
+func (m *Repository) bookingPolicy(res *models.Reservation, room models.Room, property models.Property) error {
+	res.CancellationPolicy = models.CancellationPolicy{}
+	policyID := room.CancellationPolicyID
+	if policyID == 0 {
+		policyID = property.CancellationPolicyID
+	}
+	if policyID == 0 {
+		return nil
+	}
+	policy, err := m.DB.GetCancellationPolicyByID(policyID)
+	if err != nil {
+		return err
+	}
+	policy.RoomIDs = nil
+	res.CancellationPolicy = policy
+	return nil
+}
+
+// findProperty returns the property with the id, for the parts of a guest's pages and emails
+// that depend on it. A property that can't be read is logged and left out rather than stopping
+// the guest, who then sees the site's defaults.
+func (m *Repository) findProperty(id int) models.Property {
+	p, err := m.DB.GetPropertyByID(id)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		return models.Property{}
+	}
+	return p
+}
+
+// currencyOf returns the currency of the property a reservation is at, which its prices are in
+// and its guest is charged in
+func (m *Repository) currencyOf(res models.Reservation) string {
+	if currency := m.findProperty(res.Room.PropertyID).Currency; currency != "" {
+		return currency
+	}
+	return m.App.Currency
+}
+
+// propertyNow returns the time now where a property is, so that days before arrival are counted
+// the way the house counts them
+func (m *Repository) propertyNow(propertyID int) time.Time {
+	return time.Now().In(m.findProperty(propertyID).Location())
+}
+
 // PostReservation handles the posting of a reservation form
 func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	reservation := models.Reservation{Guests: 1}
+	form, err := m.binder(r).Bind(r, &reservation)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't parse form!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	sd := r.Form.Get("start_date")
-	ed := r.Form.Get("end_date")
-
-	layout := "2006-01-02"
+	sd := form.Get("start_date")
+	ed := form.Get("end_date")
+	startDate := reservation.StartDate
+	endDate := reservation.EndDate
+	roomID := reservation.RoomID
 
-	startDate, err := time.Parse(layout, sd)
-	if err != nil {
+	if startDate.IsZero() {
 		m.App.Session.Put(r.Context(), "error", "can't parse start date!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	endDate, err := time.Parse(layout, ed)
-	if err != nil {
+	if endDate.IsZero() {
 		m.App.Session.Put(r.Context(), "error", "can't parse end date!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	roomID, err := strconv.Atoi(r.Form.Get("room_id"))
-	if err != nil {
+	if roomID == 0 {
 		m.App.Session.Put(r.Context(), "error", "invalid data!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	reservation := models.Reservation{
-		FirstName: r.Form.Get("first_name"),
-		LastName:  r.Form.Get("last_name"),
-		Phone:     r.Form.Get("phone"),
-		Email:     r.Form.Get("email"),
-		StartDate: startDate,
-		EndDate:   endDate,
-		RoomID:    roomID,
+	room, err := m.DB.GetRoomByID(roomID)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't find room")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	property, err := m.DB.GetPropertyByID(room.PropertyID)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't find property")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
 	}
 
-	form := forms.New(r.PostForm)
-	form.Required("first_name", "last_name", "email")
-	form.MinLength("first_name", 3)
-	form.IsEmail("email")
+	// guests choose neither the price nor where the booking came from
+	reservation.Room = room
+	reservation.NightlyRate = room.Price
+	reservation.Source = models.SourceWeb
+	reservation.Locale = form.Locale
+
+	fields, err := m.DB.AllCustomFields()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't get booking form fields")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	fields = customfields.Active(fields)
+	reservation.CustomFields = customfields.Validate(form, fields)
+
+	var promo models.PromoCode
+	if code := strings.TrimSpace(r.Form.Get("promo_code")); code != "" {
+		promo, err = m.DB.GetPromoCodeByCode(code)
+		if err == sql.ErrNoRows {
+			form.Errors.Add("promo_code", i18n.T(reservation.Locale, "This promo code is not valid"))
+		} else if err != nil {
+			m.App.Session.Put(r.Context(), "error", "can't get promo code from database")
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		} else {
+			uses, emailUses, err := m.DB.PromoCodeUsage(promo.ID, reservation.Email)
+			if err != nil {
+				m.App.Session.Put(r.Context(), "error", "can't get promo code usage from database")
+				http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+				return
+			}
+			if msg := checkPromoCode(promo, reservation, uses, emailUses); msg != "" {
+				form.Errors.Add("promo_code", msg)
+			} else {
+				reservation.Discount = promo.Discount(reservation.Subtotal())
+				reservation.PromoCodeID = promo.ID
+			}
+		}
+	}
+
+	err = m.quoteCharges(&reservation)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't get taxes and fees")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	err = m.bookingPolicy(&reservation, room, property)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't get cancellation policy")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
 
 	if !form.Valid() {
 		data := make(map[string]interface{})
 		data["reservation"] = reservation
+		data["property"] = property
+		data["custom_fields"] = fields
+		stringMap := make(map[string]string)
+		stringMap["start_date"] = sd
+		stringMap["end_date"] = ed
 		http.Error(w, "my own error message", http.StatusSeeOther)
 		render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
-			Form: form,
-			Data: data,
+			Form:           form,
+			Data:           data,
+			StringMap:      stringMap,
+			ChargeCurrency: property.Currency,
 		})
 		return
 	}
 
-	newReservationID, err := m.DB.InsertReservation(reservation)
+	reservation.AccessToken, err = helpers.NewToken()
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't insert reservation into database")
+		m.App.Session.Put(r.Context(), "error", "can't create reservation")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	restrictions := models.RoomRestriction{
-		StartDate:     startDate,
-		EndDate:       endDate,
-		RoomID:        roomID,
-		ReservationID: newReservationID,
-		RestrictionID: 1,
+	hold, ok := m.App.Session.Get(r.Context(), "hold").(models.RoomRestriction)
+	if !ok || hold.RoomID != roomID || !hold.StartDate.Equal(startDate) || !hold.EndDate.Equal(endDate) {
+		// the guest isn't holding this room, such as when an old form is posted again, so hold it
+		// now, which only succeeds if nobody else has the dates. Holding forgets the waitlist
+		// entry the guest came from, so it is kept to be marked booked.
+		entryID := m.App.Session.GetInt(r.Context(), "waitlist_entry")
+		err = m.holdRoom(r, reservation)
+		if entryID > 0 {
+			m.App.Session.Put(r.Context(), "waitlist_entry", entryID)
+		}
+		if err == repository.ErrRoomUnavailable {
+			m.App.Session.Put(r.Context(), "error", "Sorry, that room was just taken for these dates")
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		} else if err != nil {
+			m.App.Session.Put(r.Context(), "error", "can't hold room")
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		}
+		hold, _ = m.App.Session.Get(r.Context(), "hold").(models.RoomRestriction)
 	}
 
-	err = m.DB.InsertRoomRestrictions(restrictions)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't insert room restrictions into database")
+	// turn the hold into the reservation
+	reservation.ID, err = m.DB.ConvertHoldToReservation(hold.ID, reservation)
+	if err == repository.ErrHoldExpired {
+		m.App.Session.Remove(r.Context(), "hold")
+		m.App.Session.Put(r.Context(), "error", "Your hold on this room has expired, please search again")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	} else if err == repository.ErrPromoCodeUsedUp {
+		// others took the last uses of the code while the guest was booking, so they are shown
+		// the form again, still holding the room, to book without it
+		reservation.Discount = 0
+		reservation.PromoCodeID = 0
+		m.App.Session.Put(r.Context(), "reservation", reservation)
+		m.App.Session.Put(r.Context(), "error", "This promo code has been fully redeemed")
+		http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't insert reservation into database")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
+	m.App.Session.Remove(r.Context(), "hold")
+
+	if entryID := m.App.Session.PopInt(r.Context(), "waitlist_entry"); entryID > 0 {
+		err = m.DB.MarkWaitlistEntryBooked(entryID)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+	}
+
+	err = m.chargeDeposit(reservation)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "warning", "Your room is booked, but we couldn't take the deposit. We'll be in touch")
+	}
 
 	// send notifications - first to guest
+	m.sendConfirmation(reservation)
+
+	// send notifications to the property the room is in
 	htmlMessage := fmt.Sprintf(`
 		<strong>Reservation Confirmation</strong><br>
-		Dear %s:, <br>
-		This is confirm your reservation from %s to %s.
-`, reservation.FirstName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
+		Dear owner:, <br>
+		reservation for %s at %s is confirmed from %s to %s.
+`, room.RoomName, property.Name, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
 
 	msg := models.MailData{
-		To:      reservation.Email,
+		To:      property.Email,
 		From:    "me@here.com",
 		Subject: "Reservation Confirmation",
 		Content: htmlMessage,
@@ -196,25 +515,55 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 
 	m.App.MailChan <- msg
 
-	// send notifications to owner
-	htmlMessage = fmt.Sprintf(`
-		<strong>Reservation Confirmation</strong><br>
-		Dear owner:, <br>
-		reservation for room %d is confirmed from %s to %s.
-`, reservation.RoomID, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
+	m.App.Session.Put(r.Context(), "reservation", reservation)
+	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+}
+
+// sendConfirmation emails the guest the confirmation of their reservation, in their language
+func (m *Repository) sendConfirmation(reservation models.Reservation) {
+	locale := reservation.Locale
+	htmlMessage := fmt.Sprintf(`
+		<strong>%s</strong><br>
+		%s<br>
+		%s<br>
+		%s<br>
+		<a href="%s/reservation/%s/invoice">%s</a>
+`, i18n.T(locale, "Reservation Confirmation"),
+		i18n.T(locale, "Dear %s,", reservation.FirstName),
+		i18n.T(locale, "This is to confirm your reservation from %s to %s.",
+			i18n.Date(locale, reservation.StartDate), i18n.Date(locale, reservation.EndDate)),
+		i18n.T(locale, "Total: %s", money.New(reservation.Total(), m.currencyOf(reservation)).Format(locale)),
+		m.App.SiteURL, reservation.AccessToken, i18n.T(locale, "View your invoice"))
+
+	if lines := policyLines(locale, reservation.CancellationPolicy); lines != nil {
+		htmlMessage += fmt.Sprintf(`
+		<p>%s<br>
+		<a href="%s/reservation/%s/cancel">%s</a></p>
+`, strings.Join(lines, "<br>\n\t\t"), m.App.SiteURL, reservation.AccessToken, i18n.T(locale, "Cancel your reservation"))
+	}
 
-	msg = models.MailData{
-		To:      "owner@email.com",
+	msg := models.MailData{
+		To:      reservation.Email,
 		From:    "me@here.com",
-		Subject: "Reservation Confirmation",
+		Subject: i18n.T(locale, "Reservation Confirmation"),
 		Content: htmlMessage,
 		Template: "basic.html",
 	}
 
 	m.App.MailChan <- msg
+}
 
-	m.App.Session.Put(r.Context(), "reservation", reservation)
-	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+// policyLines describes a cancellation policy to a guest, its name and then a line per refund
+// tier. It returns nil if there is no policy.
+func policyLines(locale string, p models.CancellationPolicy) []string {
+	if len(p.Tiers) == 0 {
+		return nil
+	}
+	lines := []string{"<strong>" + i18n.T(locale, "Cancellation policy: %s", i18n.T(locale, p.Name)) + "</strong>"}
+	for _, t := range p.Tiers {
+		lines = append(lines, i18n.T(locale, "Cancel %d or more days before arrival: %d%% refunded", t.DaysBefore, t.Percent))
+	}
+	return append(lines, i18n.T(locale, "Cancellations after that aren't refunded."))
 }
 
 // Generals renders the room page
@@ -229,7 +578,17 @@ func (m *Repository) Majors(w http.ResponseWriter, r *http.Request) {
 
 // Availability renders the search availability page
 func (m *Repository) Availability(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "search-availability.page.tmpl", &models.TemplateData{})
+	properties, err := m.DB.AllProperties()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["properties"] = properties
+	render.Template(w, r, "search-availability.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
 }
 
 // PostAvailability renders the search availability page
@@ -240,23 +599,32 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
-	start := r.Form.Get("start")
-	end := r.Form.Get("end")
-	layout := "2006-01-02"
-	startDate, err := time.Parse(layout, start)
-	if err != nil {
+	form := forms.New(r.PostForm)
+	start := form.Get("start")
+	end := form.Get("end")
+	startDate := form.Date("start")
+	if startDate.IsZero() {
 		m.App.Session.Put(r.Context(), "error", "can't parse start in form data")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
-	endDate, err := time.Parse(layout, end)
-	if err != nil {
+	endDate := form.Date("end")
+	if endDate.IsZero() {
 		m.App.Session.Put(r.Context(), "error", "can't parse end in form data")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	rooms, err := m.DB.SearchAvailabilityForAllRoom(startDate, endDate)
+	form.DateRange("start", "end")
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "Departure must be after arrival")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	// guests search one property, or every property if they don't pick one
+	propertyID, _ := strconv.Atoi(form.Get("property_id"))
+	rooms, err := m.DB.SearchAvailabilityForAllRoom(startDate, endDate, propertyID)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't search availability for all room from database")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -264,12 +632,27 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if len(rooms) == 0 {
-		m.App.Session.Put(r.Context(), "error", "No availability")
-		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		m.App.Session.Put(r.Context(), "warning", "No availability, but you can join the waitlist")
+		http.Redirect(w, r, fmt.Sprintf("/waitlist?s=%s&e=%s", start, end), http.StatusSeeOther)
+		return
+	}
+	properties, err := m.DB.AllProperties()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't get properties from database")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
+	// rooms are only told apart by their property when there is more than one
+	propertyNames := make(map[int]string)
+	if len(properties) > 1 {
+		for _, p := range properties {
+			propertyNames[p.ID] = p.Name
+		}
+	}
+
 	data := make(map[string]interface{})
 	data["rooms"] = rooms
+	data["property_names"] = propertyNames
 
 	res := models.Reservation{
 		StartDate: startDate,
@@ -284,44 +667,49 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 }
 
 type jsonResponse struct {
-	OK        bool   `json:"ok"`
-	Message   string `json:"message"`
-	RoomID    string `json:"room_id"`
-	StartDate string `json:"start_date"`
-	EndDate   string `json:"end_date"`
+	OK        bool                `json:"ok"`
+	Message   string              `json:"message"`
+	RoomID    string              `json:"room_id"`
+	StartDate string              `json:"start_date"`
+	EndDate   string              `json:"end_date"`
+	Errors    map[string][]string `json:"errors,omitempty"`
+}
+
+// availabilityRequest is what AvailabilityJSON is asked, as a posted form or as JSON
+type availabilityRequest struct {
+	StartDate time.Time `form:"start" validate:"required"`
+	EndDate   time.Time `form:"end" validate:"required,after=start"`
+	RoomID    int       `form:"room_id"`
 }
 
 func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req availabilityRequest
+	form, err := m.binder(r).Bind(r, &req)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't parse form!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	sd := r.Form.Get("start")
-	ed := r.Form.Get("end")
-
-	layout := "2006-01-02"
-
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
-
-	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
-
-	available, _ := m.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, roomID)
-
 	resp := jsonResponse{
-		OK:        available,
-		Message:   "",
-		StartDate: sd,
-		EndDate:   ed,
-		RoomID:    strconv.Itoa(roomID),
+		StartDate: form.Get("start"),
+		EndDate:   form.Get("end"),
+		RoomID:    strconv.Itoa(req.RoomID),
+	}
+
+	status := http.StatusOK
+	if form.Valid() {
+		resp.OK, _ = m.DB.SearchAvailabilityByDatesByRoomID(req.StartDate, req.EndDate, req.RoomID)
+	} else {
+		status = http.StatusBadRequest
+		resp.Message = "Invalid dates"
+		resp.Errors = form.Errors
 	}
 
 	out, _ := json.MarshalIndent(resp, "", "     ")
 	log.Println(string(out))
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	w.Write(out)
 }
 
@@ -339,16 +727,19 @@ func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request)
 	}
 
 	m.App.Session.Remove(r.Context(), "reservation")
+	property := m.findProperty(reservation.Room.PropertyID)
 	data := make(map[string]interface{})
 	data["reservation"] = reservation
+	data["property"] = property
 	sd := reservation.StartDate.Format("2006-01-02")
 	ed := reservation.EndDate.Format("2006-01-02")
 	stringMap := make(map[string]string)
 	stringMap["start_date"] = sd
 	stringMap["end_date"] = ed
 	render.Template(w, r, "reservation-summary.page.tmpl", &models.TemplateData{
-		Data:      data,
-		StringMap: stringMap,
+		Data:           data,
+		StringMap:      stringMap,
+		ChargeCurrency: property.Currency,
 	})
 }
 
@@ -367,18 +758,65 @@ func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	res.RoomID = roomID
+
+	err = m.holdRoom(r, res)
+	if err == repository.ErrRoomUnavailable {
+		m.App.Session.Put(r.Context(), "error", "Sorry, that room was just taken for these dates")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't hold room")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
 	m.App.Session.Put(r.Context(), "reservation", res)
 	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
 }
 
+// holdRoom releases any hold the guest already has and places a new one for res
+func (m *Repository) holdRoom(r *http.Request, res models.Reservation) error {
+	// a new hold is for a room found some other way than a waitlist link
+	m.App.Session.Remove(r.Context(), "waitlist_entry")
+	if old, ok := m.App.Session.Get(r.Context(), "hold").(models.RoomRestriction); ok {
+		_ = m.DB.ReleaseRoomHold(old.ID)
+		m.App.Session.Remove(r.Context(), "hold")
+	}
+
+	hold := models.RoomRestriction{
+		StartDate:     res.StartDate,
+		EndDate:       res.EndDate,
+		RoomID:        res.RoomID,
+		RestrictionID: models.RestrictionHold,
+		ExpiresAt:     time.Now().Add(roomHoldDuration),
+	}
+
+	id, err := m.DB.InsertRoomHold(hold)
+	if err != nil {
+		return err
+	}
+	hold.ID = id
+
+	m.App.Session.Put(r.Context(), "hold", hold)
+	return nil
+}
+
 func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
-	roomID, _ := strconv.Atoi(r.URL.Query().Get("id"))
-	sd := r.URL.Query().Get("s")
-	ed := r.URL.Query().Get("e")
+	form := forms.New(r.URL.Query())
+	form.Required("id", "s", "e")
+	form.IsInt("id")
+	form.IsDate("s")
+	form.IsDate("e")
+	form.DateRange("s", "e")
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "Invalid room or dates, please search again")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
 
-	layout := "2006-01-02"
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
+	roomID := form.Int("id")
+	startDate := form.Date("s")
+	endDate := form.Date("e")
 
 	var res models.Reservation
 
@@ -392,6 +830,18 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	res.Room.RoomName = room.RoomName
+
+	err = m.holdRoom(r, res)
+	if err == repository.ErrRoomUnavailable {
+		m.App.Session.Put(r.Context(), "error", "Sorry, that room was just taken for these dates")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't hold room")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
 	m.App.Session.Put(r.Context(), "reservation", res)
 	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
 }
@@ -438,85 +888,332 @@ func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
 }
 
 func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
-	render.Template(w,r,"admin-dashboard.page.tmpl",&models.TemplateData{})
-}
-
-func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllReservations()
+	stats, err := m.dashboardStats(m.scopedDB(r), time.Now())
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
 	data := make(map[string]interface{})
-	data["reservations"] = reservations
-	render.Template(w,r,"admin-all-reservations.page.tmpl",&models.TemplateData{
+	data["stats"] = stats
+	render.Template(w, r, "admin-dashboard.page.tmpl", &models.TemplateData{
 		Data: data,
 	})
 }
 
-func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllNewReservations()
+// AdminDashboardJSON sends the figures on the dashboard, which the page polls to stay up to date
+func (m *Repository) AdminDashboardJSON(w http.ResponseWriter, r *http.Request) {
+	stats, err := m.dashboardStats(m.scopedDB(r), time.Now())
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	data := make(map[string]interface{})
-	data["reservations"] = reservations
-	render.Template(w,r,"admin-new-reservations.page.tmpl",&models.TemplateData{
-		Data: data,
-	})
-}
-
-// AdminShowReservation shows the reservation in the admin tool
-func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
-	exploded := strings.Split(r.RequestURI, "/")
-	id, err := strconv.Atoi(exploded[4])
+	out, err := json.Marshal(stats)
 	if err != nil {
-		helpers.ServerError(w,err)
+		helpers.ServerError(w, err)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(out)
+}
 
-	src := exploded[3]
-	stringMap := make(map[string]string)
-	stringMap["src"] = src
-
-	// get reservation from the database
-	res, err := m.DB.GetReservationByID(id)
-	if err != nil {
-		helpers.ServerError(w,err)
-		return
-	}
+// dashboardGuest is an arrival or departure on the dashboard
+type dashboardGuest struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Room   string `json:"room"`
+	Status string `json:"status"`
+}
 
-	data := make(map[string]interface{})
-	data["reservation"] = res
+// dashboardWeek is the reservations made in a week, for the bookings chart
+type dashboardWeek struct {
+	Week     string `json:"week"`
+	Bookings int    `json:"bookings"`
+	Revenue  int    `json:"revenue"`
+}
 
-	render.Template(w,r,"admin-reservations-show.page.tmpl",&models.TemplateData{
-		StringMap: stringMap,
-		Data: data,
-		Form: forms.New(nil),
-	})
+// dashboardLeadTime is a bar of the lead time chart
+type dashboardLeadTime struct {
+	Label    string `json:"label"`
+	Bookings int    `json:"bookings"`
+}
 
+// dashboardData holds the figures on the dashboard. Amounts are in cents.
+type dashboardData struct {
+	Date            string              `json:"date"`
+	Arrivals        []dashboardGuest    `json:"arrivals"`
+	Departures      []dashboardGuest    `json:"departures"`
+	Occupancy30     float64             `json:"occupancy_30"`
+	Occupancy90     float64             `json:"occupancy_90"`
+	NewReservations int                 `json:"new_reservations"`
+	Weeks           []dashboardWeek     `json:"weeks"`
+	LeadTimes       []dashboardLeadTime `json:"lead_times"`
 }
 
-func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+// dashboardWeeks is how many weeks back the bookings and lead time charts go
+const dashboardWeeks = 12
+
+// dashboardStats gathers the figures on the dashboard from db as they are on the day of now
+func (m *Repository) dashboardStats(db repository.DatabaseRepo, now time.Time) (dashboardData, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	stats := dashboardData{
+		Date:       today.Format("2006-01-02"),
+		Arrivals:   []dashboardGuest{},
+		Departures: []dashboardGuest{},
+		Weeks:      []dashboardWeek{},
+		LeadTimes:  []dashboardLeadTime{},
+	}
+
+	guest := func(res models.Reservation) dashboardGuest {
+		return dashboardGuest{
+			ID:     res.ID,
+			Name:   res.FirstName + " " + res.LastName,
+			Room:   res.Room.RoomName,
+			Status: res.Status.Label(),
+		}
+	}
+
+	arrivals, err := db.ArrivalsOn(today)
 	if err != nil {
-		helpers.ServerError(w,err)
-		return
+		return stats, err
+	}
+	for _, res := range arrivals {
+		stats.Arrivals = append(stats.Arrivals, guest(res))
 	}
 
-	exploded := strings.Split(r.RequestURI, "/")
-	id, err := strconv.Atoi(exploded[4])
+	departures, err := db.DeparturesOn(today)
 	if err != nil {
-		helpers.ServerError(w,err)
-		return
+		return stats, err
+	}
+	for _, res := range departures {
+		stats.Departures = append(stats.Departures, guest(res))
 	}
 
-	src := exploded[3]
-	stringMap := make(map[string]string)
+	occupancy, err := db.OccupancySummary(today, today.AddDate(0, 0, 30))
+	if err != nil {
+		return stats, err
+	}
+	stats.Occupancy30 = occupancy.Percent()
+
+	occupancy, err = db.OccupancySummary(today, today.AddDate(0, 0, 90))
+	if err != nil {
+		return stats, err
+	}
+	stats.Occupancy90 = occupancy.Percent()
+
+	_, stats.NewReservations, err = db.SearchReservations(models.ReservationFilter{Status: models.StatusPending, PerPage: 1})
+	if err != nil {
+		return stats, err
+	}
+
+	since := today.AddDate(0, 0, -7*dashboardWeeks)
+	weeks, err := db.BookingsByWeek(since)
+	if err != nil {
+		return stats, err
+	}
+	for _, v := range weeks {
+		stats.Weeks = append(stats.Weeks, dashboardWeek{
+			Week:     v.Start.Format("2006-01-02"),
+			Bookings: v.Bookings,
+			Revenue:  v.Revenue,
+		})
+	}
+
+	leadTimes, err := db.LeadTimeDistribution(since)
+	if err != nil {
+		return stats, err
+	}
+	for _, b := range leadTimes {
+		stats.LeadTimes = append(stats.LeadTimes, dashboardLeadTime{Label: b.Label, Bookings: b.Bookings})
+	}
+
+	return stats, nil
+}
+
+func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
+	filter, form := reservationFilter(r.URL.Query())
+	if filter.Status != "" && !filter.Status.Valid() {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	m.renderReservationList(w, r, "admin-all-reservations.page.tmpl", "all", filter, form)
+}
+
+func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
+	filter, form := reservationFilter(r.URL.Query())
+	filter.Status = models.StatusPending
+
+	m.renderReservationList(w, r, "admin-new-reservations.page.tmpl", "new", filter, form)
+}
+
+// reservationsPerPage is how many reservations the admin lists show at once
+const reservationsPerPage = 25
+
+// pageLink is a link in the pagination of a list
+type pageLink struct {
+	Number int
+	URL    string
+	Active bool
+}
+
+// sortLink is a column header of a list that sorts the list by the column
+type sortLink struct {
+	Title  string
+	URL    string
+	Active bool
+	Desc   bool
+}
+
+// reservationColumns are the titles of the columns of the admin reservation lists, by sort
+var reservationColumns = map[string]string{
+	"id":         "ID",
+	"last_name":  "Last name",
+	"room":       "Room",
+	"start_date": "Arrival",
+	"end_date":   "Departure",
+	"status":     "Status",
+	"source":     "Source",
+}
+
+// reservationFilter reads the search, sort and page of an admin reservation list from the query string
+func reservationFilter(q url.Values) (models.ReservationFilter, *forms.Form) {
+	form := forms.New(q)
+
+	filter := models.ReservationFilter{
+		Search:  strings.TrimSpace(q.Get("q")),
+		Status:  models.ReservationStatus(q.Get("status")),
+		Sort:    q.Get("sort"),
+		Desc:    q.Get("dir") == "desc",
+		Page:    1,
+		PerPage: reservationsPerPage,
+	}
+	if filter.Sort == "" {
+		filter.Sort = "start_date"
+	}
+	if v := q.Get("room_id"); v != "" {
+		filter.RoomID, _ = strconv.Atoi(v)
+	}
+	if v := q.Get("page"); v != "" {
+		if page, err := strconv.Atoi(v); err == nil && page > 0 {
+			filter.Page = page
+		}
+	}
+
+	form.IsDate("from")
+	form.IsDate("to")
+	filter.From = form.Date("from")
+	filter.To = form.Date("to")
+
+	return filter, form
+}
+
+// listURL returns path with the query string q, changing the given parameters
+func listURL(path string, q url.Values, set map[string]string) string {
+	v := url.Values{}
+	for key, values := range q {
+		v[key] = values
+	}
+	for key, value := range set {
+		v.Set(key, value)
+	}
+	return path + "?" + v.Encode()
+}
+
+// renderReservationList renders a page of an admin reservation list, with its sort and page links
+func (m *Repository) renderReservationList(w http.ResponseWriter, r *http.Request, tmpl, src string, filter models.ReservationFilter, form *forms.Form) {
+	var reservations []models.Reservation
+	var total int
+	if form.Valid() {
+		var err error
+		reservations, total, err = m.scopedDB(r).SearchReservations(filter)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	rooms, err := m.scopedDB(r).AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	path := "/admin/reservations-" + src
+	q := r.URL.Query()
+
+	// clicking the column the list is sorted by reverses it, any other column sorts ascending
+	var columns []sortLink
+	for _, col := range repository.ReservationSorts {
+		dir := "asc"
+		if col == filter.Sort && !filter.Desc {
+			dir = "desc"
+		}
+		columns = append(columns, sortLink{
+			Title:  reservationColumns[col],
+			URL:    listURL(path, q, map[string]string{"sort": col, "dir": dir, "page": "1"}),
+			Active: col == filter.Sort,
+			Desc:   filter.Desc,
+		})
+	}
+
+	lastPage := (total + reservationsPerPage - 1) / reservationsPerPage
+	var pages []pageLink
+	for p := filter.Page - 3; p <= filter.Page+3; p++ {
+		if p < 1 || p > lastPage {
+			continue
+		}
+		pages = append(pages, pageLink{
+			Number: p,
+			URL:    listURL(path, q, map[string]string{"page": strconv.Itoa(p)}),
+			Active: p == filter.Page,
+		})
+	}
+
+	stringMap := make(map[string]string)
 	stringMap["src"] = src
+	stringMap["sort"] = filter.Sort
+	if filter.Desc {
+		stringMap["dir"] = "desc"
+	}
+	if filter.Page > 1 {
+		stringMap["prev_url"] = listURL(path, q, map[string]string{"page": strconv.Itoa(filter.Page - 1)})
+	}
+	for _, format := range []string{export.CSV, export.XLSX} {
+		stringMap[format+"_url"] = listURL("/admin/reservations-export/"+src, q, map[string]string{"format": format})
+	}
+	if filter.Page < lastPage {
+		stringMap["next_url"] = listURL(path, q, map[string]string{"page": strconv.Itoa(filter.Page + 1)})
+	}
+
+	intMap := make(map[string]int)
+	intMap["total"] = total
+
+	data := make(map[string]interface{})
+	data["reservations"] = reservations
+	data["rooms"] = rooms
+	data["statuses"] = models.ReservationStatuses
+	data["columns"] = columns
+	data["pages"] = pages
+	render.Template(w, r, tmpl, &models.TemplateData{
+		StringMap: stringMap,
+		IntMap:    intMap,
+		Data:      data,
+		Form:      form,
+	})
+}
+
+// AdminShowReservation shows the reservation in the admin tool
+func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
+	exploded := strings.Split(r.RequestURI, "/")
+	id, err := strconv.Atoi(exploded[4])
+	if err != nil {
+		helpers.ServerError(w,err)
+		return
+	}
+
+	src := exploded[3]
 
 	// get reservation from the database
 	res, err := m.DB.GetReservationByID(id)
@@ -525,16 +1222,191 @@ func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	res.FirstName = r.Form.Get("first_name")
-	res.LastName = r.Form.Get("last_name")
-	res.Email = r.Form.Get("email")
-	res.Phone = r.Form.Get("phone")
+	m.renderAdminReservation(w, r, res, src, forms.New(nil))
+}
+
+// renderAdminReservation renders the admin reservation page for res, with everything else it shows
+func (m *Repository) renderAdminReservation(w http.ResponseWriter, r *http.Request, res models.Reservation, src string, form *forms.Form) {
+	id := res.ID
+	stringMap := make(map[string]string)
+	stringMap["src"] = src
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+
+	rooms, err := m.scopedDB(r).AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	data["rooms"] = rooms
+
+	redemption, err := m.DB.GetPromoRedemptionByReservationID(id)
+	if err == nil {
+		data["redemption"] = redemption
+	} else if err != sql.ErrNoRows {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	ledger, err := m.DB.PaymentTransactionsByReservationID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	data["payments"] = ledger
+
+	changes, err := m.DB.ReservationStatusChanges(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	data["status_changes"] = changes
+
+	fields, err := m.DB.AllCustomFields()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	data["custom_answers"] = customfields.Answers(fields, res.CustomFields)
+
+	notes, err := m.DB.ReservationNotes(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	data["notes"] = notes
+
+	history, err := m.DB.AuditEntries(models.AuditFilter{Entity: audit.EntityReservation, EntityID: id, Limit: 100})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	data["history"] = history
+
+	intMap := make(map[string]int)
+	intMap["paid"] = payments.Paid(ledger)
+	intMap["balance"] = res.Total() - intMap["paid"]
+	if res.Status.CanTransitionTo(models.StatusCancelled) {
+		data["cancellation_refund"] = cancellations.Compute(res, intMap["paid"], m.propertyNow(res.Room.PropertyID))
+	}
+
+	render.Template(w,r,"admin-reservations-show.page.tmpl",&models.TemplateData{
+		StringMap: stringMap,
+		IntMap: intMap,
+		Data: data,
+		Form: form,
+		ChargeCurrency: m.currencyOf(res),
+	})
+}
+
+// AdminPostShowReservation saves changes to a reservation, including moving it to other dates or another room
+func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w,err)
+		return
+	}
+
+	exploded := strings.Split(r.RequestURI, "/")
+	id, err := strconv.Atoi(exploded[4])
+	if err != nil {
+		helpers.ServerError(w,err)
+		return
+	}
+
+	src := exploded[3]
 
-	err = m.DB.UpdateReservation(res)
+	// get reservation from the database
+	res, err := m.DB.GetReservationByID(id)
 	if err != nil {
+		helpers.ServerError(w,err)
+		return
+	}
+	old := res
+
+	form := m.binder(r).BindValues(r.PostForm, &res)
+	// keep the stay as it was when the new dates or room are unusable
+	if form.Errors.Get("start_date") != "" || form.Errors.Get("end_date") != "" {
+		res.StartDate, res.EndDate = old.StartDate, old.EndDate
+	}
+	if form.Errors.Get("room_id") == "" {
+		res.Room, err = m.scopedDB(r).GetRoomByID(res.RoomID)
+		if err != nil {
+			form.Errors.Add("room_id", "Unknown room")
+		}
+	}
+	if form.Errors.Get("room_id") != "" {
+		res.RoomID, res.Room = old.RoomID, old.Room
+	}
+	// a stay moved to another room is charged that room's price
+	if res.RoomID != old.RoomID {
+		res.NightlyRate = res.Room.Price
+	}
+	// a promo code takes off what it would from the new price
+	if res.PromoCodeID > 0 && res.Subtotal() != old.Subtotal() {
+		promo, err := m.DB.GetPromoCodeByID(res.PromoCodeID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		res.Discount = promo.Discount(res.Subtotal())
+	}
+
+	moved := res.RoomID != old.RoomID || !res.StartDate.Equal(old.StartDate) || !res.EndDate.Equal(old.EndDate)
+	if moved && res.Deleted() {
+		form.Errors.Add("start_date", "Restore the reservation before moving it")
+	}
+
+	// the taxes and fees of a stay that changes are worked out again, at the current rules
+	if moved || res.Guests != old.Guests {
+		if err = m.quoteCharges(&res); err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		m.renderAdminReservation(w, r, res, src, form)
+		return
+	}
+
+	err = m.actingDB(r).UpdateReservation(res)
+	if err == repository.ErrRoomUnavailable {
+		form.Errors.Add("room_id", "The room is not available for these dates")
+		m.renderAdminReservation(w, r, res, src, form)
+		return
+	} else if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
+
+	if r.Form.Get("notify_guest") != "" {
+		// staff write in English, but the guest is written to in the language they booked in
+		locale := res.Locale
+		htmlMessage := fmt.Sprintf(`
+		<strong>%s</strong><br>
+		%s<br>
+		%s
+`, i18n.T(locale, "Reservation Changed"),
+			i18n.T(locale, "Dear %s,", res.FirstName),
+			i18n.T(locale, "Your reservation has been changed. You are now staying in %s from %s to %s.",
+				res.Room.RoomName, i18n.Date(locale, res.StartDate), i18n.Date(locale, res.EndDate)))
+
+		m.App.MailChan <- models.MailData{
+			To:       res.Email,
+			From:     "me@here.com",
+			Subject:  i18n.T(locale, "Reservation Changed"),
+			Content:  htmlMessage,
+			Template: "basic.html",
+		}
+	}
+
+	if moved {
+		// the old dates may be what someone on the waitlist is after
+		m.notifyWaitlist(old.RoomID, old.StartDate, old.EndDate)
+	}
+
 	m.App.Session.Put(r.Context(), "flash", "Changes saved")
 	http.Redirect(w,r,fmt.Sprintf("/admin/reservations-%s",src), http.StatusSeeOther)
 }
@@ -569,7 +1441,16 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 	stringMap["this_month_year"] = now.Format("2006")
 
 	// get the first and last days of the month
-	//currentYear, currentMonth, _ := now.Date()
+	currentYear, currentMonth, _ := now.Date()
+	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, time.UTC)
+	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+
+	notes, err := m.scopedDB(r).ImportantNotesBetween(firstOfMonth, lastOfMonth)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	data["important_notes"] = notes
 
 	render.Template(w,r,"admin-reservations-calendar.page.tmpl",&models.TemplateData{
 		StringMap: stringMap,
@@ -577,18 +1458,2701 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 	})
 }
 
-func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(chi.URLParam(r,"id"))
-	src := chi.URLParam(r,"src")
-	_ = m.DB.UpdateProcessedForReservation(id,1)
-	m.App.Session.Put(r.Context(), "flash", "Reservation marked as processed")
-	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s",src), http.StatusSeeOther)
+// AdminReservationStatus moves a reservation to another status
+func (m *Repository) AdminReservationStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+	src := chi.URLParam(r, "src")
+	to := models.ReservationStatus(chi.URLParam(r, "status"))
+	back := fmt.Sprintf("/admin/reservations/%s/%d", src, id)
+
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if res.Deleted() {
+		m.App.Session.Put(r.Context(), "error", "Restore the reservation from the trash before changing its status")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	if !res.Status.CanTransitionTo(to) {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("A %s reservation can't be marked as %s", strings.ToLower(res.Status.Label()), strings.ToLower(to.Label())))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+	err = m.actingDB(r).UpdateReservationStatus(id, res.Status, to, userID)
+	if err == repository.ErrStatusChanged {
+		m.App.Session.Put(r.Context(), "error", "Someone else changed this reservation, please try again")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	flash := fmt.Sprintf("Reservation marked as %s", strings.ToLower(to.Label()))
+	if to == models.StatusCancelled {
+		m.notifyWaitlist(res.RoomID, res.StartDate, res.EndDate)
+
+		refund, err := m.refundCancellation(m.actingDB(r), res, userID)
+		amount := money.New(refund.Amount, m.currencyOf(res))
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf("The reservation is cancelled, but the refund of %s failed", amount))
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+		if refund.Amount > 0 {
+			flash += fmt.Sprintf(", %s refunded", amount)
+		}
+	}
+	if to == models.StatusCheckedOut {
+		// the stay is over, so what it cost is settled and can be invoiced
+		inv, err := m.issueInvoice(res)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			m.App.Session.Put(r.Context(), "error", "The guest is checked out, but the invoice couldn't be issued")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+		flash += fmt.Sprintf(", invoice %s issued", invoices.FormatNumber(inv.Number))
+	}
+
+	m.App.Session.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+}
+
+// refundCancellation refunds through db what the cancellation policy of res gives back of what
+// was paid for it, latest payment first. It returns the refund worked out even if the payment
+// provider failed to return it.
+func (m *Repository) refundCancellation(db repository.DatabaseRepo, res models.Reservation, userID int) (cancellations.Refund, error) {
+	ledger, err := m.DB.PaymentTransactionsByReservationID(res.ID)
+	if err != nil {
+		return cancellations.Refund{}, err
+	}
+
+	refund := cancellations.Compute(res, payments.Paid(ledger), m.propertyNow(res.Room.PropertyID))
+	note := fmt.Sprintf("Cancellation refund, %s policy", res.CancellationPolicy.Name)
+	for _, a := range cancellations.Allocate(ledger, refund.Amount) {
+		_, err = m.refund(db, a.Charge, a.Amount, note, userID)
+		if err != nil {
+			return refund, err
+		}
+	}
+	return refund, nil
 }
 
+// AdminDeleteReservation moves a reservation to the trash
 func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(chi.URLParam(r,"id"))
 	src := chi.URLParam(r,"src")
-	_ = m.DB.DeleteReservation(id)
-	m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+	err = m.actingDB(r).DeleteReservation(id, userID)
+	if err == sql.ErrNoRows {
+		// someone else got there first, and has refunded the guest and told the waitlist
+		m.App.Session.Put(r.Context(), "error", "This reservation is in the trash already")
+		http.Redirect(w, r, "/admin/reservations-trash", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "error", "Can't delete reservation")
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s/%d", src, id), http.StatusSeeOther)
+		return
+	}
+
+	// a cancelled reservation gave its room back already
+	if res.Status != models.StatusCancelled {
+		m.notifyWaitlist(res.RoomID, res.StartDate, res.EndDate)
+	}
+
+	flash := "Reservation moved to the trash"
+	// deleting a stay that could still be cancelled cancels it, and gives back what cancelling it would
+	if res.Status.CanTransitionTo(models.StatusCancelled) {
+		refund, err := m.refundCancellation(m.actingDB(r), res, userID)
+		amount := money.New(refund.Amount, m.currencyOf(res))
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf("The reservation is in the trash, but the refund of %s failed", amount))
+			http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+			return
+		}
+		if refund.Amount > 0 {
+			flash += fmt.Sprintf(", %s refunded", amount)
+		}
+	}
+	m.App.Session.Put(r.Context(), "flash", flash)
 	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s",src), http.StatusSeeOther)
 }
+
+// AdminTrash lists deleted reservations that haven't been purged yet
+func (m *Repository) AdminTrash(w http.ResponseWriter, r *http.Request) {
+	reservations, err := m.scopedDB(r).DeletedReservations()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reservations"] = reservations
+	intMap := make(map[string]int)
+	intMap["retention_days"] = int(TrashRetention.Hours() / 24)
+	render.Template(w, r, "admin-trash.page.tmpl", &models.TemplateData{
+		IntMap: intMap,
+		Data:   data,
+	})
+}
+
+// AdminRestoreReservation takes a reservation out of the trash if its dates are still free
+func (m *Repository) AdminRestoreReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.actingDB(r).RestoreReservation(id)
+	if err == repository.ErrRoomUnavailable {
+		m.App.Session.Put(r.Context(), "error", "The room has been booked for these dates since the reservation was deleted")
+		http.Redirect(w, r, "/admin/reservations-trash", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation restored")
+	http.Redirect(w, r, "/admin/reservations-trash", http.StatusSeeOther)
+}
+
+// Waitlist renders the form for joining the waitlist
+func (m *Repository) Waitlist(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+	data["entry"] = models.WaitlistEntry{}
+
+	stringMap := make(map[string]string)
+	stringMap["start"] = r.URL.Query().Get("s")
+	stringMap["end"] = r.URL.Query().Get("e")
+
+	render.Template(w, r, "waitlist.page.tmpl", &models.TemplateData{
+		Form:      forms.New(nil),
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// PostWaitlist adds a guest to the waitlist for a room and date range
+func (m *Repository) PostWaitlist(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	var entry models.WaitlistEntry
+	form := m.binder(r).BindValues(r.PostForm, &entry)
+	entry.Locale = form.Locale
+
+	if !form.Valid() {
+		rooms, err := m.DB.AllRooms()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		data := make(map[string]interface{})
+		data["rooms"] = rooms
+		data["entry"] = entry
+
+		stringMap := make(map[string]string)
+		stringMap["start"] = r.Form.Get("start")
+		stringMap["end"] = r.Form.Get("end")
+
+		render.Template(w, r, "waitlist.page.tmpl", &models.TemplateData{
+			Form:      form,
+			Data:      data,
+			StringMap: stringMap,
+		})
+		return
+	}
+
+	_, err = m.DB.InsertWaitlistEntry(entry)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't insert waitlist entry into database")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "You're on the waitlist. We'll email you if the room frees up")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// WaitlistBook starts a booking from the link emailed to a waitlisted guest
+func (m *Repository) WaitlistBook(w http.ResponseWriter, r *http.Request) {
+	entry, err := m.DB.GetWaitlistEntryByToken(chi.URLParam(r, "token"))
+	if err != nil || time.Now().After(entry.TokenExpiresAt) {
+		m.App.Session.Put(r.Context(), "error", "This booking link is invalid or has expired")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(entry.RoomID)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't get room from database")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	res := models.Reservation{
+		FirstName: entry.FirstName,
+		LastName:  entry.LastName,
+		Email:     entry.Email,
+		Phone:     entry.Phone,
+		StartDate: entry.StartDate,
+		EndDate:   entry.EndDate,
+		RoomID:    entry.RoomID,
+	}
+	res.Room.RoomName = room.RoomName
+
+	err = m.holdRoom(r, res)
+	if err == repository.ErrRoomUnavailable {
+		m.App.Session.Put(r.Context(), "error", "Sorry, the room has been booked again for these dates")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't hold room")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	// remembered so that the link is used up once the guest books
+	m.App.Session.Put(r.Context(), "waitlist_entry", entry.ID)
+	m.App.Session.Put(r.Context(), "reservation", res)
+	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+}
+
+// OfferExpiredWaitlistDates moves the waitlist on past guests whose booking links ran out unused,
+// offering their dates to whoever joined next. It returns how many links had run out.
+func (m *Repository) OfferExpiredWaitlistDates() (int, error) {
+	entries, err := m.DB.ExpireWaitlistOffers()
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		m.notifyWaitlist(e.RoomID, e.StartDate, e.EndDate)
+	}
+	return len(entries), nil
+}
+
+// notifyWaitlist emails a time-limited booking link to waitlisted guests whose dates have
+// freed up in a room. Guests are offered dates in the order they joined, so an entry that
+// overlaps one already offered keeps waiting.
+func (m *Repository) notifyWaitlist(roomID int, start, end time.Time) {
+	entries, err := m.DB.WaitingEntriesForRoom(roomID, start, end)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	var offered []models.WaitlistEntry
+	for _, e := range entries {
+		taken := false
+		for _, o := range offered {
+			if e.StartDate.Before(o.EndDate) && e.EndDate.After(o.StartDate) {
+				taken = true
+				break
+			}
+		}
+		if taken {
+			continue
+		}
+
+		available, err := m.DB.SearchAvailabilityByDatesByRoomID(e.StartDate, e.EndDate, e.RoomID)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			continue
+		}
+		if !available {
+			continue
+		}
+
+		token, err := helpers.NewToken()
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			return
+		}
+		expires := time.Now().Add(waitlistOfferDuration)
+
+		err = m.DB.MarkWaitlistEntryNotified(e.ID, token, expires)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			continue
+		}
+		offered = append(offered, e)
+
+		locale := e.Locale
+		htmlMessage := fmt.Sprintf(`
+		<strong>%s</strong><br>
+		%s<br>
+		%s<br>
+		<a href="%s/waitlist/book/%s">%s</a>
+`, i18n.T(locale, "Good news!"),
+			i18n.T(locale, "Dear %s,", e.FirstName),
+			i18n.T(locale, "%s is now available from %s to %s.",
+				e.Room.RoomName, i18n.Date(locale, e.StartDate), i18n.Date(locale, e.EndDate)),
+			m.App.SiteURL, token, i18n.T(locale, "Book it now, before %s", i18n.DateTime(locale, expires)))
+
+		m.App.MailChan <- models.MailData{
+			To:       e.Email,
+			From:     "me@here.com",
+			Subject:  i18n.T(locale, "A room you waited for is available"),
+			Content:  htmlMessage,
+			Template: "basic.html",
+		}
+	}
+}
+
+// AdminWaitlist shows the waitlist for a date range, defaulting to the next 30 days
+func (m *Repository) AdminWaitlist(w http.ResponseWriter, r *http.Request) {
+	form := forms.New(r.URL.Query())
+	form.IsDate("start")
+	form.IsDate("end")
+
+	// a missing or invalid date falls back to the default range
+	start := form.Date("start")
+	if start.IsZero() {
+		start = time.Now().Truncate(24 * time.Hour)
+	}
+	end := form.Date("end")
+	if !end.After(start) {
+		end = start.AddDate(0, 0, 30)
+	}
+
+	entries, err := m.scopedDB(r).WaitlistEntriesByDates(start, end)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["entries"] = entries
+	data["now"] = time.Now()
+
+	stringMap := make(map[string]string)
+	stringMap["start"] = start.Format(forms.DateLayout)
+	stringMap["end"] = end.Format(forms.DateLayout)
+
+	render.Template(w, r, "admin-waitlist.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// checkPromoCode returns why a promo code can't be applied to the reservation, in the language of
+// the guest, or an empty
+// string if it can. uses and emailUses are the redemptions so far in total and by the guest.
+func checkPromoCode(p models.PromoCode, res models.Reservation, uses, emailUses int) string {
+	switch {
+	case !p.Active:
+		return i18n.T(res.Locale, "This promo code is not valid")
+	case res.StartDate.Before(p.ValidFrom) || res.StartDate.After(p.ValidTo):
+		return i18n.T(res.Locale, "This promo code is not valid for your dates")
+	case !p.AppliesToRoom(res.RoomID):
+		return i18n.T(res.Locale, "This promo code can't be used for this room")
+	case res.Nights() < p.MinNights:
+		return i18n.T(res.Locale, "This promo code requires a stay of at least %d nights", p.MinNights)
+	case p.UsageLimit > 0 && uses >= p.UsageLimit:
+		return i18n.T(res.Locale, "This promo code has been fully redeemed")
+	case p.PerEmailLimit > 0 && emailUses >= p.PerEmailLimit:
+		return i18n.T(res.Locale, "You have already used this promo code")
+	}
+	return ""
+}
+
+// AdminPromoCodes lists the promo codes
+func (m *Repository) AdminPromoCodes(w http.ResponseWriter, r *http.Request) {
+	codes, err := m.DB.AllPromoCodes()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["promo_codes"] = codes
+	render.Template(w, r, "admin-promo-codes.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowPromoCode shows the form for adding (id 0) or editing a promo code
+func (m *Repository) AdminShowPromoCode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	promo := models.PromoCode{
+		DiscountType: models.PromoPercent,
+		MinNights:    1,
+		Active:       true,
+	}
+	if id > 0 {
+		promo, err = m.DB.GetPromoCodeByID(id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	m.renderPromoCodeForm(w, r, promo, forms.New(nil))
+}
+
+// AdminPostPromoCode saves a promo code
+func (m *Repository) AdminPostPromoCode(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code", "discount_type", "amount", "valid_from", "valid_to", "min_nights")
+	form.OneOf("discount_type", models.PromoPercent, models.PromoFixed)
+	if form.Get("discount_type") == models.PromoPercent {
+		form.IntRange("amount", 1, 100)
+	} else {
+		form.IntRange("amount", 1, math.MaxInt32)
+	}
+	form.IsDate("valid_from")
+	form.IsDate("valid_to")
+	form.IntRange("min_nights", 1, math.MaxInt32)
+	form.IntRange("usage_limit", 0, math.MaxInt32)
+	form.IntRange("per_email_limit", 0, math.MaxInt32)
+
+	promo := models.PromoCode{
+		ID:            id,
+		Code:          strings.ToUpper(form.Trimmed("code")),
+		Description:   form.Get("description"),
+		DiscountType:  form.Get("discount_type"),
+		Amount:        form.Int("amount"),
+		ValidFrom:     form.Date("valid_from"),
+		ValidTo:       form.Date("valid_to"),
+		MinNights:     form.Int("min_nights"),
+		UsageLimit:    form.Int("usage_limit"),
+		PerEmailLimit: form.Int("per_email_limit"),
+		Active:        form.Bool("active"),
+	}
+	for _, v := range r.Form["room_ids"] {
+		roomID, err := strconv.Atoi(v)
+		if err == nil {
+			promo.RoomIDs = append(promo.RoomIDs, roomID)
+		}
+	}
+
+	// a code may be valid for a single day, so the window only has to not run backwards
+	if !promo.ValidFrom.IsZero() && promo.ValidTo.Before(promo.ValidFrom) {
+		form.Errors.Add("valid_to", "End of validity must not be before its start")
+	}
+
+	if !form.Valid() {
+		m.renderPromoCodeForm(w, r, promo, form)
+		return
+	}
+
+	if promo.ID == 0 {
+		_, err = m.actingDB(r).InsertPromoCode(promo)
+	} else {
+		err = m.actingDB(r).UpdatePromoCode(promo)
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Promo code saved")
+	http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+}
+
+// AdminDeletePromoCode deletes a promo code that was never redeemed. Redeemed codes are kept for
+// their history, and can be made inactive instead.
+func (m *Repository) AdminDeletePromoCode(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	uses, _, err := m.DB.PromoCodeUsage(id, "")
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if uses > 0 {
+		m.App.Session.Put(r.Context(), "error", "This promo code has been redeemed, make it inactive instead of deleting it")
+		http.Redirect(w, r, fmt.Sprintf("/admin/promo-codes/%d", id), http.StatusSeeOther)
+		return
+	}
+
+	err = m.actingDB(r).DeletePromoCode(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.App.Session.Put(r.Context(), "flash", "Promo code deleted")
+	http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+}
+
+// renderPromoCodeForm renders the promo code edit page
+func (m *Repository) renderPromoCodeForm(w http.ResponseWriter, r *http.Request, promo models.PromoCode, form *forms.Form) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	selected := make(map[int]bool)
+	for _, id := range promo.RoomIDs {
+		selected[id] = true
+	}
+
+	data := make(map[string]interface{})
+	data["promo_code"] = promo
+	data["rooms"] = rooms
+	data["selected_rooms"] = selected
+
+	render.Template(w, r, "admin-promo-code-show.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// chargeDeposit collects the deposit on a new reservation, going by the room's deposit percentage
+func (m *Repository) chargeDeposit(res models.Reservation) error {
+	amount := payments.Deposit(res.Total(), res.Room.DepositPercent)
+	if amount == 0 {
+		return nil
+	}
+	_, err := m.charge(m.DB, res.ID, amount, m.currencyOf(res), "Deposit", 0)
+	return err
+}
+
+// charge collects amount, in currency, for a reservation through the payment provider and
+// records the intent and the ledger entry in db
+func (m *Repository) charge(db repository.DatabaseRepo, reservationID, amount int, currency, note string, userID int) (models.PaymentTransaction, error) {
+	var t models.PaymentTransaction
+
+	intent, err := m.App.Payments.CreateIntent(amount, currency, fmt.Sprintf("reservation-%d", reservationID))
+	if err != nil {
+		return t, err
+	}
+
+	pi := models.PaymentIntent{
+		ReservationID: reservationID,
+		Provider:      m.App.Payments.Name(),
+		ProviderRef:   intent.Ref,
+		Amount:        intent.Amount,
+		Currency:      intent.Currency,
+		Status:        intent.Status,
+	}
+	pi.ID, err = db.InsertPaymentIntent(pi)
+	if err != nil {
+		return t, err
+	}
+
+	receipt, err := m.App.Payments.Capture(intent.Ref)
+	if err != nil {
+		_ = db.UpdatePaymentIntentStatus(pi.ID, payments.IntentFailed)
+		return t, err
+	}
+
+	err = db.UpdatePaymentIntentStatus(pi.ID, payments.IntentSucceeded)
+	if err != nil {
+		return t, err
+	}
+
+	t = models.PaymentTransaction{
+		ReservationID:   reservationID,
+		PaymentIntentID: pi.ID,
+		Kind:            payments.KindCharge,
+		Amount:          receipt.Amount,
+		Currency:        pi.Currency,
+		Provider:        pi.Provider,
+		ProviderRef:     receipt.Ref,
+		Note:            note,
+		UserID:          userID,
+	}
+	t.ID, err = db.InsertPaymentTransaction(t)
+	return t, err
+}
+
+// refund returns amount of a charge through the payment provider and records it in the ledger in db
+func (m *Repository) refund(db repository.DatabaseRepo, charge models.PaymentTransaction, amount int, note string, userID int) (models.PaymentTransaction, error) {
+	var t models.PaymentTransaction
+
+	receipt, err := m.App.Payments.Refund(charge.ProviderRef, amount)
+	if err != nil {
+		return t, err
+	}
+
+	t = models.PaymentTransaction{
+		ReservationID: charge.ReservationID,
+		ChargeID:      charge.ID,
+		Kind:          payments.KindRefund,
+		Amount:        receipt.Amount,
+		Currency:      charge.Currency,
+		Provider:      charge.Provider,
+		ProviderRef:   receipt.Ref,
+		Note:          note,
+		UserID:        userID,
+	}
+	t.ID, err = db.InsertPaymentTransaction(t)
+	return t, err
+}
+
+// AdminPostPayment records a charge or a refund on a reservation from the admin tool
+func (m *Repository) AdminPostPayment(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+	src := chi.URLParam(r, "src")
+	back := fmt.Sprintf("/admin/reservations/%s/%d", src, id)
+
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	currency := m.currencyOf(res)
+
+	amount, err := money.Parse(r.Form.Get("amount"), currency)
+	if err != nil || amount == 0 {
+		m.App.Session.Put(r.Context(), "error", "Invalid amount")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+	note := r.Form.Get("note")
+
+	switch r.Form.Get("kind") {
+	case payments.KindCharge:
+		_, err = m.charge(m.actingDB(r), id, amount, currency, note, userID)
+		if err == payments.ErrDeclined {
+			m.App.Session.Put(r.Context(), "error", "The payment was declined")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+	case payments.KindRefund:
+		var ledger []models.PaymentTransaction
+		ledger, err = m.DB.PaymentTransactionsByReservationID(id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		chargeID, _ := strconv.Atoi(r.Form.Get("charge_id"))
+
+		var charge models.PaymentTransaction
+		for _, t := range ledger {
+			if t.ID == chargeID && t.Kind == payments.KindCharge {
+				charge = t
+			}
+		}
+		if charge.ID == 0 || amount > payments.Refundable(ledger, chargeID) {
+			m.App.Session.Put(r.Context(), "error", "A refund can't be more than what is left of the charge")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+		_, err = m.refund(m.actingDB(r), charge, amount, note, userID)
+		if err != nil {
+			// the ledger only records refunds the provider made, so nothing was written
+			m.App.ErrorLog.Println(err)
+			m.App.Session.Put(r.Context(), "error", "The refund failed")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+	default:
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Payment recorded")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// Invoice shows a guest the invoice for their reservation
+func (m *Repository) Invoice(w http.ResponseWriter, r *http.Request) {
+	res, err := m.DB.GetReservationByAccessToken(chi.URLParam(r, "token"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't find that reservation")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	doc, err := m.invoiceDocument(res)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't create the invoice")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	m.renderInvoice(w, r, doc, fmt.Sprintf("/reservation/%s/invoice.pdf", res.AccessToken), "")
+}
+
+// InvoicePDF sends a guest the invoice for their reservation as a PDF
+func (m *Repository) InvoicePDF(w http.ResponseWriter, r *http.Request) {
+	res, err := m.DB.GetReservationByAccessToken(chi.URLParam(r, "token"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't find that reservation")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	doc, err := m.invoiceDocument(res)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't create the invoice")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	writeInvoicePDF(w, doc)
+}
+
+// CancelReservation shows a guest what cancelling their reservation would refund
+func (m *Repository) CancelReservation(w http.ResponseWriter, r *http.Request) {
+	res, err := m.DB.GetReservationByAccessToken(chi.URLParam(r, "token"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't find that reservation")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	ledger, err := m.DB.PaymentTransactionsByReservationID(res.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	property := m.findProperty(res.Room.PropertyID)
+	now := time.Now().In(property.Location())
+
+	intMap := make(map[string]int)
+	intMap["paid"] = payments.Paid(ledger)
+	if canCancel(res, now) {
+		intMap["can_cancel"] = 1
+	}
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["property"] = property
+	data["refund"] = cancellations.Compute(res, intMap["paid"], now)
+
+	render.Template(w, r, "cancel-reservation.page.tmpl", &models.TemplateData{
+		IntMap:         intMap,
+		Data:           data,
+		ChargeCurrency: property.Currency,
+	})
+}
+
+// PostCancelReservation cancels a guest's reservation and refunds what its cancellation policy
+// gives back
+func (m *Repository) PostCancelReservation(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	back := fmt.Sprintf("/reservation/%s/cancel", token)
+
+	res, err := m.DB.GetReservationByAccessToken(token)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't find that reservation")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	if !canCancel(res, m.propertyNow(res.Room.PropertyID)) {
+		m.App.Session.Put(r.Context(), "error", "This reservation can't be cancelled online, please contact us")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.UpdateReservationStatus(res.ID, res.Status, models.StatusCancelled, 0)
+	if err == repository.ErrStatusChanged {
+		m.App.Session.Put(r.Context(), "error", "This reservation has just been changed, please try again")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.notifyWaitlist(res.RoomID, res.StartDate, res.EndDate)
+
+	refund, err := m.refundCancellation(m.DB, res, 0)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "warning", "Your reservation is cancelled, but we couldn't return your refund. We'll be in touch")
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Your reservation is cancelled")
+	}
+	m.sendCancellation(res, refund)
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// canCancel reports whether a guest can still cancel res online at now, which they can until
+// the day of arrival where the property is. Stays booked without a cancellation policy are cancelled by staff, who
+// settle the refund.
+func canCancel(res models.Reservation, now time.Time) bool {
+	return len(res.CancellationPolicy.Tiers) > 0 &&
+		res.Status.CanTransitionTo(models.StatusCancelled) &&
+		cancellations.DaysBefore(res.StartDate, now) >= 0
+}
+
+// sendCancellation emails the guest that their reservation is cancelled and what is refunded
+func (m *Repository) sendCancellation(res models.Reservation, refund cancellations.Refund) {
+	locale := res.Locale
+	htmlMessage := fmt.Sprintf(`
+		<strong>%s</strong><br>
+		%s<br>
+		%s<br>
+		%s
+`, i18n.T(locale, "Reservation Cancelled"),
+		i18n.T(locale, "Dear %s,", res.FirstName),
+		i18n.T(locale, "Your reservation from %s to %s is cancelled.",
+			i18n.Date(locale, res.StartDate), i18n.Date(locale, res.EndDate)),
+		i18n.T(locale, "Refund: %s", money.New(refund.Amount, m.currencyOf(res)).Format(locale)))
+
+	m.App.MailChan <- models.MailData{
+		To:       res.Email,
+		From:     "me@here.com",
+		Subject:  i18n.T(locale, "Reservation Cancelled"),
+		Content:  htmlMessage,
+		Template: "basic.html",
+	}
+}
+
+// AdminInvoice shows the invoice for a reservation in the admin tool
+func (m *Repository) AdminInvoice(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	doc, err := m.invoiceDocument(res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	invoiceURL := fmt.Sprintf("/admin/reservations/%s/%d/invoice", chi.URLParam(r, "src"), id)
+	m.renderInvoice(w, r, doc, invoiceURL+".pdf", invoiceURL)
+}
+
+// AdminInvoicePDF sends the invoice for a reservation as a PDF from the admin tool
+func (m *Repository) AdminInvoicePDF(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	doc, err := m.invoiceDocument(res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	writeInvoicePDF(w, doc)
+}
+
+// AdminIssueInvoice issues the invoice for a reservation as it stands, giving it the next number
+func (m *Repository) AdminIssueInvoice(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	inv, err := m.issueInvoice(res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Invoice %s issued", invoices.FormatNumber(inv.Number)))
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s/%d", chi.URLParam(r, "src"), id), http.StatusSeeOther)
+}
+
+// issueInvoice issues the invoice for a reservation as it stands, unless it already has one
+func (m *Repository) issueInvoice(res models.Reservation) (models.Invoice, error) {
+	return m.DB.IssueInvoice(invoices.New(res, m.currencyOf(res)))
+}
+
+// invoiceDocument builds the invoice issued for a reservation, or a pro forma invoice of the
+// reservation as it stands if none has been issued yet. Viewing an invoice never issues it.
+func (m *Repository) invoiceDocument(res models.Reservation) (invoices.Document, error) {
+	inv, err := m.DB.GetInvoiceByReservationID(res.ID)
+	if err == sql.ErrNoRows {
+		inv = invoices.New(res, m.currencyOf(res))
+	} else if err != nil {
+		return invoices.Document{}, err
+	}
+
+	ledger, err := m.DB.PaymentTransactionsByReservationID(res.ID)
+	if err != nil {
+		return invoices.Document{}, err
+	}
+	return invoices.Build(inv, res, ledger), nil
+}
+
+// renderInvoice shows an invoice. Staff, who see it at adminURL, can issue it from there if it
+// hasn't been issued yet.
+func (m *Repository) renderInvoice(w http.ResponseWriter, r *http.Request, doc invoices.Document, pdfURL string, adminURL string) {
+	data := make(map[string]interface{})
+	data["invoice"] = doc
+	stringMap := make(map[string]string)
+	stringMap["pdf_url"] = pdfURL
+	if adminURL != "" && !doc.Issued() {
+		stringMap["issue_url"] = adminURL
+	}
+
+	render.Template(w, r, "invoice.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+func writeInvoicePDF(w http.ResponseWriter, doc invoices.Document) {
+	// build the whole file first, so a failure can still be reported as an error page
+	var buf bytes.Buffer
+	err := invoices.WritePDF(&buf, doc)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	name := doc.Number()
+	if !doc.Issued() {
+		name = fmt.Sprintf("pro-forma-%d", doc.Reservation.ID)
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, name))
+	_, _ = buf.WriteTo(w)
+}
+
+// auditPageSize is the most audit log entries shown at once
+const auditPageSize = 500
+
+// AdminAudit shows the audit log, filtered by the query string
+func (m *Repository) AdminAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	form := forms.New(q)
+
+	filter := models.AuditFilter{
+		Action: q.Get("action"),
+		Entity: q.Get("entity"),
+		Limit:  auditPageSize,
+	}
+	if v := q.Get("user_id"); v != "" {
+		filter.UserID, _ = strconv.Atoi(v)
+	}
+	if v := q.Get("entity_id"); v != "" {
+		filter.EntityID, _ = strconv.Atoi(v)
+	}
+
+	form.IsDate("from")
+	form.IsDate("to")
+	filter.From = form.Date("from")
+	if to := form.Date("to"); !to.IsZero() {
+		// the end date is inclusive
+		filter.To = to.AddDate(0, 0, 1)
+	}
+
+	var entries []models.AuditEntry
+	if form.Valid() {
+		var err error
+		entries, err = m.DB.AuditEntries(filter)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["entries"] = entries
+	data["actions"] = audit.Actions
+	data["entities"] = audit.Entities
+	render.Template(w, r, "admin-audit.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// AdminAddReservation shows the form for booking a room on behalf of a guest
+func (m *Repository) AdminAddReservation(w http.ResponseWriter, r *http.Request) {
+	m.renderAddReservationForm(w, r, forms.New(url.Values{"source": {models.SourcePhone}}))
+}
+
+// AdminPostAddReservation books a room on behalf of a guest, for phone and walk-in bookings
+func (m *Repository) AdminPostAddReservation(w http.ResponseWriter, r *http.Request) {
+	// staff have spoken to the guest, so there is nothing left to confirm
+	res := models.Reservation{Status: models.StatusConfirmed, Guests: 1}
+	form, err := m.binder(r).Bind(r, &res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	form.Required("source")
+
+	if res.RoomID != 0 {
+		res.Room, err = m.scopedDB(r).GetRoomByID(res.RoomID)
+		if err != nil {
+			form.Errors.Add("room_id", "Unknown room")
+		}
+	}
+
+	if !form.Valid() {
+		m.renderAddReservationForm(w, r, form)
+		return
+	}
+
+	res.NightlyRate = res.Room.Price
+	if err = m.quoteCharges(&res); err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	property, err := m.DB.GetPropertyByID(res.Room.PropertyID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if err = m.bookingPolicy(&res, res.Room, property); err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	res.AccessToken, err = helpers.NewToken()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// hold the room first, so the availability check and the booking can't be overtaken
+	db := m.actingDB(r)
+	holdID, err := db.InsertRoomHold(models.RoomRestriction{
+		StartDate:     res.StartDate,
+		EndDate:       res.EndDate,
+		RoomID:        res.RoomID,
+		RestrictionID: models.RestrictionHold,
+		ExpiresAt:     time.Now().Add(roomHoldDuration),
+	})
+	if err == repository.ErrRoomUnavailable {
+		form.Errors.Add("room_id", "The room is not available for these dates")
+		m.renderAddReservationForm(w, r, form)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	res.ID, err = db.ConvertHoldToReservation(holdID, res)
+	if err != nil {
+		_ = db.ReleaseRoomHold(holdID)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if r.Form.Get("send_email") != "" {
+		m.sendConfirmation(res)
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation added")
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations/all/%d", res.ID), http.StatusSeeOther)
+}
+
+func (m *Repository) renderAddReservationForm(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	rooms, err := m.scopedDB(r).AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+	data["sources"] = models.ReservationSources
+	render.Template(w, r, "admin-add-reservation.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// maxExportDays is the longest range of days the occupancy export covers
+const maxExportDays = 366
+
+// exportFormat returns the format asked for in the query string, CSV unless otherwise asked
+func exportFormat(r *http.Request) (string, bool) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "", export.CSV:
+		return export.CSV, true
+	case export.XLSX:
+		return export.XLSX, true
+	}
+	return "", false
+}
+
+// startExport sets the headers for downloading a file called name in the format and returns a Writer for it
+func startExport(w http.ResponseWriter, name, format, sheet string) (export.Writer, error) {
+	ew, err := export.NewWriter(w, format, sheet)
+	if err != nil {
+		return nil, err
+	}
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+	return ew, nil
+}
+
+// AdminExportReservations sends the reservations of an admin list, with the list's search and
+// filters applied, as a spreadsheet. CSV is streamed as it is read from the database.
+func (m *Repository) AdminExportReservations(w http.ResponseWriter, r *http.Request) {
+	src := chi.URLParam(r, "src")
+	filter, form := reservationFilter(r.URL.Query())
+	switch src {
+	case "new":
+		filter.Status = models.StatusPending
+	case "all":
+		if filter.Status != "" && !filter.Status.Valid() {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+	default:
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	format, ok := exportFormat(r)
+	if !ok || !form.Valid() {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// every custom field gets a column, including the ones no longer asked
+	fields, err := m.DB.AllCustomFields()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	name := fmt.Sprintf("reservations-%s-%s", src, time.Now().Format("2006-01-02"))
+	ew, err := startExport(w, name, format, "Reservations")
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	header := []interface{}{"ID", "First name", "Last name", "Email", "Phone", "Room", "Arrival", "Departure",
+		"Nights", "Status", "Source", "Nightly rate", "Discount", "Total"}
+	for _, f := range fields {
+		header = append(header, f.Label)
+	}
+	err = ew.WriteRow(header...)
+	if err == nil {
+		err = m.scopedDB(r).EachReservation(filter, func(res models.Reservation) error {
+			row := []interface{}{res.ID, res.FirstName, res.LastName, res.Email, res.Phone, res.Room.RoomName,
+				res.StartDate, res.EndDate, res.Nights(), res.Status.Label(), res.Source,
+				export.Cents(res.NightlyRate), export.Cents(res.Discount), export.Cents(res.Total())}
+			for _, f := range fields {
+				row = append(row, res.CustomFields[f.Name])
+			}
+			return ew.WriteRow(row...)
+		})
+	}
+	if err == nil {
+		err = ew.Close()
+	}
+	if err != nil {
+		// part of the file may have been sent already, so all we can do is log it
+		m.App.ErrorLog.Println("exporting reservations:", err)
+	}
+}
+
+// AdminOccupancy shows the form for exporting occupancy
+func (m *Repository) AdminOccupancy(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	stringMap := make(map[string]string)
+	stringMap["start"] = start.Format("2006-01-02")
+	stringMap["end"] = start.AddDate(0, 1, -1).Format("2006-01-02")
+
+	intMap := make(map[string]int)
+	intMap["max_days"] = maxExportDays
+
+	render.Template(w, r, "admin-occupancy.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		IntMap:    intMap,
+	})
+}
+
+// AdminExportOccupancy sends the nights sold per room on each day of a range as a spreadsheet,
+// a row per day and a column per room
+func (m *Repository) AdminExportOccupancy(w http.ResponseWriter, r *http.Request) {
+	form := forms.New(r.URL.Query())
+	form.Required("start", "end")
+	form.IsDate("start")
+	form.IsDate("end")
+	if form.Errors.Get("start") != "" {
+		m.App.Session.Put(r.Context(), "error", "Invalid start date")
+		http.Redirect(w, r, "/admin/occupancy", http.StatusSeeOther)
+		return
+	}
+	if form.Errors.Get("end") != "" {
+		m.App.Session.Put(r.Context(), "error", "Invalid end date")
+		http.Redirect(w, r, "/admin/occupancy", http.StatusSeeOther)
+		return
+	}
+
+	start, last := form.Date("start"), form.Date("end")
+	// the end date is inclusive
+	end := last.AddDate(0, 0, 1)
+	if !end.After(start) || end.Sub(start).Hours()/24 > maxExportDays {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Choose a range of 1 to %d days", maxExportDays))
+		http.Redirect(w, r, "/admin/occupancy", http.StatusSeeOther)
+		return
+	}
+
+	format, ok := exportFormat(r)
+	if !ok {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	occupancy, err := m.scopedDB(r).OccupancyByDay(start, end)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	name := fmt.Sprintf("occupancy-%s-%s", start.Format(forms.DateLayout), last.Format(forms.DateLayout))
+	ew, err := startExport(w, name, format, "Occupancy")
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// rows come ordered by day, then room, so each day's rooms are a run of rows
+	header := []interface{}{"Date"}
+	for _, o := range occupancy {
+		if !o.Date.Equal(occupancy[0].Date) {
+			break
+		}
+		header = append(header, o.RoomName)
+	}
+	header = append(header, "Total")
+	err = ew.WriteRow(header...)
+
+	for i := 0; err == nil && i < len(occupancy); {
+		row := []interface{}{occupancy[i].Date}
+		total := 0
+		day := occupancy[i].Date
+		for ; i < len(occupancy) && occupancy[i].Date.Equal(day); i++ {
+			row = append(row, occupancy[i].Nights)
+			total += occupancy[i].Nights
+		}
+		err = ew.WriteRow(append(row, total)...)
+	}
+	if err == nil {
+		err = ew.Close()
+	}
+	if err != nil {
+		m.App.ErrorLog.Println("exporting occupancy:", err)
+	}
+}
+
+// maxImportSize is the largest file the import upload takes
+const maxImportSize = 10 << 20
+
+// AdminImport shows the form for importing reservations from a CSV file
+func (m *Repository) AdminImport(w http.ResponseWriter, r *http.Request) {
+	m.renderImport(w, r, forms.New(url.Values{"dry_run": {"1"}}), nil)
+}
+
+// AdminPostImport imports the reservations in an uploaded CSV file, or with dry run checked, only
+// reports what importing them would do
+func (m *Repository) AdminPostImport(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	err := r.ParseMultipartForm(maxImportSize)
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	dryRun := form.Has("dry_run")
+
+	opts := importer.Options{Mapping: importer.Mapping{}, Currencies: map[int]string{}}
+	for _, field := range importer.Fields {
+		if col := strings.TrimSpace(form.Get("map_" + field)); col != "" {
+			opts.Mapping[field] = col
+		}
+	}
+	for _, layout := range importer.DateLayouts {
+		if form.Get("date_layout") == layout {
+			opts.DateLayout = layout
+		}
+	}
+	if opts.DateLayout == "" {
+		form.Errors.Add("date_layout", "Choose a date format")
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		form.Errors.Add("file", "Choose a CSV file")
+	}
+	if !form.Valid() {
+		m.renderImport(w, r, form, nil)
+		return
+	}
+	defer file.Close()
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	properties, err := m.DB.AllProperties()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	for _, p := range properties {
+		opts.Currencies[p.ID] = p.Currency
+	}
+
+	rows, err := importer.Read(file, opts, rooms)
+	if err != nil {
+		form.Errors.Add("file", err.Error())
+		m.renderImport(w, r, form, nil)
+		return
+	}
+
+	result, err := importer.Import(m.actingDB(r), rows, dryRun)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderImport(w, r, form, &result)
+}
+
+func (m *Repository) renderImport(w http.ResponseWriter, r *http.Request, form *forms.Form, result *importer.Result) {
+	// show layouts as, say, DD/MM/YYYY rather than Go's 02/01/2006
+	type dateLayout struct {
+		Layout string
+		Label  string
+	}
+	labels := strings.NewReplacer("2006", "YYYY", "01", "MM", "02", "DD")
+	var layouts []dateLayout
+	for _, l := range importer.DateLayouts {
+		layouts = append(layouts, dateLayout{Layout: l, Label: labels.Replace(l)})
+	}
+
+	data := make(map[string]interface{})
+	data["fields"] = importer.Fields
+	data["date_layouts"] = layouts
+	if result != nil {
+		data["result"] = result
+		data["failed"] = result.Failed()
+	}
+	render.Template(w, r, "admin-import.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// maxReportDays is the longest range of days a report covers
+const maxReportDays = 3 * 366
+
+// buildReport reads the range and grouping of a report from the query string and computes it. The
+// report is only computed if the form is valid.
+func (m *Repository) buildReport(r *http.Request) (reports.Report, *forms.Form, error) {
+	q := r.URL.Query()
+	form := forms.New(q)
+
+	// the current month, unless a range is chosen
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	form.IsDate("start")
+	form.IsDate("end")
+	if d := form.Date("start"); !d.IsZero() {
+		start = d
+	}
+	if d := form.Date("end"); !d.IsZero() {
+		// the end date is inclusive
+		end = d.AddDate(0, 0, 1)
+	}
+	if form.Valid() && (!end.After(start) || end.Sub(start).Hours()/24 > maxReportDays) {
+		form.Errors.Add("end", fmt.Sprintf("Choose a range of 1 to %d days", maxReportDays))
+	}
+
+	group := q.Get("group")
+	known := false
+	for _, g := range reports.Groups {
+		if g == group {
+			known = true
+		}
+	}
+	if !known {
+		form.Errors.Add("group", "Invalid grouping")
+	}
+
+	// fill in the defaults, so the form shows the range the report covers
+	form.Set("start", start.Format(forms.DateLayout))
+	form.Set("end", end.AddDate(0, 0, -1).Format(forms.DateLayout))
+
+	report := reports.Report{Start: start, End: end, Group: group}
+	if !form.Valid() {
+		return report, form, nil
+	}
+
+	in := reports.Input{Start: start, End: end, AsOf: now}
+	db := m.scopedDB(r)
+	var err error
+	if in.Rooms, err = db.AllRooms(); err != nil {
+		return report, form, err
+	}
+	if in.Reservations, err = db.ReservationsBetween(start, end); err != nil {
+		return report, form, err
+	}
+	if in.Restrictions, err = db.RestrictionsBetween(start, end); err != nil {
+		return report, form, err
+	}
+	if in.LastYear, err = db.ReservationsBetween(start.AddDate(-1, 0, 0), end.AddDate(-1, 0, 0)); err != nil {
+		return report, form, err
+	}
+
+	return reports.Build(in, group), form, nil
+}
+
+// AdminReports shows occupancy, rates, cancellations and booking pace for a range of days
+func (m *Repository) AdminReports(w http.ResponseWriter, r *http.Request) {
+	report, form, err := m.buildReport(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	for _, format := range []string{export.CSV, export.XLSX} {
+		stringMap[format+"_url"] = listURL("/admin/reports/export", r.URL.Query(), map[string]string{"format": format})
+	}
+
+	data := make(map[string]interface{})
+	data["report"] = report
+	render.Template(w, r, "admin-reports.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      form,
+	})
+}
+
+// AdminExportReport sends a report as a spreadsheet
+func (m *Repository) AdminExportReport(w http.ResponseWriter, r *http.Request) {
+	format, ok := exportFormat(r)
+	if !ok {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	report, form, err := m.buildReport(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if !form.Valid() {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	layout := "2006-01-02"
+	name := fmt.Sprintf("report-%s-%s", report.Start.Format(layout), report.End.AddDate(0, 0, -1).Format(layout))
+	ew, err := startExport(w, name, format, "Report")
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = reports.Write(ew, report)
+	if err == nil {
+		err = ew.Close()
+	}
+	if err != nil {
+		m.App.ErrorLog.Println("exporting report:", err)
+	}
+}
+
+// guestsPageSize is how many guests a search shows
+const guestsPageSize = 100
+
+// AdminGuests lists guests, best customers first, or those matching a search
+func (m *Repository) AdminGuests(w http.ResponseWriter, r *http.Request) {
+	list, err := m.DB.SearchGuests(r.URL.Query().Get("q"), guestsPageSize)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["guests"] = list
+	render.Template(w, r, "admin-guests.page.tmpl", &models.TemplateData{
+		Form: forms.New(r.URL.Query()),
+		Data: data,
+	})
+}
+
+// AdminShowGuest shows a guest's profile: their stays, what they have spent, notes, tags and
+// guests who may be the same person
+func (m *Repository) AdminShowGuest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	guest, err := m.DB.GetGuestByID(id)
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderGuest(w, r, guest, forms.New(nil))
+}
+
+// AdminPostGuest saves a guest's details, notes and tags
+func (m *Repository) AdminPostGuest(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	guest, err := m.DB.GetGuestByID(id)
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	guest.FirstName = strings.TrimSpace(r.Form.Get("first_name"))
+	guest.LastName = strings.TrimSpace(r.Form.Get("last_name"))
+	guest.Email = strings.TrimSpace(r.Form.Get("email"))
+	guest.Phone = strings.TrimSpace(r.Form.Get("phone"))
+	guest.Notes = strings.TrimSpace(r.Form.Get("notes"))
+	guest.Tags = guests.ParseTags(r.Form.Get("tags"))
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name")
+	if form.Has("email") {
+		form.IsEmail("email")
+	}
+	if !form.Valid() {
+		m.renderGuest(w, r, guest, form)
+		return
+	}
+
+	err = m.actingDB(r).UpdateGuest(guest)
+	if err == repository.ErrDuplicateGuest {
+		form.Errors.Add("email", "Another guest has this email address. Merge the two guests instead.")
+		m.renderGuest(w, r, guest, form)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Guest saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/guests/%d", id), http.StatusSeeOther)
+}
+
+// AdminMergeGuest merges the guest posted as merge_id into the guest being shown, for when the same
+// person has booked under different details
+func (m *Repository) AdminMergeGuest(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+	back := fmt.Sprintf("/admin/guests/%d", id)
+
+	mergeID, err := strconv.Atoi(r.Form.Get("merge_id"))
+	if err != nil || mergeID == id {
+		m.App.Session.Put(r.Context(), "error", "Choose another guest to merge")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	err = m.actingDB(r).MergeGuests(id, mergeID)
+	if err == sql.ErrNoRows {
+		m.App.Session.Put(r.Context(), "error", "That guest no longer exists")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Guests merged")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// renderGuest renders a guest's profile page
+func (m *Repository) renderGuest(w http.ResponseWriter, r *http.Request, guest models.Guest, form *forms.Form) {
+	reservations, err := m.DB.GuestReservations(guest.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	duplicates, err := m.DB.PossibleDuplicateGuests(guest)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	history, err := m.DB.AuditEntries(models.AuditFilter{Entity: audit.EntityGuest, EntityID: guest.ID, Limit: auditPageSize})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["tags"] = strings.Join(guest.Tags, ", ")
+
+	data := make(map[string]interface{})
+	data["guest"] = guest
+	data["reservations"] = reservations
+	data["duplicates"] = duplicates
+	data["history"] = history
+	render.Template(w, r, "admin-guest.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      form,
+	})
+}
+
+// maxNoteLength is the longest staff note, in characters
+const maxNoteLength = 5000
+
+// AdminPostReservationNote adds a staff note to a reservation, or a reply to one when parent_id is
+// posted. Notes are written by the logged in user.
+func (m *Repository) AdminPostReservationNote(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+	back := fmt.Sprintf("/admin/reservations/%s/%d#notes", chi.URLParam(r, "src"), id)
+
+	body := strings.TrimSpace(r.Form.Get("body"))
+	if body == "" || utf8.RuneCountInString(body) > maxNoteLength {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("A note must have between 1 and %d characters", maxNoteLength))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	parentID, _ := strconv.Atoi(r.Form.Get("parent_id"))
+	_, err = m.actingDB(r).InsertReservationNote(models.ReservationNote{
+		ReservationID: id,
+		ParentID:      parentID,
+		UserID:        m.App.Session.GetInt(r.Context(), "user_id"),
+		Body:          body,
+		Important:     r.Form.Get("important") == "1",
+	})
+	if err == sql.ErrNoRows {
+		m.App.Session.Put(r.Context(), "error", "The note you replied to no longer exists")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Note added")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// AdminReservationNoteImportant flags a note on a reservation as important, or unflags it when
+// important is not posted as 1
+func (m *Repository) AdminReservationNoteImportant(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+	noteID, err := strconv.Atoi(chi.URLParam(r, "noteID"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+	back := fmt.Sprintf("/admin/reservations/%s/%d#notes", chi.URLParam(r, "src"), id)
+
+	err = m.actingDB(r).SetReservationNoteImportant(noteID, id, r.Form.Get("important") == "1")
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// AdminCustomFields lists the custom fields of the booking form
+func (m *Repository) AdminCustomFields(w http.ResponseWriter, r *http.Request) {
+	fields, err := m.DB.AllCustomFields()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["custom_fields"] = fields
+	render.Template(w, r, "admin-custom-fields.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowCustomField shows the form for adding (id 0) or editing a custom field of the booking form
+func (m *Repository) AdminShowCustomField(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	field := models.CustomField{
+		Type:   models.FieldText,
+		Active: true,
+	}
+	if id > 0 {
+		field, err = m.DB.GetCustomFieldByID(id)
+		if err == sql.ErrNoRows {
+			helpers.ClientError(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	m.renderCustomFieldForm(w, r, field, forms.New(nil))
+}
+
+// AdminPostCustomField saves a custom field of the booking form
+func (m *Repository) AdminPostCustomField(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.IsInt("max_length")
+	form.IsInt("sort_order")
+
+	field := models.CustomField{
+		ID:        id,
+		Name:      form.Trimmed("name"),
+		Label:     form.Trimmed("label"),
+		Type:      form.Get("type"),
+		Required:  form.Bool("required"),
+		Options:   customfields.ParseOptions(form.Get("options")),
+		Pattern:   form.Trimmed("pattern"),
+		MaxLength: form.Int("max_length"),
+		SortOrder: form.Int("sort_order"),
+		Active:    form.Bool("active"),
+	}
+
+	customfields.CheckDefinition(form, field)
+
+	fields, err := m.DB.AllCustomFields()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	for _, f := range fields {
+		if f.Name == field.Name && f.ID != field.ID {
+			form.Errors.Add("name", "Another field has this name")
+		}
+	}
+
+	if !form.Valid() {
+		m.renderCustomFieldForm(w, r, field, form)
+		return
+	}
+
+	if field.ID == 0 {
+		_, err = m.actingDB(r).InsertCustomField(field)
+	} else {
+		err = m.actingDB(r).UpdateCustomField(field)
+	}
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Field saved")
+	http.Redirect(w, r, "/admin/custom-fields", http.StatusSeeOther)
+}
+
+// AdminDeleteCustomField deletes a custom field of the booking form. Answers already given are kept.
+func (m *Repository) AdminDeleteCustomField(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	err := m.actingDB(r).DeleteCustomField(id)
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.App.Session.Put(r.Context(), "flash", "Field deleted")
+	http.Redirect(w, r, "/admin/custom-fields", http.StatusSeeOther)
+}
+
+// renderCustomFieldForm renders the custom field edit page
+func (m *Repository) renderCustomFieldForm(w http.ResponseWriter, r *http.Request, field models.CustomField, form *forms.Form) {
+	stringMap := make(map[string]string)
+	stringMap["options"] = strings.Join(field.Options, "\n")
+
+	data := make(map[string]interface{})
+	data["custom_field"] = field
+	data["types"] = models.CustomFieldTypes
+
+	render.Template(w, r, "admin-custom-field-show.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      form,
+	})
+}
+
+// AdminTaxRules lists the taxes and fees added to stays
+func (m *Repository) AdminTaxRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := m.DB.AllTaxRules()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["tax_rules"] = rules
+	render.Template(w, r, "admin-tax-rules.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowTaxRule shows the form for adding (id 0) or editing a tax or fee
+func (m *Repository) AdminShowTaxRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	rule := models.TaxRule{
+		Type:   models.TaxPercent,
+		Active: true,
+	}
+	if id > 0 {
+		rule, err = m.DB.GetTaxRuleByID(id)
+		if err == sql.ErrNoRows {
+			helpers.ClientError(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	m.renderTaxRuleForm(w, r, rule, forms.New(nil))
+}
+
+// AdminPostTaxRule saves a tax or fee. Reservations already made keep the charges they were quoted.
+func (m *Repository) AdminPostTaxRule(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "type", "amount")
+	form.MaxLength("name", 255)
+	form.OneOf("type", models.TaxPercent, models.TaxFixed)
+	form.IsDate("valid_from")
+	form.IsDate("valid_to")
+
+	rule := models.TaxRule{
+		ID:        id,
+		Name:      form.Trimmed("name"),
+		Type:      form.Get("type"),
+		PerNight:  form.Bool("per_night"),
+		PerGuest:  form.Bool("per_guest"),
+		ValidFrom: form.Date("valid_from"),
+		ValidTo:   form.Date("valid_to"),
+		Active:    form.Bool("active"),
+	}
+	for _, v := range r.Form["room_ids"] {
+		roomID, err := strconv.Atoi(v)
+		if err == nil {
+			rule.RoomIDs = append(rule.RoomIDs, roomID)
+		}
+	}
+
+	// percentages are entered as such, with up to two decimals, and fixed amounts in cents
+	if rule.Type == models.TaxPercent {
+		percent, err := strconv.ParseFloat(form.Trimmed("amount"), 64)
+		if form.Has("amount") && (err != nil || percent <= 0 || percent > 100) {
+			form.Errors.Add("amount", "Enter a percentage between 0 and 100, such as 13.5")
+		}
+		rule.Amount = int(math.Round(percent * 100))
+		// a per night or per guest percentage would be charged more than once on the same room charge
+		rule.PerNight, rule.PerGuest = false, false
+	} else {
+		form.IntRange("amount", 1, math.MaxInt32)
+		rule.Amount = form.Int("amount")
+	}
+
+	if !rule.ValidFrom.IsZero() && !rule.ValidTo.IsZero() && rule.ValidTo.Before(rule.ValidFrom) {
+		form.Errors.Add("valid_to", "End of validity must not be before its start")
+	}
+
+	if !form.Valid() {
+		m.renderTaxRuleForm(w, r, rule, form)
+		return
+	}
+
+	if rule.ID == 0 {
+		_, err = m.actingDB(r).InsertTaxRule(rule)
+	} else {
+		err = m.actingDB(r).UpdateTaxRule(rule)
+	}
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Tax or fee saved")
+	http.Redirect(w, r, "/admin/tax-rules", http.StatusSeeOther)
+}
+
+// AdminDeleteTaxRule deletes a tax or fee. Reservations already made keep the charges they were quoted.
+func (m *Repository) AdminDeleteTaxRule(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	err := m.actingDB(r).DeleteTaxRule(id)
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.App.Session.Put(r.Context(), "flash", "Tax or fee deleted")
+	http.Redirect(w, r, "/admin/tax-rules", http.StatusSeeOther)
+}
+
+// renderTaxRuleForm renders the tax or fee edit page
+func (m *Repository) renderTaxRuleForm(w http.ResponseWriter, r *http.Request, rule models.TaxRule, form *forms.Form) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	selected := make(map[int]bool)
+	for _, id := range rule.RoomIDs {
+		selected[id] = true
+	}
+
+	// a rejected amount is shown as it was typed
+	stringMap := make(map[string]string)
+	switch {
+	case form.Has("amount"):
+		stringMap["amount"] = form.Trimmed("amount")
+	case rule.Amount == 0:
+	case rule.Type == models.TaxPercent:
+		stringMap["amount"] = rule.Percent()
+	default:
+		stringMap["amount"] = strconv.Itoa(rule.Amount)
+	}
+
+	data := make(map[string]interface{})
+	data["tax_rule"] = rule
+	data["rooms"] = rooms
+	data["selected_rooms"] = selected
+
+	render.Template(w, r, "admin-tax-rule-show.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      form,
+	})
+}
+
+// AdminCancellationPolicies lists the cancellation policies rooms are booked under
+func (m *Repository) AdminCancellationPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := m.DB.AllCancellationPolicies()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	roomNames := make(map[int]string)
+	for _, rm := range rooms {
+		roomNames[rm.ID] = rm.RoomName
+	}
+
+	data := make(map[string]interface{})
+	data["cancellation_policies"] = policies
+	data["room_names"] = roomNames
+	render.Template(w, r, "admin-cancellation-policies.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowCancellationPolicy shows the form for adding (id 0) or editing a cancellation policy
+func (m *Repository) AdminShowCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var policy models.CancellationPolicy
+	if id > 0 {
+		policy, err = m.DB.GetCancellationPolicyByID(id)
+		if err == sql.ErrNoRows {
+			helpers.ClientError(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	m.renderCancellationPolicyForm(w, r, policy, forms.New(url.Values{"tiers": {cancellations.FormatTiers(policy.Tiers)}}))
+}
+
+// AdminPostCancellationPolicy saves a cancellation policy and the rooms it is for. Reservations
+// already made keep the policy they were booked under.
+func (m *Repository) AdminPostCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "tiers")
+	form.MaxLength("name", 255)
+
+	policy := models.CancellationPolicy{
+		ID:          id,
+		Name:        form.Trimmed("name"),
+		Description: form.Trimmed("description"),
+	}
+	for _, v := range r.Form["room_ids"] {
+		roomID, err := strconv.Atoi(v)
+		if err == nil {
+			policy.RoomIDs = append(policy.RoomIDs, roomID)
+		}
+	}
+
+	if form.Has("tiers") {
+		policy.Tiers, err = cancellations.ParseTiers(form.Get("tiers"))
+		if err != nil {
+			form.Errors.Add("tiers", err.Error())
+		}
+	}
+
+	policies, err := m.DB.AllCancellationPolicies()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	for _, p := range policies {
+		if strings.EqualFold(p.Name, policy.Name) && p.ID != policy.ID {
+			form.Errors.Add("name", "Another policy has this name")
+		}
+	}
+
+	if !form.Valid() {
+		m.renderCancellationPolicyForm(w, r, policy, form)
+		return
+	}
+
+	if policy.ID == 0 {
+		_, err = m.actingDB(r).InsertCancellationPolicy(policy)
+	} else {
+		err = m.actingDB(r).UpdateCancellationPolicy(policy)
+	}
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Cancellation policy saved")
+	http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+}
+
+// AdminDeleteCancellationPolicy deletes a cancellation policy, leaving its rooms without one.
+// Reservations already made keep the policy they were booked under.
+func (m *Repository) AdminDeleteCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	err := m.actingDB(r).DeleteCancellationPolicy(id)
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.App.Session.Put(r.Context(), "flash", "Cancellation policy deleted")
+	http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+}
+
+// renderCancellationPolicyForm renders the cancellation policy edit page. The tiers are shown as
+// they are in the form.
+func (m *Repository) renderCancellationPolicyForm(w http.ResponseWriter, r *http.Request, policy models.CancellationPolicy, form *forms.Form) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	selected := make(map[int]bool)
+	for _, id := range policy.RoomIDs {
+		selected[id] = true
+	}
+
+	data := make(map[string]interface{})
+	data["cancellation_policy"] = policy
+	data["rooms"] = rooms
+	data["selected_rooms"] = selected
+
+	render.Template(w, r, "admin-cancellation-policy-show.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// AdminProperties lists the properties and the rooms and staff of each
+func (m *Repository) AdminProperties(w http.ResponseWriter, r *http.Request) {
+	properties, err := m.DB.AllProperties()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	roomNames := make(map[int]string)
+	for _, rm := range rooms {
+		roomNames[rm.ID] = rm.RoomName
+	}
+
+	users, err := m.DB.AllUsers()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	userNames := make(map[int]string)
+	for _, u := range users {
+		userNames[u.ID] = u.FirstName + " " + u.LastName
+	}
+
+	data := make(map[string]interface{})
+	data["properties"] = properties
+	data["room_names"] = roomNames
+	data["user_names"] = userNames
+	render.Template(w, r, "admin-properties.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowProperty shows the form for adding (id 0) or editing a property
+func (m *Repository) AdminShowProperty(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	property := models.Property{TimeZone: "UTC", Currency: m.App.Currency}
+	if id > 0 {
+		property, err = m.DB.GetPropertyByID(id)
+		if err == sql.ErrNoRows {
+			helpers.ClientError(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	m.renderPropertyForm(w, r, property, forms.New(nil))
+}
+
+// AdminPostProperty saves a property, the rooms moved into it and the staff who manage it
+func (m *Repository) AdminPostProperty(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var before models.Property
+	if id > 0 {
+		before, err = m.DB.GetPropertyByID(id)
+		if err == sql.ErrNoRows {
+			helpers.ClientError(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "email", "time_zone", "currency")
+	form.MaxLength("name", 255)
+	form.IsEmail("email")
+
+	property := models.Property{
+		ID:       id,
+		Name:     form.Trimmed("name"),
+		Email:    form.Trimmed("email"),
+		Address:  form.Trimmed("address"),
+		TimeZone: form.Trimmed("time_zone"),
+		Currency: strings.ToUpper(form.Trimmed("currency")),
+	}
+	property.CancellationPolicyID, _ = strconv.Atoi(form.Get("cancellation_policy_id"))
+	for _, v := range r.Form["room_ids"] {
+		roomID, err := strconv.Atoi(v)
+		if err == nil {
+			property.RoomIDs = append(property.RoomIDs, roomID)
+		}
+	}
+	for _, v := range r.Form["user_ids"] {
+		userID, err := strconv.Atoi(v)
+		if err == nil {
+			property.UserIDs = append(property.UserIDs, userID)
+		}
+	}
+
+	if _, err := time.LoadLocation(property.TimeZone); form.Has("time_zone") && err != nil {
+		form.Errors.Add("time_zone", "Unknown time zone, use a name such as America/Halifax")
+	}
+	if form.Has("currency") && !m.App.Rates.Has(property.Currency) {
+		form.Errors.Add("currency", "Prices can't be shown in this currency, add an exchange rate for it first")
+	}
+	if property.CancellationPolicyID > 0 {
+		_, err = m.DB.GetCancellationPolicyByID(property.CancellationPolicyID)
+		if err == sql.ErrNoRows {
+			form.Errors.Add("cancellation_policy_id", "Unknown cancellation policy")
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	// every room is in a property, so rooms leave one only by being moved into another
+	kept := make(map[int]bool)
+	for _, roomID := range property.RoomIDs {
+		kept[roomID] = true
+	}
+	for _, roomID := range before.RoomIDs {
+		if !kept[roomID] {
+			form.Errors.Add("room_ids", "Rooms can't be left without a property, move them to another one instead")
+			break
+		}
+	}
+
+	properties, err := m.DB.AllProperties()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	for _, p := range properties {
+		if strings.EqualFold(p.Name, property.Name) && p.ID != property.ID {
+			form.Errors.Add("name", "Another property has this name")
+		}
+	}
+
+	if !form.Valid() {
+		m.renderPropertyForm(w, r, property, form)
+		return
+	}
+
+	if property.ID == 0 {
+		_, err = m.actingDB(r).InsertProperty(property)
+	} else {
+		err = m.actingDB(r).UpdateProperty(property)
+	}
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Property saved")
+	http.Redirect(w, r, "/admin/properties", http.StatusSeeOther)
+}
+
+// AdminDeleteProperty deletes a property once its rooms have been moved to other ones
+func (m *Repository) AdminDeleteProperty(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	property, err := m.DB.GetPropertyByID(id)
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if len(property.RoomIDs) > 0 {
+		m.App.Session.Put(r.Context(), "error", "Move the rooms of this property to another one before deleting it")
+		http.Redirect(w, r, fmt.Sprintf("/admin/properties/%d", id), http.StatusSeeOther)
+		return
+	}
+
+	err = m.actingDB(r).DeleteProperty(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.App.Session.Put(r.Context(), "flash", "Property deleted")
+	http.Redirect(w, r, "/admin/properties", http.StatusSeeOther)
+}
+
+// renderPropertyForm renders the property edit page
+func (m *Repository) renderPropertyForm(w http.ResponseWriter, r *http.Request, property models.Property, form *forms.Form) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	users, err := m.DB.AllUsers()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	policies, err := m.DB.AllCancellationPolicies()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	selectedRooms := make(map[int]bool)
+	for _, id := range property.RoomIDs {
+		selectedRooms[id] = true
+	}
+	selectedUsers := make(map[int]bool)
+	for _, id := range property.UserIDs {
+		selectedUsers[id] = true
+	}
+
+	data := make(map[string]interface{})
+	data["property"] = property
+	data["rooms"] = rooms
+	data["users"] = users
+	data["cancellation_policies"] = policies
+	data["selected_rooms"] = selectedRooms
+	data["selected_users"] = selectedUsers
+	data["currencies"] = m.App.Rates.Currencies()
+
+	render.Template(w, r, "admin-property-show.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// LoadExchangeRates reads the exchange rates into the app config, where the pages showing prices
+// in other currencies find them
+func (m *Repository) LoadExchangeRates() error {
+	rates, err := m.DB.AllExchangeRates()
+	if err != nil {
+		return err
+	}
+
+	byCurrency := make(map[string]float64)
+	for _, e := range rates {
+		byCurrency[e.Currency] = e.Rate
+	}
+	m.App.Rates.Set(byCurrency)
+	return nil
+}
+
+// AdminExchangeRates lists the exchange rates guests can see prices at
+func (m *Repository) AdminExchangeRates(w http.ResponseWriter, r *http.Request) {
+	m.renderExchangeRates(w, r, forms.New(nil))
+}
+
+// AdminPostExchangeRate adds or updates the exchange rate of one currency
+func (m *Repository) AdminPostExchangeRate(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("currency", "rate")
+
+	currency := strings.ToUpper(form.Trimmed("currency"))
+	if form.Has("currency") && !money.IsCurrencyCode(currency) {
+		form.Errors.Add("currency", "Enter a three letter currency code, such as EUR")
+	} else if currency == m.App.Rates.Base() {
+		form.Errors.Add("currency", "Rates are kept against this currency")
+	}
+	rate, err := money.ParseRate(form.Get("rate"))
+	if form.Has("rate") && err != nil {
+		form.Errors.Add("rate", "The rate must be a positive number")
+	}
+
+	if !form.Valid() {
+		m.renderExchangeRates(w, r, form)
+		return
+	}
+
+	m.saveExchangeRates(w, r, map[string]float64{currency: rate}, "Exchange rate saved")
+}
+
+// AdminImportExchangeRates updates exchange rates from an uploaded CSV file with a currency code
+// and a rate on each line. Currencies not in the file keep their rate and a rate for the base
+// currency is ignored, as it is always 1.
+func (m *Repository) AdminImportExchangeRates(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	err := r.ParseMultipartForm(maxImportSize)
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		form.Errors.Add("file", "Choose a CSV file")
+		m.renderExchangeRates(w, r, form)
+		return
+	}
+	defer file.Close()
+
+	rates, err := money.ReadRatesCSV(file)
+	if err != nil {
+		form.Errors.Add("file", err.Error())
+		m.renderExchangeRates(w, r, form)
+		return
+	}
+	delete(rates, m.App.Rates.Base())
+
+	m.saveExchangeRates(w, r, rates, fmt.Sprintf("%d exchange rates saved", len(rates)))
+}
+
+// AdminDeleteExchangeRate stops showing prices in a currency. The rate of a currency a property
+// charges in is kept, since its prices couldn't be shown in the currency of the site.
+func (m *Repository) AdminDeleteExchangeRate(w http.ResponseWriter, r *http.Request) {
+	currency := chi.URLParam(r, "currency")
+	properties, err := m.DB.AllProperties()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	for _, p := range properties {
+		if strings.EqualFold(p.Currency, currency) {
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf("%s charges in %s, change its currency before deleting this rate", p.Name, p.Currency))
+			http.Redirect(w, r, "/admin/exchange-rates", http.StatusSeeOther)
+			return
+		}
+	}
+
+	err = m.actingDB(r).DeleteExchangeRate(currency)
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if err = m.LoadExchangeRates(); err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.App.Session.Put(r.Context(), "flash", "Exchange rate deleted")
+	http.Redirect(w, r, "/admin/exchange-rates", http.StatusSeeOther)
+}
+
+// saveExchangeRates saves rates, reloads the rates pages are shown with and redirects back to
+// the list with flash
+func (m *Repository) saveExchangeRates(w http.ResponseWriter, r *http.Request, rates map[string]float64, flash string) {
+	var list []models.ExchangeRate
+	for currency, rate := range rates {
+		list = append(list, models.ExchangeRate{Currency: currency, Rate: rate})
+	}
+
+	err := m.actingDB(r).SaveExchangeRates(list)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if err = m.LoadExchangeRates(); err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, "/admin/exchange-rates", http.StatusSeeOther)
+}
+
+// renderExchangeRates renders the exchange rate list with its forms
+func (m *Repository) renderExchangeRates(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	rates, err := m.DB.AllExchangeRates()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["base_currency"] = m.App.Rates.Base()
+
+	data := make(map[string]interface{})
+	data["exchange_rates"] = rates
+
+	render.Template(w, r, "admin-exchange-rates.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      form,
+	})
+}
@@ -1,15 +1,27 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
 
 	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/money"
+	"github.com/tsawler/bookings-app/internal/payments"
+	"github.com/tsawler/bookings-app/internal/repository"
 )
 
 type postData struct {
@@ -86,6 +98,9 @@ func TestRepository_Reservation(t *testing.T) {
 	if rr.Code != http.StatusOK {
 		t.Errorf("Rerservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
 	}
+	if !strings.Contains(rr.Body.String(), "Cancellation policy: Moderate") {
+		t.Error("Reservation handler doesn't show the cancellation policy of the room")
+	}
 
 	// test case where reservation is not in session (reset everything)
 	req, _ = http.NewRequest("GET", "/make-reservation",nil)
@@ -146,6 +161,75 @@ func TestRepository_ReservationSummary(t *testing.T) {
 	}
 }
 
+func TestRepository_ReservationSummaryCurrency(t *testing.T) {
+	reservation := models.Reservation{
+		RoomID:      1,
+		Room:        models.Room{ID: 1, RoomName: "General's Quarters"},
+		StartDate:   time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		NightlyRate: 10000,
+	}
+
+	var tests = []struct {
+		currency string
+		expected []string
+	}{
+		{"USD", []string{"$200.00"}},
+		{"EUR", []string{"€180.00", "Charged as $200.00"}},
+		{"JPY", []string{"¥30,000", "Charged as $200.00"}},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/reservation-summary", nil)
+		ctx := getCtx(req)
+		req = req.WithContext(money.WithCurrency(ctx, e.currency))
+		rr := httptest.NewRecorder()
+		session.Put(ctx, "reservation", reservation)
+
+		handler := http.HandlerFunc(Repo.ReservationSummary)
+		handler.ServeHTTP(rr, req)
+
+		for _, text := range e.expected {
+			if !strings.Contains(rr.Body.String(), text) {
+				t.Errorf("reservation summary in %s doesn't show %q", e.currency, text)
+			}
+		}
+		if e.currency == "USD" && strings.Contains(rr.Body.String(), "Charged as") {
+			t.Error("reservation summary in the base currency shows what is charged twice")
+		}
+	}
+}
+
+func TestRepository_ReservationSummaryCharges(t *testing.T) {
+	reservation := models.Reservation{
+		RoomID:      1,
+		Room:        models.Room{ID: 1, RoomName: "General's Quarters"},
+		StartDate:   time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		NightlyRate: 10000,
+		Guests:      2,
+		Charges: []models.Charge{
+			{TaxRuleID: 1, Description: "Lodging tax", Amount: 2000},
+			{TaxRuleID: 2, Description: "Tourism fee", Amount: 800},
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "/reservation-summary", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+	session.Put(ctx, "reservation", reservation)
+
+	handler := http.HandlerFunc(Repo.ReservationSummary)
+	handler.ServeHTTP(rr, req)
+
+	for _, text := range []string{"Lodging tax", "$20.00", "Tourism fee", "$8.00", "$228.00"} {
+		if !strings.Contains(rr.Body.String(), text) {
+			t.Errorf("reservation summary doesn't show %q", text)
+		}
+	}
+}
+
 func TestRepository_ChooseRoom(t *testing.T) {
 	reservation := models.Reservation{
 		RoomID: 1,
@@ -197,6 +281,48 @@ func TestRepository_ChooseRoom(t *testing.T) {
 	}
 }
 
+func TestRepository_ChooseRoom_Hold(t *testing.T) {
+	reservation := models.Reservation{
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+
+	// test case where the room was taken by someone else's hold
+	req, _ := http.NewRequest("GET", "/choose-room/3", nil)
+	req.RequestURI = "/choose-room/3"
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	session.Put(ctx, "reservation", reservation)
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.ChooseRoom)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("ChooseRoom handler returned wrong response code for unavailable room: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if loc := rr.Header().Get("Location"); loc != "/search-availability" {
+		t.Errorf("ChooseRoom handler redirected to wrong location for unavailable room: got %s", loc)
+	}
+
+	// test case where a hold is placed in the session
+	req, _ = http.NewRequest("GET", "/choose-room/1", nil)
+	req.RequestURI = "/choose-room/1"
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	session.Put(ctx, "reservation", reservation)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	hold, ok := session.Get(ctx, "hold").(models.RoomRestriction)
+	if !ok {
+		t.Fatal("ChooseRoom handler did not put a hold in the session")
+	}
+	if hold.RoomID != 1 || !hold.ExpiresAt.After(time.Now()) {
+		t.Errorf("ChooseRoom handler put wrong hold in the session: %+v", hold)
+	}
+}
+
 func TestRepository_BookRoom(t *testing.T) {
 	// test case where room is not found in database
 	req, _ := http.NewRequest("GET", "/book-room?id=123&s=2050-01-01&e=2050-01-03", nil)
@@ -221,6 +347,24 @@ func TestRepository_BookRoom(t *testing.T) {
 	if rr.Code != http.StatusSeeOther {
 		t.Errorf("BookRoom handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
 	}
+
+	// test cases for a bad room id or dates, which send the guest back to search
+	for _, query := range []string{
+		"id=one&s=2050-01-01&e=2050-01-03",
+		"id=1&s=2050-01-01",
+		"id=1&s=01/01/2050&e=2050-01-03",
+		"id=1&s=2050-01-03&e=2050-01-01",
+	} {
+		req, _ = http.NewRequest("GET", "/book-room?"+query, nil)
+		ctx = getCtx(req)
+		req = req.WithContext(ctx)
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/search-availability" {
+			t.Errorf("BookRoom handler for %s returned %d to %q, wanted %d to /search-availability", query, rr.Code, rr.Header().Get("Location"), http.StatusSeeOther)
+		}
+	}
 }
 
 func TestRepository_PostReservation(t *testing.T) {
@@ -347,6 +491,28 @@ func TestRepository_PostReservation(t *testing.T) {
 		t.Errorf("PostRerservation handler returned wrong response code for invalid data: got %d, wanted %d", rr.Code, http.StatusSeeOther)
 	}
 
+	// test for invalid phone number
+	reqBody = "start_date=2050-01-01"
+	reqBody = fmt.Sprintf("%s&%s",reqBody, "end_date=2050-01-02")
+	reqBody = fmt.Sprintf("%s&%s",reqBody, "first_name=John")
+	reqBody = fmt.Sprintf("%s&%s",reqBody, "last_name=Smith")
+	reqBody = fmt.Sprintf("%s&%s",reqBody, "email=john@smith.com")
+	reqBody = fmt.Sprintf("%s&%s",reqBody, "phone=call+me")
+	reqBody = fmt.Sprintf("%s&%s",reqBody, "room_id=1")
+
+	req, _ = http.NewRequest("POST", "/make-reservation",strings.NewReader(reqBody))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	handler = http.HandlerFunc(Repo.PostReservation)
+	handler.ServeHTTP(rr,req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("PostRerservation handler returned wrong response code for invalid phone: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
 	// test for failure to insert reservation into database
 	reqBody = "start_date=2050-01-01"
 	reqBody = fmt.Sprintf("%s&%s",reqBody, "end_date=2050-01-02")
@@ -369,7 +535,7 @@ func TestRepository_PostReservation(t *testing.T) {
 		t.Errorf("PostRerservation handler failed when trying to insert reservation: got %d, wanted %d", rr.Code, http.StatusTemporaryRedirect)
 	}
 
-	// test for failure to insert room restriction into database
+	// test for a room taken by someone else since the form was shown
 	reqBody = "start_date=2050-01-01"
 	reqBody = fmt.Sprintf("%s&%s",reqBody, "end_date=2050-01-02")
 	reqBody = fmt.Sprintf("%s&%s",reqBody, "first_name=John")
@@ -387,8 +553,287 @@ func TestRepository_PostReservation(t *testing.T) {
 	handler = http.HandlerFunc(Repo.PostReservation)
 	handler.ServeHTTP(rr,req)
 
-	if rr.Code != http.StatusTemporaryRedirect {
-		t.Errorf("PostRerservation handler failed when trying to insert room restriction: got %d, wanted %d", rr.Code, http.StatusTemporaryRedirect)
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("PostRerservation handler returned wrong response code for a taken room: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if loc := rr.Header().Get("Location"); loc != "/search-availability" {
+		t.Errorf("PostRerservation handler redirected to wrong location for a taken room: got %s", loc)
+	}
+}
+
+// waitlistRepo remembers the waitlist entries marked booked through it
+type waitlistRepo struct {
+	repository.DatabaseRepo
+	booked []int
+}
+
+func (db *waitlistRepo) MarkWaitlistEntryBooked(id int) error {
+	db.booked = append(db.booked, id)
+	return nil
+}
+
+func TestRepository_PostReservation_WaitlistEntry(t *testing.T) {
+	db := &waitlistRepo{DatabaseRepo: Repo.DB}
+	repo := &Repository{App: Repo.App, DB: db}
+
+	form := url.Values{}
+	form.Add("start_date", "2050-01-01")
+	form.Add("end_date", "2050-01-02")
+	form.Add("first_name", "John")
+	form.Add("last_name", "Smith")
+	form.Add("email", "john@smith.com")
+	form.Add("phone", "123456789")
+	form.Add("room_id", "1")
+
+	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(form.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// the guest came from a waitlist offer, but their hold on the room is gone
+	session.Put(ctx, "waitlist_entry", 7)
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(repo.PostReservation).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("PostReservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if !reflect.DeepEqual(db.booked, []int{7}) {
+		t.Errorf("PostReservation handler marked waitlist entries %v booked, wanted [7]", db.booked)
+	}
+}
+
+func TestRepository_PostReservation_SpecialRequests(t *testing.T) {
+	var tests = []struct {
+		name            string
+		specialRequests string
+		expectedSaved   string
+	}{
+		{"saved", "  Late arrival, extra pillows ", "Late arrival, extra pillows"},
+		{"too-long", strings.Repeat("a", 1001), ""},
+	}
+
+	for _, e := range tests {
+		form := url.Values{}
+		form.Add("start_date", "2050-01-01")
+		form.Add("end_date", "2050-01-02")
+		form.Add("first_name", "John")
+		form.Add("last_name", "Smith")
+		form.Add("email", "john@smith.com")
+		form.Add("phone", "123456789")
+		form.Add("room_id", "1")
+		form.Add("special_requests", e.specialRequests)
+
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(form.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(rr, req)
+
+		res, _ := session.Get(ctx, "reservation").(models.Reservation)
+		if res.SpecialRequests != e.expectedSaved {
+			t.Errorf("PostReservation for %s saved special requests %q, wanted %q", e.name, res.SpecialRequests, e.expectedSaved)
+		}
+	}
+}
+
+func TestRepository_PostReservation_CustomFields(t *testing.T) {
+	var tests = []struct {
+		name          string
+		arrivalTime   string
+		diet          string
+		expectedSaved map[string]string
+	}{
+		{"answered", "18:30", "Vegetarian", map[string]string{"arrival_time": "18:30", "diet": "Vegetarian"}},
+		{"unanswered", "", "", map[string]string{}},
+		{"bad-time", "evening", "Vegetarian", nil},
+		{"bad-option", "18:30", "Paleo", nil},
+	}
+
+	for _, e := range tests {
+		form := url.Values{}
+		form.Add("start_date", "2050-01-01")
+		form.Add("end_date", "2050-01-02")
+		form.Add("first_name", "John")
+		form.Add("last_name", "Smith")
+		form.Add("email", "john@smith.com")
+		form.Add("phone", "123456789")
+		form.Add("room_id", "1")
+		form.Add("custom_arrival_time", e.arrivalTime)
+		form.Add("custom_diet", e.diet)
+
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(form.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(rr, req)
+
+		res, ok := session.Get(ctx, "reservation").(models.Reservation)
+		if e.expectedSaved == nil {
+			if ok {
+				t.Errorf("PostReservation for %s booked the room, wanted the form shown again", e.name)
+			}
+			if !strings.Contains(rr.Body.String(), "custom_arrival_time") {
+				t.Errorf("PostReservation for %s did not show the custom fields again", e.name)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(res.CustomFields, e.expectedSaved) {
+			t.Errorf("PostReservation for %s saved custom fields %v, wanted %v", e.name, res.CustomFields, e.expectedSaved)
+		}
+	}
+}
+
+func TestRepository_PostReservation_Hold(t *testing.T) {
+	reqBody := "start_date=2050-01-01"
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "end_date=2050-01-02")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "first_name=John")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "last_name=Smith")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "email=john@smith.com")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "phone=123456789")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "room_id=1")
+
+	hold := models.RoomRestriction{
+		ID:        1,
+		RoomID:    1,
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+
+	// test for converting a hold into the reservation
+	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	session.Put(ctx, "hold", hold)
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.PostReservation)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("PostRerservation handler returned wrong response code for held room: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if session.Exists(ctx, "hold") {
+		t.Error("PostRerservation handler did not clear the hold from the session")
+	}
+
+	// test for an expired hold
+	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	hold.ID = 2
+	session.Put(ctx, "hold", hold)
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if loc := rr.Header().Get("Location"); loc != "/search-availability" {
+		t.Errorf("PostRerservation handler redirected to wrong location for expired hold: got %s", loc)
+	}
+}
+
+func TestRepository_PostReservation_PromoCode(t *testing.T) {
+	var tests = []struct {
+		name             string
+		endDate          string
+		code             string
+		expectedLocation string
+	}{
+		{"valid", "2050-01-03", "SUMMER", "/reservation-summary"},
+		{"unknown", "2050-01-03", "WINTER", ""},
+		{"too-short", "2050-01-02", "SUMMER", ""},
+		{"used-up", "2050-01-03", "LASTONE", "/make-reservation"},
+	}
+
+	for _, e := range tests {
+		reqBody := "start_date=2050-01-01"
+		reqBody = fmt.Sprintf("%s&end_date=%s", reqBody, e.endDate)
+		reqBody = fmt.Sprintf("%s&%s", reqBody, "first_name=John")
+		reqBody = fmt.Sprintf("%s&%s", reqBody, "last_name=Smith")
+		reqBody = fmt.Sprintf("%s&%s", reqBody, "email=john@smith.com")
+		reqBody = fmt.Sprintf("%s&%s", reqBody, "room_id=1")
+		reqBody = fmt.Sprintf("%s&promo_code=%s", reqBody, e.code)
+
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(rr, req)
+
+		if loc := rr.Header().Get("Location"); loc != e.expectedLocation {
+			t.Errorf("PostRerservation handler with promo code %s: got location %q, wanted %q", e.name, loc, e.expectedLocation)
+		}
+
+		if e.name == "valid" {
+			res, _ := session.Get(ctx, "reservation").(models.Reservation)
+			if res.Discount != 2000 {
+				t.Errorf("PostRerservation handler applied wrong discount: got %d, wanted %d", res.Discount, 2000)
+			}
+		}
+		if e.name == "used-up" {
+			res, _ := session.Get(ctx, "reservation").(models.Reservation)
+			if res.Discount != 0 || res.PromoCodeID != 0 {
+				t.Errorf("PostRerservation handler kept the discount of a used up promo code: got %d", res.Discount)
+			}
+		}
+	}
+}
+
+func TestCheckPromoCode(t *testing.T) {
+	promo := models.PromoCode{
+		DiscountType:  models.PromoPercent,
+		Amount:        10,
+		ValidFrom:     time.Date(2050, 6, 1, 0, 0, 0, 0, time.UTC),
+		ValidTo:       time.Date(2050, 8, 31, 0, 0, 0, 0, time.UTC),
+		MinNights:     2,
+		UsageLimit:    5,
+		PerEmailLimit: 1,
+		Active:        true,
+		RoomIDs:       []int{1},
+	}
+	res := models.Reservation{
+		RoomID:    1,
+		StartDate: time.Date(2050, 7, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 7, 3, 0, 0, 0, 0, time.UTC),
+	}
+
+	var tests = []struct {
+		name      string
+		modify    func(p *models.PromoCode, r *models.Reservation)
+		uses      int
+		emailUses int
+		valid     bool
+	}{
+		{"valid", func(p *models.PromoCode, r *models.Reservation) {}, 0, 0, true},
+		{"inactive", func(p *models.PromoCode, r *models.Reservation) { p.Active = false }, 0, 0, false},
+		{"before-window", func(p *models.PromoCode, r *models.Reservation) { r.StartDate = p.ValidFrom.AddDate(0, 0, -1) }, 0, 0, false},
+		{"after-window", func(p *models.PromoCode, r *models.Reservation) { r.StartDate = p.ValidTo.AddDate(0, 0, 1) }, 0, 0, false},
+		{"wrong-room", func(p *models.PromoCode, r *models.Reservation) { r.RoomID = 2 }, 0, 0, false},
+		{"too-short", func(p *models.PromoCode, r *models.Reservation) { r.EndDate = r.StartDate.AddDate(0, 0, 1) }, 0, 0, false},
+		{"used-up", func(p *models.PromoCode, r *models.Reservation) {}, 5, 0, false},
+		{"used-by-email", func(p *models.PromoCode, r *models.Reservation) {}, 1, 1, false},
+		{"unlimited", func(p *models.PromoCode, r *models.Reservation) { p.UsageLimit = 0; p.PerEmailLimit = 0 }, 50, 50, true},
+	}
+
+	for _, e := range tests {
+		p, r := promo, res
+		e.modify(&p, &r)
+		msg := checkPromoCode(p, r, e.uses, e.emailUses)
+		if (msg == "") != e.valid {
+			t.Errorf("checkPromoCode for %s: got %q, wanted valid=%t", e.name, msg, e.valid)
+		}
 	}
 }
 
@@ -523,6 +968,2075 @@ func TestRepository_AvailabilityJSON(t *testing.T) {
 	}
 }
 
+func TestRepository_AvailabilityJSON_Bodies(t *testing.T) {
+	var tests = []struct {
+		name           string
+		contentType    string
+		body           string
+		expectedStatus int
+		expectedError  string
+	}{
+		{"json", "application/json", `{"start": "2050-01-01", "end": "2050-01-02", "room_id": 1}`, http.StatusOK, ""},
+		{"json-end-before-start", "application/json", `{"start": "2050-01-02", "end": "2050-01-01", "room_id": 1}`, http.StatusBadRequest, "end"},
+		{"form-bad-date", "application/x-www-form-urlencoded", "start=soon&end=2050-01-02", http.StatusBadRequest, "start"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/search-availability-json", strings.NewReader(e.body))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", e.contentType)
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AvailabilityJSON)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("AvailabilityJSON handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatus)
+		}
+
+		var resp jsonResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Errorf("AvailabilityJSON handler for %s returned invalid JSON: %s", e.name, err)
+		}
+		if e.expectedError != "" && len(resp.Errors[e.expectedError]) == 0 {
+			t.Errorf("AvailabilityJSON handler for %s returned errors %v, wanted one on %s", e.name, resp.Errors, e.expectedError)
+		}
+	}
+}
+
+func TestRepository_Waitlist(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/waitlist?s=2050-01-01&e=2050-01-02", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.Waitlist)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Waitlist handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+}
+
+func TestRepository_PostWaitlist(t *testing.T) {
+	var tests = []struct {
+		name               string
+		body               string
+		expectedStatusCode int
+	}{
+		{"valid", "start=2050-01-01&end=2050-01-03&room_id=1&first_name=John&last_name=Smith&email=john@smith.com", http.StatusSeeOther},
+		{"missing-email", "start=2050-01-01&end=2050-01-03&room_id=1&first_name=John&last_name=Smith", http.StatusOK},
+		{"dates-reversed", "start=2050-01-03&end=2050-01-01&room_id=1&first_name=John&last_name=Smith&email=john@smith.com", http.StatusOK},
+		{"insert-fails", "start=2050-01-01&end=2050-01-03&room_id=2&first_name=John&last_name=Smith&email=john@smith.com", http.StatusTemporaryRedirect},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/waitlist", strings.NewReader(e.body))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostWaitlist)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("PostWaitlist handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_WaitlistBook(t *testing.T) {
+	var tests = []struct {
+		name             string
+		token            string
+		expectedLocation string
+	}{
+		{"valid", "valid", "/make-reservation"},
+		{"expired", "expired", "/search-availability"},
+		{"unknown", "unknown", "/search-availability"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/waitlist/book/"+e.token, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("token", e.token)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.WaitlistBook)
+		handler.ServeHTTP(rr, req)
+
+		if loc := rr.Header().Get("Location"); loc != e.expectedLocation {
+			t.Errorf("WaitlistBook handler for %s redirected to wrong location: got %s, wanted %s", e.name, loc, e.expectedLocation)
+		}
+		if e.name == "valid" && session.GetInt(ctx, "waitlist_entry") != 1 {
+			t.Error("WaitlistBook handler did not remember the entry whose link was used")
+		}
+	}
+}
+
+func TestRepository_OfferExpiredWaitlistDates(t *testing.T) {
+	n, err := Repo.OfferExpiredWaitlistDates()
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 1 {
+		t.Errorf("OfferExpiredWaitlistDates moved past %d expired offers, wanted 1", n)
+	}
+}
+
+func TestRepository_AdminShowPromoCode(t *testing.T) {
+	for _, id := range []string{"0", "1"} {
+		req, _ := http.NewRequest("GET", "/admin/promo-codes/"+id, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminShowPromoCode)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("AdminShowPromoCode handler for id %s returned wrong response code: got %d, wanted %d", id, rr.Code, http.StatusOK)
+		}
+	}
+}
+
+func TestRepository_AdminPostPromoCode(t *testing.T) {
+	var tests = []struct {
+		name               string
+		body               string
+		expectedStatusCode int
+	}{
+		{"valid", "code=summer&discount_type=percent&amount=10&valid_from=2050-06-01&valid_to=2050-08-31&min_nights=2&room_ids=1&active=1", http.StatusSeeOther},
+		{"percent-too-high", "code=summer&discount_type=percent&amount=150&valid_from=2050-06-01&valid_to=2050-08-31&min_nights=2", http.StatusOK},
+		{"window-reversed", "code=summer&discount_type=fixed&amount=1000&valid_from=2050-08-31&valid_to=2050-06-01&min_nights=1", http.StatusOK},
+		{"missing-code", "discount_type=fixed&amount=1000&valid_from=2050-06-01&valid_to=2050-08-31&min_nights=1", http.StatusOK},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/promo-codes/0", strings.NewReader(e.body))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "0")
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostPromoCode)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminPostPromoCode handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminDeletePromoCode(t *testing.T) {
+	var tests = []struct {
+		id               string
+		expectedLocation string
+	}{
+		{"1", "/admin/promo-codes"},
+		{"2", "/admin/promo-codes/2"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/delete-promo-code/"+e.id, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminDeletePromoCode)
+		handler.ServeHTTP(rr, req)
+
+		if loc := rr.Header().Get("Location"); loc != e.expectedLocation {
+			t.Errorf("AdminDeletePromoCode handler for id %s redirected to %q, wanted %q", e.id, loc, e.expectedLocation)
+		}
+	}
+}
+
+func TestRepository_AdminShowReservation(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/reservations/all/1", nil)
+	req.RequestURI = "/admin/reservations/all/1"
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminShowReservation)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminShowReservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	// reservation 4 is at a property that charges in euros
+	req, _ = http.NewRequest("GET", "/admin/reservations/all/4", nil)
+	req.RequestURI = "/admin/reservations/all/4"
+	req = req.WithContext(getCtx(req))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if !strings.Contains(rr.Body.String(), "€80.00") {
+		t.Error("AdminShowReservation handler doesn't show the prices of a reservation in euros")
+	}
+}
+
+func TestRepository_AdminPostPayment(t *testing.T) {
+	var tests = []struct {
+		name            string
+		body            string
+		expectedStatus  int
+		expectedMessage string
+	}{
+		{"charge", "kind=charge&amount=25.00", http.StatusSeeOther, "flash"},
+		{"refund", "kind=refund&charge_id=1&amount=20", http.StatusSeeOther, "flash"},
+		{"refund-too-much", "kind=refund&charge_id=1&amount=60", http.StatusSeeOther, "error"},
+		{"refund-unknown-charge", "kind=refund&charge_id=9&amount=10", http.StatusSeeOther, "error"},
+		{"bad-amount", "kind=charge&amount=ten", http.StatusSeeOther, "error"},
+		{"bad-kind", "kind=gift&amount=10", http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/reservations/all/1/payments", strings.NewReader(e.body))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "all")
+		rctx.URLParams.Add("id", "1")
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostPayment)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("AdminPostPayment handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatus)
+		}
+		if e.expectedMessage != "" && !session.Exists(ctx, e.expectedMessage) {
+			t.Errorf("AdminPostPayment handler for %s did not put %s in the session", e.name, e.expectedMessage)
+		}
+	}
+}
+
+// ledgerRepo counts the ledger entries written through it
+type ledgerRepo struct {
+	repository.DatabaseRepo
+	entries int
+}
+
+func (l *ledgerRepo) WithActor(a models.Actor) repository.DatabaseRepo {
+	return l
+}
+
+func (l *ledgerRepo) InsertPaymentTransaction(t models.PaymentTransaction) (int, error) {
+	l.entries++
+	return l.DatabaseRepo.InsertPaymentTransaction(t)
+}
+
+func TestRepository_AdminPostPayment_refundFails(t *testing.T) {
+	provider := payments.NewFakeProvider()
+	provider.Decline[1700] = true
+	app := *Repo.App
+	app.Payments = provider
+	db := &ledgerRepo{DatabaseRepo: Repo.DB}
+	repo := &Repository{App: &app, DB: db}
+
+	req, _ := http.NewRequest("POST", "/admin/reservations/all/1/payments", strings.NewReader("kind=refund&charge_id=1&amount=17"))
+	ctx := getCtx(req)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("src", "all")
+	rctx.URLParams.Add("id", "1")
+	req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(repo.AdminPostPayment).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminPostPayment handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if flash := session.GetString(ctx, "flash"); flash != "" {
+		t.Errorf("AdminPostPayment handler flashed %q for a refund that failed", flash)
+	}
+	if session.GetString(ctx, "error") != "The refund failed" {
+		t.Error("AdminPostPayment handler did not put the error in the session")
+	}
+	if db.entries != 0 {
+		t.Errorf("AdminPostPayment handler wrote %d ledger entries for a refund that failed", db.entries)
+	}
+}
+
+func TestRepository_Invoice(t *testing.T) {
+	var tests = []struct {
+		name             string
+		handler          http.HandlerFunc
+		token            string
+		expectedStatus   int
+		expectedLocation string
+		expectedType     string
+	}{
+		{"html", Repo.Invoice, "valid", http.StatusOK, "", "text/html"},
+		{"pdf", Repo.InvoicePDF, "valid", http.StatusOK, "", "application/pdf"},
+		{"html-unknown-token", Repo.Invoice, "bogus", http.StatusTemporaryRedirect, "/", ""},
+		{"pdf-unknown-token", Repo.InvoicePDF, "bogus", http.StatusTemporaryRedirect, "/", ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/reservation/"+e.token+"/invoice", nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("token", e.token)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("invoice handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatus)
+		}
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("invoice handler for %s: expected location %s, but got %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+		if e.expectedType != "" && !strings.HasPrefix(rr.Header().Get("Content-Type"), e.expectedType) {
+			t.Errorf("invoice handler for %s: expected content type %s, but got %s", e.name, e.expectedType, rr.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestRepository_CancelReservation(t *testing.T) {
+	var tests = []struct {
+		name             string
+		method           string
+		token            string
+		expectedStatus   int
+		expectedLocation string
+		expectedFlash    string
+	}{
+		{"show", "GET", "valid", http.StatusOK, "", ""},
+		{"show-unknown-token", "GET", "bogus", http.StatusTemporaryRedirect, "/", ""},
+		{"cancel", "POST", "valid", http.StatusSeeOther, "/", "Your reservation is cancelled"},
+		{"cancel-unknown-token", "POST", "bogus", http.StatusTemporaryRedirect, "/", ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest(e.method, "/reservation/"+e.token+"/cancel", nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("token", e.token)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.CancelReservation)
+		if e.method == "POST" {
+			handler = Repo.PostCancelReservation
+		}
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("cancel handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatus)
+		}
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("cancel handler for %s: expected location %s, but got %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+		if e.expectedFlash != "" && session.GetString(ctx, "flash") != e.expectedFlash {
+			t.Errorf("cancel handler for %s: expected flash %q, got %q", e.name, e.expectedFlash, session.GetString(ctx, "flash"))
+		}
+		// the test stay is moderate and far off, so the 50.00 paid is all refunded
+		if e.name == "show" && !strings.Contains(rr.Body.String(), "$50.00") {
+			t.Error("cancel page doesn't show the refund")
+		}
+	}
+}
+
+func TestCanCancel(t *testing.T) {
+	res := models.Reservation{
+		StartDate:          time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+		Status:             models.StatusConfirmed,
+		CancellationPolicy: models.CancellationPolicy{Tiers: []models.RefundTier{{DaysBefore: 7, Percent: 100}}},
+	}
+	checkedIn := res
+	checkedIn.Status = models.StatusCheckedIn
+	noPolicy := res
+	noPolicy.CancellationPolicy = models.CancellationPolicy{}
+
+	var tests = []struct {
+		name     string
+		res      models.Reservation
+		now      time.Time
+		expected bool
+	}{
+		{"before-arrival", res, time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"day-of-arrival", res, time.Date(2050, 1, 10, 15, 0, 0, 0, time.UTC), true},
+		{"after-arrival", res, time.Date(2050, 1, 11, 0, 0, 0, 0, time.UTC), false},
+		{"checked-in", checkedIn, time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), false},
+		{"no-policy", noPolicy, time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, e := range tests {
+		if got := canCancel(e.res, e.now); got != e.expected {
+			t.Errorf("canCancel for %s is %t, wanted %t", e.name, got, e.expected)
+		}
+	}
+}
+
+func TestRepository_AdminInvoice(t *testing.T) {
+	// reservation 1 has been invoiced and 2 hasn't
+	for _, id := range []string{"1", "2"} {
+		for _, handler := range []http.HandlerFunc{Repo.AdminInvoice, Repo.AdminInvoicePDF} {
+			req, _ := http.NewRequest("GET", "/admin/reservations/all/"+id+"/invoice", nil)
+			ctx := getCtx(req)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("src", "all")
+			rctx.URLParams.Add("id", id)
+			req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("admin invoice handler for id %s returned wrong response code: got %d, wanted %d", id, rr.Code, http.StatusOK)
+			}
+			if rr.Header().Get("Content-Type") == "application/pdf" {
+				continue
+			}
+			body := rr.Body.String()
+			if id == "1" && (!strings.Contains(body, "INV-000001") || strings.Contains(body, "Issue Invoice")) {
+				t.Error("admin invoice handler doesn't show the issued invoice")
+			}
+			if id == "2" && (!strings.Contains(body, "Pro Forma Invoice") || !strings.Contains(body, "Issue Invoice")) {
+				t.Error("admin invoice handler doesn't offer to issue the pro forma invoice")
+			}
+		}
+	}
+}
+
+func TestRepository_AdminIssueInvoice(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/admin/reservations/all/2/invoice", nil)
+	ctx := getCtx(req)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("src", "all")
+	rctx.URLParams.Add("id", "2")
+	req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminIssueInvoice)
+	handler.ServeHTTP(rr, req)
+
+	if loc := rr.Header().Get("Location"); loc != "/admin/reservations/all/2" {
+		t.Errorf("AdminIssueInvoice handler redirected to %q, wanted /admin/reservations/all/2", loc)
+	}
+	if flash := session.GetString(ctx, "flash"); flash != "Invoice INV-000001 issued" {
+		t.Errorf("AdminIssueInvoice handler flashed %q", flash)
+	}
+}
+
+func TestRepository_AdminReservationStatus(t *testing.T) {
+	var tests = []struct {
+		name             string
+		id               string
+		status           string
+		expectedStatus   int
+		expectedLocation string
+		expectedMessage  string
+	}{
+		{"confirm", "1", "confirmed", http.StatusSeeOther, "/admin/reservations-new", "flash"},
+		{"cancel", "1", "cancelled", http.StatusSeeOther, "/admin/reservations-new", "flash"},
+		{"not-allowed", "1", "checked_out", http.StatusSeeOther, "/admin/reservations/new/1", "error"},
+		{"check-out", "3", "checked_out", http.StatusSeeOther, "/admin/reservations-new", "flash"},
+		{"unknown-status", "1", "lost", http.StatusSeeOther, "/admin/reservations/new/1", "error"},
+		{"changed-by-someone-else", "2", "confirmed", http.StatusSeeOther, "/admin/reservations/new/2", "error"},
+		{"in-the-trash", "6", "confirmed", http.StatusSeeOther, "/admin/reservations/new/6", "error"},
+		{"bad-id", "x", "confirmed", http.StatusBadRequest, "", ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/reservation-status/new/"+e.id+"/"+e.status, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "new")
+		rctx.URLParams.Add("id", e.id)
+		rctx.URLParams.Add("status", e.status)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminReservationStatus)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("AdminReservationStatus handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatus)
+		}
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("AdminReservationStatus handler for %s: expected location %s, but got %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+		if e.expectedMessage != "" && !session.Exists(ctx, e.expectedMessage) {
+			t.Errorf("AdminReservationStatus handler for %s did not put %s in the session", e.name, e.expectedMessage)
+		}
+	}
+}
+
+func TestRepository_AdminAllReservations(t *testing.T) {
+	var tests = []struct {
+		query          string
+		expectedStatus int
+	}{
+		{"", http.StatusOK},
+		{"?status=confirmed", http.StatusOK},
+		{"?status=lost", http.StatusBadRequest},
+		{"?q=smith&room_id=1&from=2050-01-01&to=2050-02-01", http.StatusOK},
+		{"?from=not-a-date", http.StatusOK},
+		{"?sort=last_name&dir=desc&page=2", http.StatusOK},
+		{"?sort=bogus&page=-1", http.StatusOK},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/reservations-all"+e.query, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminAllReservations)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("AdminAllReservations handler for %q returned wrong response code: got %d, wanted %d", e.query, rr.Code, e.expectedStatus)
+		}
+	}
+}
+
+func TestRepository_AdminDeleteReservation(t *testing.T) {
+	var tests = []struct {
+		name             string
+		id               string
+		expectedLocation string
+		expectedMessage  string
+		expectedFlash    string
+	}{
+		// reservations 1 and 4 were never cancelled, so deleting them refunds their deposit
+		{"delete", "1", "/admin/reservations-all", "flash", "Reservation moved to the trash, $50.00 refunded"},
+		{"delete-in-euros", "4", "/admin/reservations-all", "flash", "Reservation moved to the trash, €50.00 refunded"},
+		{"delete-fails", "2", "/admin/reservations/all/2", "error", ""},
+		{"already-deleted", "6", "/admin/reservations-trash", "error", ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/delete-reservation/all/"+e.id, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "all")
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminDeleteReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("AdminDeleteReservation handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, http.StatusSeeOther)
+		}
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("AdminDeleteReservation handler for %s: expected location %s, but got %s", e.name, e.expectedLocation, actualLoc.String())
+		}
+		if !session.Exists(ctx, e.expectedMessage) {
+			t.Errorf("AdminDeleteReservation handler for %s did not put %s in the session", e.name, e.expectedMessage)
+		}
+		if flash := session.GetString(ctx, "flash"); e.expectedFlash != "" && flash != e.expectedFlash {
+			t.Errorf("AdminDeleteReservation handler for %s flashed %q, wanted %q", e.name, flash, e.expectedFlash)
+		}
+	}
+}
+
+func TestRepository_AdminRestoreReservation(t *testing.T) {
+	var tests = []struct {
+		name            string
+		id              string
+		expectedStatus  int
+		expectedMessage string
+	}{
+		{"restore", "1", http.StatusSeeOther, "flash"},
+		{"dates-taken", "2", http.StatusSeeOther, "error"},
+		{"bad-id", "x", http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/restore-reservation/"+e.id, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminRestoreReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("AdminRestoreReservation handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatus)
+		}
+		if e.expectedMessage != "" && !session.Exists(ctx, e.expectedMessage) {
+			t.Errorf("AdminRestoreReservation handler for %s did not put %s in the session", e.name, e.expectedMessage)
+		}
+	}
+}
+
+// trashRepo holds one reservation and its ledger, and moves the reservation in and out of
+// the trash the way the postgres repository does
+type trashRepo struct {
+	repository.DatabaseRepo
+	res    models.Reservation
+	ledger []models.PaymentTransaction
+}
+
+func (db *trashRepo) WithActor(a models.Actor) repository.DatabaseRepo {
+	return db
+}
+
+func (db *trashRepo) GetReservationByID(id int) (models.Reservation, error) {
+	return db.res, nil
+}
+
+func (db *trashRepo) DeleteReservation(id, userID int) error {
+	if db.res.Deleted() {
+		return sql.ErrNoRows
+	}
+	if db.res.Status.CanTransitionTo(models.StatusCancelled) {
+		db.res.Status = models.StatusCancelled
+	}
+	db.res.DeletedAt = time.Now()
+	return nil
+}
+
+func (db *trashRepo) RestoreReservation(id int) error {
+	db.res.DeletedAt = time.Time{}
+	return nil
+}
+
+func (db *trashRepo) PaymentTransactionsByReservationID(id int) ([]models.PaymentTransaction, error) {
+	return db.ledger, nil
+}
+
+func (db *trashRepo) InsertPaymentTransaction(t models.PaymentTransaction) (int, error) {
+	t.ID = len(db.ledger) + 1
+	db.ledger = append(db.ledger, t)
+	return t.ID, nil
+}
+
+func TestRepository_AdminDeleteReservation_restore(t *testing.T) {
+	res, _ := Repo.DB.GetReservationByID(1)
+	res.Status = models.StatusConfirmed
+	ledger, _ := Repo.DB.PaymentTransactionsByReservationID(1)
+	db := &trashRepo{DatabaseRepo: Repo.DB, res: res, ledger: ledger}
+	repo := &Repository{App: Repo.App, DB: db}
+
+	req, _ := http.NewRequest("GET", "/admin/delete-reservation/all/1", nil)
+	ctx := getCtx(req)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("src", "all")
+	rctx.URLParams.Add("id", "1")
+	req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+	http.HandlerFunc(repo.AdminDeleteReservation).ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("GET", "/admin/restore-reservation/1", nil)
+	ctx = getCtx(req)
+	rctx = chi.NewRouteContext()
+	rctx.URLParams.Add("id", "1")
+	req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(repo.AdminRestoreReservation).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminRestoreReservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if db.res.Deleted() {
+		t.Error("the reservation is still in the trash after restoring it")
+	}
+	if db.res.Status != models.StatusCancelled {
+		t.Errorf("a refunded reservation came back from the trash %s, wanted %s", db.res.Status, models.StatusCancelled)
+	}
+	if paid := payments.Paid(db.ledger); paid != 0 {
+		t.Errorf("a refunded reservation came back from the trash with %d paid, wanted 0", paid)
+	}
+}
+
+func TestRepository_AdminTrash(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/reservations-trash", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminTrash)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminTrash handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+}
+
+func TestRepository_AdminAudit(t *testing.T) {
+	var tests = []string{
+		"",
+		"?entity=reservation&entity_id=1",
+		"?action=update&user_id=1&from=2050-01-01&to=2050-01-31",
+		"?from=yesterday",
+	}
+
+	for _, query := range tests {
+		req, _ := http.NewRequest("GET", "/admin/audit"+query, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminAudit)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("AdminAudit handler for %q returned wrong response code: got %d, wanted %d", query, rr.Code, http.StatusOK)
+		}
+	}
+}
+
+// promoRepo has reservation 1 booked with the SUMMER promo code, and remembers the reservation
+// saved through it
+type promoRepo struct {
+	repository.DatabaseRepo
+	saved models.Reservation
+}
+
+func (db *promoRepo) WithActor(a models.Actor) repository.DatabaseRepo {
+	return db
+}
+
+func (db *promoRepo) GetReservationByID(id int) (models.Reservation, error) {
+	res, err := db.DatabaseRepo.GetReservationByID(id)
+	res.PromoCodeID = 1
+	res.Discount = 1600
+	return res, err
+}
+
+func (db *promoRepo) GetPromoCodeByID(id int) (models.PromoCode, error) {
+	return db.DatabaseRepo.GetPromoCodeByCode("SUMMER")
+}
+
+func (db *promoRepo) UpdateReservation(u models.Reservation) error {
+	db.saved = u
+	return db.DatabaseRepo.UpdateReservation(u)
+}
+
+func TestRepository_AdminPostShowReservation_promoCode(t *testing.T) {
+	var tests = []struct {
+		name             string
+		roomID           string
+		endDate          string
+		expectedDiscount int
+	}{
+		// 10% off two nights at 80.00
+		{"unchanged", "1", "2050-01-03", 1600},
+		// 10% off two nights at 100.00
+		{"other-room", "1000", "2050-01-03", 2000},
+		// 10% off three nights at 80.00
+		{"longer-stay", "1", "2050-01-04", 2400},
+	}
+
+	for _, e := range tests {
+		db := &promoRepo{DatabaseRepo: Repo.DB}
+		repo := &Repository{App: Repo.App, DB: db}
+
+		body := "first_name=John&last_name=Smith&email=john@smith.com&phone=555-123-4567&start_date=2050-01-01&end_date=" +
+			e.endDate + "&room_id=" + e.roomID
+		req, _ := http.NewRequest("POST", "/admin/reservations/all/1", strings.NewReader(body))
+		req.RequestURI = "/admin/reservations/all/1"
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(repo.AdminPostShowReservation).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("AdminPostShowReservation handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, http.StatusSeeOther)
+		}
+		if db.saved.Discount != e.expectedDiscount {
+			t.Errorf("AdminPostShowReservation handler for %s saved a discount of %d, wanted %d", e.name, db.saved.Discount, e.expectedDiscount)
+		}
+	}
+}
+
+func TestRepository_AdminPostShowReservation(t *testing.T) {
+	var tests = []struct {
+		name             string
+		body             string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"valid", "first_name=John&last_name=Smith&email=john@smith.com&phone=555-123-4567&start_date=2050-01-01&end_date=2050-01-03&room_id=1", http.StatusSeeOther, "/admin/reservations-all"},
+		{"notify-guest", "first_name=John&last_name=Smith&email=john@smith.com&phone=555-123-4567&start_date=2050-01-01&end_date=2050-01-03&room_id=1&notify_guest=1", http.StatusSeeOther, "/admin/reservations-all"},
+		{"invalid-email", "first_name=John&last_name=Smith&email=john&phone=555-123-4567&start_date=2050-01-01&end_date=2050-01-03&room_id=1", http.StatusOK, ""},
+		{"invalid-date", "first_name=John&last_name=Smith&email=john@smith.com&phone=555-123-4567&start_date=invalid&end_date=2050-01-03&room_id=1", http.StatusOK, ""},
+		{"end-before-start", "first_name=John&last_name=Smith&email=john@smith.com&phone=555-123-4567&start_date=2050-01-03&end_date=2050-01-01&room_id=1", http.StatusOK, ""},
+		{"invalid-phone", "first_name=John&last_name=Smith&email=john@smith.com&phone=555&start_date=2050-01-01&end_date=2050-01-03&room_id=1", http.StatusOK, ""},
+		{"unknown-room", "first_name=John&last_name=Smith&email=john@smith.com&phone=555-123-4567&start_date=2050-01-01&end_date=2050-01-03&room_id=99", http.StatusOK, ""},
+		{"room-taken", "first_name=John&last_name=Smith&email=john@smith.com&phone=555-123-4567&start_date=2050-01-01&end_date=2050-01-03&room_id=2", http.StatusOK, ""},
+		{"other-room", "first_name=John&last_name=Smith&email=john@smith.com&phone=555-123-4567&start_date=2050-01-01&end_date=2050-01-03&room_id=1000", http.StatusSeeOther, "/admin/reservations-all"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/reservations/all/1", strings.NewReader(e.body))
+		req.RequestURI = "/admin/reservations/all/1"
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostShowReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("AdminPostShowReservation handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatus)
+		}
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("AdminPostShowReservation handler for %s: expected location %s, but got %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+func TestRepository_AdminAddReservation(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/add-reservation", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminAddReservation)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminAddReservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+}
+
+func TestRepository_AdminPostAddReservation(t *testing.T) {
+	valid := "first_name=John&last_name=Smith&email=john@smith.com&phone=555-123-4567&start_date=2050-01-01&end_date=2050-01-03&source=phone"
+
+	var tests = []struct {
+		name             string
+		body             string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"valid", valid + "&room_id=1", http.StatusSeeOther, "/admin/reservations/all/1"},
+		{"send-email", valid + "&room_id=1&send_email=1", http.StatusSeeOther, "/admin/reservations/all/1"},
+		{"missing-source", "first_name=John&last_name=Smith&email=john@smith.com&start_date=2050-01-01&end_date=2050-01-03&room_id=1", http.StatusOK, ""},
+		{"invalid-email", "first_name=John&last_name=Smith&email=john&start_date=2050-01-01&end_date=2050-01-03&room_id=1&source=phone", http.StatusOK, ""},
+		{"end-before-start", "first_name=John&last_name=Smith&email=john@smith.com&start_date=2050-01-03&end_date=2050-01-01&room_id=1&source=phone", http.StatusOK, ""},
+		{"unknown-room", valid + "&room_id=99", http.StatusOK, ""},
+		{"booking-fails", valid + "&room_id=2", http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/add-reservation", strings.NewReader(e.body))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostAddReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("AdminPostAddReservation handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatus)
+		}
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("AdminPostAddReservation handler for %s: expected location %s, but got %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+func TestRepository_AdminNewReservations(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/reservations-new?q=smith&page=2", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminNewReservations)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminNewReservations handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	// 60 reservations make three pages, and page links keep the search
+	for _, link := range []string{
+		"/admin/reservations-new?page=1&amp;q=smith",
+		"/admin/reservations-new?page=3&amp;q=smith",
+	} {
+		if !strings.Contains(rr.Body.String(), link) {
+			t.Errorf("AdminNewReservations page has no link to %s", link)
+		}
+	}
+	if strings.Contains(rr.Body.String(), "page=4") {
+		t.Error("AdminNewReservations page links past the last page")
+	}
+}
+
+func TestRepository_AdminExportReservations(t *testing.T) {
+	var tests = []struct {
+		name                string
+		src                 string
+		query               string
+		expectedStatus      int
+		expectedContentType string
+	}{
+		{"csv", "all", "?q=smith", http.StatusOK, "text/csv; charset=utf-8"},
+		{"xlsx", "new", "?format=xlsx", http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		{"bad-format", "all", "?format=pdf", http.StatusBadRequest, ""},
+		{"bad-status", "all", "?status=lost", http.StatusBadRequest, ""},
+		{"bad-date", "all", "?from=not-a-date", http.StatusBadRequest, ""},
+		{"bad-src", "trash", "", http.StatusNotFound, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/reservations-export/"+e.src+e.query, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", e.src)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminExportReservations)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: AdminExportReservations handler returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatus)
+		}
+		if e.expectedContentType != "" && rr.Header().Get("Content-Type") != e.expectedContentType {
+			t.Errorf("%s: wrong content type %q", e.name, rr.Header().Get("Content-Type"))
+		}
+	}
+
+	// the CSV has a header and a row per reservation
+	req, _ := http.NewRequest("GET", "/admin/reservations-export/all", nil)
+	ctx := getCtx(req)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("src", "all")
+	req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+	rr := httptest.NewRecorder()
+	Repo.AdminExportReservations(rr, req)
+
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "1,John,Smith,") {
+		t.Errorf("unexpected reservations CSV:\n%s", rr.Body.String())
+	}
+
+	// custom fields come last, one column each
+	if !strings.HasSuffix(strings.TrimSpace(lines[0]), ",Estimated arrival,Dietary needs,No longer asked") ||
+		!strings.HasSuffix(strings.TrimSpace(lines[len(lines)-1]), ",,Vegetarian,") {
+		t.Errorf("custom fields missing from reservations CSV:\n%s", rr.Body.String())
+	}
+}
+
+func TestRepository_AdminExportOccupancy(t *testing.T) {
+	var tests = []struct {
+		name             string
+		query            string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"csv", "?start=2050-01-01&end=2050-01-03", http.StatusOK, ""},
+		{"xlsx", "?start=2050-01-01&end=2050-01-03&format=xlsx", http.StatusOK, ""},
+		{"bad-start", "?start=x&end=2050-01-03", http.StatusSeeOther, "/admin/occupancy"},
+		{"bad-end", "?start=2050-01-01&end=x", http.StatusSeeOther, "/admin/occupancy"},
+		{"backwards", "?start=2050-01-03&end=2050-01-01", http.StatusSeeOther, "/admin/occupancy"},
+		{"too-long", "?start=2050-01-01&end=2052-01-01", http.StatusSeeOther, "/admin/occupancy"},
+		{"bad-format", "?start=2050-01-01&end=2050-01-03&format=pdf", http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/occupancy/export"+e.query, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminExportOccupancy)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: AdminExportOccupancy handler returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatus)
+		}
+		if e.expectedLocation != "" {
+			if location, _ := rr.Result().Location(); location == nil || location.String() != e.expectedLocation {
+				t.Errorf("%s: expected redirect to %s, got %v", e.name, e.expectedLocation, location)
+			}
+		}
+	}
+
+	// the end date is inclusive, and room 1 is booked on odd days
+	req, _ := http.NewRequest("GET", "/admin/occupancy/export?start=2050-01-01&end=2050-01-03", nil)
+	req = req.WithContext(getCtx(req))
+	rr := httptest.NewRecorder()
+	Repo.AdminExportOccupancy(rr, req)
+
+	expected := "Date,General's Quarters,Major's Suite,Total\n" +
+		"2050-01-01,1,0,1\n" +
+		"2050-01-02,0,0,0\n" +
+		"2050-01-03,1,0,1\n"
+	if rr.Body.String() != expected {
+		t.Errorf("unexpected occupancy CSV:\n%s\nwanted:\n%s", rr.Body.String(), expected)
+	}
+}
+
+func TestRepository_AdminOccupancy(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/occupancy", nil)
+	req = req.WithContext(getCtx(req))
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminOccupancy)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminOccupancy handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+}
+
+func TestRepository_AdminImport(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/import", nil)
+	req = req.WithContext(getCtx(req))
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminImport)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminImport handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+}
+
+func TestRepository_AdminPostImport(t *testing.T) {
+	file := "First name,Surname,Email,Room,Arrival,Departure\n" +
+		"John,Smith,john@smith.com,1,2050-01-01,2050-01-03\n" +
+		"Jane,Doe,jane@doe.com,2,2050-01-01,2050-01-03\n" +
+		"Bad,Email,nope,1,2050-01-01,2050-01-03\n"
+
+	var tests = []struct {
+		name            string
+		file            string
+		fields          map[string]string
+		expectedMessage string
+	}{
+		// the test repository always has room 2 booked, so only John can be imported
+		{"dry-run", file, map[string]string{"dry_run": "1", "map_last_name": "Surname", "map_start_date": "Arrival", "map_end_date": "Departure"},
+			"Dry run: 1 of 3 rows would be imported"},
+		{"import", file, map[string]string{"map_last_name": "Surname", "map_start_date": "Arrival", "map_end_date": "Departure"},
+			"1 of 3 rows imported"},
+		{"no-file", "", map[string]string{}, "Choose a CSV file"},
+		{"missing-column", file, map[string]string{}, "there is no column for last_name"},
+		{"bad-layout", file, map[string]string{"date_layout": "Mon Jan 2"}, "Choose a date format"},
+	}
+
+	for _, e := range tests {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		if _, ok := e.fields["date_layout"]; !ok {
+			_ = mw.WriteField("date_layout", "2006-01-02")
+		}
+		for k, v := range e.fields {
+			_ = mw.WriteField(k, v)
+		}
+		if e.file != "" {
+			fw, _ := mw.CreateFormFile("file", "bookings.csv")
+			_, _ = fw.Write([]byte(e.file))
+		}
+		_ = mw.Close()
+
+		req, _ := http.NewRequest("POST", "/admin/import", &body)
+		req = req.WithContext(getCtx(req))
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostImport)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: AdminPostImport handler returned wrong response code: got %d, wanted %d", e.name, rr.Code, http.StatusOK)
+		}
+		if !strings.Contains(rr.Body.String(), e.expectedMessage) {
+			t.Errorf("%s: expected the page to say %q", e.name, e.expectedMessage)
+		}
+	}
+
+	// a body that is not a multipart form is rejected
+	req, _ := http.NewRequest("POST", "/admin/import", strings.NewReader("not multipart"))
+	req = req.WithContext(getCtx(req))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+	rr := httptest.NewRecorder()
+	Repo.AdminPostImport(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("AdminPostImport handler returned wrong response code for a broken upload: got %d, wanted %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRepository_AdminDashboard(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/dashboard", nil)
+	req = req.WithContext(getCtx(req))
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminDashboard)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminDashboard handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+}
+
+func TestRepository_AdminDashboardJSON(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/dashboard.json", nil)
+	req = req.WithContext(getCtx(req))
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminDashboardJSON)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("AdminDashboardJSON handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	var stats dashboardData
+	err := json.Unmarshal(rr.Body.Bytes(), &stats)
+	if err != nil {
+		t.Fatal("failed to parse json", err)
+	}
+
+	// the test repository has half the nights sold, 60 pending reservations and one arrival
+	if stats.Occupancy30 != 50 || stats.Occupancy90 != 50 {
+		t.Errorf("expected 50%% occupancy, got %v and %v", stats.Occupancy30, stats.Occupancy90)
+	}
+	if stats.NewReservations != 60 {
+		t.Errorf("expected 60 new reservations, got %d", stats.NewReservations)
+	}
+	if len(stats.Arrivals) != 1 || stats.Arrivals[0].Name != "John Smith" {
+		t.Errorf("unexpected arrivals %+v", stats.Arrivals)
+	}
+	if stats.Departures == nil || len(stats.Departures) != 0 {
+		t.Errorf("expected an empty list of departures, got %v", stats.Departures)
+	}
+	if len(stats.Weeks) != 2 || stats.Weeks[0].Revenue != 40000 {
+		t.Errorf("unexpected weeks %+v", stats.Weeks)
+	}
+	if len(stats.LeadTimes) != len(models.LeadTimeBuckets) || stats.LeadTimes[1].Bookings != 3 {
+		t.Errorf("unexpected lead times %+v", stats.LeadTimes)
+	}
+}
+
+func TestRepository_AdminReports(t *testing.T) {
+	var tests = []struct {
+		name            string
+		query           string
+		expectedMessage string
+	}{
+		{"this-month", "", "Total"},
+		{"by-room", "?start=2050-01-01&end=2050-01-31&group=room", "Major&#39;s Suite"},
+		{"by-month", "?start=2050-01-01&end=2050-02-28&group=month", "February 2050"},
+		{"bad-date", "?start=x", "Invalid date"},
+		{"backwards", "?start=2050-02-01&end=2050-01-01", "Choose a range"},
+		{"bad-group", "?group=week", "Invalid grouping"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/reports"+e.query, nil)
+		req = req.WithContext(getCtx(req))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminReports)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: AdminReports handler returned wrong response code: got %d, wanted %d", e.name, rr.Code, http.StatusOK)
+		}
+		if !strings.Contains(rr.Body.String(), e.expectedMessage) {
+			t.Errorf("%s: expected the page to show %q", e.name, e.expectedMessage)
+		}
+	}
+}
+
+func TestRepository_AdminExportReport(t *testing.T) {
+	var tests = []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{"csv", "?start=2050-01-01&end=2050-01-31&group=room", http.StatusOK},
+		{"xlsx", "?start=2050-01-01&end=2050-01-31&format=xlsx", http.StatusOK},
+		{"bad-format", "?format=pdf", http.StatusBadRequest},
+		{"bad-range", "?start=2050-01-01&end=2060-01-01", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/reports/export"+e.query, nil)
+		req = req.WithContext(getCtx(req))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminExportReport)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: AdminExportReport handler returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatus)
+		}
+	}
+
+	// the test repository has one two night stay in room 1 at the start of the range
+	req, _ := http.NewRequest("GET", "/admin/reports/export?start=2050-01-01&end=2050-01-10", nil)
+	req = req.WithContext(getCtx(req))
+	rr := httptest.NewRecorder()
+	Repo.AdminExportReport(rr, req)
+
+	// it was booked in 2049, after today, so it is not on the books yet as far as pace goes
+	expected := "Total,20,2,10.0,200.00,100.00,10.00,1,0,0.0,2.0,0,0,0.0"
+	if !strings.Contains(rr.Body.String(), expected) {
+		t.Errorf("unexpected report CSV:\n%s\nwanted a total of:\n%s", rr.Body.String(), expected)
+	}
+}
+
+func TestRepository_AdminGuests(t *testing.T) {
+	for _, q := range []string{"", "smith"} {
+		req, _ := http.NewRequest("GET", "/admin/guests?q="+q, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminGuests)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("AdminGuests handler for %q returned wrong response code: got %d, wanted %d", q, rr.Code, http.StatusOK)
+		}
+	}
+}
+
+func TestRepository_AdminShowGuest(t *testing.T) {
+	var tests = []struct {
+		id                 string
+		expectedStatusCode int
+	}{
+		{"1", http.StatusOK},
+		{"3", http.StatusNotFound},
+		{"x", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/guests/"+e.id, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminShowGuest)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminShowGuest handler for id %s returned wrong response code: got %d, wanted %d", e.id, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminPostGuest(t *testing.T) {
+	var tests = []struct {
+		name               string
+		id                 string
+		body               string
+		expectedStatusCode int
+	}{
+		{"valid", "1", "first_name=John&last_name=Smith&email=john@smith.com&phone=555-1234&tags=vip,+Corporate&notes=Likes+quiet+rooms", http.StatusSeeOther},
+		{"missing-name", "1", "last_name=Smith&email=john@smith.com", http.StatusOK},
+		{"bad-email", "1", "first_name=John&last_name=Smith&email=john", http.StatusOK},
+		{"duplicate-email", "1", "first_name=John&last_name=Smith&email=jane@doe.com", http.StatusOK},
+		{"unknown-guest", "3", "first_name=John&last_name=Smith", http.StatusNotFound},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/guests/"+e.id, strings.NewReader(e.body))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostGuest)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminPostGuest handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminMergeGuest(t *testing.T) {
+	var tests = []struct {
+		name             string
+		body             string
+		expectedLocation string
+		expectedError    bool
+	}{
+		{"merged", "merge_id=2", "/admin/guests/1", false},
+		{"itself", "merge_id=1", "/admin/guests/1", true},
+		{"missing", "", "/admin/guests/1", true},
+		{"gone", "merge_id=3", "/admin/guests/1", true},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/guests/1/merge", strings.NewReader(e.body))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "1")
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminMergeGuest)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("AdminMergeGuest handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, http.StatusSeeOther)
+		}
+		if loc, _ := rr.Result().Location(); loc == nil || loc.String() != e.expectedLocation {
+			t.Errorf("AdminMergeGuest handler for %s redirected to %v, wanted %s", e.name, loc, e.expectedLocation)
+		}
+		if hasError := session.Exists(req.Context(), "error"); hasError != e.expectedError {
+			t.Errorf("AdminMergeGuest handler for %s set an error: %v, wanted %v", e.name, hasError, e.expectedError)
+		}
+	}
+}
+
+func TestRepository_AdminReservationsCalendar(t *testing.T) {
+	for _, query := range []string{"", "?y=2050&m=1"} {
+		req, _ := http.NewRequest("GET", "/admin/reservations-calendar"+query, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminReservationsCalendar)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("AdminReservationsCalendar handler for %q returned wrong response code: got %d, wanted %d", query, rr.Code, http.StatusOK)
+		}
+		if !strings.Contains(rr.Body.String(), "Arriving late, after 11pm") {
+			t.Errorf("AdminReservationsCalendar handler for %q did not show the important notes", query)
+		}
+	}
+}
+
+func TestRepository_AdminPostReservationNote(t *testing.T) {
+	var tests = []struct {
+		name          string
+		body          string
+		expectedError bool
+	}{
+		{"note", "body=Arriving+late&important=1", false},
+		{"reply", "body=Key+at+the+night+desk&parent_id=1", false},
+		{"empty", "body=++", true},
+		{"too-long", "body=" + strings.Repeat("a", maxNoteLength+1), true},
+		{"missing-parent", "body=Hello&parent_id=3", true},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/reservations/all/1/notes", strings.NewReader(e.body))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "all")
+		rctx.URLParams.Add("id", "1")
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostReservationNote)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("AdminPostReservationNote handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, http.StatusSeeOther)
+		}
+		if loc := rr.Header().Get("Location"); loc != "/admin/reservations/all/1#notes" {
+			t.Errorf("AdminPostReservationNote handler for %s redirected to %s", e.name, loc)
+		}
+		if hasError := session.Exists(req.Context(), "error"); hasError != e.expectedError {
+			t.Errorf("AdminPostReservationNote handler for %s set an error: %v, wanted %v", e.name, hasError, e.expectedError)
+		}
+	}
+}
+
+func TestRepository_AdminReservationNoteImportant(t *testing.T) {
+	var tests = []struct {
+		name               string
+		noteID             string
+		expectedStatusCode int
+	}{
+		{"flagged", "1", http.StatusSeeOther},
+		{"unknown-note", "3", http.StatusNotFound},
+		{"bad-note-id", "x", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/reservations/all/1/notes/"+e.noteID+"/important", strings.NewReader("important=1"))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "all")
+		rctx.URLParams.Add("id", "1")
+		rctx.URLParams.Add("noteID", e.noteID)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminReservationNoteImportant)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminReservationNoteImportant handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminCustomFields(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/custom-fields", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminCustomFields)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminCustomFields handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+}
+
+func TestRepository_AdminShowCustomField(t *testing.T) {
+	var tests = []struct {
+		id                 string
+		expectedStatusCode int
+	}{
+		{"0", http.StatusOK},
+		{"2", http.StatusOK},
+		{"9", http.StatusNotFound},
+		{"x", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/custom-fields/"+e.id, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminShowCustomField)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminShowCustomField handler for id %s returned wrong response code: got %d, wanted %d", e.id, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminPostCustomField(t *testing.T) {
+	var tests = []struct {
+		name               string
+		id                 string
+		body               string
+		expectedStatusCode int
+	}{
+		{"new", "0", "name=plate&label=Vehicle+plate&type=text&pattern=%5E%5BA-Z0-9+-%5D%2B%24&max_length=10&active=1", http.StatusSeeOther},
+		{"edit", "2", "name=diet&label=Dietary+needs&type=select&options=None%0D%0AVegan&required=1&active=1", http.StatusSeeOther},
+		{"duplicate-name", "0", "name=diet&label=Diet&type=text", http.StatusOK},
+		{"bad-name", "0", "name=Vehicle+Plate&label=Plate&type=text", http.StatusOK},
+		{"select-without-options", "0", "name=size&label=Size&type=select", http.StatusOK},
+		{"bad-pattern", "0", "name=plate&label=Plate&type=text&pattern=(", http.StatusOK},
+		{"bad-id", "x", "name=plate&label=Plate&type=text", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/custom-fields/"+e.id, strings.NewReader(e.body))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostCustomField)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminPostCustomField handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminDeleteCustomField(t *testing.T) {
+	var tests = []struct {
+		id                 string
+		expectedStatusCode int
+	}{
+		{"1", http.StatusSeeOther},
+		{"9", http.StatusNotFound},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/delete-custom-field/"+e.id, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminDeleteCustomField)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminDeleteCustomField handler for id %s returned wrong response code: got %d, wanted %d", e.id, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminExchangeRates(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/exchange-rates", nil)
+	req = req.WithContext(getCtx(req))
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminExchangeRates)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminExchangeRates handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "€90.00") {
+		t.Error("AdminExchangeRates doesn't show an example price in EUR")
+	}
+}
+
+func TestRepository_AdminPostExchangeRate(t *testing.T) {
+	var tests = []struct {
+		name               string
+		body               string
+		expectedStatusCode int
+	}{
+		{"valid", "currency=gbp&rate=0.79", http.StatusSeeOther},
+		{"update", "currency=EUR&rate=0.92", http.StatusSeeOther},
+		{"missing", "currency=&rate=", http.StatusOK},
+		{"bad-code", "currency=EURO&rate=1", http.StatusOK},
+		{"base-currency", "currency=USD&rate=1", http.StatusOK},
+		{"bad-rate", "currency=GBP&rate=0", http.StatusOK},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/exchange-rates", strings.NewReader(e.body))
+		req = req.WithContext(getCtx(req))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostExchangeRate)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminPostExchangeRate handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminImportExchangeRates(t *testing.T) {
+	var tests = []struct {
+		name               string
+		file               string
+		expectedStatusCode int
+		expectedMessage    string
+	}{
+		{"valid", "currency,rate\nEUR,0.92\nUSD,1\n", http.StatusSeeOther, ""},
+		{"bad-rate", "EUR,0.92\nJPY,lots\n", http.StatusOK, "line 2: the rate must be a positive number"},
+		{"no-file", "", http.StatusOK, "Choose a CSV file"},
+	}
+
+	for _, e := range tests {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		if e.file != "" {
+			fw, _ := mw.CreateFormFile("file", "rates.csv")
+			_, _ = fw.Write([]byte(e.file))
+		}
+		_ = mw.Close()
+
+		req, _ := http.NewRequest("POST", "/admin/exchange-rates/import", &body)
+		req = req.WithContext(getCtx(req))
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminImportExchangeRates)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: AdminImportExchangeRates handler returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+		if !strings.Contains(rr.Body.String(), e.expectedMessage) {
+			t.Errorf("%s: expected the page to say %q", e.name, e.expectedMessage)
+		}
+	}
+}
+
+func TestRepository_AdminDeleteExchangeRate(t *testing.T) {
+	var tests = []struct {
+		currency           string
+		expectedStatusCode int
+		expectedMessage    string
+	}{
+		{"JPY", http.StatusSeeOther, "flash"},
+		// Harbour House charges in euros
+		{"EUR", http.StatusSeeOther, "error"},
+		{"GBP", http.StatusNotFound, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/delete-exchange-rate/"+e.currency, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("currency", e.currency)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminDeleteExchangeRate)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminDeleteExchangeRate handler for %s returned wrong response code: got %d, wanted %d", e.currency, rr.Code, e.expectedStatusCode)
+		}
+		if e.expectedMessage != "" && !session.Exists(ctx, e.expectedMessage) {
+			t.Errorf("AdminDeleteExchangeRate handler for %s did not put %s in the session", e.currency, e.expectedMessage)
+		}
+	}
+}
+
+func TestRepository_AdminTaxRules(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/tax-rules", nil)
+	req = req.WithContext(getCtx(req))
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminTaxRules)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminTaxRules handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "10% of the room charge") {
+		t.Error("AdminTaxRules doesn't show the lodging tax as a percentage")
+	}
+}
+
+func TestRepository_AdminShowTaxRule(t *testing.T) {
+	var tests = []struct {
+		id                 string
+		expectedStatusCode int
+	}{
+		{"0", http.StatusOK},
+		{"1", http.StatusOK},
+		{"9", http.StatusNotFound},
+		{"x", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/tax-rules/"+e.id, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminShowTaxRule)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminShowTaxRule handler for id %s returned wrong response code: got %d, wanted %d", e.id, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminPostTaxRule(t *testing.T) {
+	var tests = []struct {
+		name               string
+		id                 string
+		body               string
+		expectedStatusCode int
+	}{
+		{"new-percent", "0", "name=Lodging+tax&type=percent&amount=13.5&active=1", http.StatusSeeOther},
+		{"new-fee", "0", "name=Tourism+fee&type=fixed&amount=250&per_night=1&per_guest=1&valid_from=2050-01-01&room_ids=1&active=1", http.StatusSeeOther},
+		{"edit", "3", "name=Cleaning+fee&type=fixed&amount=4000&room_ids=2&active=1", http.StatusSeeOther},
+		{"unknown", "9", "name=Cleaning+fee&type=fixed&amount=4000", http.StatusNotFound},
+		{"percent-too-high", "0", "name=Lodging+tax&type=percent&amount=150", http.StatusOK},
+		{"percent-not-a-number", "0", "name=Lodging+tax&type=percent&amount=ten", http.StatusOK},
+		{"fee-in-dollars", "0", "name=Cleaning+fee&type=fixed&amount=40.00", http.StatusOK},
+		{"window-reversed", "0", "name=Tourism+fee&type=fixed&amount=250&valid_from=2050-08-31&valid_to=2050-06-01", http.StatusOK},
+		{"missing-name", "0", "type=fixed&amount=250", http.StatusOK},
+		{"bad-type", "0", "name=Fee&type=free&amount=250", http.StatusOK},
+		{"bad-id", "x", "name=Fee&type=fixed&amount=250", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/tax-rules/"+e.id, strings.NewReader(e.body))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostTaxRule)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminPostTaxRule handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminDeleteTaxRule(t *testing.T) {
+	var tests = []struct {
+		id                 string
+		expectedStatusCode int
+	}{
+		{"1", http.StatusSeeOther},
+		{"9", http.StatusNotFound},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/delete-tax-rule/"+e.id, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminDeleteTaxRule)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminDeleteTaxRule handler for id %s returned wrong response code: got %d, wanted %d", e.id, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminCancellationPolicies(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/cancellation-policies", nil)
+	req = req.WithContext(getCtx(req))
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminCancellationPolicies)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminCancellationPolicies handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "General&#39;s Quarters") {
+		t.Error("AdminCancellationPolicies doesn't show the rooms of the moderate policy")
+	}
+}
+
+func TestRepository_AdminShowCancellationPolicy(t *testing.T) {
+	var tests = []struct {
+		id                 string
+		expectedStatusCode int
+	}{
+		{"0", http.StatusOK},
+		{"2", http.StatusOK},
+		{"9", http.StatusNotFound},
+		{"x", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/cancellation-policies/"+e.id, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminShowCancellationPolicy)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminShowCancellationPolicy handler for id %s returned wrong response code: got %d, wanted %d", e.id, rr.Code, e.expectedStatusCode)
+		}
+		if e.id == "2" && !strings.Contains(rr.Body.String(), "7,100\n2,50") {
+			t.Error("AdminShowCancellationPolicy doesn't show the tiers of the policy")
+		}
+	}
+}
+
+func TestRepository_AdminPostCancellationPolicy(t *testing.T) {
+	var tests = []struct {
+		name               string
+		id                 string
+		body               string
+		expectedStatusCode int
+	}{
+		{"new", "0", "name=Non-refundable&tiers=0%2C0", http.StatusSeeOther},
+		{"edit", "2", "name=Moderate&tiers=7%2C100%0D%0A2%2C50&room_ids=1&room_ids=2", http.StatusSeeOther},
+		{"unknown", "9", "name=Lenient&tiers=1%2C100", http.StatusNotFound},
+		{"missing-name", "0", "tiers=1%2C100", http.StatusOK},
+		{"missing-tiers", "0", "name=Lenient", http.StatusOK},
+		{"bad-tiers", "0", "name=Lenient&tiers=1%2C200", http.StatusOK},
+		{"duplicate-name", "0", "name=strict&tiers=14%2C50", http.StatusOK},
+		{"bad-id", "x", "name=Lenient&tiers=1%2C100", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/cancellation-policies/"+e.id, strings.NewReader(e.body))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostCancellationPolicy)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminPostCancellationPolicy handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminDeleteCancellationPolicy(t *testing.T) {
+	var tests = []struct {
+		id                 string
+		expectedStatusCode int
+	}{
+		{"1", http.StatusSeeOther},
+		{"9", http.StatusNotFound},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/delete-cancellation-policy/"+e.id, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminDeleteCancellationPolicy)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminDeleteCancellationPolicy handler for id %s returned wrong response code: got %d, wanted %d", e.id, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminProperties(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/properties", nil)
+	req = req.WithContext(getCtx(req))
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminProperties)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminProperties handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "Harbour Manager") {
+		t.Error("AdminProperties doesn't show the staff of Harbour House")
+	}
+}
+
+func TestRepository_AdminShowProperty(t *testing.T) {
+	var tests = []struct {
+		id                 string
+		expectedStatusCode int
+	}{
+		{"0", http.StatusOK},
+		{"2", http.StatusOK},
+		{"99", http.StatusNotFound},
+		{"x", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/properties/"+e.id, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminShowProperty)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminShowProperty handler for id %s returned wrong response code: got %d, wanted %d", e.id, rr.Code, e.expectedStatusCode)
+		}
+		if e.id == "2" && !strings.Contains(rr.Body.String(), "Europe/Paris") {
+			t.Error("AdminShowProperty doesn't show the time zone of the property")
+		}
+	}
+}
+
+func TestRepository_AdminPostProperty(t *testing.T) {
+	var tests = []struct {
+		name               string
+		id                 string
+		body               string
+		expectedStatusCode int
+	}{
+		{"new", "0", "name=Lighthouse&email=light%40house.com&time_zone=America%2FHalifax&currency=usd", http.StatusSeeOther},
+		{"edit", "1", "name=Fort+Smythe&email=owner%40email.com&time_zone=America%2FHalifax&currency=USD&room_ids=1&room_ids=2", http.StatusSeeOther},
+		{"move-room", "2", "name=Harbour+House&email=harbour%40email.com&time_zone=Europe%2FParis&currency=EUR&room_ids=2&user_ids=2", http.StatusSeeOther},
+		{"unknown", "99", "name=Lighthouse&email=light%40house.com&time_zone=UTC&currency=USD", http.StatusNotFound},
+		{"missing-name", "0", "email=light%40house.com&time_zone=UTC&currency=USD", http.StatusOK},
+		{"bad-email", "0", "name=Lighthouse&email=light&time_zone=UTC&currency=USD", http.StatusOK},
+		{"bad-time-zone", "0", "name=Lighthouse&email=light%40house.com&time_zone=Mars%2FOlympus&currency=USD", http.StatusOK},
+		{"bad-currency", "0", "name=Lighthouse&email=light%40house.com&time_zone=UTC&currency=GBP", http.StatusOK},
+		{"bad-policy", "0", "name=Lighthouse&email=light%40house.com&time_zone=UTC&currency=USD&cancellation_policy_id=9", http.StatusOK},
+		{"room-left-out", "1", "name=Fort+Smythe&email=owner%40email.com&time_zone=America%2FHalifax&currency=USD&room_ids=1", http.StatusOK},
+		{"duplicate-name", "0", "name=harbour+house&email=light%40house.com&time_zone=UTC&currency=EUR", http.StatusOK},
+		{"bad-id", "x", "name=Lighthouse&email=light%40house.com&time_zone=UTC&currency=USD", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/properties/"+e.id, strings.NewReader(e.body))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostProperty)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminPostProperty handler for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_AdminDeleteProperty(t *testing.T) {
+	var tests = []struct {
+		id                 string
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"1", http.StatusSeeOther, "/admin/properties/1"},
+		{"2", http.StatusSeeOther, "/admin/properties"},
+		{"99", http.StatusNotFound, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/delete-property/"+e.id, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminDeleteProperty)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("AdminDeleteProperty handler for id %s returned wrong response code: got %d, wanted %d", e.id, rr.Code, e.expectedStatusCode)
+		}
+		if location := rr.Header().Get("Location"); location != e.expectedLocation {
+			t.Errorf("AdminDeleteProperty handler for id %s redirected to %q, wanted %q", e.id, location, e.expectedLocation)
+		}
+	}
+}
+
+func TestRepository_StaffProperties(t *testing.T) {
+	var tests = []struct {
+		name               string
+		userID             int
+		expectedStatusCode int
+		expectedProperties []int
+	}{
+		{"signed-out", 0, http.StatusForbidden, nil},
+		{"every-property", 1, http.StatusOK, nil},
+		{"own-property", 2, http.StatusOK, []int{2}},
+	}
+
+	for _, e := range tests {
+		var properties []int
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			properties = staffProperties(r)
+		})
+
+		req, _ := http.NewRequest("GET", "/admin/dashboard", nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		if e.userID != 0 {
+			session.Put(ctx, "user_id", e.userID)
+		}
+		rr := httptest.NewRecorder()
+
+		Repo.StaffProperties(next).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("StaffProperties for %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+		if !reflect.DeepEqual(properties, e.expectedProperties) {
+			t.Errorf("StaffProperties for %s limited the admin tool to %v, wanted %v", e.name, properties, e.expectedProperties)
+		}
+	}
+}
+
+func TestRepository_PropertyAccess(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	var tests = []struct {
+		name               string
+		properties         []int
+		middleware         func(http.Handler) http.Handler
+		id                 string
+		expectedStatusCode int
+	}{
+		{"all-properties", nil, Repo.AllProperties, "", http.StatusOK},
+		{"all-properties-limited", []int{2}, Repo.AllProperties, "", http.StatusForbidden},
+		{"reservation", nil, Repo.ReservationAccess, "1", http.StatusOK},
+		{"reservation-own-property", []int{1}, Repo.ReservationAccess, "1", http.StatusOK},
+		{"reservation-other-property", []int{2}, Repo.ReservationAccess, "1", http.StatusNotFound},
+		{"reservation-bad-id", []int{2}, Repo.ReservationAccess, "x", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/reservations/all/"+e.id+"/show", nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(context.WithValue(ctx, propertiesKey{}, e.properties))
+		rr := httptest.NewRecorder()
+
+		e.middleware(next).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
 
 func getCtx(req *http.Request) context.Context {
 	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
@@ -17,17 +17,35 @@ import (
 	"github.com/justinas/nosurf"
 
 	"github.com/tsawler/bookings-app/internal/config"
+	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/i18n"
 	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/money"
+	"github.com/tsawler/bookings-app/internal/payments"
 	"github.com/tsawler/bookings-app/internal/render"
 )
 
 var app config.AppConfig
 var session *scs.SessionManager
 var pathToTemplates = "./../../templates"
-var functions = template.FuncMap{}
+var functions = template.FuncMap{
+	"humanDate":    render.HumanDate,
+	"formatDate":   render.FormatDate,
+	"formatPrice":  render.FormatPrice,
+	"formatMoney":  render.FormatMoney,
+	"T":            i18n.T,
+	"localDate":    i18n.Date,
+	"localNumber":  i18n.Number,
+	"localPrice":   render.LocalPrice,
+	"displayPrice": render.DisplayPrice,
+	"currencies":   render.Currencies,
+	"baseCurrency": render.BaseCurrency,
+	"locales":      render.Locales,
+}
 
 func TestMain(m *testing.M) {
 	gob.Register(models.Reservation{})
+	gob.Register(models.RoomRestriction{})
 
 	// change this to true when in production
 	app.InProduction = false
@@ -46,6 +64,11 @@ func TestMain(m *testing.M) {
 	session.Cookie.Secure = app.InProduction
 
 	app.Session = session
+	app.Currency = "USD"
+	app.Rates = money.NewRates(app.Currency)
+	app.Rates.Set(map[string]float64{"EUR": 0.9, "JPY": 150})
+	app.PhoneCountry = "1"
+	app.Payments = payments.NewFakeProvider()
 
 	mailChan := make(chan models.MailData)
 	app.MailChan = mailChan
@@ -65,6 +88,7 @@ func TestMain(m *testing.M) {
 	NewHandlers(repo)
 
 	render.NewRenderer(&app)
+	helpers.NewHelpers(&app)
 
 	os.Exit(m.Run())
 }
@@ -97,6 +121,11 @@ func getRoutes() http.Handler {
 	session.Cookie.Secure = app.InProduction
 
 	app.Session = session
+	app.Currency = "USD"
+	app.Rates = money.NewRates(app.Currency)
+	app.Rates.Set(map[string]float64{"EUR": 0.9, "JPY": 150})
+	app.PhoneCountry = "1"
+	app.Payments = payments.NewFakeProvider()
 
 	tc, err := CreateTestTemplateCache()
 	if err != nil {
@@ -110,6 +139,7 @@ func getRoutes() http.Handler {
 	NewHandlers(repo)
 
 	render.NewRenderer(&app)
+	helpers.NewHelpers(&app)
 
 	mux := chi.NewRouter()
 
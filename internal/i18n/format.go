@@ -0,0 +1,48 @@
+package i18n
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayouts are how each locale writes a date. Korean and Japanese use month numbers, as Go
+// only knows the English month names.
+var dateLayouts = map[string]string{
+	"en": "January 2, 2006",
+	"ko": "2006년 1월 2일",
+	"ja": "2006年1月2日",
+}
+
+// Date formats a date the way locale writes it, such as "January 2, 2006" or "2006년 1월 2일"
+func Date(locale string, t time.Time) string {
+	layout, ok := dateLayouts[locale]
+	if !ok {
+		layout = dateLayouts[Default]
+	}
+	return t.Format(layout)
+}
+
+// DateTime formats a date and a 24 hour time, such as "January 2, 2006 15:04"
+func DateTime(locale string, t time.Time) string {
+	return Date(locale, t) + " " + t.Format("15:04")
+}
+
+// Number formats a whole number with the thousands separator of locale
+func Number(locale string, n int) string {
+	s := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+
+	// all the supported locales group by thousands with a comma
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteRune(',')
+		}
+		b.WriteRune(r)
+	}
+	return sign + b.String()
+}
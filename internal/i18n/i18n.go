@@ -0,0 +1,138 @@
+// Package i18n translates the text guests see and formats dates and numbers for their language.
+//
+// Messages are looked up by their English text, so English needs no catalog and a message
+// missing from a catalog shows in English rather than not at all.
+package i18n
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default is the locale used when nothing better is known
+const Default = "en"
+
+// CookieName is the cookie that remembers the locale a guest chose
+const CookieName = "lang"
+
+// Supported lists the locales the site is translated into
+var Supported = []string{"en", "ko", "ja"}
+
+// Names are the names of the supported locales, in their own language, for language menus
+var Names = map[string]string{
+	"en": "English",
+	"ko": "한국어",
+	"ja": "日本語",
+}
+
+var catalogs = map[string]map[string]string{
+	"ko": ko,
+	"ja": ja,
+}
+
+type contextKey struct{}
+
+// T translates msg into locale, then formats it with args like fmt.Sprintf if there are any
+func T(locale, msg string, args ...interface{}) string {
+	if translated, ok := catalogs[locale][msg]; ok {
+		msg = translated
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// IsSupported reports whether locale is one of Supported
+func IsSupported(locale string) bool {
+	for _, l := range Supported {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize returns the supported locale for a language tag such as "ko-KR", or "" if there is none
+func Normalize(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if IsSupported(tag) {
+		return tag
+	}
+	return ""
+}
+
+// Match returns the supported locale the guest prefers most in an Accept-Language header, or
+// Default if they accept none of them
+func Match(acceptLanguage string) string {
+	type choice struct {
+		locale string
+		q      float64
+	}
+
+	var choices []choice
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(part, ";")
+		locale := Normalize(fields[0])
+		if locale == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			choices = append(choices, choice{locale, q})
+		}
+	}
+	if len(choices) == 0 {
+		return Default
+	}
+
+	sort.SliceStable(choices, func(i, j int) bool {
+		return choices[i].q > choices[j].q
+	})
+	return choices[0].locale
+}
+
+// SplitPath takes a locale prefix off a URL path, so "/ko/search-availability" gives "ko" and
+// "/search-availability". Paths without a supported prefix come back unchanged with no locale.
+func SplitPath(path string) (locale, rest string) {
+	trimmed := strings.TrimPrefix(path, "/")
+	prefix := trimmed
+	if i := strings.Index(trimmed, "/"); i >= 0 {
+		prefix = trimmed[:i]
+	}
+	if !IsSupported(prefix) {
+		return "", path
+	}
+	rest = strings.TrimPrefix(trimmed, prefix)
+	if rest == "" {
+		rest = "/"
+	}
+	return prefix, rest
+}
+
+// WithLocale returns a context carrying locale
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, contextKey{}, locale)
+}
+
+// FromContext returns the locale in ctx, or Default
+func FromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(contextKey{}).(string); ok && locale != "" {
+		return locale
+	}
+	return Default
+}
@@ -0,0 +1,124 @@
+package i18n
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestT(t *testing.T) {
+	var tests = []struct {
+		locale   string
+		msg      string
+		args     []interface{}
+		expected string
+	}{
+		{"en", "This field cannot be blank", nil, "This field cannot be blank"},
+		{"ko", "This field cannot be blank", nil, "필수 입력 항목입니다"},
+		{"ja", "This field must be at least %d characters long", []interface{}{3}, "3文字以上で入力してください"},
+		{"ko", "Not in any catalog", nil, "Not in any catalog"},
+		{"fr", "Dear %s,", []interface{}{"John"}, "Dear John,"},
+	}
+
+	for _, e := range tests {
+		if got := T(e.locale, e.msg, e.args...); got != e.expected {
+			t.Errorf("T(%q, %q) is %q, wanted %q", e.locale, e.msg, got, e.expected)
+		}
+	}
+}
+
+func TestCatalogs(t *testing.T) {
+	for locale, catalog := range catalogs {
+		for msg, translated := range catalog {
+			if strings.Count(msg, "%") != strings.Count(translated, "%") {
+				t.Errorf("the %s translation of %q has different verbs: %q", locale, msg, translated)
+			}
+		}
+		for other, otherCatalog := range catalogs {
+			for msg := range otherCatalog {
+				if _, ok := catalog[msg]; !ok {
+					t.Errorf("%q is translated for %s but not for %s", msg, other, locale)
+				}
+			}
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	var tests = []struct {
+		header   string
+		expected string
+	}{
+		{"", "en"},
+		{"ko-KR,ko;q=0.9,en-US;q=0.8,en;q=0.7", "ko"},
+		{"en-US,en;q=0.9,ja;q=0.8", "en"},
+		{"fr-FR,fr;q=0.9,ja;q=0.5", "ja"},
+		{"ko;q=0.3, ja;q=0.6", "ja"},
+		{"ja;q=0, ko", "ko"},
+		{"fr, de", "en"},
+	}
+
+	for _, e := range tests {
+		if got := Match(e.header); got != e.expected {
+			t.Errorf("Match(%q) is %q, wanted %q", e.header, got, e.expected)
+		}
+	}
+}
+
+func TestSplitPath(t *testing.T) {
+	var tests = []struct {
+		path           string
+		expectedLocale string
+		expectedRest   string
+	}{
+		{"/ko/search-availability", "ko", "/search-availability"},
+		{"/ja", "ja", "/"},
+		{"/en/", "en", "/"},
+		{"/search-availability", "", "/search-availability"},
+		{"/kor/x", "", "/kor/x"},
+		{"/", "", "/"},
+	}
+
+	for _, e := range tests {
+		locale, rest := SplitPath(e.path)
+		if locale != e.expectedLocale || rest != e.expectedRest {
+			t.Errorf("SplitPath(%q) is %q, %q, wanted %q, %q", e.path, locale, rest, e.expectedLocale, e.expectedRest)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != Default {
+		t.Errorf("FromContext without a locale is %q, wanted %q", got, Default)
+	}
+	if got := FromContext(WithLocale(context.Background(), "ja")); got != "ja" {
+		t.Errorf("FromContext is %q, wanted ja", got)
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	d := time.Date(2050, 3, 7, 15, 4, 0, 0, time.UTC)
+
+	var dates = map[string]string{
+		"en": "March 7, 2050",
+		"ko": "2050년 3월 7일",
+		"ja": "2050年3月7日",
+		"fr": "March 7, 2050",
+	}
+	for locale, expected := range dates {
+		if got := Date(locale, d); got != expected {
+			t.Errorf("Date for %s is %q, wanted %q", locale, got, expected)
+		}
+	}
+	if got := DateTime("ja", d); got != "2050年3月7日 15:04" {
+		t.Errorf("DateTime is %q", got)
+	}
+
+	var numbers = map[int]string{0: "0", 999: "999", 1000: "1,000", -1234567: "-1,234,567"}
+	for n, expected := range numbers {
+		if got := Number("ko", n); got != expected {
+			t.Errorf("Number(%d) is %q, wanted %q", n, got, expected)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package i18n
+
+// ja is the Japanese catalog
+var ja = map[string]string{
+	// site
+	"Fort Smythe Bed and Breakfast":            "フォート・スマイス B&B",
+	"Welcome to Fort Smythe Bed and Breakfast": "フォート・スマイス B&B へようこそ",
+	"Home":                 "ホーム",
+	"About":                "紹介",
+	"Rooms":                "客室",
+	"General's Quarters":   "ジェネラルズ・クォーターズ",
+	"Major's Suite":        "メジャーズ・スイート",
+	"Book Now":             "今すぐ予約",
+	"Contact":              "お問い合わせ",
+	"Login":                "ログイン",
+	"Make Reservation Now": "今すぐ予約する",
+	"Check Availability":   "空室を確認",
+
+	// booking
+	"Search for Availability":               "空室検索",
+	"Search Availability":                   "検索",
+	"Arrival":                               "チェックイン",
+	"Departure":                             "チェックアウト",
+	"Choose a Room":                         "客室を選択",
+	"Make a Reservation":                    "予約する",
+	"Reservation Details":                   "予約内容",
+	"Room":                                  "客室",
+	"Rate":                                  "料金",
+	"%s per night":                          "1泊 %s",
+	"%d nights":                             "%d泊",
+	"This room is held for you for another": "この客室はお客様のために確保されています。残り時間:",
+	"Your hold on this room has expired.":   "客室の確保期限が切れました。",
+	"Search again":                          "もう一度検索",
+	"First Name":                            "名",
+	"Last Name":                             "姓",
+	"Name":                                  "氏名",
+	"Email":                                 "メールアドレス",
+	"Phone":                                 "電話番号",
+	"Special Requests":                      "ご要望",
+	"Late arrival, extra pillows, ...":      "到着が遅くなる、枕を追加したい など",
+	"Promo Code":                            "プロモーションコード",
+	"Make Reservation":                      "予約する",
+	"Reservation Summary":                   "予約の概要",
+	"Discount":                              "割引",
+	"Total":                                 "合計",
+	"Guests":                                "人数",
+	"Fees per guest are worked out again for the number of guests you book for.": "お一人様あたりの料金は、ご予約人数に合わせて再計算されます。",
+	"Prices in %s are estimates. You will be charged %s.":                        "%sでの価格は目安です。実際のご請求額は%sです。",
+	"Charged as %s": "ご請求額: %s",
+
+	// the usual names of tax and fee rules, which admins name in English
+	"Lodging tax":  "宿泊税",
+	"Tourism fee":  "観光税",
+	"Cleaning fee": "清掃料",
+
+	// cancellations
+	"Cancellation policy: %s":                              "キャンセルポリシー: %s",
+	"Cancel %d or more days before arrival: %d%% refunded": "チェックインの%d日前までのキャンセル: %d%%返金",
+	"Cancellations after that aren't refunded.":            "それ以降のキャンセルは返金されません。",
+	"Flexible":                            "フレキシブル",
+	"Moderate":                            "スタンダード",
+	"Strict":                              "ストリクト",
+	"Cancel Reservation":                  "予約のキャンセル",
+	"Paid":                                "お支払い済み",
+	"Cancellation fee":                    "キャンセル料",
+	"Refund":                              "返金額",
+	"Still owed":                          "未払い額",
+	"Cancel this reservation":             "この予約をキャンセルする",
+	"Are you sure? This can't be undone.": "キャンセルしてよろしいですか? 元に戻すことはできません。",
+	"This reservation can't be cancelled online, please contact us": "この予約はオンラインではキャンセルできません。お問い合わせください",
+
+	// waitlist
+	"Join the Waitlist": "キャンセル待ちに登録",
+	"Every room is booked for these dates. Leave your details and we'll email you a booking link as soon as the room you want frees up.": "この日程はすべての客室が予約済みです。ご連絡先をご登録いただければ、ご希望の客室が空き次第、予約用のリンクをメールでお送りします。",
+	"Join Waitlist": "キャンセル待ちに登録",
+
+	// flash messages
+	"Invalid room or dates, please search again":                               "客室または日付が正しくありません。もう一度検索してください",
+	"Departure must be after arrival":                                          "チェックアウトはチェックインより後の日付にしてください",
+	"No availability, but you can join the waitlist":                           "空室はありませんが、キャンセル待ちに登録できます",
+	"Sorry, that room was just taken for these dates":                          "申し訳ありません。この日程の客室はたった今予約されました",
+	"Sorry, the room has been booked again for these dates":                    "申し訳ありません。この日程の客室は再び予約されました",
+	"Your hold on this room has expired, please search again":                  "客室の確保期限が切れました。もう一度検索してください",
+	"Your room is booked, but we couldn't take the deposit. We'll be in touch": "ご予約は完了しましたが、デポジットの決済ができませんでした。追ってご連絡いたします",
+	"You're on the waitlist. We'll email you if the room frees up":             "キャンセル待ちに登録しました。客室が空き次第メールでお知らせします",
+	"This booking link is invalid or has expired":                              "この予約リンクは無効か、期限が切れています",
+	"Can't find that reservation":                                              "予約が見つかりません",
+
+	// cancellations
+	"This reservation has just been changed, please try again":                             "ご予約がたった今変更されました。もう一度お試しください",
+	"Your reservation is cancelled":                                                        "ご予約をキャンセルしました",
+	"Your reservation is cancelled, but we couldn't return your refund. We'll be in touch": "ご予約はキャンセルされましたが、返金を処理できませんでした。追ってご連絡いたします",
+
+	// promo codes
+	"This promo code is not valid":                          "無効なプロモーションコードです",
+	"This promo code is not valid for your dates":           "ご指定の日程ではこのプロモーションコードをご利用いただけません",
+	"This promo code can't be used for this room":           "この客室ではこのプロモーションコードをご利用いただけません",
+	"This promo code requires a stay of at least %d nights": "このプロモーションコードは%d泊以上のご宿泊が必要です",
+	"This promo code has been fully redeemed":               "このプロモーションコードは利用上限に達しました",
+	"You have already used this promo code":                 "このプロモーションコードはすでにご利用済みです",
+
+	// form validation
+	"This field cannot be blank":                     "必須項目です",
+	"This field must be at least %d characters long": "%d文字以上で入力してください",
+	"This field must be at most %d characters long":  "%d文字以内で入力してください",
+	"Invalid email address":                          "メールアドレスが正しくありません",
+	"Invalid phone number":                           "電話番号が正しくありません",
+	"This field must be a whole number":              "整数で入力してください",
+	"This field must be from %d to %d":               "%dから%dの間で入力してください",
+	"Invalid date":                                   "日付が正しくありません",
+	"This date must be after %s":                     "%sより後の日付にしてください",
+	"This date must be before %s":                    "%sより前の日付にしてください",
+	"This date is in the past":                       "過去の日付です",
+	"This date must be after the start date":         "開始日より後の日付にしてください",
+	"The values do not match":                        "値が一致しません",
+	"Invalid choice":                                 "選択が正しくありません",
+	"This field is not in the expected format":       "形式が正しくありません",
+	"Please enter a number":                          "数値を入力してください",
+	"Please enter a date":                            "日付を入力してください",
+	"Please enter a time, such as 18:30":             "18:30のように時刻を入力してください",
+	"Please choose one of the options":               "選択肢から選んでください",
+
+	// emails
+	"Reservation Confirmation": "ご予約の確認",
+	"Dear %s,":                 "%s 様",
+	"This is to confirm your reservation from %s to %s.": "%sから%sまでのご予約を承りました。",
+	"Total: %s":           "合計: %s",
+	"View your invoice":   "請求書を見る",
+	"Reservation Changed": "ご予約の変更",
+	"Your reservation has been changed. You are now staying in %s from %s to %s.": "ご予約が変更されました。%sに%sから%sまでご宿泊いただけます。",
+	"Good news!":                         "お知らせです!",
+	"%s is now available from %s to %s.": "%sが%sから%sまでご予約いただけるようになりました。",
+	"Book it now, before %s":             "%sまでにご予約ください",
+	"A room you waited for is available": "キャンセル待ちの客室が空きました",
+
+	// cancellations
+	"Cancel your reservation":                      "ご予約をキャンセルする",
+	"Reservation Cancelled":                        "ご予約のキャンセル",
+	"Your reservation from %s to %s is cancelled.": "%sから%sまでのご予約はキャンセルされました。",
+	"Refund: %s":                                   "返金額: %s",
+
+	// properties
+	"House":      "施設",
+	"All houses": "すべての施設",
+}
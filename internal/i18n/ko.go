@@ -0,0 +1,145 @@
+package i18n
+
+// ko is the Korean catalog
+var ko = map[string]string{
+	// site
+	"Fort Smythe Bed and Breakfast":            "포트 스마이스 B&B",
+	"Welcome to Fort Smythe Bed and Breakfast": "포트 스마이스 B&B에 오신 것을 환영합니다",
+	"Home":                 "홈",
+	"About":                "소개",
+	"Rooms":                "객실",
+	"General's Quarters":   "제너럴스 쿼터스",
+	"Major's Suite":        "메이저스 스위트",
+	"Book Now":             "지금 예약",
+	"Contact":              "문의",
+	"Login":                "로그인",
+	"Make Reservation Now": "지금 예약하기",
+	"Check Availability":   "예약 가능 여부 확인",
+
+	// booking
+	"Search for Availability":               "예약 가능한 객실 검색",
+	"Search Availability":                   "검색",
+	"Arrival":                               "체크인",
+	"Departure":                             "체크아웃",
+	"Choose a Room":                         "객실 선택",
+	"Make a Reservation":                    "예약하기",
+	"Reservation Details":                   "예약 내용",
+	"Room":                                  "객실",
+	"Rate":                                  "요금",
+	"%s per night":                          "1박 %s",
+	"%d nights":                             "%d박",
+	"This room is held for you for another": "이 객실은 다음 시간 동안 고객님을 위해 보류됩니다:",
+	"Your hold on this room has expired.":   "객실 보류 시간이 만료되었습니다.",
+	"Search again":                          "다시 검색",
+	"First Name":                            "이름",
+	"Last Name":                             "성",
+	"Name":                                  "성명",
+	"Email":                                 "이메일",
+	"Phone":                                 "전화번호",
+	"Special Requests":                      "요청 사항",
+	"Late arrival, extra pillows, ...":      "늦은 체크인, 베개 추가 등",
+	"Promo Code":                            "프로모션 코드",
+	"Make Reservation":                      "예약하기",
+	"Reservation Summary":                   "예약 요약",
+	"Discount":                              "할인",
+	"Total":                                 "합계",
+	"Guests":                                "인원",
+	"Fees per guest are worked out again for the number of guests you book for.": "1인당 요금은 예약 인원에 맞춰 다시 계산됩니다.",
+	"Prices in %s are estimates. You will be charged %s.":                        "%s 가격은 예상 금액입니다. 실제 결제 금액은 %s입니다.",
+	"Charged as %s": "결제 금액: %s",
+
+	// the usual names of tax and fee rules, which admins name in English
+	"Lodging tax":  "숙박세",
+	"Tourism fee":  "관광세",
+	"Cleaning fee": "청소비",
+
+	// cancellations
+	"Cancellation policy: %s":                              "취소 규정: %s",
+	"Cancel %d or more days before arrival: %d%% refunded": "체크인 %d일 전까지 취소 시 %d%% 환불",
+	"Cancellations after that aren't refunded.":            "그 이후 취소 시에는 환불되지 않습니다.",
+	"Flexible":                            "유연",
+	"Moderate":                            "보통",
+	"Strict":                              "엄격",
+	"Cancel Reservation":                  "예약 취소",
+	"Paid":                                "결제 금액",
+	"Cancellation fee":                    "취소 수수료",
+	"Refund":                              "환불 금액",
+	"Still owed":                          "미결제 금액",
+	"Cancel this reservation":             "이 예약 취소하기",
+	"Are you sure? This can't be undone.": "정말 취소하시겠습니까? 되돌릴 수 없습니다.",
+	"This reservation can't be cancelled online, please contact us": "이 예약은 온라인으로 취소할 수 없습니다. 문의해 주세요",
+
+	// waitlist
+	"Join the Waitlist": "대기자 명단 등록",
+	"Every room is booked for these dates. Leave your details and we'll email you a booking link as soon as the room you want frees up.": "이 날짜에는 모든 객실이 예약되어 있습니다. 연락처를 남겨 주시면 원하시는 객실이 비는 즉시 예약 링크를 이메일로 보내 드립니다.",
+	"Join Waitlist": "대기자 등록",
+
+	// flash messages
+	"Invalid room or dates, please search again":                               "객실 또는 날짜가 올바르지 않습니다. 다시 검색해 주세요",
+	"Departure must be after arrival":                                          "체크아웃은 체크인 이후여야 합니다",
+	"No availability, but you can join the waitlist":                           "예약 가능한 객실이 없지만 대기자 명단에 등록하실 수 있습니다",
+	"Sorry, that room was just taken for these dates":                          "죄송합니다. 방금 이 날짜에 해당 객실이 예약되었습니다",
+	"Sorry, the room has been booked again for these dates":                    "죄송합니다. 이 날짜에 객실이 다시 예약되었습니다",
+	"Your hold on this room has expired, please search again":                  "객실 보류 시간이 만료되었습니다. 다시 검색해 주세요",
+	"Your room is booked, but we couldn't take the deposit. We'll be in touch": "객실은 예약되었지만 보증금 결제에 실패했습니다. 곧 연락드리겠습니다",
+	"You're on the waitlist. We'll email you if the room frees up":             "대기자 명단에 등록되었습니다. 객실이 비면 이메일로 알려 드립니다",
+	"This booking link is invalid or has expired":                              "이 예약 링크는 유효하지 않거나 만료되었습니다",
+	"Can't find that reservation":                                              "예약을 찾을 수 없습니다",
+
+	// cancellations
+	"This reservation has just been changed, please try again":                             "방금 예약이 변경되었습니다. 다시 시도해 주세요",
+	"Your reservation is cancelled":                                                        "예약이 취소되었습니다",
+	"Your reservation is cancelled, but we couldn't return your refund. We'll be in touch": "예약은 취소되었지만 환불을 처리하지 못했습니다. 곧 연락드리겠습니다",
+
+	// promo codes
+	"This promo code is not valid":                          "유효하지 않은 프로모션 코드입니다",
+	"This promo code is not valid for your dates":           "선택하신 날짜에는 사용할 수 없는 프로모션 코드입니다",
+	"This promo code can't be used for this room":           "이 객실에는 사용할 수 없는 프로모션 코드입니다",
+	"This promo code requires a stay of at least %d nights": "이 프로모션 코드는 최소 %d박 이상 숙박 시 사용할 수 있습니다",
+	"This promo code has been fully redeemed":               "사용 한도에 도달한 프로모션 코드입니다",
+	"You have already used this promo code":                 "이미 사용하신 프로모션 코드입니다",
+
+	// form validation
+	"This field cannot be blank":                     "필수 입력 항목입니다",
+	"This field must be at least %d characters long": "%d자 이상 입력해 주세요",
+	"This field must be at most %d characters long":  "%d자 이하로 입력해 주세요",
+	"Invalid email address":                          "올바른 이메일 주소가 아닙니다",
+	"Invalid phone number":                           "올바른 전화번호가 아닙니다",
+	"This field must be a whole number":              "정수를 입력해 주세요",
+	"This field must be from %d to %d":               "%d에서 %d 사이의 값을 입력해 주세요",
+	"Invalid date":                                   "올바른 날짜가 아닙니다",
+	"This date must be after %s":                     "%s 이후의 날짜여야 합니다",
+	"This date must be before %s":                    "%s 이전의 날짜여야 합니다",
+	"This date is in the past":                       "지난 날짜입니다",
+	"This date must be after the start date":         "시작일 이후의 날짜여야 합니다",
+	"The values do not match":                        "값이 일치하지 않습니다",
+	"Invalid choice":                                 "올바른 선택이 아닙니다",
+	"This field is not in the expected format":       "형식이 올바르지 않습니다",
+	"Please enter a number":                          "숫자를 입력해 주세요",
+	"Please enter a date":                            "날짜를 입력해 주세요",
+	"Please enter a time, such as 18:30":             "18:30과 같이 시간을 입력해 주세요",
+	"Please choose one of the options":               "항목 중 하나를 선택해 주세요",
+
+	// emails
+	"Reservation Confirmation": "예약 확인",
+	"Dear %s,":                 "%s 님께,",
+	"This is to confirm your reservation from %s to %s.": "%s부터 %s까지의 예약이 확정되었습니다.",
+	"Total: %s":           "합계: %s",
+	"View your invoice":   "청구서 보기",
+	"Reservation Changed": "예약 변경 안내",
+	"Your reservation has been changed. You are now staying in %s from %s to %s.": "예약이 변경되었습니다. %s 객실에서 %s부터 %s까지 숙박하십니다.",
+	"Good news!":                         "좋은 소식입니다!",
+	"%s is now available from %s to %s.": "%s 객실을 %s부터 %s까지 예약하실 수 있습니다.",
+	"Book it now, before %s":             "%s 전에 지금 예약하세요",
+	"A room you waited for is available": "기다리시던 객실이 예약 가능합니다",
+
+	// cancellations
+	"Cancel your reservation":                      "예약 취소하기",
+	"Reservation Cancelled":                        "예약 취소 안내",
+	"Your reservation from %s to %s is cancelled.": "%s부터 %s까지의 예약이 취소되었습니다.",
+	"Refund: %s":                                   "환불 금액: %s",
+
+	// properties
+	"House":      "숙소",
+	"All houses": "모든 숙소",
+}
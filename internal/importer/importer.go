@@ -0,0 +1,320 @@
+// Package importer loads reservations from CSV files, such as a spreadsheet of past bookings or an
+// export from another booking system
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/forms"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/money"
+	"github.com/tsawler/bookings-app/internal/repository"
+)
+
+// Fields are the reservation fields a column can be mapped to. room takes a room's id or name.
+var Fields = []string{
+	"first_name",
+	"last_name",
+	"email",
+	"phone",
+	"room",
+	"start_date",
+	"end_date",
+	"status",
+	"source",
+	"nightly_rate",
+}
+
+// requiredFields must be mapped to a column and filled in on every row
+var requiredFields = []string{"first_name", "last_name", "email", "room", "start_date", "end_date"}
+
+// DateLayouts are the date formats files may use
+var DateLayouts = []string{"2006-01-02", "01/02/2006", "02/01/2006", "02.01.2006"}
+
+// Mapping maps fields to the header of the column holding them. Fields that aren't mapped are read
+// from the column named like the field, ignoring case, spaces and dashes, if there is one.
+type Mapping map[string]string
+
+// ParseMapping parses a mapping written as field=column pairs separated by commas, such as
+// "first_name=First,last_name=Surname"
+func ParseMapping(s string) (Mapping, error) {
+	m := Mapping{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		i := strings.IndexByte(pair, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("mapping %q is not field=column", pair)
+		}
+		field := strings.TrimSpace(pair[:i])
+		if !isField(field) {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		m[field] = strings.TrimSpace(pair[i+1:])
+	}
+	return m, nil
+}
+
+func isField(field string) bool {
+	for _, f := range Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize turns a header such as "First Name" into the field name first_name
+func normalize(header string) string {
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(header)))
+}
+
+// Options control how a file is read
+type Options struct {
+	Mapping Mapping
+	// DateLayout is the format of dates in the file, 2006-01-02 unless set
+	DateLayout string
+	// Currencies are the currencies of the properties by id. Amounts are in the currency of the
+	// property of their room, which says how many decimals they have.
+	Currencies map[int]string
+}
+
+// Row is a line of the file, with the reservation read from it or what is wrong with it
+type Row struct {
+	Line        int
+	Reservation models.Reservation
+	Errors      []string
+}
+
+// Valid reports whether the row can be imported
+func (r Row) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+// Result is the outcome of an import
+type Result struct {
+	Rows     []Row
+	Imported int
+	DryRun   bool
+}
+
+// Failed returns the rows that were not imported
+func (r Result) Failed() []Row {
+	var failed []Row
+	for _, row := range r.Rows {
+		if !row.Valid() {
+			failed = append(failed, row)
+		}
+	}
+	return failed
+}
+
+// Read reads the rows of a CSV file and checks each of them. The first line must name the columns.
+// Rows that fail the checks are returned with their errors; an error is only returned when the file
+// as a whole can't be read.
+func Read(r io.Reader, opts Options, rooms []models.Room) ([]Row, error) {
+	layout := opts.DateLayout
+	if layout == "" {
+		layout = DateLayouts[0]
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("the file is empty")
+	} else if err != nil {
+		return nil, err
+	}
+
+	columns, err := mapColumns(header, opts.Mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []Row
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		values := url.Values{}
+		for field, col := range columns {
+			if col < len(record) {
+				values.Set(field, strings.TrimSpace(record[col]))
+			}
+		}
+		rows = append(rows, readRow(line, values, layout, opts.Currencies, rooms))
+	}
+
+	return rows, nil
+}
+
+// mapColumns finds the index of the column holding each field
+func mapColumns(header []string, mapping Mapping) (map[string]int, error) {
+	columns := make(map[string]int)
+	for field, name := range mapping {
+		if name == "" {
+			continue
+		}
+		found := false
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), name) {
+				columns[field] = i
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("there is no column %q for %s", name, field)
+		}
+	}
+
+	for i, h := range header {
+		field := normalize(h)
+		if _, mapped := columns[field]; !mapped && isField(field) && mapping[field] == "" {
+			columns[field] = i
+		}
+	}
+
+	for _, field := range requiredFields {
+		if _, ok := columns[field]; !ok {
+			return nil, fmt.Errorf("there is no column for %s", field)
+		}
+	}
+	return columns, nil
+}
+
+// readRow checks the values of a row with the rules of the reservation forms and builds its reservation
+func readRow(line int, values url.Values, layout string, currencies map[int]string, rooms []models.Room) Row {
+	form := forms.New(values)
+	form.Required(requiredFields...)
+	if form.Has("email") {
+		form.IsEmail("email")
+	}
+
+	res := models.Reservation{
+		FirstName: form.Get("first_name"),
+		LastName:  form.Get("last_name"),
+		Email:     form.Get("email"),
+		Phone:     form.Get("phone"),
+		Source:    form.Get("source"),
+		Status:    models.ReservationStatus(form.Get("status")),
+	}
+	if res.Source == "" {
+		res.Source = models.SourceImport
+	}
+
+	var room models.Room
+	if form.Has("room") {
+		var ok bool
+		room, ok = findRoom(form.Get("room"), rooms)
+		if !ok {
+			form.Errors.Add("room", "No such room")
+		}
+		res.RoomID = room.ID
+		res.NightlyRate = room.Price
+	}
+
+	if form.Has("start_date") {
+		start, err := time.Parse(layout, form.Get("start_date"))
+		if err != nil {
+			form.Errors.Add("start_date", "Invalid date")
+		}
+		res.StartDate = start
+	}
+	if form.Has("end_date") {
+		end, err := time.Parse(layout, form.Get("end_date"))
+		if err != nil {
+			form.Errors.Add("end_date", "Invalid date")
+		} else if !res.StartDate.IsZero() && !end.After(res.StartDate) {
+			form.Errors.Add("end_date", "Departure must be after arrival")
+		}
+		res.EndDate = end
+	}
+
+	if res.Status == "" {
+		// bookings that are already over have been stayed, anything else is still to come
+		res.Status = models.StatusConfirmed
+		if !res.EndDate.IsZero() && res.EndDate.Before(time.Now()) {
+			res.Status = models.StatusCheckedOut
+		}
+	} else if !res.Status.Valid() {
+		form.Errors.Add("status", "Invalid status")
+	}
+
+	if form.Has("nightly_rate") {
+		rate, err := money.Parse(form.Get("nightly_rate"), currencies[room.PropertyID])
+		if err != nil {
+			form.Errors.Add("nightly_rate", "Invalid amount")
+		}
+		res.NightlyRate = rate
+	}
+
+	row := Row{Line: line, Reservation: res}
+	for _, field := range Fields {
+		if msg := form.Errors.Get(field); msg != "" {
+			row.Errors = append(row.Errors, fmt.Sprintf("%s: %s", field, msg))
+		}
+	}
+	return row
+}
+
+// findRoom finds a room by its id or, ignoring case, its name
+func findRoom(s string, rooms []models.Room) (models.Room, bool) {
+	id, err := strconv.Atoi(s)
+	for _, room := range rooms {
+		if (err == nil && room.ID == id) || strings.EqualFold(room.RoomName, s) {
+			return room, true
+		}
+	}
+	return models.Room{}, false
+}
+
+// Import saves the valid rows in a single transaction, skipping those whose room is already
+// booked for their dates, and reports what happened to every row. With dryRun set the rows are
+// checked the same way but nothing is saved.
+func Import(db repository.DatabaseRepo, rows []Row, dryRun bool) (Result, error) {
+	result := Result{Rows: rows, DryRun: dryRun}
+
+	var valid []int
+	var reservations []models.Reservation
+	for i, row := range rows {
+		if row.Valid() {
+			valid = append(valid, i)
+			reservations = append(reservations, row.Reservation)
+		}
+	}
+	if len(reservations) == 0 {
+		return result, nil
+	}
+
+	conflicts, err := db.ImportReservations(reservations, dryRun)
+	if err != nil {
+		return result, err
+	}
+
+	for j, i := range valid {
+		if conflicts[j] == repository.ErrRoomUnavailable {
+			result.Rows[i].Errors = append(result.Rows[i].Errors, "room: The room is already booked for these dates")
+		} else if conflicts[j] != nil {
+			result.Rows[i].Errors = append(result.Rows[i].Errors, conflicts[j].Error())
+		} else {
+			result.Imported++
+		}
+	}
+	return result, nil
+}
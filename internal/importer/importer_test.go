@@ -0,0 +1,166 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tsawler/bookings-app/internal/config"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/repository/dbrepo"
+)
+
+var testRooms = []models.Room{
+	{ID: 1, RoomName: "General's Quarters", Price: 10000},
+	{ID: 2, RoomName: "Major's Suite", Price: 15000},
+}
+
+func TestParseMapping(t *testing.T) {
+	var tests = []struct {
+		name        string
+		mapping     string
+		expected    Mapping
+		expectError bool
+	}{
+		{"empty", "", Mapping{}, false},
+		{"pairs", "first_name=First, last_name = Surname", Mapping{"first_name": "First", "last_name": "Surname"}, false},
+		{"no-equals", "first_name", nil, true},
+		{"unknown-field", "nickname=Nick", nil, true},
+	}
+
+	for _, e := range tests {
+		m, err := ParseMapping(e.mapping)
+		if (err != nil) != e.expectError {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+			continue
+		}
+		if len(m) != len(e.expected) {
+			t.Errorf("%s: got %v, wanted %v", e.name, m, e.expected)
+		}
+		for k, v := range e.expected {
+			if m[k] != v {
+				t.Errorf("%s: %s mapped to %q, wanted %q", e.name, k, m[k], v)
+			}
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	file := `First Name,Surname,Email,Room,Arrival,Departure,Status,Nightly Rate
+John,Smith,john@smith.com,1,2050-01-01,2050-01-03,,
+Jane,Doe,jane@doe.com,major's suite,2050-02-01,2050-02-05,pending,99.50
+Bad,Email,nope,1,2050-01-01,2050-01-03,,
+No,Room,no@room.com,7,2050-01-01,2050-01-03,,
+Back,Wards,back@wards.com,1,2050-01-03,2050-01-01,,
+Odd,Status,odd@status.com,1,2050-01-01,2050-01-03,lost,
+,,,,,,,
+`
+	opts := Options{Mapping: Mapping{"last_name": "Surname", "start_date": "Arrival", "end_date": "Departure"}}
+	rows, err := Read(strings.NewReader(file), opts, testRooms)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name           string
+		expectedErrors int
+	}{
+		{"valid", 0},
+		{"room-by-name", 0},
+		{"bad-email", 1},
+		{"no-room", 1},
+		{"backwards", 1},
+		{"bad-status", 1},
+		{"blank", 6},
+	}
+	if len(rows) != len(tests) {
+		t.Fatalf("expected %d rows, got %d", len(tests), len(rows))
+	}
+	for i, e := range tests {
+		if len(rows[i].Errors) != e.expectedErrors {
+			t.Errorf("%s: expected %d errors, got %v", e.name, e.expectedErrors, rows[i].Errors)
+		}
+		if rows[i].Line != i+2 {
+			t.Errorf("%s: expected line %d, got %d", e.name, i+2, rows[i].Line)
+		}
+	}
+
+	john := rows[0].Reservation
+	if john.RoomID != 1 || john.NightlyRate != 10000 || john.Status != models.StatusConfirmed || john.Source != models.SourceImport {
+		t.Errorf("unexpected reservation %+v", john)
+	}
+	jane := rows[1].Reservation
+	if jane.RoomID != 2 || jane.NightlyRate != 9950 || jane.Status != models.StatusPending {
+		t.Errorf("unexpected reservation %+v", jane)
+	}
+}
+
+func TestRead_dateLayout(t *testing.T) {
+	file := "first_name,last_name,email,room,start_date,end_date\nJohn,Smith,john@smith.com,1,31/01/2050,02/02/2050\n"
+	rows, err := Read(strings.NewReader(file), Options{DateLayout: "02/01/2006"}, testRooms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rows[0].Valid() || rows[0].Reservation.Nights() != 2 {
+		t.Errorf("unexpected row %+v", rows[0])
+	}
+}
+
+func TestRead_currency(t *testing.T) {
+	file := "first_name,last_name,email,room,start_date,end_date,nightly_rate\n" +
+		"John,Smith,john@smith.com,1,2050-01-01,2050-01-03,15000\n" +
+		"Jane,Doe,jane@doe.com,1,2050-01-01,2050-01-03,150.50\n"
+	rooms := []models.Room{{ID: 1, RoomName: "Washitsu", Price: 15000, PropertyID: 2}}
+	rows, err := Read(strings.NewReader(file), Options{Currencies: map[int]string{2: "JPY"}}, rooms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// yen have no decimals, so the rate is taken as it is written
+	if !rows[0].Valid() || rows[0].Reservation.NightlyRate != 15000 {
+		t.Errorf("unexpected row %+v", rows[0])
+	}
+	if rows[1].Valid() {
+		t.Error("a rate in yen with decimals was accepted")
+	}
+}
+
+func TestRead_badFile(t *testing.T) {
+	var tests = []struct {
+		name    string
+		file    string
+		mapping Mapping
+	}{
+		{"empty", "", nil},
+		{"missing-column", "first_name,last_name,email,room,start_date\n", nil},
+		{"unknown-mapped-column", "first_name,last_name,email,room,start_date,end_date\n", Mapping{"phone": "Telephone"}},
+	}
+
+	for _, e := range tests {
+		_, err := Read(strings.NewReader(e.file), Options{Mapping: e.mapping}, testRooms)
+		if err == nil {
+			t.Errorf("%s: expected an error", e.name)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	db := dbrepo.NewTestingRepo(&config.AppConfig{})
+	rows := []Row{
+		{Line: 2, Reservation: models.Reservation{RoomID: 1}},
+		{Line: 3, Reservation: models.Reservation{RoomID: 2}},
+		{Line: 4, Errors: []string{"email: Invalid email address"}},
+	}
+
+	result, err := Import(db, rows, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the test repository always has room 2 booked
+	if result.Imported != 1 || !result.DryRun {
+		t.Errorf("expected 1 row imported in a dry run, got %d", result.Imported)
+	}
+	failed := result.Failed()
+	if len(failed) != 2 || failed[0].Line != 3 || failed[1].Line != 4 {
+		t.Errorf("unexpected failed rows %+v", failed)
+	}
+}
@@ -0,0 +1,105 @@
+package invoices
+
+import (
+	"fmt"
+
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/payments"
+)
+
+// Line is a row of an invoice
+type Line = models.InvoiceLine
+
+// Document is everything printed on an invoice, worked out once so the HTML and the PDF agree
+type Document struct {
+	Invoice     models.Invoice
+	Reservation models.Reservation
+	Lines       []Line
+	Taxes       []Line
+	Discount    int
+	Subtotal    int
+	Total       int
+	Payments    []models.PaymentTransaction
+	Paid        int
+	Balance     int
+}
+
+// New works out the invoice for a reservation as it stands, which is what is kept when the
+// invoice is issued. It has no number until then.
+func New(res models.Reservation, currency string) models.Invoice {
+	inv := models.Invoice{
+		ReservationID: res.ID,
+		Currency:      currency,
+		Lines: []Line{
+			{
+				Description: fmt.Sprintf("%s, %s to %s", res.Room.RoomName, res.StartDate.Format("2006-01-02"), res.EndDate.Format("2006-01-02")),
+				Quantity:    res.Nights(),
+				UnitPrice:   res.NightlyRate,
+				Amount:      res.Subtotal(),
+			},
+		},
+		Taxes:    []Line{},
+		Subtotal: res.Subtotal(),
+		Discount: res.Discount,
+		Total:    res.Total(),
+	}
+	for _, c := range res.Charges {
+		inv.Taxes = append(inv.Taxes, Line{
+			Description: c.Description,
+			Quantity:    1,
+			UnitPrice:   c.Amount,
+			Amount:      c.Amount,
+		})
+	}
+	return inv
+}
+
+// Build puts together the invoice document for an invoice, the reservation it bills and its
+// payment ledger. What was billed comes from the invoice, so an issued invoice prints as it was
+// issued.
+func Build(inv models.Invoice, res models.Reservation, ledger []models.PaymentTransaction) Document {
+	doc := Document{
+		Invoice:     inv,
+		Reservation: res,
+		Lines:       inv.Lines,
+		Taxes:       inv.Taxes,
+		Discount:    inv.Discount,
+		Subtotal:    inv.Subtotal,
+		Total:       inv.Total,
+		Payments:    ledger,
+		Paid:        payments.Paid(ledger),
+	}
+	doc.Balance = doc.Total - doc.Paid
+	return doc
+}
+
+// Issued reports whether the invoice has been issued, and so has a number. Until then the
+// document is a pro forma invoice.
+func (d Document) Issued() bool {
+	return d.Invoice.Number > 0
+}
+
+// Number is the invoice number as printed, or "" if it hasn't been issued
+func (d Document) Number() string {
+	if !d.Issued() {
+		return ""
+	}
+	return FormatNumber(d.Invoice.Number)
+}
+
+// Title is "Pro Forma Invoice" until the invoice is issued, then "Receipt" once the reservation
+// is paid in full, and "Invoice" until then
+func (d Document) Title() string {
+	if !d.Issued() {
+		return "Pro Forma Invoice"
+	}
+	if d.Paid > 0 && d.Balance <= 0 {
+		return "Receipt"
+	}
+	return "Invoice"
+}
+
+// FormatNumber formats an invoice number, e.g. INV-000042
+func FormatNumber(n int) string {
+	return fmt.Sprintf("INV-%06d", n)
+}
@@ -0,0 +1,125 @@
+package invoices
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/payments"
+)
+
+func testReservation() models.Reservation {
+	return models.Reservation{
+		ID:          1,
+		FirstName:   "John",
+		LastName:    "Smith",
+		Email:       "john@smith.com",
+		StartDate:   time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2050, 1, 4, 0, 0, 0, 0, time.UTC),
+		Room:        models.Room{ID: 1, RoomName: "General's Quarters"},
+		NightlyRate: 10000,
+		Discount:    3000,
+	}
+}
+
+func TestBuild(t *testing.T) {
+	var tests = []struct {
+		name            string
+		ledger          []models.PaymentTransaction
+		expectedPaid    int
+		expectedBalance int
+		expectedTitle   string
+	}{
+		{"unpaid", nil, 0, 27000, "Invoice"},
+		{"deposit", []models.PaymentTransaction{{ID: 1, Kind: payments.KindCharge, Amount: 5400}}, 5400, 21600, "Invoice"},
+		{"paid", []models.PaymentTransaction{{ID: 1, Kind: payments.KindCharge, Amount: 27000}}, 27000, 0, "Receipt"},
+		{"refunded", []models.PaymentTransaction{
+			{ID: 1, Kind: payments.KindCharge, Amount: 27000},
+			{ID: 2, Kind: payments.KindRefund, Amount: 27000, ChargeID: 1},
+		}, 0, 27000, "Invoice"},
+	}
+
+	for _, e := range tests {
+		inv := New(testReservation(), "USD")
+		inv.Number = 42
+		doc := Build(inv, testReservation(), e.ledger)
+
+		if doc.Subtotal != 30000 || doc.Total != 27000 {
+			t.Errorf("%s: got subtotal %d and total %d, wanted 30000 and 27000", e.name, doc.Subtotal, doc.Total)
+		}
+		if len(doc.Lines) != 1 || doc.Lines[0].Quantity != 3 || doc.Lines[0].Amount != 30000 {
+			t.Errorf("%s: unexpected lines %+v", e.name, doc.Lines)
+		}
+		if doc.Paid != e.expectedPaid {
+			t.Errorf("%s: got paid %d, wanted %d", e.name, doc.Paid, e.expectedPaid)
+		}
+		if doc.Balance != e.expectedBalance {
+			t.Errorf("%s: got balance %d, wanted %d", e.name, doc.Balance, e.expectedBalance)
+		}
+		if doc.Title() != e.expectedTitle {
+			t.Errorf("%s: got title %s, wanted %s", e.name, doc.Title(), e.expectedTitle)
+		}
+		if doc.Number() != "INV-000042" {
+			t.Errorf("%s: got number %s, wanted INV-000042", e.name, doc.Number())
+		}
+	}
+}
+
+func TestBuildWithCharges(t *testing.T) {
+	res := testReservation()
+	res.Charges = []models.Charge{
+		{TaxRuleID: 1, Description: "Lodging tax", Amount: 3645},
+		{TaxRuleID: 2, Description: "Cleaning fee", Amount: 4000},
+	}
+
+	doc := Build(New(res, "USD"), res, nil)
+
+	if len(doc.Taxes) != 2 || doc.Taxes[0].Description != "Lodging tax" || doc.Taxes[1].Amount != 4000 {
+		t.Errorf("unexpected tax lines %+v", doc.Taxes)
+	}
+	if doc.Total != 27000+3645+4000 || doc.Balance != doc.Total {
+		t.Errorf("got total %d and balance %d, wanted the charges added to 27000", doc.Total, doc.Balance)
+	}
+}
+
+func TestBuildIssued(t *testing.T) {
+	inv := New(testReservation(), "USD")
+	inv.Number = 7
+
+	// the stay is moved to a dearer room after the invoice was issued
+	res := testReservation()
+	res.NightlyRate = 20000
+
+	doc := Build(inv, res, nil)
+	if doc.Total != 27000 || doc.Lines[0].UnitPrice != 10000 {
+		t.Errorf("issued invoice changed with its reservation: got total %d and rate %d", doc.Total, doc.Lines[0].UnitPrice)
+	}
+
+	proForma := Build(New(res, "USD"), res, nil)
+	if proForma.Issued() || proForma.Number() != "" || proForma.Title() != "Pro Forma Invoice" {
+		t.Errorf("unissued invoice printed as %q %q", proForma.Title(), proForma.Number())
+	}
+	if proForma.Total != 57000 {
+		t.Errorf("pro forma invoice has total %d, wanted 57000", proForma.Total)
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	ledger := []models.PaymentTransaction{
+		{ID: 1, Kind: payments.KindCharge, Amount: 5400, Note: "Deposit"},
+	}
+	inv := New(testReservation(), "USD")
+	inv.Number = 1
+	inv.IssuedAt = time.Now()
+	doc := Build(inv, testReservation(), ledger)
+
+	var buf bytes.Buffer
+	err := WritePDF(&buf, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")) {
+		t.Error("WritePDF did not write a PDF")
+	}
+}
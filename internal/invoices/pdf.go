@@ -0,0 +1,99 @@
+package invoices
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/tsawler/bookings-app/internal/money"
+	"github.com/tsawler/bookings-app/internal/payments"
+)
+
+// WritePDF writes the document to w as an A4 PDF
+func WritePDF(w io.Writer, d Document) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	price := func(amount int) string {
+		return money.New(amount, d.Invoice.Currency).String()
+	}
+	pdf.SetMargins(20, 20, 20)
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(0, 10, d.Title(), "", 1, "L", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(0, 6, "Fort Smythe Bed and Breakfast", "", 1, "L", false, 0, "")
+	if d.Issued() {
+		pdf.CellFormat(0, 6, fmt.Sprintf("Number: %s", d.Number()), "", 1, "L", false, 0, "")
+		pdf.CellFormat(0, 6, fmt.Sprintf("Issued: %s", d.Invoice.IssuedAt.Format("2006-01-02")), "", 1, "L", false, 0, "")
+	} else {
+		pdf.CellFormat(0, 6, "Not issued yet", "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	res := d.Reservation
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(0, 6, "Bill to", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(0, 6, fmt.Sprintf("%s %s", res.FirstName, res.LastName), "", 1, "L", false, 0, "")
+	pdf.CellFormat(0, 6, res.Email, "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	// line items
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(95, 7, "Description", "B", 0, "L", false, 0, "")
+	pdf.CellFormat(20, 7, "Nights", "B", 0, "R", false, 0, "")
+	pdf.CellFormat(25, 7, "Rate", "B", 0, "R", false, 0, "")
+	pdf.CellFormat(30, 7, "Amount", "B", 1, "R", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	for _, l := range d.Lines {
+		pdf.CellFormat(95, 7, l.Description, "", 0, "L", false, 0, "")
+		pdf.CellFormat(20, 7, fmt.Sprint(l.Quantity), "", 0, "R", false, 0, "")
+		pdf.CellFormat(25, 7, price(l.UnitPrice), "", 0, "R", false, 0, "")
+		pdf.CellFormat(30, 7, price(l.Amount), "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(2)
+
+	total := func(label string, amount int, bold bool) {
+		style := ""
+		if bold {
+			style = "B"
+		}
+		pdf.SetFont("Helvetica", style, 10)
+		pdf.CellFormat(140, 7, label, "", 0, "R", false, 0, "")
+		pdf.CellFormat(30, 7, price(amount), "", 1, "R", false, 0, "")
+	}
+	total("Subtotal", d.Subtotal, false)
+	if d.Discount > 0 {
+		total("Discount", -d.Discount, false)
+	}
+	for _, t := range d.Taxes {
+		total(t.Description, t.Amount, false)
+	}
+	total("Total", d.Total, true)
+
+	if len(d.Payments) > 0 {
+		pdf.Ln(4)
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(0, 7, "Payments", "B", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		for _, p := range d.Payments {
+			amount := p.Amount
+			if p.Kind == payments.KindRefund {
+				amount = -amount
+			}
+			label := fmt.Sprintf("%s %s", p.CreatedAt.Format("2006-01-02"), strings.Title(p.Kind))
+			if p.Note != "" {
+				label += " - " + p.Note
+			}
+			pdf.CellFormat(140, 7, label, "", 0, "L", false, 0, "")
+			pdf.CellFormat(30, 7, price(amount), "", 1, "R", false, 0, "")
+		}
+	}
+	pdf.Ln(2)
+	total("Paid", d.Paid, false)
+	total("Balance due", d.Balance, true)
+
+	return pdf.Output(w)
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strconv"
 	"time"
 )
 
@@ -11,14 +12,22 @@ type User struct {
 	Email       string
 	Password    string
 	AccessLevel int
+	// PropertyIDs are the properties the user manages. A user with none manages all of them.
+	PropertyIDs []int
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 }
 
 type Room struct {
-	ID        int
-	RoomName  string
-	CreatedAt time.Time
+	ID             int
+	RoomName       string
+	Price          int
+	DepositPercent int
+	// CancellationPolicyID is the policy of new bookings of the room, 0 for the property's
+	CancellationPolicyID int
+	// PropertyID is the property the room is in
+	PropertyID     int
+	CreatedAt      time.Time
 	UpdatedAt time.Time
 }
 
@@ -29,19 +38,262 @@ type Restriction struct {
 	UpdatedAt       time.Time
 }
 
+// ids of the rows seeded into the restrictions table
+const (
+	RestrictionReservation = 1
+	RestrictionOwnerBlock  = 2
+	RestrictionHold        = 3
+)
+
+// Reservation is the reservation model. The form tags name the inputs guests and staff fill
+// in, see forms.Binder.
 type Reservation struct {
+	ID        int
+	FirstName string    `form:"first_name" validate:"required,min=3"`
+	LastName  string    `form:"last_name" validate:"required"`
+	Email     string    `form:"email" validate:"required,email"`
+	Phone     string    `form:"phone" validate:"phone"`
+	StartDate time.Time `form:"start_date" validate:"required"`
+	EndDate   time.Time `form:"end_date" validate:"required,after=start_date"`
+	RoomID    int       `form:"room_id" validate:"required,min=1"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Status    ReservationStatus
+	Source    string `form:"source" validate:"max=50"`
+	GuestID   int
+	Room      Room
+
+	// Guests is how many people are staying, which fees per guest are charged for
+	Guests int `form:"guests" validate:"min=1,max=20"`
+
+	// amounts are in cents
+	NightlyRate int
+	Discount    int
+
+	// PromoCodeID is the promo code the discount came from, which is redeemed with the
+	// reservation when it is inserted
+	PromoCodeID int
+
+	// Charges are the taxes and fees on the stay, as worked out when it was booked
+	Charges []Charge
+
+	// CancellationPolicy is the room's policy as it was when the stay was booked, which decides
+	// the refund if it is cancelled. It has no tiers if there was no policy.
+	CancellationPolicy CancellationPolicy
+
+	// AccessToken lets the guest open their reservation from links in emails
+	AccessToken string
+
+	// SpecialRequests is what the guest asked for when booking. Staff-only notes are kept
+	// apart, see ReservationNote.
+	SpecialRequests string `form:"special_requests" validate:"max=1000"`
+
+	// ImportantNote is the latest staff note flagged as important, for lists
+	ImportantNote string
+
+	// CustomFields holds the answers to the admin-defined booking form fields, by field name
+	CustomFields map[string]string
+
+	// Locale is the language the guest booked in, which emails to them are written in
+	Locale string
+
+	// set when the reservation has been moved to the trash
+	DeletedAt     time.Time
+	DeletedBy     int
+	DeletedByName string
+}
+
+// Guest is a person who has booked, however many times. Reservations are matched to guests by
+// email address and phone number.
+type Guest struct {
 	ID        int
 	FirstName string
 	LastName  string
 	Email     string
 	Phone     string
-	StartDate time.Time
-	EndDate   time.Time
-	RoomID    int
+	Notes     string
+	Tags      []string
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	Processed int
-	Room      Room
+
+	// Stays counts the guest's reservations that weren't cancelled and LifetimeValue is what they
+	// are worth in cents
+	Stays         int
+	LifetimeValue int
+	LastStay      time.Time
+}
+
+// Deleted reports whether the reservation is in the trash
+func (r Reservation) Deleted() bool {
+	return !r.DeletedAt.IsZero()
+}
+
+// Nights returns the number of nights of the stay
+func (r Reservation) Nights() int {
+	return int(r.EndDate.Sub(r.StartDate).Hours() / 24)
+}
+
+// Subtotal returns the room charge before discounts
+func (r Reservation) Subtotal() int {
+	return r.Nights() * r.NightlyRate
+}
+
+// ChargesTotal returns the taxes and fees on the stay
+func (r Reservation) ChargesTotal() int {
+	total := 0
+	for _, c := range r.Charges {
+		total += c.Amount
+	}
+	return total
+}
+
+// Total returns the amount the guest owes for the stay
+func (r Reservation) Total() int {
+	return r.Subtotal() - r.Discount + r.ChargesTotal()
+}
+
+// common booking sources. Anything else, such as the name of a booking channel, may be recorded too.
+const (
+	SourceWeb    = "web"
+	SourcePhone  = "phone"
+	SourceWalkIn = "walk-in"
+	SourceImport = "import"
+)
+
+// ReservationSources lists the common booking sources, for suggestions
+var ReservationSources = []string{SourceWeb, SourcePhone, SourceWalkIn}
+
+// ReservationStatus is where a reservation is in its lifecycle
+type ReservationStatus string
+
+// statuses of a reservation
+const (
+	StatusPending    ReservationStatus = "pending"
+	StatusConfirmed  ReservationStatus = "confirmed"
+	StatusCheckedIn  ReservationStatus = "checked_in"
+	StatusCheckedOut ReservationStatus = "checked_out"
+	StatusCancelled  ReservationStatus = "cancelled"
+	StatusNoShow     ReservationStatus = "no_show"
+)
+
+// ReservationStatuses lists every status, in lifecycle order
+var ReservationStatuses = []ReservationStatus{
+	StatusPending,
+	StatusConfirmed,
+	StatusCheckedIn,
+	StatusCheckedOut,
+	StatusCancelled,
+	StatusNoShow,
+}
+
+// statusTransitions holds the statuses each status may move to. Statuses missing here are final.
+var statusTransitions = map[ReservationStatus][]ReservationStatus{
+	StatusPending:   {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusCheckedIn, StatusCancelled, StatusNoShow},
+	StatusCheckedIn: {StatusCheckedOut},
+}
+
+var statusLabels = map[ReservationStatus]string{
+	StatusPending:    "Pending",
+	StatusConfirmed:  "Confirmed",
+	StatusCheckedIn:  "Checked in",
+	StatusCheckedOut: "Checked out",
+	StatusCancelled:  "Cancelled",
+	StatusNoShow:     "No-show",
+}
+
+// Valid reports whether s is a known status
+func (s ReservationStatus) Valid() bool {
+	_, ok := statusLabels[s]
+	return ok
+}
+
+// Label returns the status as shown to people
+func (s ReservationStatus) Label() string {
+	if l, ok := statusLabels[s]; ok {
+		return l
+	}
+	return string(s)
+}
+
+// Next returns the statuses s may move to
+func (s ReservationStatus) Next() []ReservationStatus {
+	return statusTransitions[s]
+}
+
+// CanTransitionTo reports whether a reservation may move from s to to
+func (s ReservationStatus) CanTransitionTo(to ReservationStatus) bool {
+	for _, n := range statusTransitions[s] {
+		if n == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ReservationStatusChange records a reservation moving from one status to another
+type ReservationStatusChange struct {
+	ID            int
+	ReservationID int
+	FromStatus    ReservationStatus
+	ToStatus      ReservationStatus
+	UserID        int
+	UserName      string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// types of custom booking form field
+const (
+	FieldText     = "text"
+	FieldTextarea = "textarea"
+	FieldNumber   = "number"
+	FieldDate     = "date"
+	FieldTime     = "time"
+	FieldSelect   = "select"
+	FieldCheckbox = "checkbox"
+)
+
+// CustomFieldTypes lists every type of custom field
+var CustomFieldTypes = []string{FieldText, FieldTextarea, FieldNumber, FieldDate, FieldTime, FieldSelect, FieldCheckbox}
+
+// CustomField is an extra question on the booking form, defined by admins. Options are the
+// choices of a select field. Pattern is a regular expression the answer must match and a zero
+// MaxLength means no limit.
+type CustomField struct {
+	ID        int
+	Name      string
+	Label     string
+	Type      string
+	Required  bool
+	Options   []string
+	Pattern   string
+	MaxLength int
+	SortOrder int
+	Active    bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// InputName returns the name of the field's input on the booking form
+func (f CustomField) InputName() string {
+	return "custom_" + f.Name
+}
+
+// ReservationNote is a staff-only note on a reservation. Notes are threaded one level deep:
+// replies point at the note they answer through ParentID.
+type ReservationNote struct {
+	ID            int
+	ReservationID int
+	ParentID      int
+	UserID        int
+	UserName      string
+	Body          string
+	Important     bool
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Replies       []ReservationNote
+	Reservation   Reservation
 }
 
 type RoomRestriction struct {
@@ -51,6 +303,7 @@ type RoomRestriction struct {
 	RoomID        int
 	ReservationID int
 	RestrictionID int
+	ExpiresAt     time.Time
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 	Room          Room
@@ -58,6 +311,386 @@ type RoomRestriction struct {
 	Restriction   Restriction
 }
 
+// WaitlistEntry is a guest waiting for a room to free up for a date range. The form tags name
+// the inputs of the waitlist form.
+type WaitlistEntry struct {
+	ID             int
+	FirstName      string    `form:"first_name" validate:"required"`
+	LastName       string    `form:"last_name" validate:"required"`
+	Email          string    `form:"email" validate:"required,email"`
+	Phone          string    `form:"phone" validate:"phone"`
+	StartDate      time.Time `form:"start" validate:"required"`
+	EndDate        time.Time `form:"end" validate:"required,after=start"`
+	RoomID         int       `form:"room_id" validate:"required,min=1"`
+	Token          string
+	TokenExpiresAt time.Time
+	NotifiedAt     time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Locale         string
+	Room           Room
+}
+
+// discount types of a promo code
+const (
+	PromoPercent = "percent"
+	PromoFixed   = "fixed"
+)
+
+// PromoCode is a discount guests can enter when booking. Amount is a percentage for
+// PromoPercent codes and cents for PromoFixed codes; zero limits mean unlimited.
+type PromoCode struct {
+	ID            int
+	Code          string
+	Description   string
+	DiscountType  string
+	Amount        int
+	ValidFrom     time.Time
+	ValidTo       time.Time
+	MinNights     int
+	UsageLimit    int
+	PerEmailLimit int
+	Active        bool
+	RoomIDs       []int
+	Uses          int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Discount returns the discount in cents the code gives on subtotal
+func (p PromoCode) Discount(subtotal int) int {
+	var d int
+	if p.DiscountType == PromoFixed {
+		d = p.Amount
+	} else {
+		d = subtotal * p.Amount / 100
+	}
+	if d > subtotal {
+		d = subtotal
+	}
+	return d
+}
+
+// AppliesToRoom reports whether the code can be used for the room
+func (p PromoCode) AppliesToRoom(roomID int) bool {
+	if len(p.RoomIDs) == 0 {
+		return true
+	}
+	for _, id := range p.RoomIDs {
+		if id == roomID {
+			return true
+		}
+	}
+	return false
+}
+
+// PromoRedemption records a promo code used on a reservation
+type PromoRedemption struct {
+	ID            int
+	PromoCodeID   int
+	ReservationID int
+	Email         string
+	Amount        int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	PromoCode     PromoCode
+}
+
+// PaymentIntent is an amount we asked the payment provider to collect for a reservation
+type PaymentIntent struct {
+	ID            int
+	ReservationID int
+	Provider      string
+	ProviderRef   string
+	Amount        int
+	Currency      string
+	Status        string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// PaymentTransaction is an entry in the payments ledger: money charged to or refunded to a
+// guest. Refunds point at the charge they return through ChargeID.
+type PaymentTransaction struct {
+	ID              int
+	ReservationID   int
+	PaymentIntentID int
+	ChargeID        int
+	Kind            string
+	Amount          int
+	Currency        string
+	Provider        string
+	ProviderRef     string
+	Note            string
+	UserID          int
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// Invoice is a numbered invoice issued for a reservation. Numbers are sequential and gap-free.
+type Invoice struct {
+	ID            int
+	Number        int
+	ReservationID int
+	IssuedAt      time.Time
+	Total         int
+	Currency      string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+
+	// what was billed, kept as it was when the invoice was issued so that it always prints the
+	// same, whatever happens to the reservation later. Amounts are in cents.
+	Lines    []InvoiceLine
+	Taxes    []InvoiceLine
+	Subtotal int
+	Discount int
+}
+
+// InvoiceLine is a row of an invoice. Amounts are in cents.
+type InvoiceLine struct {
+	Description string
+	Quantity    int
+	UnitPrice   int
+	Amount      int
+}
+
+// kinds of tax and fee rules
+const (
+	TaxPercent = "percent"
+	TaxFixed   = "fixed"
+)
+
+// TaxRule is a tax or fee added to stays. Amount is in hundredths of a percent of the room charge
+// after discounts for TaxPercent rules, so 1350 is 13.5%, and in cents for TaxFixed rules, which
+// are charged once per stay unless PerNight or PerGuest multiply them. A rule covers the nights
+// from ValidFrom to ValidTo, either of which may be zero for no limit, in the rooms in RoomIDs, or
+// in every room if there are none.
+type TaxRule struct {
+	ID        int
+	Name      string
+	Type      string
+	Amount    int
+	PerNight  bool
+	PerGuest  bool
+	ValidFrom time.Time
+	ValidTo   time.Time
+	RoomIDs   []int
+	Active    bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// AppliesToRoom reports whether the rule covers stays in the room
+func (t TaxRule) AppliesToRoom(roomID int) bool {
+	if len(t.RoomIDs) == 0 {
+		return true
+	}
+	for _, id := range t.RoomIDs {
+		if id == roomID {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidOn reports whether the rule covers the night of day
+func (t TaxRule) ValidOn(day time.Time) bool {
+	if !t.ValidFrom.IsZero() && day.Before(t.ValidFrom) {
+		return false
+	}
+	if !t.ValidTo.IsZero() && day.After(t.ValidTo) {
+		return false
+	}
+	return true
+}
+
+// Percent returns the percentage of a TaxPercent rule as admins enter it, such as 13.5
+func (t TaxRule) Percent() string {
+	return strconv.FormatFloat(float64(t.Amount)/100, 'f', -1, 64)
+}
+
+// Charge is a tax or fee on a reservation. It is kept with the reservation, so changing the
+// rules later doesn't change what past bookings owe.
+type Charge struct {
+	TaxRuleID   int    `json:"tax_rule_id"`
+	Description string `json:"description"`
+	Amount      int    `json:"amount"`
+}
+
+// RefundTier refunds Percent of a stay cancelled at least DaysBefore days before arrival
+type RefundTier struct {
+	DaysBefore int `json:"days_before"`
+	Percent    int `json:"percent"`
+}
+
+// CancellationPolicy decides how much of a cancelled stay is refunded. Tiers are kept with the
+// most days first; a cancellation later than every tier isn't refunded. RoomIDs are the rooms
+// whose new bookings get the policy.
+type CancellationPolicy struct {
+	ID          int          `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Tiers       []RefundTier `json:"tiers"`
+	RoomIDs     []int        `json:"-"`
+	CreatedAt   time.Time    `json:"-"`
+	UpdatedAt   time.Time    `json:"-"`
+}
+
+// RefundPercent returns the percentage of the stay refunded for a cancellation daysBefore days
+// before arrival
+func (p CancellationPolicy) RefundPercent(daysBefore int) int {
+	for _, t := range p.Tiers {
+		if daysBefore >= t.DaysBefore {
+			return t.Percent
+		}
+	}
+	return 0
+}
+
+// Property is a house whose rooms are let. Bookings of its rooms are sent to Email, counted in
+// days of TimeZone and shown to guests in Currency unless they choose another. Its cancellation
+// policy is given to rooms without one of their own. RoomIDs are its rooms and UserIDs the staff
+// who manage it.
+type Property struct {
+	ID                   int
+	Name                 string
+	Email                string
+	Address              string
+	TimeZone             string
+	Currency             string
+	CancellationPolicyID int
+	RoomIDs              []int
+	UserIDs              []int
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+}
+
+// Location returns the time zone of the property, UTC if it has none or an unknown one
+func (p Property) Location() *time.Location {
+	loc, err := time.LoadLocation(p.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// ExchangeRate is how many units of Currency one unit of the base currency buys. Rates are only
+// used to show prices in other currencies, guests are charged in the currency of the property.
+type ExchangeRate struct {
+	ID        int
+	Currency  string
+	Rate      float64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// ReservationFilter narrows down, sorts and pages a list of reservations. Zero fields don't filter.
+type ReservationFilter struct {
+	// Search matches part of the guest's name or email
+	Search string
+	RoomID int
+	// PropertyID selects stays in the rooms of a property
+	PropertyID int
+	// From and To select stays overlapping the dates
+	From    time.Time
+	To      time.Time
+	Status  ReservationStatus
+	Sort    string
+	Desc    bool
+	Page    int
+	PerPage int
+}
+
+// DailyOccupancy is how many nights of a room were sold on a day
+type DailyOccupancy struct {
+	Date     time.Time
+	RoomID   int
+	RoomName string
+	Nights   int
+}
+
+// OccupancySummary is how many room nights were sold in a range of days, out of how many there were
+type OccupancySummary struct {
+	NightsSold      int
+	NightsAvailable int
+}
+
+// Percent returns the share of nights sold, from 0 to 100
+func (o OccupancySummary) Percent() float64 {
+	if o.NightsAvailable == 0 {
+		return 0
+	}
+	return float64(o.NightsSold) * 100 / float64(o.NightsAvailable)
+}
+
+// BookingVolume is how many reservations were made in a period starting on Start, and what they are worth in cents
+type BookingVolume struct {
+	Start    time.Time
+	Bookings int
+	Revenue  int
+}
+
+// LeadTimeBucket counts the reservations made from MinDays to MaxDays ahead of arrival. A MaxDays
+// of -1 has no upper limit.
+type LeadTimeBucket struct {
+	Label    string
+	MinDays  int
+	MaxDays  int
+	Bookings int
+}
+
+// Contains reports whether a reservation made days ahead of arrival falls in the bucket
+func (b LeadTimeBucket) Contains(days int) bool {
+	return days >= b.MinDays && (b.MaxDays < 0 || days <= b.MaxDays)
+}
+
+// LeadTimeBuckets are the ranges lead times are counted in
+var LeadTimeBuckets = []LeadTimeBucket{
+	{Label: "Same day", MinDays: 0, MaxDays: 0},
+	{Label: "1-7 days", MinDays: 1, MaxDays: 7},
+	{Label: "8-30 days", MinDays: 8, MaxDays: 30},
+	{Label: "31-90 days", MinDays: 31, MaxDays: 90},
+	{Label: "Over 90 days", MinDays: 91, MaxDays: -1},
+}
+
+// Actor is who is making a change, for the audit log
+type Actor struct {
+	UserID int
+	IP     string
+}
+
+// AuditChange is the old and new value of a field
+type AuditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// AuditEntry is a row of the append-only audit log. Before and After hold JSON snapshots.
+type AuditEntry struct {
+	ID        int
+	UserID    int
+	UserName  string
+	Action    string
+	Entity    string
+	EntityID  int
+	Before    string
+	After     string
+	Changes   map[string]AuditChange
+	IPAddress string
+	CreatedAt time.Time
+}
+
+// AuditFilter narrows down the audit log. Zero fields don't filter.
+type AuditFilter struct {
+	UserID   int
+	Action   string
+	Entity   string
+	EntityID int
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
 // MailData holds an email message
 type MailData struct {
 	To string
@@ -16,4 +16,13 @@ type TemplateData struct {
 	Error     string
 	Form *forms.Form
 	IsAuthenticated int
+
+	// Locale is the language the page is shown in, see i18n
+	Locale string
+	// Currency is the currency the guest wants prices shown in, see money. Prices are shown in
+	// ChargeCurrency unless the guest chose another.
+	Currency string
+	// ChargeCurrency is the currency the prices on the page are in, that of the property they
+	// are for, which guests are charged in. It is the currency of the site unless set.
+	ChargeCurrency string
 }
@@ -0,0 +1,134 @@
+// Package money holds amounts of money in the minor unit of their currency, such as cents, and
+// converts them between currencies for display.
+//
+// Guests are always charged in the currency of the property they book. Other currencies are only
+// ever shown, converted at the exchange rates admins keep, so a converted amount is an estimate.
+package money
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tsawler/bookings-app/internal/i18n"
+)
+
+// Money is an amount in the minor unit of its currency, such as cents for USD or whole yen for JPY
+type Money struct {
+	Amount   int
+	Currency string
+}
+
+// symbols are the symbols of the currencies we know, the code is shown for the rest
+var symbols = map[string]string{
+	"USD": "$",
+	"CAD": "CA$",
+	"AUD": "A$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"KRW": "₩",
+	"CNY": "CN¥",
+}
+
+// zeroDecimal lists the currencies that have no minor unit
+var zeroDecimal = map[string]bool{
+	"JPY": true,
+	"KRW": true,
+}
+
+type contextKey struct{}
+
+// New returns amount, in the minor unit of currency, as Money
+func New(amount int, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// Exponent returns the number of decimal places of currency, 2 for USD and 0 for JPY
+func Exponent(currency string) int {
+	if zeroDecimal[strings.ToUpper(currency)] {
+		return 0
+	}
+	return 2
+}
+
+// Parse parses a decimal amount such as "50" or "49.95" into the minor unit of currency, so
+// "49.95" is 4995 in USD. Amounts in currencies without a minor unit, such as JPY, can't have
+// decimals.
+func Parse(s, currency string) (int, error) {
+	s = strings.TrimSpace(s)
+	exp := Exponent(currency)
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	// only digits, as Atoi would let a sign through and "-0.50" would come out positive
+	if whole == "" || len(frac) > exp || !digits(whole) || !digits(frac) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	frac += strings.Repeat("0", exp-len(frac))
+
+	amount, err := strconv.Atoi(whole + frac)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return amount, nil
+}
+
+// digits reports whether s is made of the digits 0 to 9 only
+func digits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// IsCurrencyCode reports whether code looks like an ISO 4217 currency code, three letters
+func IsCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+// Format writes the amount the way locale does, such as "$1,234.56" or "₩15,000". Amounts
+// without a currency are written without a symbol.
+func (m Money) Format(locale string) string {
+	symbol, ok := symbols[m.Currency]
+	if !ok && m.Currency != "" {
+		symbol = m.Currency + " "
+	}
+
+	sign, amount := "", m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	if Exponent(m.Currency) == 0 {
+		return sign + symbol + i18n.Number(locale, amount)
+	}
+	return fmt.Sprintf("%s%s%s.%02d", sign, symbol, i18n.Number(locale, amount/100), amount%100)
+}
+
+// String formats the amount in English
+func (m Money) String() string {
+	return m.Format(i18n.Default)
+}
+
+// WithCurrency returns a context carrying the currency a guest wants prices shown in
+func WithCurrency(ctx context.Context, currency string) context.Context {
+	return context.WithValue(ctx, contextKey{}, currency)
+}
+
+// FromContext returns the currency a guest wants prices shown in, or "" if they haven't chosen one
+func FromContext(ctx context.Context) string {
+	currency, _ := ctx.Value(contextKey{}).(string)
+	return currency
+}
@@ -0,0 +1,158 @@
+package money
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMoney_Format(t *testing.T) {
+	var tests = []struct {
+		money    Money
+		locale   string
+		expected string
+	}{
+		{New(123456, "USD"), "en", "$1,234.56"},
+		{New(-995, "usd"), "en", "-$9.95"},
+		{New(5, "EUR"), "ko", "€0.05"},
+		{New(15000, "KRW"), "ko", "₩15,000"},
+		{New(1500, "JPY"), "ja", "¥1,500"},
+		{New(500, "CHF"), "en", "CHF 5.00"},
+		{New(500, ""), "en", "5.00"},
+	}
+
+	for _, e := range tests {
+		if got := e.money.Format(e.locale); got != e.expected {
+			t.Errorf("%v formatted for %s is %q, wanted %q", e.money, e.locale, got, e.expected)
+		}
+	}
+
+	if got := New(9500, "USD").String(); got != "$95.00" {
+		t.Errorf("String is %q, wanted $95.00", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	var tests = []struct {
+		in       string
+		currency string
+		expected int
+		valid    bool
+	}{
+		{"50", "USD", 5000, true},
+		{"49.95", "USD", 4995, true},
+		{"49.9", "usd", 4990, true},
+		{" 12.00 ", "EUR", 1200, true},
+		{"15000", "JPY", 15000, true},
+		{"15000", "KRW", 15000, true},
+		{"150.50", "JPY", 0, false},
+		{"", "USD", 0, false},
+		{".5", "USD", 0, false},
+		{"1.234", "USD", 0, false},
+		{"-5", "USD", 0, false},
+		{"-0.50", "USD", 0, false},
+		{"+5", "USD", 0, false},
+		{"1.+5", "USD", 0, false},
+		{"abc", "USD", 0, false},
+	}
+
+	for _, e := range tests {
+		got, err := Parse(e.in, e.currency)
+		if (err == nil) != e.valid || got != e.expected {
+			t.Errorf("Parse(%q, %s): got %d, %v; wanted %d, valid=%t", e.in, e.currency, got, err, e.expected, e.valid)
+		}
+	}
+}
+
+func TestIsCurrencyCode(t *testing.T) {
+	for code, expected := range map[string]bool{"EUR": true, "jpy": true, "EU": false, "EURO": false, "E1R": false, "": false} {
+		if got := IsCurrencyCode(code); got != expected {
+			t.Errorf("IsCurrencyCode(%q) is %v, wanted %v", code, got, expected)
+		}
+	}
+}
+
+func TestRates_Convert(t *testing.T) {
+	rates := NewRates("usd")
+	rates.Set(map[string]float64{"eur": 0.9, "JPY": 150, "KRW": 1350})
+
+	var tests = []struct {
+		money      Money
+		currency   string
+		expected   Money
+		expectedOK bool
+	}{
+		{New(10000, "USD"), "EUR", New(9000, "EUR"), true},
+		{New(10000, "USD"), "jpy", New(15000, "JPY"), true},
+		{New(333, "USD"), "EUR", New(300, "EUR"), true},
+		{New(15000, "JPY"), "USD", New(10000, "USD"), true},
+		{New(15000, "JPY"), "KRW", New(135000, "KRW"), true},
+		{New(10000, "USD"), "USD", New(10000, "USD"), true},
+		{New(10000, "USD"), "GBP", New(10000, "USD"), false},
+		{New(10000, "GBP"), "USD", New(10000, "GBP"), false},
+	}
+
+	for _, e := range tests {
+		got, ok := rates.Convert(e.money, e.currency)
+		if got != e.expected || ok != e.expectedOK {
+			t.Errorf("converting %v to %s gave %v, %v, wanted %v, %v", e.money, e.currency, got, ok, e.expected, e.expectedOK)
+		}
+	}
+}
+
+func TestRates_Currencies(t *testing.T) {
+	rates := NewRates("USD")
+	if got := rates.Currencies(); !reflect.DeepEqual(got, []string{"USD"}) {
+		t.Errorf("Currencies without rates is %v", got)
+	}
+
+	rates.Set(map[string]float64{"JPY": 150, "EUR": 0.9})
+	if got := rates.Currencies(); !reflect.DeepEqual(got, []string{"USD", "EUR", "JPY"}) {
+		t.Errorf("Currencies is %v, wanted the base currency then the others in order", got)
+	}
+	if !rates.Has("eur") || !rates.Has("USD") || rates.Has("GBP") {
+		t.Error("Has doesn't match the rates")
+	}
+}
+
+func TestReadRatesCSV(t *testing.T) {
+	var tests = []struct {
+		name          string
+		csv           string
+		expected      map[string]float64
+		expectedError string
+	}{
+		{"plain", "EUR,0.92\njpy, 151.5\n", map[string]float64{"EUR": 0.92, "JPY": 151.5}, ""},
+		{"header", "currency,rate\nEUR,0.92\n", map[string]float64{"EUR": 0.92}, ""},
+		{"bad-code", "EUR,0.92\nEuro,1\n", nil, `line 2: "Euro" is not a currency code`},
+		{"bad-rate", "EUR,0.92\nJPY,-1\n", nil, "line 2: the rate must be a positive number"},
+		{"wrong-columns", "EUR,0.92,x\n", nil, "wrong number of fields"},
+		{"empty", "currency,rate\n", nil, "the file has no rates"},
+	}
+
+	for _, e := range tests {
+		rates, err := ReadRatesCSV(strings.NewReader(e.csv))
+		if e.expectedError != "" {
+			if err == nil || !strings.Contains(err.Error(), e.expectedError) {
+				t.Errorf("%s: expected error %q, got %v", e.name, e.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+		}
+		if !reflect.DeepEqual(rates, e.expected) {
+			t.Errorf("%s: read %v, wanted %v", e.name, rates, e.expected)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != "" {
+		t.Errorf("FromContext without a currency is %q", got)
+	}
+	if got := FromContext(WithCurrency(context.Background(), "EUR")); got != "EUR" {
+		t.Errorf("FromContext is %q, wanted EUR", got)
+	}
+}
@@ -0,0 +1,144 @@
+package money
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Rates are the exchange rates from the base currency to the currencies prices can be shown in,
+// as the number of units of the currency one unit of the base currency buys. Amounts in any of
+// the currencies are converted through the base currency, so a property charging in another one
+// needs no rates of its own. They are kept in memory as every guest page needs them, and
+// replaced whenever admins change them.
+type Rates struct {
+	mu    sync.RWMutex
+	base  string
+	rates map[string]float64
+}
+
+// NewRates returns rates for base with no other currencies yet
+func NewRates(base string) *Rates {
+	return &Rates{base: strings.ToUpper(base), rates: map[string]float64{}}
+}
+
+// Base returns the currency the rates are kept against
+func (r *Rates) Base() string {
+	return r.base
+}
+
+// Set replaces every rate with rates
+func (r *Rates) Set(rates map[string]float64) {
+	copied := make(map[string]float64, len(rates))
+	for currency, rate := range rates {
+		copied[strings.ToUpper(currency)] = rate
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rates = copied
+}
+
+// Has reports whether prices can be shown in currency
+func (r *Rates) Has(currency string) bool {
+	_, ok := r.rate(strings.ToUpper(currency))
+	return ok
+}
+
+// Currencies returns the base currency followed by the others prices can be shown in, in order
+func (r *Rates) Currencies() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var others []string
+	for currency := range r.rates {
+		if currency != r.base {
+			others = append(others, currency)
+		}
+	}
+	sort.Strings(others)
+	return append([]string{r.base}, others...)
+}
+
+// Convert returns m in currency, rounded to its minor unit. ok is false if there is no rate for
+// either currency, in which case m is returned unchanged.
+func (r *Rates) Convert(m Money, currency string) (converted Money, ok bool) {
+	currency = strings.ToUpper(currency)
+	if m.Currency == currency {
+		return m, true
+	}
+	from, ok := r.rate(m.Currency)
+	if !ok {
+		return m, false
+	}
+	to, ok := r.rate(currency)
+	if !ok {
+		return m, false
+	}
+
+	major := float64(m.Amount) / math.Pow10(Exponent(m.Currency)) / from * to
+	return New(int(math.Round(major*math.Pow10(Exponent(currency)))), currency), true
+}
+
+// rate returns the rate of currency, which is always 1 for the base currency
+func (r *Rates) rate(currency string) (float64, bool) {
+	if currency == r.base {
+		return 1, true
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rate, ok := r.rates[currency]
+	return rate, ok
+}
+
+// ParseRate reads an exchange rate, which must be a positive number
+func ParseRate(s string) (float64, error) {
+	rate, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+		return 0, errors.New("the rate must be a positive number")
+	}
+	return rate, nil
+}
+
+// ReadRatesCSV reads exchange rates from CSV with a currency code and a rate on each line, such
+// as "EUR,0.92". A first line that doesn't have a rate is taken to be a header and skipped.
+func ReadRatesCSV(r io.Reader) (map[string]float64, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	cr.TrimLeadingSpace = true
+
+	rates := make(map[string]float64)
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		currency := strings.ToUpper(strings.TrimSpace(record[0]))
+		rate, err := ParseRate(record[1])
+		if err != nil && line == 1 {
+			continue
+		}
+		if !IsCurrencyCode(currency) {
+			return nil, fmt.Errorf("line %d: %q is not a currency code", line, record[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		rates[currency] = rate
+	}
+
+	if len(rates) == 0 {
+		return nil, errors.New("the file has no rates")
+	}
+	return rates, nil
+}
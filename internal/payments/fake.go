@@ -0,0 +1,106 @@
+package payments
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// FakeProvider is an in-memory provider for development and tests. It declines any
+// charge or refund of an amount listed in Decline and otherwise always succeeds.
+type FakeProvider struct {
+	Decline map[int]bool
+
+	mu       sync.Mutex
+	next     int
+	intents  map[string]Intent
+	charges  map[string]int
+	refunded map[string]int
+}
+
+// NewFakeProvider returns a FakeProvider with no declined amounts
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{
+		Decline:  map[int]bool{},
+		intents:  map[string]Intent{},
+		charges:  map[string]int{},
+		refunded: map[string]int{},
+	}
+}
+
+// Name identifies the provider
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+// CreateIntent records an intent to collect amount
+func (p *FakeProvider) CreateIntent(amount int, currency, reference string) (Intent, error) {
+	if amount <= 0 {
+		return Intent{}, errors.New("amount must be positive")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.next++
+	intent := Intent{
+		Ref:      fmt.Sprintf("fake_pi_%d", p.next),
+		Amount:   amount,
+		Currency: currency,
+		Status:   IntentPending,
+	}
+	p.intents[intent.Ref] = intent
+	return intent, nil
+}
+
+// Capture charges a pending intent
+func (p *FakeProvider) Capture(intentRef string) (Receipt, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[intentRef]
+	if !ok || intent.Status != IntentPending {
+		return Receipt{}, fmt.Errorf("no pending intent %s", intentRef)
+	}
+
+	if p.Decline[intent.Amount] {
+		intent.Status = IntentFailed
+		p.intents[intentRef] = intent
+		return Receipt{}, ErrDeclined
+	}
+
+	intent.Status = IntentSucceeded
+	p.intents[intentRef] = intent
+
+	p.next++
+	receipt := Receipt{
+		Ref:    fmt.Sprintf("fake_ch_%d", p.next),
+		Amount: intent.Amount,
+	}
+	p.charges[receipt.Ref] = intent.Amount
+	return receipt, nil
+}
+
+// Refund returns part or all of a charge
+func (p *FakeProvider) Refund(chargeRef string, amount int) (Receipt, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if amount <= 0 {
+		return Receipt{}, errors.New("amount must be positive")
+	}
+	if p.Decline[amount] {
+		return Receipt{}, ErrDeclined
+	}
+	// charges made before a restart are unknown, so only those seen are checked
+	if charged, ok := p.charges[chargeRef]; ok && p.refunded[chargeRef]+amount > charged {
+		return Receipt{}, errors.New("refund exceeds the charge")
+	}
+	p.refunded[chargeRef] += amount
+
+	p.next++
+	return Receipt{
+		Ref:    fmt.Sprintf("fake_re_%d", p.next),
+		Amount: amount,
+	}, nil
+}
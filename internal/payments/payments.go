@@ -0,0 +1,88 @@
+package payments
+
+import (
+	"errors"
+
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+// statuses of a payment intent
+const (
+	IntentPending   = "pending"
+	IntentSucceeded = "succeeded"
+	IntentFailed    = "failed"
+)
+
+// kinds of ledger entries
+const (
+	KindCharge = "charge"
+	KindRefund = "refund"
+)
+
+// ErrDeclined is returned by a provider when it refuses a charge or a refund
+var ErrDeclined = errors.New("payment declined")
+
+// Intent is an amount a provider has been asked to collect
+type Intent struct {
+	Ref      string
+	Amount   int
+	Currency string
+	Status   string
+}
+
+// Receipt is the provider's record of money moving, for a charge or a refund
+type Receipt struct {
+	Ref    string
+	Amount int
+}
+
+// Provider is implemented by payment gateways. Amounts are in cents.
+type Provider interface {
+	// Name identifies the provider in the ledger
+	Name() string
+	// CreateIntent prepares to collect amount; reference ties it to our records
+	CreateIntent(amount int, currency, reference string) (Intent, error)
+	// Capture collects the money for an intent
+	Capture(intentRef string) (Receipt, error)
+	// Refund returns amount of a captured charge
+	Refund(chargeRef string, amount int) (Receipt, error)
+}
+
+// Deposit returns the deposit due on total for a deposit percentage, rounded up to the cent
+func Deposit(total, percent int) int {
+	if total <= 0 || percent <= 0 {
+		return 0
+	}
+	if percent >= 100 {
+		return total
+	}
+	return (total*percent + 99) / 100
+}
+
+// Paid returns the net amount collected by the ledger entries
+func Paid(entries []models.PaymentTransaction) int {
+	var paid int
+	for _, e := range entries {
+		switch e.Kind {
+		case KindCharge:
+			paid += e.Amount
+		case KindRefund:
+			paid -= e.Amount
+		}
+	}
+	return paid
+}
+
+// Refundable returns how much of the charge with id chargeID has not been refunded yet
+func Refundable(entries []models.PaymentTransaction, chargeID int) int {
+	var amount int
+	for _, e := range entries {
+		if e.Kind == KindCharge && e.ID == chargeID {
+			amount += e.Amount
+		}
+		if e.Kind == KindRefund && e.ChargeID == chargeID {
+			amount -= e.Amount
+		}
+	}
+	return amount
+}
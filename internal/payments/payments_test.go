@@ -0,0 +1,93 @@
+package payments
+
+import (
+	"testing"
+
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+func TestDeposit(t *testing.T) {
+	var tests = []struct {
+		total    int
+		percent  int
+		expected int
+	}{
+		{10000, 20, 2000},
+		{9999, 20, 2000},
+		{10000, 0, 0},
+		{10000, 100, 10000},
+		{10000, 150, 10000},
+		{0, 20, 0},
+	}
+
+	for _, e := range tests {
+		if got := Deposit(e.total, e.percent); got != e.expected {
+			t.Errorf("Deposit(%d, %d): got %d, wanted %d", e.total, e.percent, got, e.expected)
+		}
+	}
+}
+
+func TestPaidAndRefundable(t *testing.T) {
+	ledger := []models.PaymentTransaction{
+		{ID: 1, Kind: KindCharge, Amount: 5000},
+		{ID: 2, Kind: KindCharge, Amount: 3000},
+		{ID: 3, Kind: KindRefund, Amount: 1000, ChargeID: 1},
+	}
+
+	if got := Paid(ledger); got != 7000 {
+		t.Errorf("Paid: got %d, wanted %d", got, 7000)
+	}
+	if got := Refundable(ledger, 1); got != 4000 {
+		t.Errorf("Refundable for charge 1: got %d, wanted %d", got, 4000)
+	}
+	if got := Refundable(ledger, 2); got != 3000 {
+		t.Errorf("Refundable for charge 2: got %d, wanted %d", got, 3000)
+	}
+}
+
+func TestFakeProvider(t *testing.T) {
+	var p Provider = NewFakeProvider()
+
+	intent, err := p.CreateIntent(5000, "USD", "reservation-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intent.Status != IntentPending {
+		t.Errorf("new intent has status %s, wanted %s", intent.Status, IntentPending)
+	}
+
+	charge, err := p.Capture(intent.Ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if charge.Amount != 5000 {
+		t.Errorf("captured %d, wanted %d", charge.Amount, 5000)
+	}
+
+	if _, err := p.Capture(intent.Ref); err == nil {
+		t.Error("captured the same intent twice")
+	}
+
+	if _, err := p.Refund(charge.Ref, 3000); err != nil {
+		t.Error(err)
+	}
+	if _, err := p.Refund(charge.Ref, 3000); err == nil {
+		t.Error("refunded more than was charged")
+	}
+}
+
+func TestFakeProvider_Decline(t *testing.T) {
+	p := NewFakeProvider()
+	p.Decline[666] = true
+
+	intent, err := p.CreateIntent(666, "USD", "reservation-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Capture(intent.Ref); err != ErrDeclined {
+		t.Errorf("got %v, wanted ErrDeclined", err)
+	}
+	if _, err := p.Refund("fake_ch_1", 666); err != ErrDeclined {
+		t.Errorf("refund got %v, wanted ErrDeclined", err)
+	}
+}
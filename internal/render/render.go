@@ -12,12 +12,24 @@ import (
 	"github.com/justinas/nosurf"
 
 	"github.com/tsawler/bookings-app/internal/config"
+	"github.com/tsawler/bookings-app/internal/i18n"
 	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/money"
 )
 
 var functions = template.FuncMap{
 	"humanDate": HumanDate,
 	"formatDate": FormatDate,
+	"formatPrice": FormatPrice,
+	"formatMoney": FormatMoney,
+	"T": i18n.T,
+	"localDate": i18n.Date,
+	"localNumber": i18n.Number,
+	"localPrice": LocalPrice,
+	"displayPrice": DisplayPrice,
+	"currencies": Currencies,
+	"baseCurrency": BaseCurrency,
+	"locales": Locales,
 }
 
 var app *config.AppConfig
@@ -37,10 +49,70 @@ func FormatDate(t time.Time, f string) string {
 	return t.Format(f)
 }
 
+// FormatPrice formats an amount in cents in the currency of the site, e.g. $95.00
+func FormatPrice(cents int) string {
+	return money.New(cents, app.Currency).String()
+}
+
+// FormatMoney formats an amount in cents in currency, e.g. €95.00
+func FormatMoney(cents int, currency string) string {
+	return money.New(cents, currency).String()
+}
+
+// LocalPrice formats an amount in cents in currency, the way locale writes it
+func LocalPrice(locale, currency string, cents int) string {
+	return money.New(cents, currency).Format(locale)
+}
+
+// DisplayPrice formats an amount in cents in the currency from converted to to, the currency the
+// guest wants prices shown in. It is LocalPrice in from if there is no rate for either of them.
+func DisplayPrice(locale, from, to string, cents int) string {
+	converted, ok := rates().Convert(money.New(cents, from), to)
+	if !ok {
+		return LocalPrice(locale, from, cents)
+	}
+	return converted.Format(locale)
+}
+
+// BaseCurrency returns the currency of the site, which exchange rates are kept against and
+// properties are charged in unless they have their own
+func BaseCurrency() string {
+	return app.Currency
+}
+
+// Currencies returns the currencies prices can be shown in, for the currency menu
+func Currencies() []string {
+	return rates().Currencies()
+}
+
+// rates returns the exchange rates of the site, which have none until they are loaded
+func rates() *money.Rates {
+	if app.Rates == nil {
+		return money.NewRates(app.Currency)
+	}
+	return app.Rates
+}
+
+// Locales returns the supported locales with their names, for the language menu
+func Locales() map[string]string {
+	return i18n.Names
+}
+
 func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateData {
-	td.Flash = app.Session.PopString(r.Context(), "flash")
-	td.Error = app.Session.PopString(r.Context(), "error")
-	td.Warning = app.Session.PopString(r.Context(), "warning")
+	// flash messages are put in the session in English and shown in the language of the page
+	td.Locale = i18n.FromContext(r.Context())
+	if td.ChargeCurrency == "" {
+		td.ChargeCurrency = app.Currency
+	}
+	// a currency the guest chose wins over the one of the property the page is about
+	if currency := money.FromContext(r.Context()); currency != "" {
+		td.Currency = currency
+	} else if td.Currency == "" {
+		td.Currency = td.ChargeCurrency
+	}
+	td.Flash = i18n.T(td.Locale, app.Session.PopString(r.Context(), "flash"))
+	td.Error = i18n.T(td.Locale, app.Session.PopString(r.Context(), "error"))
+	td.Warning = i18n.T(td.Locale, app.Session.PopString(r.Context(), "warning"))
 	td.CSRFToken = nosurf.Token(r)
 	if app.Session.Exists(r.Context(), "user_id") {
 		td.IsAuthenticated = 1
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/money"
 )
 
 func TestAddDefaultData(t *testing.T) {
@@ -20,6 +21,49 @@ func TestAddDefaultData(t *testing.T) {
 	}
 }
 
+func TestAddDefaultData_currency(t *testing.T) {
+	testApp.Currency = "USD"
+	r, err := getSession()
+	if err != nil {
+		t.Error(err)
+	}
+
+	td := AddDefaultData(&models.TemplateData{ChargeCurrency: "EUR"}, r)
+	if td.ChargeCurrency != "EUR" || td.Currency != "EUR" {
+		t.Errorf("prices of a EUR property are in %s and shown in %s", td.ChargeCurrency, td.Currency)
+	}
+	td = AddDefaultData(&models.TemplateData{}, r)
+	if td.ChargeCurrency != "USD" || td.Currency != "USD" {
+		t.Errorf("prices of the site are in %s and shown in %s", td.ChargeCurrency, td.Currency)
+	}
+}
+
+func TestDisplayPrice(t *testing.T) {
+	testApp.Currency = "USD"
+	testApp.Rates = money.NewRates("USD")
+	testApp.Rates.Set(map[string]float64{"EUR": 0.9, "JPY": 150})
+	defer func() { testApp.Rates = nil }()
+
+	var tests = []struct {
+		from     string
+		to       string
+		cents    int
+		expected string
+	}{
+		{"EUR", "EUR", 9000, "€90.00"},
+		{"EUR", "JPY", 9000, "¥15,000"},
+		{"EUR", "USD", 9000, "$100.00"},
+		{"USD", "EUR", 10000, "€90.00"},
+		{"EUR", "GBP", 9000, "€90.00"},
+	}
+
+	for _, e := range tests {
+		if got := DisplayPrice("en", e.from, e.to, e.cents); got != e.expected {
+			t.Errorf("DisplayPrice of %d in %s shown in %s is %q, wanted %q", e.cents, e.from, e.to, got, e.expected)
+		}
+	}
+}
+
 func TestRenderTemplate(t *testing.T) {
 	pathToTemplates = "../../templates"
 	tc, err := CreateTemplateCache()
@@ -0,0 +1,279 @@
+// Package reports computes the figures owners track a hotel by: occupancy, average daily rate,
+// revenue per available room, cancellations, length of stay and booking pace
+package reports
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/export"
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+// ways a report can be broken down
+const (
+	GroupNone  = ""
+	GroupRoom  = "room"
+	GroupMonth = "month"
+)
+
+// Groups lists the ways a report can be broken down
+var Groups = []string{GroupNone, GroupRoom, GroupMonth}
+
+// Input is what a report is computed from
+type Input struct {
+	// Start is the first day of the report and End the day after the last
+	Start time.Time
+	End   time.Time
+	Rooms []models.Room
+	// Reservations are those with stays overlapping the range, cancelled ones included
+	Reservations []models.Reservation
+	// Restrictions are the bookings and owner blocks overlapping the range
+	Restrictions []models.RoomRestriction
+	// LastYear are the reservations with stays overlapping the same range a year earlier
+	LastYear []models.Reservation
+	// AsOf is when the report is run. Pace compares what was booked by then with what was booked
+	// by the same time a year earlier.
+	AsOf time.Time
+}
+
+// Row holds the figures of a room, month or the whole range. Amounts are in cents.
+type Row struct {
+	Label string
+
+	AvailableNights int
+	SoldNights      int
+	Revenue         int
+
+	// Arrivals counts the reservations arriving in the range, Cancelled those of them that were cancelled
+	Arrivals   int
+	Cancelled  int
+	StayNights int
+
+	// PaceNights are the nights booked by AsOf, PaceNightsLastYear those booked a year earlier for
+	// the same range a year earlier
+	PaceNights         int
+	PaceNightsLastYear int
+}
+
+// Occupancy returns the share of available nights sold, as a percentage
+func (r Row) Occupancy() float64 {
+	return percent(r.SoldNights, r.AvailableNights)
+}
+
+// ADR returns the average daily rate, the revenue per night sold
+func (r Row) ADR() int {
+	return divide(r.Revenue, r.SoldNights)
+}
+
+// RevPAR returns the revenue per available room night
+func (r Row) RevPAR() int {
+	return divide(r.Revenue, r.AvailableNights)
+}
+
+// CancellationRate returns the share of arrivals that were cancelled, as a percentage
+func (r Row) CancellationRate() float64 {
+	return percent(r.Cancelled, r.Arrivals)
+}
+
+// AverageStay returns the average number of nights of the stays that weren't cancelled
+func (r Row) AverageStay() float64 {
+	stays := r.Arrivals - r.Cancelled
+	if stays == 0 {
+		return 0
+	}
+	return float64(r.StayNights) / float64(stays)
+}
+
+// Pace returns how far ahead, or behind when negative, bookings are of last year, as a percentage.
+// It is zero when nothing was booked last year.
+func (r Row) Pace() float64 {
+	if r.PaceNightsLastYear == 0 {
+		return 0
+	}
+	return percent(r.PaceNights-r.PaceNightsLastYear, r.PaceNightsLastYear)
+}
+
+func percent(n, of int) float64 {
+	if of == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(of)
+}
+
+func divide(n, by int) int {
+	if by == 0 {
+		return 0
+	}
+	return n / by
+}
+
+// Report is a report broken down into rows, with the figures of the whole range in Total
+type Report struct {
+	Start time.Time
+	End   time.Time
+	Group string
+	Rows  []Row
+	Total Row
+}
+
+// period is the part of the report a row covers: a range of days and, when grouping by room, a room
+type period struct {
+	label  string
+	start  time.Time
+	end    time.Time
+	roomID int
+}
+
+// Build computes the report for in, broken down by group
+func Build(in Input, group string) Report {
+	report := Report{Start: in.Start, End: in.End, Group: group}
+
+	whole := period{label: "Total", start: in.Start, end: in.End}
+
+	var periods []period
+	switch group {
+	case GroupRoom:
+		for _, room := range in.Rooms {
+			periods = append(periods, period{label: room.RoomName, start: in.Start, end: in.End, roomID: room.ID})
+		}
+	case GroupMonth:
+		for m := time.Date(in.Start.Year(), in.Start.Month(), 1, 0, 0, 0, 0, time.UTC); m.Before(in.End); m = m.AddDate(0, 1, 0) {
+			p := period{label: m.Format("January 2006"), start: m, end: m.AddDate(0, 1, 0)}
+			if p.start.Before(in.Start) {
+				p.start = in.Start
+			}
+			if p.end.After(in.End) {
+				p.end = in.End
+			}
+			periods = append(periods, p)
+		}
+	}
+
+	for _, p := range periods {
+		report.Rows = append(report.Rows, compute(in, p))
+	}
+	report.Total = compute(in, whole)
+
+	return report
+}
+
+// compute works out the figures of a row
+func compute(in Input, p period) Row {
+	row := Row{Label: p.label}
+
+	days := nights(p.start, p.end)
+	for _, room := range in.Rooms {
+		if p.roomID == 0 || room.ID == p.roomID {
+			row.AvailableNights += days
+		}
+	}
+
+	for _, rr := range in.Restrictions {
+		if p.roomID != 0 && rr.RoomID != p.roomID {
+			continue
+		}
+		n := overlap(rr.StartDate, rr.EndDate, p.start, p.end)
+		switch rr.RestrictionID {
+		case models.RestrictionReservation:
+			row.SoldNights += n
+		case models.RestrictionOwnerBlock:
+			// rooms the owner blocked weren't for sale
+			row.AvailableNights -= n
+		}
+	}
+
+	for _, res := range in.Reservations {
+		if p.roomID != 0 && res.RoomID != p.roomID {
+			continue
+		}
+		cancelled := res.Status == models.StatusCancelled
+
+		if !res.StartDate.Before(p.start) && res.StartDate.Before(p.end) {
+			row.Arrivals++
+			if cancelled {
+				row.Cancelled++
+			} else {
+				row.StayNights += res.Nights()
+			}
+		}
+
+		if cancelled {
+			continue
+		}
+
+		n := overlap(res.StartDate, res.EndDate, p.start, p.end)
+		if n > 0 {
+			row.Revenue += revenue(res, n)
+			if !res.CreatedAt.After(in.AsOf) {
+				row.PaceNights += n
+			}
+		}
+	}
+
+	// the same days and room a year earlier, as booked by the same time a year earlier
+	lyStart, lyEnd, lyAsOf := p.start.AddDate(-1, 0, 0), p.end.AddDate(-1, 0, 0), in.AsOf.AddDate(-1, 0, 0)
+	for _, res := range in.LastYear {
+		if res.Status == models.StatusCancelled || (p.roomID != 0 && res.RoomID != p.roomID) {
+			continue
+		}
+		if !res.CreatedAt.After(lyAsOf) {
+			row.PaceNightsLastYear += overlap(res.StartDate, res.EndDate, lyStart, lyEnd)
+		}
+	}
+
+	return row
+}
+
+// revenue returns what n nights of a reservation earn, with its discount spread over its nights
+func revenue(res models.Reservation, n int) int {
+	total := res.Nights()
+	if total == 0 {
+		return 0
+	}
+	return n*res.NightlyRate - res.Discount*n/total
+}
+
+// nights returns the number of nights from start to end
+func nights(start, end time.Time) int {
+	if !end.After(start) {
+		return 0
+	}
+	return int(end.Sub(start).Hours()/24 + 0.5)
+}
+
+// overlap returns how many nights from start to end fall between from and to
+func overlap(start, end, from, to time.Time) int {
+	if start.Before(from) {
+		start = from
+	}
+	if end.After(to) {
+		end = to
+	}
+	return nights(start, end)
+}
+
+// Write writes the report as a table, a line per row followed by the total
+func Write(w export.Writer, r Report) error {
+	err := w.WriteRow("", "Available nights", "Nights sold", "Occupancy %", "Revenue", "ADR", "RevPAR",
+		"Arrivals", "Cancelled", "Cancellation %", "Average stay", "Nights on the books", "Last year", "Pace %")
+	if err != nil {
+		return err
+	}
+
+	for _, row := range append(r.Rows, r.Total) {
+		err = w.WriteRow(row.Label, row.AvailableNights, row.SoldNights, round(row.Occupancy()),
+			export.Cents(row.Revenue), export.Cents(row.ADR()), export.Cents(row.RevPAR()),
+			row.Arrivals, row.Cancelled, round(row.CancellationRate()), round(row.AverageStay()),
+			row.PaceNights, row.PaceNightsLastYear, round(row.Pace()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// round writes a figure with one decimal
+func round(f float64) string {
+	return strconv.FormatFloat(f, 'f', 1, 64)
+}
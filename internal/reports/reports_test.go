@@ -0,0 +1,176 @@
+package reports
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/export"
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// testInput covers January and February 2050 for two rooms. Room 1 has a five night stay with a
+// discount, a cancelled stay and a week blocked by the owner; room 2 has a stay across the end of
+// January and one booked after the report is run.
+func testInput() Input {
+	a := models.Reservation{ID: 1, RoomID: 1, StartDate: date(2050, 1, 10), EndDate: date(2050, 1, 15),
+		NightlyRate: 10000, Discount: 5000, Status: models.StatusConfirmed, CreatedAt: date(2049, 12, 1)}
+	b := models.Reservation{ID: 2, RoomID: 2, StartDate: date(2050, 1, 30), EndDate: date(2050, 2, 3),
+		NightlyRate: 20000, Status: models.StatusConfirmed, CreatedAt: date(2049, 12, 20)}
+	c := models.Reservation{ID: 3, RoomID: 1, StartDate: date(2050, 2, 10), EndDate: date(2050, 2, 12),
+		NightlyRate: 10000, Status: models.StatusCancelled, CreatedAt: date(2049, 12, 5)}
+	d := models.Reservation{ID: 4, RoomID: 2, StartDate: date(2050, 2, 20), EndDate: date(2050, 2, 22),
+		NightlyRate: 15000, Status: models.StatusPending, CreatedAt: date(2050, 1, 15)}
+
+	restriction := func(res models.Reservation) models.RoomRestriction {
+		return models.RoomRestriction{RoomID: res.RoomID, StartDate: res.StartDate, EndDate: res.EndDate,
+			ReservationID: res.ID, RestrictionID: models.RestrictionReservation}
+	}
+
+	return Input{
+		Start: date(2050, 1, 1),
+		End:   date(2050, 3, 1),
+		Rooms: []models.Room{
+			{ID: 1, RoomName: "General's Quarters"},
+			{ID: 2, RoomName: "Major's Suite"},
+		},
+		Reservations: []models.Reservation{a, b, c, d},
+		Restrictions: []models.RoomRestriction{
+			restriction(a),
+			restriction(b),
+			restriction(d),
+			{RoomID: 1, StartDate: date(2050, 2, 1), EndDate: date(2050, 2, 8), RestrictionID: models.RestrictionOwnerBlock},
+		},
+		LastYear: []models.Reservation{
+			{RoomID: 1, StartDate: date(2049, 1, 5), EndDate: date(2049, 1, 9), NightlyRate: 10000,
+				Status: models.StatusCheckedOut, CreatedAt: date(2048, 12, 1)},
+			// booked after the same time last year, so not part of the pace
+			{RoomID: 2, StartDate: date(2049, 2, 1), EndDate: date(2049, 2, 3), NightlyRate: 20000,
+				Status: models.StatusCheckedOut, CreatedAt: date(2049, 1, 10)},
+		},
+		AsOf: date(2050, 1, 1),
+	}
+}
+
+func TestBuild(t *testing.T) {
+	total := Row{Label: "Total", AvailableNights: 111, SoldNights: 11, Revenue: 155000,
+		Arrivals: 4, Cancelled: 1, StayNights: 11, PaceNights: 9, PaceNightsLastYear: 4}
+
+	var tests = []struct {
+		name         string
+		group        string
+		expectedRows []Row
+	}{
+		{"whole range", GroupNone, nil},
+		{"by room", GroupRoom, []Row{
+			{Label: "General's Quarters", AvailableNights: 52, SoldNights: 5, Revenue: 45000,
+				Arrivals: 2, Cancelled: 1, StayNights: 5, PaceNights: 5, PaceNightsLastYear: 4},
+			{Label: "Major's Suite", AvailableNights: 59, SoldNights: 6, Revenue: 110000,
+				Arrivals: 2, Cancelled: 0, StayNights: 6, PaceNights: 4, PaceNightsLastYear: 0},
+		}},
+		{"by month", GroupMonth, []Row{
+			{Label: "January 2050", AvailableNights: 62, SoldNights: 7, Revenue: 85000,
+				Arrivals: 2, Cancelled: 0, StayNights: 9, PaceNights: 7, PaceNightsLastYear: 4},
+			{Label: "February 2050", AvailableNights: 49, SoldNights: 4, Revenue: 70000,
+				Arrivals: 2, Cancelled: 1, StayNights: 2, PaceNights: 2, PaceNightsLastYear: 0},
+		}},
+	}
+
+	for _, e := range tests {
+		report := Build(testInput(), e.group)
+
+		if report.Total != total {
+			t.Errorf("%s: total is %+v, wanted %+v", e.name, report.Total, total)
+		}
+		if len(report.Rows) != len(e.expectedRows) {
+			t.Errorf("%s: got %d rows, wanted %d", e.name, len(report.Rows), len(e.expectedRows))
+			continue
+		}
+		for i, row := range report.Rows {
+			if row != e.expectedRows[i] {
+				t.Errorf("%s: row %d is %+v, wanted %+v", e.name, i, row, e.expectedRows[i])
+			}
+		}
+	}
+}
+
+func TestBuild_partialMonths(t *testing.T) {
+	in := testInput()
+	in.Start = date(2050, 1, 20)
+	in.End = date(2050, 2, 5)
+
+	report := Build(in, GroupMonth)
+	if len(report.Rows) != 2 {
+		t.Fatalf("expected 2 months, got %d", len(report.Rows))
+	}
+	// January 20th to 31st and February 1st to 4th, with room 1 blocked from the 1st
+	if report.Rows[0].AvailableNights != 24 || report.Rows[1].AvailableNights != 4 {
+		t.Errorf("unexpected available nights %d and %d", report.Rows[0].AvailableNights, report.Rows[1].AvailableNights)
+	}
+}
+
+func TestRow(t *testing.T) {
+	var tests = []struct {
+		name                     string
+		row                      Row
+		expectedOccupancy        float64
+		expectedADR              int
+		expectedRevPAR           int
+		expectedCancellationRate float64
+		expectedAverageStay      float64
+		expectedPace             float64
+	}{
+		{"empty", Row{}, 0, 0, 0, 0, 0, 0},
+		{"half full", Row{AvailableNights: 20, SoldNights: 10, Revenue: 100000, Arrivals: 4, Cancelled: 1,
+			StayNights: 9, PaceNights: 10, PaceNightsLastYear: 8}, 50, 10000, 5000, 25, 3, 25},
+		{"behind last year", Row{AvailableNights: 10, SoldNights: 3, Revenue: 30000, Arrivals: 1,
+			StayNights: 3, PaceNights: 3, PaceNightsLastYear: 6}, 30, 10000, 3000, 0, 3, -50},
+	}
+
+	for _, e := range tests {
+		if got := e.row.Occupancy(); got != e.expectedOccupancy {
+			t.Errorf("%s: occupancy is %v, wanted %v", e.name, got, e.expectedOccupancy)
+		}
+		if got := e.row.ADR(); got != e.expectedADR {
+			t.Errorf("%s: ADR is %v, wanted %v", e.name, got, e.expectedADR)
+		}
+		if got := e.row.RevPAR(); got != e.expectedRevPAR {
+			t.Errorf("%s: RevPAR is %v, wanted %v", e.name, got, e.expectedRevPAR)
+		}
+		if got := e.row.CancellationRate(); got != e.expectedCancellationRate {
+			t.Errorf("%s: cancellation rate is %v, wanted %v", e.name, got, e.expectedCancellationRate)
+		}
+		if got := e.row.AverageStay(); got != e.expectedAverageStay {
+			t.Errorf("%s: average stay is %v, wanted %v", e.name, got, e.expectedAverageStay)
+		}
+		if got := e.row.Pace(); got != e.expectedPace {
+			t.Errorf("%s: pace is %v, wanted %v", e.name, got, e.expectedPace)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := export.NewWriter(&buf, export.CSV, "")
+	err := Write(w, Build(testInput(), GroupRoom))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected a header, two rooms and a total, got:\n%s", buf.String())
+	}
+	expected := "Total,111,11,9.9,1550.00,140.90,13.96,4,1,25.0,3.7,9,4,125.0"
+	if lines[3] != expected {
+		t.Errorf("total line is %q, wanted %q", lines[3], expected)
+	}
+}
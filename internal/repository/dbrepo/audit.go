@@ -0,0 +1,198 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/audit"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/repository"
+)
+
+// execer is satisfied by both *sql.DB and *sql.Tx, so audit rows can be written inside the
+// transaction of the change they describe
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// reservationAudit is what the audit log keeps of a reservation
+type reservationAudit struct {
+	FirstName   string
+	LastName    string
+	Email       string
+	Phone       string
+	StartDate   string
+	EndDate     string
+	RoomID      int
+	Status      models.ReservationStatus
+	Source      string
+	NightlyRate int
+	Discount    int
+	Guests      int
+
+	SpecialRequests string            `json:",omitempty"`
+	CustomFields    map[string]string `json:",omitempty"`
+	Charges         []models.Charge   `json:",omitempty"`
+
+	CancellationPolicy string `json:",omitempty"`
+}
+
+func reservationSnapshot(r models.Reservation) reservationAudit {
+	return reservationAudit{
+		FirstName:   r.FirstName,
+		LastName:    r.LastName,
+		Email:       r.Email,
+		Phone:       r.Phone,
+		StartDate:   r.StartDate.Format("2006-01-02"),
+		EndDate:     r.EndDate.Format("2006-01-02"),
+		RoomID:      r.RoomID,
+		Status:      r.Status,
+		Source:      r.Source,
+		NightlyRate: r.NightlyRate,
+		Discount:    r.Discount,
+		Guests:      r.Guests,
+
+		SpecialRequests: r.SpecialRequests,
+		CustomFields:    r.CustomFields,
+		Charges:         r.Charges,
+
+		CancellationPolicy: r.CancellationPolicy.Name,
+	}
+}
+
+// WithActor returns a copy of the repository whose writes are recorded in the audit log as made by a
+func (m *postgresDBRepo) WithActor(a models.Actor) repository.DatabaseRepo {
+	c := *m
+	c.actor = &a
+	return &c
+}
+
+// writeAudit is the hook write methods call to record a change in the audit log. before and
+// after are snapshots of the record, either of which may be nil. Nothing is written unless the
+// repository was given an actor with WithActor, so guests' own bookings are not logged.
+func (m *postgresDBRepo) writeAudit(ctx context.Context, q execer, action, entity string, entityID int, before, after interface{}) error {
+	if m.actor == nil {
+		return nil
+	}
+
+	b, err := audit.Snapshot(before)
+	if err != nil {
+		return err
+	}
+	a, err := audit.Snapshot(after)
+	if err != nil {
+		return err
+	}
+	diff, err := audit.Diff(b, a)
+	if err != nil {
+		return err
+	}
+	changes, err := json.Marshal(diff)
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into audit_log (user_id, action, entity, entity_id, before, after, changes, ip_address, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	_, err = q.ExecContext(ctx, stmt,
+		nullInt(m.actor.UserID),
+		action,
+		entity,
+		entityID,
+		sql.NullString{String: string(b), Valid: b != nil},
+		sql.NullString{String: string(a), Valid: a != nil},
+		string(changes),
+		m.actor.IP,
+		time.Now(),
+		time.Now(),
+	)
+	return err
+}
+
+// AuditEntries returns audit log entries matching f, newest first
+func (m *postgresDBRepo) AuditEntries(f models.AuditFilter) ([]models.AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var entries []models.AuditEntry
+
+	var where []string
+	var args []interface{}
+	add := func(clause string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(clause, len(args)))
+	}
+	if f.UserID > 0 {
+		add("a.user_id = $%d", f.UserID)
+	}
+	if f.Action != "" {
+		add("a.action = $%d", f.Action)
+	}
+	if f.Entity != "" {
+		add("a.entity = $%d", f.Entity)
+	}
+	if f.EntityID > 0 {
+		add("a.entity_id = $%d", f.EntityID)
+	}
+	if !f.From.IsZero() {
+		add("a.created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("a.created_at < $%d", f.To)
+	}
+
+	query := `
+		select a.id, coalesce(a.user_id, 0), coalesce(u.first_name || ' ' || u.last_name, ''), a.action,
+		a.entity, a.entity_id, coalesce(a.before::text, ''), coalesce(a.after::text, ''), a.changes::text,
+		a.ip_address, a.created_at
+		from audit_log a
+		left join users u on (a.user_id = u.id)`
+	if len(where) > 0 {
+		query += " where " + strings.Join(where, " and ")
+	}
+	query += " order by a.created_at desc, a.id desc"
+	if f.Limit > 0 {
+		args = append(args, f.Limit)
+		query += fmt.Sprintf(" limit $%d", len(args))
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.AuditEntry
+		var changes string
+		err := rows.Scan(
+			&e.ID,
+			&e.UserID,
+			&e.UserName,
+			&e.Action,
+			&e.Entity,
+			&e.EntityID,
+			&e.Before,
+			&e.After,
+			&changes,
+			&e.IPAddress,
+			&e.CreatedAt,
+		)
+		if err != nil {
+			return entries, err
+		}
+		if err = json.Unmarshal([]byte(changes), &e.Changes); err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return entries, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,239 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/audit"
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+// policyJSON returns the jsonb stored for the cancellation policy a reservation was booked under,
+// or null if there was none
+func policyJSON(p models.CancellationPolicy) (interface{}, error) {
+	if len(p.Tiers) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(p)
+}
+
+// parsePolicy reads the cancellation policy a reservation was booked under from its jsonb
+func parsePolicy(b []byte) (models.CancellationPolicy, error) {
+	var p models.CancellationPolicy
+	if len(b) == 0 {
+		return p, nil
+	}
+	err := json.Unmarshal(b, &p)
+	return p, err
+}
+
+func scanPolicy(row interface{ Scan(...interface{}) error }) (models.CancellationPolicy, error) {
+	var p models.CancellationPolicy
+	var tiers []byte
+	err := row.Scan(&p.ID, &p.Name, &p.Description, &tiers, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return p, err
+	}
+	err = json.Unmarshal(tiers, &p.Tiers)
+	return p, err
+}
+
+// policyRooms returns the rooms of every cancellation policy, by policy id
+func (m *postgresDBRepo) policyRooms(ctx context.Context) (map[int][]int, error) {
+	rooms := make(map[int][]int)
+
+	rows, err := m.DB.QueryContext(ctx, `select cancellation_policy_id, id from rooms
+			where cancellation_policy_id is not null order by id`)
+	if err != nil {
+		return rooms, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var policyID, roomID int
+		if err := rows.Scan(&policyID, &roomID); err != nil {
+			return rooms, err
+		}
+		rooms[policyID] = append(rooms[policyID], roomID)
+	}
+	return rooms, rows.Err()
+}
+
+// AllCancellationPolicies returns every cancellation policy with its rooms, by name
+func (m *postgresDBRepo) AllCancellationPolicies() ([]models.CancellationPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var policies []models.CancellationPolicy
+
+	rows, err := m.DB.QueryContext(ctx, `select id, name, description, tiers, created_at, updated_at
+			from cancellation_policies order by name`)
+	if err != nil {
+		return policies, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPolicy(rows)
+		if err != nil {
+			return policies, err
+		}
+		policies = append(policies, p)
+	}
+	if err = rows.Err(); err != nil {
+		return policies, err
+	}
+
+	rooms, err := m.policyRooms(ctx)
+	if err != nil {
+		return policies, err
+	}
+	for i := range policies {
+		policies[i].RoomIDs = rooms[policies[i].ID]
+	}
+	return policies, nil
+}
+
+// GetCancellationPolicyByID returns a cancellation policy with its rooms
+func (m *postgresDBRepo) GetCancellationPolicyByID(id int) (models.CancellationPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	p, err := scanPolicy(m.DB.QueryRowContext(ctx, `select id, name, description, tiers, created_at, updated_at
+			from cancellation_policies where id = $1`, id))
+	if err != nil {
+		return p, err
+	}
+
+	rooms, err := m.policyRooms(ctx)
+	p.RoomIDs = rooms[p.ID]
+	return p, err
+}
+
+// setPolicyRooms gives the rooms in roomIDs the cancellation policy, taking it off any others.
+// A room has one policy, so rooms that had another one are moved to this one.
+func setPolicyRooms(ctx context.Context, tx *sql.Tx, policyID int, roomIDs []int) error {
+	_, err := tx.ExecContext(ctx, "update rooms set cancellation_policy_id = null where cancellation_policy_id = $1", policyID)
+	if err != nil {
+		return err
+	}
+
+	for _, roomID := range roomIDs {
+		_, err = tx.ExecContext(ctx, "update rooms set cancellation_policy_id = $1, updated_at = $2 where id = $3",
+			policyID, time.Now(), roomID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertCancellationPolicy adds a cancellation policy and gives it to its rooms
+func (m *postgresDBRepo) InsertCancellationPolicy(p models.CancellationPolicy) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tiers, err := json.Marshal(p.Tiers)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var newID int
+	stmt := `insert into cancellation_policies (name, description, tiers, created_at, updated_at)
+			values ($1, $2, $3, $4, $5) returning id`
+	err = tx.QueryRowContext(ctx, stmt, p.Name, p.Description, tiers, time.Now(), time.Now()).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = setPolicyRooms(ctx, tx, newID, p.RoomIDs); err != nil {
+		return 0, err
+	}
+
+	p.ID = newID
+	if err = m.writeAudit(ctx, tx, audit.ActionCreate, audit.EntityPolicy, newID, nil, p); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// UpdateCancellationPolicy saves a cancellation policy and its rooms. Reservations already made
+// keep the policy they were booked under.
+func (m *postgresDBRepo) UpdateCancellationPolicy(p models.CancellationPolicy) error {
+	before, err := m.GetCancellationPolicyByID(p.ID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tiers, err := json.Marshal(p.Tiers)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `update cancellation_policies set name = $1, description = $2, tiers = $3, updated_at = $4
+			where id = $5`
+	_, err = tx.ExecContext(ctx, stmt, p.Name, p.Description, tiers, time.Now(), p.ID)
+	if err != nil {
+		return err
+	}
+
+	if err = setPolicyRooms(ctx, tx, p.ID, p.RoomIDs); err != nil {
+		return err
+	}
+
+	if err = m.writeAudit(ctx, tx, audit.ActionUpdate, audit.EntityPolicy, p.ID, before, p); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteCancellationPolicy deletes a cancellation policy, leaving its rooms without one.
+// Reservations already made keep the policy they were booked under.
+func (m *postgresDBRepo) DeleteCancellationPolicy(id int) error {
+	before, err := m.GetCancellationPolicyByID(id)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "delete from cancellation_policies where id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	if err = m.writeAudit(ctx, tx, audit.ActionDelete, audit.EntityPolicy, id, before, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,208 @@
+package dbrepo
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/audit"
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+// customFieldsJSON returns the jsonb stored for a reservation's custom field answers
+func customFieldsJSON(values map[string]string) ([]byte, error) {
+	if len(values) == 0 {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(values)
+}
+
+// parseCustomFields reads a reservation's custom field answers from their jsonb
+func parseCustomFields(b []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	if len(b) == 0 {
+		return values, nil
+	}
+	err := json.Unmarshal(b, &values)
+	return values, err
+}
+
+const customFieldColumns = `
+		select id, name, label, field_type, required, options, pattern, max_length, sort_order, active,
+		created_at, updated_at
+		from custom_fields`
+
+func scanCustomField(row interface{ Scan(...interface{}) error }) (models.CustomField, error) {
+	var f models.CustomField
+	var options string
+	err := row.Scan(
+		&f.ID,
+		&f.Name,
+		&f.Label,
+		&f.Type,
+		&f.Required,
+		&options,
+		&f.Pattern,
+		&f.MaxLength,
+		&f.SortOrder,
+		&f.Active,
+		&f.CreatedAt,
+		&f.UpdatedAt,
+	)
+	if options != "" {
+		f.Options = strings.Split(options, "\n")
+	}
+	return f, err
+}
+
+// AllCustomFields returns every custom booking form field, in the order they are asked
+func (m *postgresDBRepo) AllCustomFields() ([]models.CustomField, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var fields []models.CustomField
+
+	rows, err := m.DB.QueryContext(ctx, customFieldColumns+" order by sort_order, id")
+	if err != nil {
+		return fields, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		f, err := scanCustomField(rows)
+		if err != nil {
+			return fields, err
+		}
+		fields = append(fields, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return fields, err
+	}
+	return fields, nil
+}
+
+// GetCustomFieldByID returns a custom booking form field by id
+func (m *postgresDBRepo) GetCustomFieldByID(id int) (models.CustomField, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanCustomField(m.DB.QueryRowContext(ctx, customFieldColumns+" where id = $1", id))
+}
+
+// InsertCustomField adds a custom booking form field
+func (m *postgresDBRepo) InsertCustomField(f models.CustomField) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var newID int
+	stmt := `insert into custom_fields (name, label, field_type, required, options, pattern, max_length,
+			sort_order, active, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) returning id`
+	err = tx.QueryRowContext(ctx, stmt,
+		f.Name,
+		f.Label,
+		f.Type,
+		f.Required,
+		strings.Join(f.Options, "\n"),
+		f.Pattern,
+		f.MaxLength,
+		f.SortOrder,
+		f.Active,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	f.ID = newID
+	if err = m.writeAudit(ctx, tx, audit.ActionCreate, audit.EntityCustomField, newID, nil, f); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// UpdateCustomField saves a custom booking form field. Answers already given are kept under the
+// field's name, so renaming a field leaves them behind.
+func (m *postgresDBRepo) UpdateCustomField(f models.CustomField) error {
+	before, err := m.GetCustomFieldByID(f.ID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `update custom_fields set name = $1, label = $2, field_type = $3, required = $4, options = $5,
+			pattern = $6, max_length = $7, sort_order = $8, active = $9, updated_at = $10
+			where id = $11`
+	_, err = tx.ExecContext(ctx, stmt,
+		f.Name,
+		f.Label,
+		f.Type,
+		f.Required,
+		strings.Join(f.Options, "\n"),
+		f.Pattern,
+		f.MaxLength,
+		f.SortOrder,
+		f.Active,
+		time.Now(),
+		f.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err = m.writeAudit(ctx, tx, audit.ActionUpdate, audit.EntityCustomField, f.ID, before, f); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteCustomField deletes a custom booking form field. Answers already given stay on their
+// reservations.
+func (m *postgresDBRepo) DeleteCustomField(id int) error {
+	before, err := m.GetCustomFieldByID(id)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "delete from custom_fields where id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	if err = m.writeAudit(ctx, tx, audit.ActionDelete, audit.EntityCustomField, id, before, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
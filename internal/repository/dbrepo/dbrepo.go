@@ -4,17 +4,26 @@ import (
 	"database/sql"
 
 	"github.com/tsawler/bookings-app/internal/config"
+	"github.com/tsawler/bookings-app/internal/models"
 	"github.com/tsawler/bookings-app/internal/repository"
 )
 
 type postgresDBRepo struct {
 	App *config.AppConfig
 	DB *sql.DB
+
+	// actor is who writes are recorded against in the audit log, see WithActor
+	actor *models.Actor
+	// properties are the properties reads are limited to, see WithProperties
+	properties []int
 }
 
 type testDBRepo struct {
 	App *config.AppConfig
 	DB *sql.DB
+
+	// properties are the properties reads are limited to, see WithProperties
+	properties []int
 }
 
 func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
@@ -0,0 +1,380 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/audit"
+	"github.com/tsawler/bookings-app/internal/guests"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/repository"
+)
+
+// queryer is satisfied by both *sql.DB and *sql.Tx, so guests can be matched inside the
+// transaction of the reservation being saved
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// guestAudit is what the audit log keeps of a guest
+type guestAudit struct {
+	FirstName  string
+	LastName   string
+	Email      string
+	Phone      string
+	Notes      string
+	Tags       string
+	MergedInto int `json:",omitempty"`
+}
+
+func guestSnapshot(g models.Guest) guestAudit {
+	return guestAudit{
+		FirstName: g.FirstName,
+		LastName:  g.LastName,
+		Email:     g.Email,
+		Phone:     g.Phone,
+		Notes:     g.Notes,
+		Tags:      strings.Join(g.Tags, ", "),
+	}
+}
+
+// matchGuest returns the id of the guest who made a reservation, creating the guest if they are
+// new. Guests are matched on their email address, then on the email addresses of their earlier
+// reservations, which keeps working for guests that have been merged, and last on their phone number.
+func (m *postgresDBRepo) matchGuest(ctx context.Context, q queryer, res models.Reservation) (int, error) {
+	email := guests.NormalizeEmail(res.Email)
+	phone := guests.NormalizePhone(res.Phone)
+
+	var id int
+	if email != "" {
+		err := q.QueryRowContext(ctx, "select id from guests where email_normalized = $1", email).Scan(&id)
+		if err != sql.ErrNoRows {
+			return id, err
+		}
+
+		query := `
+			select guest_id from reservations
+			where lower(trim(email)) = $1 and guest_id is not null
+			order by id desc limit 1`
+		err = q.QueryRowContext(ctx, query, email).Scan(&id)
+		if err != sql.ErrNoRows {
+			return id, err
+		}
+	}
+
+	if phone != "" {
+		err := q.QueryRowContext(ctx, "select id from guests where phone_normalized = $1 order by id limit 1", phone).Scan(&id)
+		if err != sql.ErrNoRows {
+			return id, err
+		}
+	}
+
+	// someone booking with the same email at the same moment may have just created the guest
+	stmt := `insert into guests (first_name, last_name, email, phone, email_normalized, phone_normalized, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)
+		on conflict (email_normalized) where email_normalized <> '' do update set updated_at = excluded.updated_at
+		returning id`
+	err := q.QueryRowContext(ctx, stmt,
+		res.FirstName,
+		res.LastName,
+		strings.TrimSpace(res.Email),
+		strings.TrimSpace(res.Phone),
+		email,
+		phone,
+		time.Now(),
+		time.Now(),
+	).Scan(&id)
+	return id, err
+}
+
+// guestColumns selects a guest along with their tags and the totals of their reservations
+const guestColumns = `
+	select g.id, g.first_name, g.last_name, g.email, g.phone, g.notes, g.created_at, g.updated_at,
+	coalesce((select string_agg(t.tag, ',' order by t.tag) from guest_tags t where t.guest_id = g.id), ''),
+	count(r.id),
+	coalesce(sum(r.nightly_rate * (r.end_date - r.start_date) - r.discount), 0),
+	max(r.end_date)
+	from guests g
+	left join reservations r on (r.guest_id = g.id and r.deleted_at is null and r.status not in ('cancelled', 'no_show'))`
+
+func scanGuest(row interface{ Scan(...interface{}) error }) (models.Guest, error) {
+	var g models.Guest
+	var tags string
+	var lastStay sql.NullTime
+	err := row.Scan(
+		&g.ID,
+		&g.FirstName,
+		&g.LastName,
+		&g.Email,
+		&g.Phone,
+		&g.Notes,
+		&g.CreatedAt,
+		&g.UpdatedAt,
+		&tags,
+		&g.Stays,
+		&g.LifetimeValue,
+		&lastStay,
+	)
+	if tags != "" {
+		g.Tags = strings.Split(tags, ",")
+	}
+	g.LastStay = lastStay.Time
+	return g, err
+}
+
+// listGuests returns the guests matching the where clause
+func (m *postgresDBRepo) listGuests(ctx context.Context, where, order string, args ...interface{}) ([]models.Guest, error) {
+	var list []models.Guest
+
+	query := guestColumns + ` where ` + where + ` group by g.id order by ` + order
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return list, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		g, err := scanGuest(rows)
+		if err != nil {
+			return list, err
+		}
+		list = append(list, g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return list, err
+	}
+	return list, nil
+}
+
+// SearchGuests returns up to limit guests whose name, email, phone or tags contain search, best
+// customers first
+func (m *postgresDBRepo) SearchGuests(search string, limit int) ([]models.Guest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// match the text literally, not as a pattern
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.TrimSpace(search)) + "%"
+	where := `(g.first_name || ' ' || g.last_name ilike $1 or g.email ilike $1 or g.phone ilike $1
+		or exists (select 1 from guest_tags t where t.guest_id = g.id and t.tag ilike $1))`
+
+	return m.listGuests(ctx, where, "count(r.id) desc, g.last_name, g.first_name limit $2", pattern, limit)
+}
+
+// GetGuestByID returns a guest
+func (m *postgresDBRepo) GetGuestByID(id int) (models.Guest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanGuest(m.DB.QueryRowContext(ctx, guestColumns+` where g.id = $1 group by g.id`, id))
+}
+
+// GuestReservations returns the reservations of a guest, latest stay first. Deleted reservations are left out.
+func (m *postgresDBRepo) GuestReservations(guestID int) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := reservationSearchColumns + `
+		where r.deleted_at is null and r.guest_id = $1
+		order by r.start_date desc, r.id desc`
+
+	rows, err := m.DB.QueryContext(ctx, query, guestID)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		i, err := scanSearchedReservation(rows)
+		if err != nil {
+			return reservations, err
+		}
+		reservations = append(reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+	return reservations, nil
+}
+
+// PossibleDuplicateGuests returns the other guests who may be the same person as g: those with the
+// same phone number or the same name
+func (m *postgresDBRepo) PossibleDuplicateGuests(g models.Guest) ([]models.Guest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	where := `g.id <> $1 and ((g.phone_normalized <> '' and g.phone_normalized = $2)
+		or (lower(g.first_name) = lower($3) and lower(g.last_name) = lower($4)))`
+
+	return m.listGuests(ctx, where, "g.id", g.ID, guests.NormalizePhone(g.Phone), g.FirstName, g.LastName)
+}
+
+// UpdateGuest saves a guest's details, notes and tags
+func (m *postgresDBRepo) UpdateGuest(g models.Guest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := scanGuest(tx.QueryRowContext(ctx, guestColumns+` where g.id = $1 group by g.id`, g.ID))
+	if err != nil {
+		return err
+	}
+
+	email := guests.NormalizeEmail(g.Email)
+	if email != "" {
+		var other int
+		err = tx.QueryRowContext(ctx, "select id from guests where email_normalized = $1 and id <> $2", email, g.ID).Scan(&other)
+		if err == nil {
+			return repository.ErrDuplicateGuest
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	stmt := `update guests set first_name = $1, last_name = $2, email = $3, phone = $4, email_normalized = $5,
+		phone_normalized = $6, notes = $7, updated_at = $8 where id = $9`
+	_, err = tx.ExecContext(ctx, stmt,
+		g.FirstName,
+		g.LastName,
+		strings.TrimSpace(g.Email),
+		strings.TrimSpace(g.Phone),
+		email,
+		guests.NormalizePhone(g.Phone),
+		g.Notes,
+		time.Now(),
+		g.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = m.setGuestTags(ctx, tx, g.ID, g.Tags)
+	if err != nil {
+		return err
+	}
+
+	err = m.writeAudit(ctx, tx, audit.ActionUpdate, audit.EntityGuest, g.ID, guestSnapshot(before), guestSnapshot(g))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setGuestTags replaces the tags of a guest
+func (m *postgresDBRepo) setGuestTags(ctx context.Context, tx *sql.Tx, guestID int, tags []string) error {
+	_, err := tx.ExecContext(ctx, "delete from guest_tags where guest_id = $1", guestID)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		stmt := `insert into guest_tags (guest_id, tag, created_at, updated_at) values ($1, $2, $3, $4)`
+		_, err = tx.ExecContext(ctx, stmt, guestID, tag, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergeGuests folds the guest mergeID into keepID: their reservations move over, their notes and
+// tags are added and any contact details keepID lacks are filled in. mergeID is then deleted.
+func (m *postgresDBRepo) MergeGuests(keepID, mergeID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// lock both, in id order so that two merges of the same pair can't deadlock
+	first, second := keepID, mergeID
+	if first > second {
+		first, second = second, first
+	}
+	for _, id := range []int{first, second} {
+		var locked int
+		err = tx.QueryRowContext(ctx, "select id from guests where id = $1 for update", id).Scan(&locked)
+		if err != nil {
+			return err
+		}
+	}
+
+	keep, err := scanGuest(tx.QueryRowContext(ctx, guestColumns+` where g.id = $1 group by g.id`, keepID))
+	if err != nil {
+		return err
+	}
+	merge, err := scanGuest(tx.QueryRowContext(ctx, guestColumns+` where g.id = $1 group by g.id`, mergeID))
+	if err != nil {
+		return err
+	}
+
+	merged := keep
+	if merged.Email == "" {
+		merged.Email = merge.Email
+	}
+	if merged.Phone == "" {
+		merged.Phone = merge.Phone
+	}
+	if merge.Notes != "" {
+		merged.Notes = strings.TrimSpace(merged.Notes + "\n\n" + merge.Notes)
+	}
+	merged.Tags = guests.ParseTags(strings.Join(append(append([]string{}, keep.Tags...), merge.Tags...), ","))
+
+	_, err = tx.ExecContext(ctx, "update reservations set guest_id = $1, updated_at = $2 where guest_id = $3", keepID, time.Now(), mergeID)
+	if err != nil {
+		return err
+	}
+
+	// the merged guest goes first, so their email address is free for the guest kept
+	_, err = tx.ExecContext(ctx, "delete from guests where id = $1", mergeID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `update guests set email = $1, phone = $2, email_normalized = $3, phone_normalized = $4, notes = $5,
+		updated_at = $6 where id = $7`
+	_, err = tx.ExecContext(ctx, stmt,
+		merged.Email,
+		merged.Phone,
+		guests.NormalizeEmail(merged.Email),
+		guests.NormalizePhone(merged.Phone),
+		merged.Notes,
+		time.Now(),
+		keepID,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = m.setGuestTags(ctx, tx, keepID, merged.Tags)
+	if err != nil {
+		return err
+	}
+
+	gone := guestSnapshot(merge)
+	gone.MergedInto = keepID
+	err = m.writeAudit(ctx, tx, audit.ActionMerge, audit.EntityGuest, mergeID, guestSnapshot(merge), gone)
+	if err != nil {
+		return err
+	}
+	err = m.writeAudit(ctx, tx, audit.ActionUpdate, audit.EntityGuest, keepID, guestSnapshot(keep), guestSnapshot(merged))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
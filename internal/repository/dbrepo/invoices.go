@@ -0,0 +1,126 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+const invoiceColumns = `select id, number, reservation_id, issued_at, total, currency, subtotal, discount,
+		lines, taxes, created_at, updated_at
+		from invoices`
+
+// scanInvoice scans a row selected with invoiceColumns
+func scanInvoice(row interface{ Scan(...interface{}) error }) (models.Invoice, error) {
+	var inv models.Invoice
+	var lines, taxes []byte
+
+	err := row.Scan(
+		&inv.ID,
+		&inv.Number,
+		&inv.ReservationID,
+		&inv.IssuedAt,
+		&inv.Total,
+		&inv.Currency,
+		&inv.Subtotal,
+		&inv.Discount,
+		&lines,
+		&taxes,
+		&inv.CreatedAt,
+		&inv.UpdatedAt,
+	)
+	if err != nil {
+		return inv, err
+	}
+
+	if err = json.Unmarshal(lines, &inv.Lines); err != nil {
+		return inv, err
+	}
+	err = json.Unmarshal(taxes, &inv.Taxes)
+	return inv, err
+}
+
+// GetInvoiceByReservationID returns the invoice issued for a reservation, or sql.ErrNoRows if
+// none has been issued yet
+func (m *postgresDBRepo) GetInvoiceByReservationID(id int) (models.Invoice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanInvoice(m.DB.QueryRowContext(ctx, invoiceColumns+" where reservation_id = $1", id))
+}
+
+// IssueInvoice issues inv, the invoice worked out for its reservation, with the next invoice
+// number and keeps what it bills. If the reservation already has an invoice, that one is
+// returned instead. The counter row is locked and updated in the same transaction as the
+// insert, so numbers are never skipped.
+func (m *postgresDBRepo) IssueInvoice(inv models.Invoice) (models.Invoice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return inv, err
+	}
+	defer tx.Rollback()
+
+	// take the counter lock first so two requests can't both see no invoice and issue two
+	var number int
+	err = tx.QueryRowContext(ctx, "select last_number from invoice_counters where id = 1 for update").Scan(&number)
+	if err != nil {
+		return inv, err
+	}
+
+	issued, err := scanInvoice(tx.QueryRowContext(ctx, invoiceColumns+" where reservation_id = $1", inv.ReservationID))
+	if err == nil {
+		return issued, nil
+	} else if err != sql.ErrNoRows {
+		return inv, err
+	}
+
+	lines, err := json.Marshal(inv.Lines)
+	if err != nil {
+		return inv, err
+	}
+	taxes, err := json.Marshal(inv.Taxes)
+	if err != nil {
+		return inv, err
+	}
+
+	number++
+	_, err = tx.ExecContext(ctx, "update invoice_counters set last_number = $1, updated_at = $2 where id = 1", number, time.Now())
+	if err != nil {
+		return inv, err
+	}
+
+	inv.Number = number
+	inv.IssuedAt = time.Now()
+	inv.CreatedAt = time.Now()
+	inv.UpdatedAt = time.Now()
+	stmt := `insert into invoices (number, reservation_id, issued_at, total, currency, subtotal, discount, lines, taxes,
+		created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) returning id`
+	err = tx.QueryRowContext(ctx, stmt,
+		inv.Number,
+		inv.ReservationID,
+		inv.IssuedAt,
+		inv.Total,
+		inv.Currency,
+		inv.Subtotal,
+		inv.Discount,
+		lines,
+		taxes,
+		inv.CreatedAt,
+		inv.UpdatedAt,
+	).Scan(&inv.ID)
+	if err != nil {
+		return inv, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return inv, err
+	}
+	return inv, nil
+}
@@ -0,0 +1,171 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+// ReservationNotes returns the staff notes on a reservation as threads, oldest first, with the
+// replies to each note in its Replies
+func (m *postgresDBRepo) ReservationNotes(reservationID int) ([]models.ReservationNote, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var threads []models.ReservationNote
+
+	query := `
+		select n.id, n.reservation_id, coalesce(n.parent_id, 0), coalesce(n.user_id, 0),
+		coalesce(u.first_name || ' ' || u.last_name, ''), n.body, n.important, n.created_at, n.updated_at
+		from reservation_notes n
+		left join users u on (n.user_id = u.id)
+		where n.reservation_id = $1
+		order by n.created_at asc, n.id asc`
+	rows, err := m.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return threads, err
+	}
+	defer rows.Close()
+
+	// replies always come after the note they answer
+	index := make(map[int]int)
+	for rows.Next() {
+		var n models.ReservationNote
+		err := rows.Scan(
+			&n.ID,
+			&n.ReservationID,
+			&n.ParentID,
+			&n.UserID,
+			&n.UserName,
+			&n.Body,
+			&n.Important,
+			&n.CreatedAt,
+			&n.UpdatedAt,
+		)
+		if err != nil {
+			return threads, err
+		}
+
+		if i, ok := index[n.ParentID]; ok {
+			threads[i].Replies = append(threads[i].Replies, n)
+			continue
+		}
+		index[n.ID] = len(threads)
+		threads = append(threads, n)
+	}
+
+	if err = rows.Err(); err != nil {
+		return threads, err
+	}
+	return threads, nil
+}
+
+// InsertReservationNote adds a staff note to a reservation. A reply to a reply joins the thread
+// of the note it answers. It returns sql.ErrNoRows if the parent note is not on the reservation.
+func (m *postgresDBRepo) InsertReservationNote(n models.ReservationNote) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var parentID sql.NullInt64
+	if n.ParentID > 0 {
+		query := "select coalesce(parent_id, id) from reservation_notes where id = $1 and reservation_id = $2"
+		err := m.DB.QueryRowContext(ctx, query, n.ParentID, n.ReservationID).Scan(&parentID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var newID int
+	stmt := `insert into reservation_notes (reservation_id, parent_id, user_id, body, important, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7) returning id`
+	err := m.DB.QueryRowContext(ctx, stmt,
+		n.ReservationID,
+		parentID,
+		sql.NullInt64{Int64: int64(n.UserID), Valid: n.UserID > 0},
+		n.Body,
+		n.Important,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// SetReservationNoteImportant flags or unflags a note on a reservation as important. It returns
+// sql.ErrNoRows if the note is not on the reservation.
+func (m *postgresDBRepo) SetReservationNoteImportant(id, reservationID int, important bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := "update reservation_notes set important = $1, updated_at = $2 where id = $3 and reservation_id = $4"
+	result, err := m.DB.ExecContext(ctx, stmt, important, time.Now(), id, reservationID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ImportantNotesBetween returns the notes flagged as important on reservations staying between
+// start and end, by arrival date, together with their reservation and room
+func (m *postgresDBRepo) ImportantNotesBetween(start, end time.Time) ([]models.ReservationNote, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var notes []models.ReservationNote
+
+	query := `
+		select n.id, n.reservation_id, coalesce(n.user_id, 0), coalesce(u.first_name || ' ' || u.last_name, ''),
+		n.body, n.created_at, r.first_name, r.last_name, r.start_date, r.end_date, r.room_id, rm.room_name
+		from reservation_notes n
+		left join users u on (n.user_id = u.id)
+		left join reservations r on (n.reservation_id = r.id)
+		left join rooms rm on (r.room_id = rm.id)
+		where n.important and r.deleted_at is null and r.start_date <= $2 and r.end_date > $1
+		and ` + m.roomScope("r.room_id") + `
+		order by r.start_date, r.id, n.created_at`
+	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	if err != nil {
+		return notes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		n := models.ReservationNote{Important: true}
+		err := rows.Scan(
+			&n.ID,
+			&n.ReservationID,
+			&n.UserID,
+			&n.UserName,
+			&n.Body,
+			&n.CreatedAt,
+			&n.Reservation.FirstName,
+			&n.Reservation.LastName,
+			&n.Reservation.StartDate,
+			&n.Reservation.EndDate,
+			&n.Reservation.RoomID,
+			&n.Reservation.Room.RoomName,
+		)
+		if err != nil {
+			return notes, err
+		}
+		n.Reservation.ID = n.ReservationID
+		notes = append(notes, n)
+	}
+
+	if err = rows.Err(); err != nil {
+		return notes, err
+	}
+	return notes, nil
+}
@@ -2,29 +2,62 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/tsawler/bookings-app/internal/audit"
+	"github.com/tsawler/bookings-app/internal/i18n"
 	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/repository"
 )
 
 func (m *postgresDBRepo) AllUser() bool {
 	return true
 }
 
-// InsertReservation inserts a reservation into the database
+// InsertReservation inserts a reservation into the database, along with its guest and the
+// redemption of its promo code
 func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
 	var newID int
 
-	stmt := `insert into reservations (first_name, last_name, email, phone, start_date, end_date, room_id, created_at, updated_at) 
-			values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+	guestID, err := m.matchGuest(ctx, tx, res)
+	if err != nil {
+		return 0, err
+	}
 
-	err := m.DB.QueryRowContext(ctx, stmt,
+	customFields, err := customFieldsJSON(res.CustomFields)
+	if err != nil {
+		return 0, err
+	}
+	charges, err := chargesJSON(res.Charges)
+	if err != nil {
+		return 0, err
+	}
+	policy, err := policyJSON(res.CancellationPolicy)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `insert into reservations (first_name, last_name, email, phone, start_date, end_date, room_id, created_at, updated_at,
+			nightly_rate, discount, access_token, status, source, guest_id, special_requests, custom_fields, locale,
+			guests, charges, cancellation_policy) 
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
 		res.FirstName,
 		res.LastName,
 		res.Email,
@@ -34,15 +67,72 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 		res.RoomID,
 		time.Now(),
 		time.Now(),
+		res.NightlyRate,
+		res.Discount,
+		sql.NullString{String: res.AccessToken, Valid: res.AccessToken != ""},
+		newReservationStatus(res),
+		newReservationSource(res),
+		guestID,
+		res.SpecialRequests,
+		customFields,
+		newLocale(res.Locale),
+		newGuests(res.Guests),
+		charges,
+		policy,
 	).Scan(&newID)
 
 	if err != nil {
 		return 0,err
 	}
 
+	res.ID = newID
+	if err = redeemPromoCode(ctx, tx, res); err != nil {
+		return 0, err
+	}
+
+	err = m.writeAudit(ctx, tx, audit.ActionCreate, audit.EntityReservation, newID, nil, reservationSnapshot(res))
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
 	return newID, nil
 }
 
+// newReservationStatus is the status a reservation is inserted with, pending unless it is set
+func newReservationStatus(res models.Reservation) models.ReservationStatus {
+	if res.Status == "" {
+		return models.StatusPending
+	}
+	return res.Status
+}
+
+// newReservationSource is where a reservation is recorded as coming from, the web unless it is set
+func newReservationSource(res models.Reservation) string {
+	if res.Source == "" {
+		return models.SourceWeb
+	}
+	return res.Source
+}
+
+// newGuests is the number of guests a reservation is inserted with, one unless it is set
+func newGuests(guests int) int {
+	if guests < 1 {
+		return 1
+	}
+	return guests
+}
+
+// newLocale is the language a guest is written to in, English unless it is set
+func newLocale(locale string) string {
+	if locale == "" {
+		return i18n.Default
+	}
+	return locale
+}
+
 func (m *postgresDBRepo) InsertRoomRestrictions(r models.RoomRestriction) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -77,7 +167,8 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time,
 			room_restrictions
 		where
 		    room_id = $1 and
-			$2 < end_date and $3 > start_date;`
+			$2 < end_date and $3 > start_date and
+			(expires_at is null or expires_at > now());`
 
 	row := m.DB.QueryRowContext(ctx,query, roomID, start, end)
 	err := row.Scan(&numRows)
@@ -91,19 +182,24 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time,
 	return false, nil
 }
 
-func (m *postgresDBRepo) SearchAvailabilityForAllRoom(start, end time.Time) ([]models.Room, error) {
+// SearchAvailabilityForAllRoom returns the rooms free between start and end, in the property
+// propertyID or, if it is 0, in every property
+func (m *postgresDBRepo) SearchAvailabilityForAllRoom(start, end time.Time, propertyID int) ([]models.Room, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	var rooms []models.Room
 
 	query := `
-		select r.id, r.room_name
+		select r.id, r.room_name, r.property_id
 		from rooms r
-		where r.id not in (select room_id from room_restrictions rr where $1 < rr.end_date and $2 > rr.start_date)
+		where r.id not in (select room_id from room_restrictions rr where $1 < rr.end_date and $2 > rr.start_date
+			and (rr.expires_at is null or rr.expires_at > now()))
+		and ($3 = 0 or r.property_id = $3)
+		order by r.property_id, r.room_name
 		`
 
-	rows, err := m.DB.QueryContext(ctx,query, start, end)
+	rows, err := m.DB.QueryContext(ctx,query, start, end, propertyID)
 	if err != nil {
 		return nil, err
 	}
@@ -113,6 +209,7 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRoom(start, end time.Time) ([]m
 		err := rows.Scan(
 			&room.ID,
 			&room.RoomName,
+			&room.PropertyID,
 			)
 		if err != nil {
 			return rooms, err
@@ -130,9 +227,12 @@ func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	var room models.Room
-	query := `select id, room_name, created_at, updated_at from rooms where id = $1`
+	query := `select id, room_name, price, deposit_percent, coalesce(cancellation_policy_id, 0), property_id,
+			created_at, updated_at
+			from rooms where id = $1 and ` + m.roomScope("id")
 	row := m.DB.QueryRowContext(ctx,query,id)
-	err := row.Scan(&room.ID, &room.RoomName, &room.CreatedAt, &room.UpdatedAt)
+	err := row.Scan(&room.ID, &room.RoomName, &room.Price, &room.DepositPercent, &room.CancellationPolicyID,
+		&room.PropertyID, &room.CreatedAt, &room.UpdatedAt)
 	if err != nil {
 		return room,err
 	}
@@ -163,7 +263,9 @@ func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
 	if err != nil {
 		return u,err
 	}
-	return u,nil
+
+	u.PropertyIDs, err = m.userProperties(ctx, u.ID)
+	return u,err
 }
 
 func (m *postgresDBRepo) UpdateUser(u models.User) error {
@@ -210,41 +312,249 @@ func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string,
 	return id, hashedPassword, nil
 }
 
-func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
+// reservationSortColumns maps the sorts in repository.ReservationSorts to columns
+var reservationSortColumns = map[string]string{
+	"id":         "r.id",
+	"last_name":  "lower(r.last_name)",
+	"room":       "rm.room_name",
+	"start_date": "r.start_date",
+	"end_date":   "r.end_date",
+	"status":     "r.status",
+	"source":     "r.source",
+}
+
+// reservationSearch builds the where clause, arguments and order by of a search for reservations
+// matching f. Deleted reservations are left out.
+func (m *postgresDBRepo) reservationSearch(f models.ReservationFilter) (string, []interface{}, string) {
+	where := []string{"r.deleted_at is null", m.roomScope("r.room_id")}
+	var args []interface{}
+	add := func(clause string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, strings.ReplaceAll(clause, "$?", fmt.Sprintf("$%d", len(args))))
+	}
+	if f.Search != "" {
+		// match the text literally, not as a pattern
+		search := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(f.Search)
+		add("(r.first_name || ' ' || r.last_name ilike $? or r.email ilike $?)", "%"+search+"%")
+	}
+	if f.RoomID > 0 {
+		add("r.room_id = $?", f.RoomID)
+	}
+	if f.PropertyID > 0 {
+		add("r.room_id in (select id from rooms where property_id = $?)", f.PropertyID)
+	}
+	if !f.From.IsZero() {
+		add("r.end_date > $?", f.From)
+	}
+	if !f.To.IsZero() {
+		add("r.start_date <= $?", f.To)
+	}
+	if f.Status != "" {
+		add("r.status = $?", f.Status)
+	}
+
+	order, ok := reservationSortColumns[f.Sort]
+	if !ok {
+		order = reservationSortColumns["start_date"]
+	}
+	if f.Desc {
+		order += " desc"
+	}
+
+	return " where " + strings.Join(where, " and "), args, order + ", r.id"
+}
+
+const reservationSearchColumns = `
+		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
+		r.end_date, r.room_id, r.created_at, r.updated_at, r.status, r.source,
+		r.nightly_rate, r.discount, coalesce(r.guest_id, 0), rm.id, rm.room_name, coalesce(rm.property_id, 0),
+		coalesce((select n.body from reservation_notes n where n.reservation_id = r.id and n.important
+			order by n.created_at desc limit 1), ''), r.custom_fields, r.guests, r.charges
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)`
+
+func scanSearchedReservation(rows *sql.Rows) (models.Reservation, error) {
+	var i models.Reservation
+	var customFields, charges []byte
+	err := rows.Scan(
+		&i.ID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Phone,
+		&i.StartDate,
+		&i.EndDate,
+		&i.RoomID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Status,
+		&i.Source,
+		&i.NightlyRate,
+		&i.Discount,
+		&i.GuestID,
+		&i.Room.ID,
+		&i.Room.RoomName,
+		&i.Room.PropertyID,
+		&i.ImportantNote,
+		&customFields,
+		&i.Guests,
+		&charges,
+	)
+	if err != nil {
+		return i, err
+	}
+	i.CustomFields, err = parseCustomFields(customFields)
+	if err != nil {
+		return i, err
+	}
+	i.Charges, err = parseCharges(charges)
+	return i, err
+}
+
+// SearchReservations returns a page of the reservations matching f, along with how many match in total.
+// Deleted reservations are left out.
+func (m *postgresDBRepo) SearchReservations(f models.ReservationFilter) ([]models.Reservation, int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	var reservations []models.Reservation
 
+	whereSQL, args, order := m.reservationSearch(f)
+
+	var total int
+	query := `select count(r.id) from reservations r` + whereSQL
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&total)
+	if err != nil {
+		return reservations, 0, err
+	}
+
+	query = reservationSearchColumns + whereSQL + ` order by ` + order
+	if f.PerPage > 0 {
+		page := f.Page
+		if page < 1 {
+			page = 1
+		}
+		args = append(args, f.PerPage, (page-1)*f.PerPage)
+		query += fmt.Sprintf(" limit $%d offset $%d", len(args)-1, len(args))
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return reservations, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		i, err := scanSearchedReservation(rows)
+		if err != nil {
+			return reservations, 0, err
+		}
+		reservations = append(reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, 0, err
+	}
+	return reservations, total, nil
+}
+
+// EachReservation calls fn with every reservation matching f, in order, as they are read from the
+// database, so that long lists don't have to be held in memory. Paging in f is ignored.
+func (m *postgresDBRepo) EachReservation(f models.ReservationFilter, fn func(models.Reservation) error) error {
+	// exports read every reservation, so they get longer than the usual queries
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	whereSQL, args, order := m.reservationSearch(f)
+
+	rows, err := m.DB.QueryContext(ctx, reservationSearchColumns+whereSQL+` order by `+order, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		i, err := scanSearchedReservation(rows)
+		if err != nil {
+			return err
+		}
+		if err = fn(i); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// OccupancyByDay returns the nights sold in every room on every day from start up to, but not
+// including, end. Days a room is not booked are returned with no nights.
+func (m *postgresDBRepo) OccupancyByDay(start, end time.Time) ([]models.DailyOccupancy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var occupancy []models.DailyOccupancy
+
 	query := `
-		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
-		r.end_date, r.room_id, r.created_at, r.updated_at, 
-		rm.id, rm.room_name
-		from reservations r
-		left join rooms rm on (r.room_id = rm.id)
-		order by r.start_date asc
-`
-	rows,err := m.DB.QueryContext(ctx,query)
+		select d.day::date, rm.id, rm.room_name, count(rr.id)
+		from generate_series($1::date, $2::date - 1, interval '1 day') as d(day)
+		cross join rooms rm
+		left join room_restrictions rr on (rr.room_id = rm.id and rr.restriction_id = $3
+			and rr.start_date <= d.day and rr.end_date > d.day)
+		where ` + m.roomScope("rm.id") + `
+		group by d.day, rm.id, rm.room_name
+		order by d.day, rm.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end, models.RestrictionReservation)
+	if err != nil {
+		return occupancy, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o models.DailyOccupancy
+		err := rows.Scan(&o.Date, &o.RoomID, &o.RoomName, &o.Nights)
+		if err != nil {
+			return occupancy, err
+		}
+		occupancy = append(occupancy, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return occupancy, err
+	}
+	return occupancy, nil
+}
+
+// ArrivalsOn returns the reservations arriving on day, leaving out cancelled and no-show ones
+func (m *postgresDBRepo) ArrivalsOn(day time.Time) ([]models.Reservation, error) {
+	return m.reservationsOn("r.start_date", day)
+}
+
+// DeparturesOn returns the reservations leaving on day, leaving out cancelled and no-show ones
+func (m *postgresDBRepo) DeparturesOn(day time.Time) ([]models.Reservation, error) {
+	return m.reservationsOn("r.end_date", day)
+}
+
+// reservationsOn returns the live reservations whose date column falls on day
+func (m *postgresDBRepo) reservationsOn(column string, day time.Time) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := reservationSearchColumns + `
+		where r.deleted_at is null and r.status not in ($1, $2) and ` + column + ` = $3
+		and ` + m.roomScope("r.room_id") + `
+		order by rm.room_name, r.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, models.StatusCancelled, models.StatusNoShow, day)
 	if err != nil {
 		return reservations, err
 	}
 	defer rows.Close()
+
 	for rows.Next() {
-		var i models.Reservation
-		err := rows.Scan(
-			&i.ID,
-			&i.FirstName,
-			&i.LastName,
-			&i.Email,
-			&i.Phone,
-			&i.StartDate,
-			&i.EndDate,
-			&i.RoomID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.RoomID,
-			&i.Room.RoomName,
-			)
+		i, err := scanSearchedReservation(rows)
 		if err != nil {
 			return reservations, err
 		}
@@ -254,46 +564,137 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 	if err = rows.Err(); err != nil {
 		return reservations, err
 	}
-	return reservations,nil
+	return reservations, nil
 }
 
-func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
+// OccupancySummary returns the room nights sold from start up to, but not including, end, and how
+// many nights all the rooms have between them in that time
+func (m *postgresDBRepo) OccupancySummary(start, end time.Time) (models.OccupancySummary, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var reservations []models.Reservation
+	var o models.OccupancySummary
 
+	// count the part of each stay that falls inside the range
 	query := `
-		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
-		r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
-		rm.id, rm.room_name
+		select
+			coalesce((select sum(least(rr.end_date, $2::date) - greatest(rr.start_date, $1::date))
+				from room_restrictions rr
+				where rr.restriction_id = $3 and rr.start_date < $2 and rr.end_date > $1
+				and ` + m.roomScope("rr.room_id") + `), 0),
+			(select count(id) from rooms where ` + m.roomScope("id") + `) * ($2::date - $1::date)`
+
+	err := m.DB.QueryRowContext(ctx, query, start, end, models.RestrictionReservation).Scan(
+		&o.NightsSold,
+		&o.NightsAvailable,
+	)
+	if err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// BookingsByWeek returns the reservations made in each week from the week of since up to this week,
+// with what they are worth. Weeks start on Monday; cancelled reservations are left out.
+func (m *postgresDBRepo) BookingsByWeek(since time.Time) ([]models.BookingVolume, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var volumes []models.BookingVolume
+
+	query := `
+		select w.week, count(r.id),
+			coalesce(sum(r.nightly_rate * (r.end_date - r.start_date) - r.discount), 0)
+		from generate_series(date_trunc('week', $1::timestamp), date_trunc('week', now()), interval '1 week') as w(week)
+		left join reservations r on (date_trunc('week', r.created_at) = w.week
+			and r.deleted_at is null and r.status <> $2 and ` + m.roomScope("r.room_id") + `)
+		group by w.week
+		order by w.week`
+
+	rows, err := m.DB.QueryContext(ctx, query, since, models.StatusCancelled)
+	if err != nil {
+		return volumes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v models.BookingVolume
+		err := rows.Scan(&v.Start, &v.Bookings, &v.Revenue)
+		if err != nil {
+			return volumes, err
+		}
+		volumes = append(volumes, v)
+	}
+
+	if err = rows.Err(); err != nil {
+		return volumes, err
+	}
+	return volumes, nil
+}
+
+// LeadTimeDistribution counts the reservations made since the given time by how many days ahead of
+// arrival they were made, in the ranges of models.LeadTimeBuckets. Cancelled reservations are left out.
+func (m *postgresDBRepo) LeadTimeDistribution(since time.Time) ([]models.LeadTimeBucket, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	buckets := make([]models.LeadTimeBucket, len(models.LeadTimeBuckets))
+	copy(buckets, models.LeadTimeBuckets)
+
+	query := `
+		select greatest(r.start_date - r.created_at::date, 0) as lead, count(r.id)
 		from reservations r
-		left join rooms rm on (r.room_id = rm.id)
-		where processed=0
-		order by r.start_date asc
-`
-	rows,err := m.DB.QueryContext(ctx,query)
+		where r.created_at >= $1 and r.deleted_at is null and r.status <> $2
+		and ` + m.roomScope("r.room_id") + `
+		group by lead`
+
+	rows, err := m.DB.QueryContext(ctx, query, since, models.StatusCancelled)
+	if err != nil {
+		return buckets, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var days, count int
+		err := rows.Scan(&days, &count)
+		if err != nil {
+			return buckets, err
+		}
+		for i := range buckets {
+			if buckets[i].Contains(days) {
+				buckets[i].Bookings += count
+				break
+			}
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return buckets, err
+	}
+	return buckets, nil
+}
+
+// ReservationsBetween returns the reservations with stays overlapping start up to, but not
+// including, end. Cancelled reservations are included; deleted ones are not.
+func (m *postgresDBRepo) ReservationsBetween(start, end time.Time) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := reservationSearchColumns + `
+		where r.deleted_at is null and r.start_date < $2 and r.end_date > $1
+		and ` + m.roomScope("r.room_id") + `
+		order by r.start_date, r.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end)
 	if err != nil {
 		return reservations, err
 	}
 	defer rows.Close()
+
 	for rows.Next() {
-		var i models.Reservation
-		err := rows.Scan(
-			&i.ID,
-			&i.FirstName,
-			&i.LastName,
-			&i.Email,
-			&i.Phone,
-			&i.StartDate,
-			&i.EndDate,
-			&i.RoomID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Processed,
-			&i.RoomID,
-			&i.Room.RoomName,
-		)
+		i, err := scanSearchedReservation(rows)
 		if err != nil {
 			return reservations, err
 		}
@@ -303,24 +704,82 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 	if err = rows.Err(); err != nil {
 		return reservations, err
 	}
-	return reservations,nil
+	return reservations, nil
+}
+
+// RestrictionsBetween returns the bookings and owner blocks overlapping start up to, but not
+// including, end. Room holds are left out.
+func (m *postgresDBRepo) RestrictionsBetween(start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var restrictions []models.RoomRestriction
+
+	query := `
+		select id, start_date, end_date, room_id, coalesce(reservation_id, 0), restriction_id
+		from room_restrictions
+		where restriction_id in ($1, $2) and start_date < $4 and end_date > $3
+		and ` + m.roomScope("room_id") + `
+		order by start_date, id`
+
+	rows, err := m.DB.QueryContext(ctx, query, models.RestrictionReservation, models.RestrictionOwnerBlock, start, end)
+	if err != nil {
+		return restrictions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.RoomRestriction
+		err := rows.Scan(
+			&r.ID,
+			&r.StartDate,
+			&r.EndDate,
+			&r.RoomID,
+			&r.ReservationID,
+			&r.RestrictionID,
+		)
+		if err != nil {
+			return restrictions, err
+		}
+		restrictions = append(restrictions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return restrictions, err
+	}
+	return restrictions, nil
 }
 
 func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error) {
+	return m.getReservation("r.id = $1", id)
+}
+
+// GetReservationByAccessToken returns the reservation a guest link points at
+func (m *postgresDBRepo) GetReservationByAccessToken(token string) (models.Reservation, error) {
+	return m.getReservation("r.access_token = $1 and r.deleted_at is null", token)
+}
+
+// getReservation returns the reservation matching where, together with its room
+func (m *postgresDBRepo) getReservation(where string, arg interface{}) (models.Reservation, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	var res models.Reservation
+	var accessToken sql.NullString
+	var deletedAt sql.NullTime
+	var customFields, charges, policy []byte
 
 	query := `
 		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
-		r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
-		rm.id, rm.room_name
+		r.end_date, r.room_id, r.created_at, r.updated_at, r.status,
+		r.nightly_rate, r.discount, r.access_token, r.deleted_at, coalesce(r.deleted_by, 0), r.source,
+		coalesce(r.guest_id, 0), r.special_requests, r.custom_fields, r.locale, r.guests, r.charges,
+		r.cancellation_policy,
+		rm.id, rm.room_name, rm.price, rm.deposit_percent, coalesce(rm.property_id, 0)
 		from reservations r
 		left join rooms rm on (r.room_id=rm.id)
-		where r.id=$1
-`
-	row := m.DB.QueryRowContext(ctx,query,id)
+		where ` + where + ` and ` + m.roomScope("r.room_id")
+	row := m.DB.QueryRowContext(ctx,query,arg)
 	err := row.Scan(
 		&res.ID,
 		&res.FirstName,
@@ -332,65 +791,1454 @@ func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error)
 		&res.RoomID,
 		&res.CreatedAt,
 		&res.UpdatedAt,
-		&res.Processed,
+		&res.Status,
+		&res.NightlyRate,
+		&res.Discount,
+		&accessToken,
+		&deletedAt,
+		&res.DeletedBy,
+		&res.Source,
+		&res.GuestID,
+		&res.SpecialRequests,
+		&customFields,
+		&res.Locale,
+		&res.Guests,
+		&charges,
+		&policy,
 		&res.Room.ID,
 		&res.Room.RoomName,
+		&res.Room.Price,
+		&res.Room.DepositPercent,
+		&res.Room.PropertyID,
 		)
 
 	if err != nil {
 		return res,err
 	}
-	return res,nil
+	res.AccessToken = accessToken.String
+	res.DeletedAt = deletedAt.Time
+	res.CustomFields, err = parseCustomFields(customFields)
+	if err != nil {
+		return res, err
+	}
+	res.Charges, err = parseCharges(charges)
+	if err != nil {
+		return res, err
+	}
+	res.CancellationPolicy, err = parsePolicy(policy)
+	return res,err
 }
 
+// UpdateReservation saves the guest details, dates and room of a reservation. When the dates or
+// room change, the room's availability is checked again, ignoring the reservation's own restriction,
+// and the restriction is moved with it. It returns repository.ErrRoomUnavailable if the new dates
+// are taken.
 func (m *postgresDBRepo) UpdateReservation(u models.Reservation) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	query := `
-		update reservations set first_name = $1, last_name = $2, email = $3, phone = $4, updated_at = $5
-		where id = $6 
-`
-	_, err := m.DB.ExecContext(ctx,query,
-		u.FirstName,
-		u.LastName,
-		u.Email,
-		u.Phone,
-		time.Now(),
-		u.ID,
-	)
+	before, err := m.GetReservationByID(u.ID)
+	if err != nil {
+		return err
+	}
 
+	charges, err := chargesJSON(u.Charges)
 	if err != nil {
 		return err
 	}
-	return nil
-}
 
-// DeleteReservation deletes one reservation by id
-func (m *postgresDBRepo) DeleteReservation(id int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := "delete from reservations where id = $1"
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	moved := u.RoomID != before.RoomID || !u.StartDate.Equal(before.StartDate) || !u.EndDate.Equal(before.EndDate)
+	if moved {
+		// same lock as room holds, so nobody can take the dates while we check them
+		_, err = tx.ExecContext(ctx, "select pg_advisory_xact_lock($1)", u.RoomID)
+		if err != nil {
+			return err
+		}
+
+		var numRows int
+		query := `
+			select count(id)
+			from room_restrictions
+			where room_id = $1 and $2 < end_date and $3 > start_date
+			and (reservation_id is null or reservation_id <> $4)
+			and (expires_at is null or expires_at > now())`
+		err = tx.QueryRowContext(ctx, query, u.RoomID, u.StartDate, u.EndDate, u.ID).Scan(&numRows)
+		if err != nil {
+			return err
+		}
+		if numRows > 0 {
+			return repository.ErrRoomUnavailable
+		}
+
+		stmt := `update room_restrictions set start_date = $1, end_date = $2, room_id = $3, updated_at = $4
+			where reservation_id = $5`
+		_, err = tx.ExecContext(ctx, stmt, u.StartDate, u.EndDate, u.RoomID, time.Now(), u.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		update reservations set first_name = $1, last_name = $2, email = $3, phone = $4, updated_at = $5,
+		start_date = $6, end_date = $7, room_id = $8, guests = $9, charges = $10, nightly_rate = $11
+		where id = $12 
+`
+	_, err = tx.ExecContext(ctx,query,
+		u.FirstName,
+		u.LastName,
+		u.Email,
+		u.Phone,
+		time.Now(),
+		u.StartDate,
+		u.EndDate,
+		u.RoomID,
+		newGuests(u.Guests),
+		charges,
+		u.NightlyRate,
+		u.ID,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	after := before
+	after.FirstName = u.FirstName
+	after.LastName = u.LastName
+	after.Email = u.Email
+	after.Phone = u.Phone
+	after.StartDate = u.StartDate
+	after.EndDate = u.EndDate
+	after.RoomID = u.RoomID
+	after.Guests = u.Guests
+	after.Charges = u.Charges
+	after.NightlyRate = u.NightlyRate
+	err = m.writeAudit(ctx, tx, audit.ActionUpdate, audit.EntityReservation, u.ID, reservationSnapshot(before), reservationSnapshot(after))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteReservation moves a reservation to the trash and releases its room. A reservation
+// that could still be cancelled is cancelled too, so restoring it doesn't bring back a stay
+// the guest has been refunded for. It returns sql.ErrNoRows if the reservation is in the
+// trash already
+func (m *postgresDBRepo) DeleteReservation(id, userID int) error {
+	before, err := m.GetReservationByID(id)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "update reservations set deleted_at = $1, deleted_by = $2 where id = $3 and deleted_at is null"
+	result, err := tx.ExecContext(ctx, query, time.Now(), nullInt(userID), id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	if before.Status.CanTransitionTo(models.StatusCancelled) {
+		result, err = tx.ExecContext(ctx, "update reservations set status = $1, updated_at = $2 where id = $3 and status = $4",
+			models.StatusCancelled, time.Now(), id, before.Status)
+		if err != nil {
+			return err
+		}
+		n, err = result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return repository.ErrStatusChanged
+		}
+
+		stmt := `insert into reservation_status_changes (reservation_id, from_status, to_status, user_id, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6)`
+		_, err = tx.ExecContext(ctx, stmt, id, before.Status, models.StatusCancelled, nullInt(userID), time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from room_restrictions where reservation_id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	err = m.writeAudit(ctx, tx, audit.ActionDelete, audit.EntityReservation, id, reservationSnapshot(before), nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeletedReservations returns the reservations in the trash, most recently deleted first
+func (m *postgresDBRepo) DeletedReservations() ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `
+		select r.id, r.first_name, r.last_name, r.email, r.start_date, r.end_date, r.room_id,
+		r.status, r.deleted_at, coalesce(r.deleted_by, 0), coalesce(u.first_name || ' ' || u.last_name, ''),
+		rm.room_name, coalesce(rm.property_id, 0)
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		left join users u on (r.deleted_by = u.id)
+		where r.deleted_at is not null and ` + m.roomScope("r.room_id") + `
+		order by r.deleted_at desc`
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.Status,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.DeletedByName,
+			&i.Room.RoomName,
+			&i.Room.PropertyID,
+		)
+		if err != nil {
+			return reservations, err
+		}
+		i.Room.ID = i.RoomID
+		reservations = append(reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+	return reservations, nil
+}
+
+// RestoreReservation takes a reservation out of the trash and books its room again. It returns
+// repository.ErrRoomUnavailable if the dates have been taken in the meantime.
+func (m *postgresDBRepo) RestoreReservation(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var res models.Reservation
+	query := `select first_name, last_name, email, phone, room_id, start_date, end_date, status, nightly_rate, discount
+		from reservations where id = $1 and deleted_at is not null for update`
+	err = tx.QueryRowContext(ctx, query, id).Scan(
+		&res.FirstName,
+		&res.LastName,
+		&res.Email,
+		&res.Phone,
+		&res.RoomID,
+		&res.StartDate,
+		&res.EndDate,
+		&res.Status,
+		&res.NightlyRate,
+		&res.Discount,
+	)
+	if err != nil {
+		return err
+	}
+
+	// cancelled reservations don't hold a room, so there is nothing to check
+	if res.Status != models.StatusCancelled {
+		// same lock as room holds, so nobody can take the dates while we check them
+		_, err = tx.ExecContext(ctx, "select pg_advisory_xact_lock($1)", res.RoomID)
+		if err != nil {
+			return err
+		}
+
+		var numRows int
+		query = `
+			select count(id)
+			from room_restrictions
+			where room_id = $1 and $2 < end_date and $3 > start_date
+			and (expires_at is null or expires_at > now())`
+		err = tx.QueryRowContext(ctx, query, res.RoomID, res.StartDate, res.EndDate).Scan(&numRows)
+		if err != nil {
+			return err
+		}
+		if numRows > 0 {
+			return repository.ErrRoomUnavailable
+		}
+
+		stmt := `insert into room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7)`
+		_, err = tx.ExecContext(ctx, stmt,
+			res.StartDate,
+			res.EndDate,
+			res.RoomID,
+			id,
+			models.RestrictionReservation,
+			time.Now(),
+			time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "update reservations set deleted_at = null, deleted_by = null where id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	err = m.writeAudit(ctx, tx, audit.ActionRestore, audit.EntityReservation, id, nil, reservationSnapshot(res))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ImportReservations inserts reservations, along with the restrictions holding their rooms, in a
+// single transaction. A reservation whose room is taken for its dates, by an existing booking or by
+// one earlier in res, is skipped and gets repository.ErrRoomUnavailable at its index in the returned
+// slice. With dryRun set the same checks are made but nothing is saved.
+func (m *postgresDBRepo) ImportReservations(res []models.Reservation, dryRun bool) ([]error, error) {
+	// imports can be years of bookings, so they get longer than the usual queries
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	conflicts := make([]error, len(res))
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return conflicts, err
+	}
+	defer tx.Rollback()
+
+	for i, r := range res {
+		r.Status = newReservationStatus(r)
+
+		// cancelled reservations don't hold a room, so there is nothing to check
+		if r.Status != models.StatusCancelled {
+			// same lock as room holds, so nobody can take the dates while we check them
+			_, err = tx.ExecContext(ctx, "select pg_advisory_xact_lock($1)", r.RoomID)
+			if err != nil {
+				return conflicts, err
+			}
+
+			var numRows int
+			query := `
+				select count(id)
+				from room_restrictions
+				where room_id = $1 and $2 < end_date and $3 > start_date
+				and (expires_at is null or expires_at > now())`
+			err = tx.QueryRowContext(ctx, query, r.RoomID, r.StartDate, r.EndDate).Scan(&numRows)
+			if err != nil {
+				return conflicts, err
+			}
+			if numRows > 0 {
+				conflicts[i] = repository.ErrRoomUnavailable
+				continue
+			}
+		}
+
+		r.GuestID, err = m.matchGuest(ctx, tx, r)
+		if err != nil {
+			return conflicts, err
+		}
+
+		stmt := `insert into reservations (first_name, last_name, email, phone, start_date, end_date, room_id, created_at, updated_at,
+			nightly_rate, discount, status, source, guest_id)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) returning id`
+		err = tx.QueryRowContext(ctx, stmt,
+			r.FirstName,
+			r.LastName,
+			r.Email,
+			r.Phone,
+			r.StartDate,
+			r.EndDate,
+			r.RoomID,
+			time.Now(),
+			time.Now(),
+			r.NightlyRate,
+			r.Discount,
+			r.Status,
+			newReservationSource(r),
+			r.GuestID,
+		).Scan(&r.ID)
+		if err != nil {
+			return conflicts, err
+		}
+
+		if r.Status != models.StatusCancelled {
+			stmt = `insert into room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
+				values ($1, $2, $3, $4, $5, $6, $7)`
+			_, err = tx.ExecContext(ctx, stmt,
+				r.StartDate,
+				r.EndDate,
+				r.RoomID,
+				r.ID,
+				models.RestrictionReservation,
+				time.Now(),
+				time.Now(),
+			)
+			if err != nil {
+				return conflicts, err
+			}
+		}
+
+		err = m.writeAudit(ctx, tx, audit.ActionCreate, audit.EntityReservation, r.ID, nil, reservationSnapshot(r))
+		if err != nil {
+			return conflicts, err
+		}
+	}
+
+	if dryRun {
+		return conflicts, nil
+	}
+	return conflicts, tx.Commit()
+}
+
+// PurgeDeletedReservations permanently removes reservations deleted before the given time.
+// Reservations that have been invoiced are kept, since invoices must not disappear.
+func (m *postgresDBRepo) PurgeDeletedReservations(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		delete from reservations r
+		where r.deleted_at is not null and r.deleted_at < $1
+		and not exists (select 1 from invoices i where i.reservation_id = r.id)`
+	result, err := m.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// UpdateReservationStatus moves a reservation from one status to another and records the change.
+// It returns repository.ErrStatusChanged if the reservation is no longer in from or has been moved
+// to the trash. Cancelling a reservation frees its room.
+func (m *postgresDBRepo) UpdateReservationStatus(id int, from, to models.ReservationStatus, userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "update reservations set status = $1, updated_at = $2 where id = $3 and status = $4 and deleted_at is null",
+		to, time.Now(), id, from)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrStatusChanged
+	}
+
+	stmt := `insert into reservation_status_changes (reservation_id, from_status, to_status, user_id, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6)`
+	_, err = tx.ExecContext(ctx, stmt, id, from, to, nullInt(userID), time.Now(), time.Now())
+	if err != nil {
+		return err
+	}
+
+	err = m.writeAudit(ctx, tx, audit.ActionStatus, audit.EntityReservation, id,
+		map[string]models.ReservationStatus{"Status": from}, map[string]models.ReservationStatus{"Status": to})
+	if err != nil {
+		return err
+	}
+
+	if to == models.StatusCancelled {
+		_, err = tx.ExecContext(ctx, "delete from room_restrictions where reservation_id = $1", id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ReservationStatusChanges returns the status history of a reservation, oldest first
+func (m *postgresDBRepo) ReservationStatusChanges(reservationID int) ([]models.ReservationStatusChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var changes []models.ReservationStatusChange
+
+	query := `
+		select c.id, c.reservation_id, c.from_status, c.to_status, coalesce(c.user_id, 0),
+		coalesce(u.first_name || ' ' || u.last_name, ''), c.created_at, c.updated_at
+		from reservation_status_changes c
+		left join users u on (c.user_id = u.id)
+		where c.reservation_id = $1
+		order by c.created_at asc, c.id asc`
+	rows, err := m.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return changes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.ReservationStatusChange
+		err := rows.Scan(
+			&c.ID,
+			&c.ReservationID,
+			&c.FromStatus,
+			&c.ToStatus,
+			&c.UserID,
+			&c.UserName,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+		)
+		if err != nil {
+			return changes, err
+		}
+		changes = append(changes, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return changes, err
+	}
+	return changes, nil
+}
+
+// InsertRoomHold places a temporary hold on a room, failing with repository.ErrRoomUnavailable
+// if the dates are already taken
+func (m *postgresDBRepo) InsertRoomHold(r models.RoomRestriction) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// serialize hold creation per room so two guests can't hold the same dates
+	_, err = tx.ExecContext(ctx, "select pg_advisory_xact_lock($1)", r.RoomID)
+	if err != nil {
+		return 0, err
+	}
+
+	var numRows int
+	query := `
+		select count(id)
+		from room_restrictions
+		where room_id = $1 and $2 < end_date and $3 > start_date
+		and (expires_at is null or expires_at > now())`
+	err = tx.QueryRowContext(ctx, query, r.RoomID, r.StartDate, r.EndDate).Scan(&numRows)
+	if err != nil {
+		return 0, err
+	}
+	if numRows > 0 {
+		return 0, repository.ErrRoomUnavailable
+	}
+
+	var newID int
+	stmt := `insert into room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, expires_at, created_at, updated_at)
+			values ($1, $2, $3, null, $4, $5, $6, $7) returning id`
+	err = tx.QueryRowContext(ctx, stmt,
+		r.StartDate,
+		r.EndDate,
+		r.RoomID,
+		models.RestrictionHold,
+		r.ExpiresAt,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// ConvertHoldToReservation inserts the reservation, turns the hold into its room restriction and
+// redeems its promo code in a single transaction. A booking made by a signed in user also
+// records the status it starts in.
+func (m *postgresDBRepo) ConvertHoldToReservation(holdID int, res models.Reservation) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	query := `
+		select id from room_restrictions
+		where id = $1 and restriction_id = $2 and expires_at > now()
+		for update`
+	err = tx.QueryRowContext(ctx, query, holdID, models.RestrictionHold).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, repository.ErrHoldExpired
+	} else if err != nil {
+		return 0, err
+	}
+
+	guestID, err := m.matchGuest(ctx, tx, res)
+	if err != nil {
+		return 0, err
+	}
+
+	customFields, err := customFieldsJSON(res.CustomFields)
+	if err != nil {
+		return 0, err
+	}
+	charges, err := chargesJSON(res.Charges)
+	if err != nil {
+		return 0, err
+	}
+	policy, err := policyJSON(res.CancellationPolicy)
+	if err != nil {
+		return 0, err
+	}
+
+	var newID int
+	stmt := `insert into reservations (first_name, last_name, email, phone, start_date, end_date, room_id, created_at, updated_at,
+			nightly_rate, discount, access_token, status, source, guest_id, special_requests, custom_fields, locale,
+			guests, charges, cancellation_policy) 
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21) returning id`
+	err = tx.QueryRowContext(ctx, stmt,
+		res.FirstName,
+		res.LastName,
+		res.Email,
+		res.Phone,
+		res.StartDate,
+		res.EndDate,
+		res.RoomID,
+		time.Now(),
+		time.Now(),
+		res.NightlyRate,
+		res.Discount,
+		sql.NullString{String: res.AccessToken, Valid: res.AccessToken != ""},
+		newReservationStatus(res),
+		newReservationSource(res),
+		guestID,
+		res.SpecialRequests,
+		customFields,
+		newLocale(res.Locale),
+		newGuests(res.Guests),
+		charges,
+		policy,
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `update room_restrictions set reservation_id = $1, restriction_id = $2, expires_at = null, updated_at = $3
+			where id = $4`
+	_, err = tx.ExecContext(ctx, stmt, newID, models.RestrictionReservation, time.Now(), holdID)
+	if err != nil {
+		return 0, err
+	}
+
+	res.ID = newID
+	if err = redeemPromoCode(ctx, tx, res); err != nil {
+		return 0, err
+	}
+
+	res.Status = newReservationStatus(res)
+	if m.actor != nil {
+		// staff can book straight into any status, so their bookings start the status history
+		stmt = `insert into reservation_status_changes (reservation_id, from_status, to_status, user_id, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6)`
+		_, err = tx.ExecContext(ctx, stmt, newID, "", res.Status, nullInt(m.actor.UserID), time.Now(), time.Now())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = m.writeAudit(ctx, tx, audit.ActionCreate, audit.EntityReservation, newID, nil, reservationSnapshot(res))
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// ReleaseRoomHold removes a hold before it expires
+func (m *postgresDBRepo) ReleaseRoomHold(holdID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "delete from room_restrictions where id = $1 and restriction_id = $2"
+
+	_, err := m.DB.ExecContext(ctx, query, holdID, models.RestrictionHold)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpiredHolds removes every hold past its expiry and returns how many were released
+func (m *postgresDBRepo) DeleteExpiredHolds() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "delete from room_restrictions where restriction_id = $1 and expires_at <= now()"
+
+	result, err := m.DB.ExecContext(ctx, query, models.RestrictionHold)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// AllRooms returns every room ordered by name
+func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rooms []models.Room
+
+	query := `select id, room_name, price, deposit_percent, coalesce(cancellation_policy_id, 0), property_id,
+			created_at, updated_at
+			from rooms where ` + m.roomScope("id") + ` order by room_name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return rooms, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rm models.Room
+		err := rows.Scan(&rm.ID, &rm.RoomName, &rm.Price, &rm.DepositPercent, &rm.CancellationPolicyID,
+			&rm.PropertyID, &rm.CreatedAt, &rm.UpdatedAt)
+		if err != nil {
+			return rooms, err
+		}
+		rooms = append(rooms, rm)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rooms, err
+	}
+	return rooms, nil
+}
+
+// InsertWaitlistEntry adds a guest to the waitlist
+func (m *postgresDBRepo) InsertWaitlistEntry(e models.WaitlistEntry) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newID int
+
+	stmt := `insert into waitlist_entries (first_name, last_name, email, phone, start_date, end_date, room_id, created_at, updated_at,
+			locale)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		e.FirstName,
+		e.LastName,
+		e.Email,
+		e.Phone,
+		e.StartDate,
+		e.EndDate,
+		e.RoomID,
+		time.Now(),
+		time.Now(),
+		newLocale(e.Locale),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+const waitlistColumns = `w.id, w.first_name, w.last_name, w.email, w.phone, w.start_date, w.end_date,
+		w.room_id, w.token, w.token_expires_at, w.notified_at, w.created_at, w.updated_at, w.locale,
+		rm.id, rm.room_name`
+
+// scanWaitlistEntry scans a row selected with waitlistColumns
+func scanWaitlistEntry(row interface{ Scan(...interface{}) error }) (models.WaitlistEntry, error) {
+	var e models.WaitlistEntry
+	var token sql.NullString
+	var tokenExpiresAt, notifiedAt sql.NullTime
+
+	err := row.Scan(
+		&e.ID,
+		&e.FirstName,
+		&e.LastName,
+		&e.Email,
+		&e.Phone,
+		&e.StartDate,
+		&e.EndDate,
+		&e.RoomID,
+		&token,
+		&tokenExpiresAt,
+		&notifiedAt,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+		&e.Locale,
+		&e.Room.ID,
+		&e.Room.RoomName,
+	)
+	if err != nil {
+		return e, err
+	}
+
+	e.Token = token.String
+	e.TokenExpiresAt = tokenExpiresAt.Time
+	e.NotifiedAt = notifiedAt.Time
+	return e, nil
+}
+
+// queryWaitlistEntries runs a query selecting waitlistColumns and collects the entries
+func (m *postgresDBRepo) queryWaitlistEntries(query string, args ...interface{}) ([]models.WaitlistEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var entries []models.WaitlistEntry
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanWaitlistEntry(rows)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return entries, err
+	}
+	return entries, nil
+}
+
+// WaitingEntriesForRoom returns entries for a room that overlap the dates and have not been
+// notified yet, oldest first. Entries whose dates overlap an offer that is still open are left
+// out, since that guest may yet book the room.
+func (m *postgresDBRepo) WaitingEntriesForRoom(roomID int, start, end time.Time) ([]models.WaitlistEntry, error) {
+	query := `
+		select ` + waitlistColumns + `
+		from waitlist_entries w
+		left join rooms rm on (w.room_id = rm.id)
+		where w.room_id = $1 and $2 < w.end_date and $3 > w.start_date and w.notified_at is null
+		and not exists (
+			select 1 from waitlist_entries o
+			where o.room_id = w.room_id and o.start_date < w.end_date and o.end_date > w.start_date
+			and o.token_expires_at > $4
+		)
+		order by w.created_at asc, w.id asc`
+
+	return m.queryWaitlistEntries(query, roomID, start, end, time.Now())
+}
+
+// MarkWaitlistEntryNotified stores the booking link token sent to a waitlisted guest
+func (m *postgresDBRepo) MarkWaitlistEntryNotified(id int, token string, expires time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update waitlist_entries set token = $1, token_expires_at = $2, notified_at = $3, updated_at = $3
+		where id = $4`
+
+	_, err := m.DB.ExecContext(ctx, query, token, expires, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetWaitlistEntryByToken returns the entry a booking link was sent to
+func (m *postgresDBRepo) GetWaitlistEntryByToken(token string) (models.WaitlistEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select ` + waitlistColumns + `
+		from waitlist_entries w
+		left join rooms rm on (w.room_id = rm.id)
+		where w.token = $1`
+
+	return scanWaitlistEntry(m.DB.QueryRowContext(ctx, query, token))
+}
+
+// WaitlistEntriesByDates returns every entry overlapping the date range, by room and join order
+func (m *postgresDBRepo) WaitlistEntriesByDates(start, end time.Time) ([]models.WaitlistEntry, error) {
+	query := `
+		select ` + waitlistColumns + `
+		from waitlist_entries w
+		left join rooms rm on (w.room_id = rm.id)
+		where $1 < w.end_date and $2 > w.start_date and ` + m.roomScope("w.room_id") + `
+		order by rm.room_name asc, w.created_at asc`
+
+	return m.queryWaitlistEntries(query, start, end)
+}
+
+// ExpireWaitlistOffers takes the booking links that ran out unused off their entries and returns
+// those entries, whose dates can then be offered to the next guests in line
+func (m *postgresDBRepo) ExpireWaitlistOffers() ([]models.WaitlistEntry, error) {
+	query := `
+		update waitlist_entries w set token = null, updated_at = now()
+		from rooms rm
+		where w.room_id = rm.id and w.token is not null and w.token_expires_at <= now()
+		returning ` + waitlistColumns
+
+	return m.queryWaitlistEntries(query)
+}
+
+// MarkWaitlistEntryBooked takes the booking link off an entry once the guest has booked with it,
+// so it can't be used again
+func (m *postgresDBRepo) MarkWaitlistEntryBooked(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update waitlist_entries set token = null, token_expires_at = null, updated_at = $1 where id = $2`
+
+	_, err := m.DB.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AllPromoCodes returns every promo code with the number of times it was used
+func (m *postgresDBRepo) AllPromoCodes() ([]models.PromoCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var codes []models.PromoCode
+
+	query := `
+		select p.id, p.code, p.description, p.discount_type, p.amount, p.valid_from, p.valid_to,
+		p.min_nights, p.usage_limit, p.per_email_limit, p.active, p.created_at, p.updated_at,
+		(select count(id) from promo_redemptions pr where pr.promo_code_id = p.id)
+		from promo_codes p
+		order by p.valid_from desc, p.code asc`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return codes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.PromoCode
+		err := rows.Scan(
+			&p.ID,
+			&p.Code,
+			&p.Description,
+			&p.DiscountType,
+			&p.Amount,
+			&p.ValidFrom,
+			&p.ValidTo,
+			&p.MinNights,
+			&p.UsageLimit,
+			&p.PerEmailLimit,
+			&p.Active,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.Uses,
+		)
+		if err != nil {
+			return codes, err
+		}
+		codes = append(codes, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return codes, err
+	}
+	return codes, nil
+}
 
-	_, err := m.DB.ExecContext(ctx, query, id)
+// getPromoCode returns the promo code matching where, together with its eligible rooms
+func (m *postgresDBRepo) getPromoCode(where string, arg interface{}) (models.PromoCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var p models.PromoCode
+
+	query := `
+		select id, code, description, discount_type, amount, valid_from, valid_to,
+		min_nights, usage_limit, per_email_limit, active, created_at, updated_at
+		from promo_codes
+		where ` + where
+	err := m.DB.QueryRowContext(ctx, query, arg).Scan(
+		&p.ID,
+		&p.Code,
+		&p.Description,
+		&p.DiscountType,
+		&p.Amount,
+		&p.ValidFrom,
+		&p.ValidTo,
+		&p.MinNights,
+		&p.UsageLimit,
+		&p.PerEmailLimit,
+		&p.Active,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return p, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, "select room_id from promo_code_rooms where promo_code_id = $1 order by room_id", p.ID)
+	if err != nil {
+		return p, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var roomID int
+		if err := rows.Scan(&roomID); err != nil {
+			return p, err
+		}
+		p.RoomIDs = append(p.RoomIDs, roomID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// GetPromoCodeByID returns a promo code by id
+func (m *postgresDBRepo) GetPromoCodeByID(id int) (models.PromoCode, error) {
+	return m.getPromoCode("id = $1", id)
+}
+
+// GetPromoCodeByCode returns a promo code by its code, ignoring case
+func (m *postgresDBRepo) GetPromoCodeByCode(code string) (models.PromoCode, error) {
+	return m.getPromoCode("lower(code) = lower($1)", code)
+}
+
+// setPromoCodeRooms replaces the eligible rooms of a promo code
+func setPromoCodeRooms(ctx context.Context, tx *sql.Tx, promoCodeID int, roomIDs []int) error {
+	_, err := tx.ExecContext(ctx, "delete from promo_code_rooms where promo_code_id = $1", promoCodeID)
 	if err != nil {
 		return err
 	}
 
+	stmt := `insert into promo_code_rooms (promo_code_id, room_id, created_at, updated_at) values ($1, $2, $3, $4)`
+	for _, roomID := range roomIDs {
+		_, err = tx.ExecContext(ctx, stmt, promoCodeID, roomID, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error {
+// InsertPromoCode inserts a promo code and its eligible rooms
+func (m *postgresDBRepo) InsertPromoCode(p models.PromoCode) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var newID int
+	stmt := `insert into promo_codes (code, description, discount_type, amount, valid_from, valid_to,
+			min_nights, usage_limit, per_email_limit, active, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) returning id`
+	err = tx.QueryRowContext(ctx, stmt,
+		p.Code,
+		p.Description,
+		p.DiscountType,
+		p.Amount,
+		p.ValidFrom,
+		p.ValidTo,
+		p.MinNights,
+		p.UsageLimit,
+		p.PerEmailLimit,
+		p.Active,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = setPromoCodeRooms(ctx, tx, newID, p.RoomIDs); err != nil {
+		return 0, err
+	}
+
+	p.ID = newID
+	if err = m.writeAudit(ctx, tx, audit.ActionCreate, audit.EntityPromoCode, newID, nil, p); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// UpdatePromoCode updates a promo code and its eligible rooms
+func (m *postgresDBRepo) UpdatePromoCode(p models.PromoCode) error {
+	before, err := m.GetPromoCodeByID(p.ID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `update promo_codes set code = $1, description = $2, discount_type = $3, amount = $4,
+			valid_from = $5, valid_to = $6, min_nights = $7, usage_limit = $8, per_email_limit = $9,
+			active = $10, updated_at = $11
+			where id = $12`
+	_, err = tx.ExecContext(ctx, stmt,
+		p.Code,
+		p.Description,
+		p.DiscountType,
+		p.Amount,
+		p.ValidFrom,
+		p.ValidTo,
+		p.MinNights,
+		p.UsageLimit,
+		p.PerEmailLimit,
+		p.Active,
+		time.Now(),
+		p.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err = setPromoCodeRooms(ctx, tx, p.ID, p.RoomIDs); err != nil {
+		return err
+	}
+
+	if err = m.writeAudit(ctx, tx, audit.ActionUpdate, audit.EntityPromoCode, p.ID, before, p); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeletePromoCode deletes a promo code along with its rooms. A code that has been redeemed can't
+// be deleted, since its redemptions refer to it.
+func (m *postgresDBRepo) DeletePromoCode(id int) error {
+	before, err := m.GetPromoCodeByID(id)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "delete from promo_codes where id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	if err = m.writeAudit(ctx, tx, audit.ActionDelete, audit.EntityPromoCode, id, before, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PromoCodeUsage returns how many times a promo code was redeemed in total and by email
+func (m *postgresDBRepo) PromoCodeUsage(promoCodeID int, email string) (int, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var total, byEmail int
+
+	query := `
+		select count(id), count(id) filter (where lower(email) = lower($2))
+		from promo_redemptions
+		where promo_code_id = $1`
+	err := m.DB.QueryRowContext(ctx, query, promoCodeID, email).Scan(&total, &byEmail)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return total, byEmail, nil
+}
+
+// redeemPromoCode records the redemption of the promo code res was discounted with. The code is
+// locked while its uses are counted again, so that bookings made at the same time can't take it
+// past its limits; if they would, it returns repository.ErrPromoCodeUsedUp.
+func redeemPromoCode(ctx context.Context, tx *sql.Tx, res models.Reservation) error {
+	if res.PromoCodeID == 0 {
+		return nil
+	}
+
+	var usageLimit, perEmailLimit int
+	query := "select usage_limit, per_email_limit from promo_codes where id = $1 for update"
+	err := tx.QueryRowContext(ctx, query, res.PromoCodeID).Scan(&usageLimit, &perEmailLimit)
+	if err == sql.ErrNoRows {
+		return repository.ErrPromoCodeUsedUp
+	} else if err != nil {
+		return err
+	}
+
+	var total, byEmail int
+	query = `
+		select count(id), count(id) filter (where lower(email) = lower($2))
+		from promo_redemptions
+		where promo_code_id = $1`
+	err = tx.QueryRowContext(ctx, query, res.PromoCodeID, res.Email).Scan(&total, &byEmail)
+	if err != nil {
+		return err
+	}
+	if (usageLimit > 0 && total >= usageLimit) || (perEmailLimit > 0 && byEmail >= perEmailLimit) {
+		return repository.ErrPromoCodeUsedUp
+	}
+
+	stmt := `insert into promo_redemptions (promo_code_id, reservation_id, email, amount, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6)`
+	_, err = tx.ExecContext(ctx, stmt,
+		res.PromoCodeID,
+		res.ID,
+		res.Email,
+		res.Discount,
+		time.Now(),
+		time.Now(),
+	)
+	return err
+}
+
+// GetPromoRedemptionByReservationID returns the promo code redeemed on a reservation, or
+// sql.ErrNoRows if there is none
+func (m *postgresDBRepo) GetPromoRedemptionByReservationID(id int) (models.PromoRedemption, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var r models.PromoRedemption
+
+	query := `
+		select pr.id, pr.promo_code_id, pr.reservation_id, pr.email, pr.amount, pr.created_at, pr.updated_at,
+		p.id, p.code, p.description, p.discount_type, p.amount
+		from promo_redemptions pr
+		left join promo_codes p on (pr.promo_code_id = p.id)
+		where pr.reservation_id = $1`
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&r.ID,
+		&r.PromoCodeID,
+		&r.ReservationID,
+		&r.Email,
+		&r.Amount,
+		&r.CreatedAt,
+		&r.UpdatedAt,
+		&r.PromoCode.ID,
+		&r.PromoCode.Code,
+		&r.PromoCode.Description,
+		&r.PromoCode.DiscountType,
+		&r.PromoCode.Amount,
+	)
+	if err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+// InsertPaymentIntent records an intent created with the payment provider
+func (m *postgresDBRepo) InsertPaymentIntent(pi models.PaymentIntent) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newID int
+
+	stmt := `insert into payment_intents (reservation_id, provider, provider_ref, amount, currency, status, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
+	err := m.DB.QueryRowContext(ctx, stmt,
+		pi.ReservationID,
+		pi.Provider,
+		pi.ProviderRef,
+		pi.Amount,
+		pi.Currency,
+		pi.Status,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// UpdatePaymentIntentStatus updates the status of a payment intent
+func (m *postgresDBRepo) UpdatePaymentIntentStatus(id int, status string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := "update reservations set processed = $1 where id = $2"
+	query := "update payment_intents set status = $1, updated_at = $2 where id = $3"
 
-	_, err := m.DB.ExecContext(ctx, query, processed, id)
+	_, err := m.DB.ExecContext(ctx, query, status, time.Now(), id)
 	if err != nil {
 		return err
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// nullInt stores zero ids as null
+func nullInt(i int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(i), Valid: i != 0}
+}
+
+// InsertPaymentTransaction appends a charge or refund to the payments ledger
+func (m *postgresDBRepo) InsertPaymentTransaction(t models.PaymentTransaction) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var newID int
+
+	stmt := `insert into payment_transactions (reservation_id, payment_intent_id, charge_id, kind, amount, currency,
+			provider, provider_ref, note, user_id, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) returning id`
+	err = tx.QueryRowContext(ctx, stmt,
+		t.ReservationID,
+		nullInt(t.PaymentIntentID),
+		nullInt(t.ChargeID),
+		t.Kind,
+		t.Amount,
+		t.Currency,
+		t.Provider,
+		t.ProviderRef,
+		t.Note,
+		nullInt(t.UserID),
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	// the audit entry goes in with the ledger row, so a payment is never recorded without one
+	t.ID = newID
+	if err = m.writeAudit(ctx, tx, audit.ActionCreate, audit.EntityPayment, newID, nil, t); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// PaymentTransactionsByReservationID returns the ledger entries of a reservation, oldest first
+func (m *postgresDBRepo) PaymentTransactionsByReservationID(id int) ([]models.PaymentTransaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var entries []models.PaymentTransaction
+
+	query := `
+		select id, reservation_id, coalesce(payment_intent_id, 0), coalesce(charge_id, 0), kind, amount,
+		currency, provider, provider_ref, note, coalesce(user_id, 0), created_at, updated_at
+		from payment_transactions
+		where reservation_id = $1
+		order by created_at asc, id asc`
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.PaymentTransaction
+		err := rows.Scan(
+			&t.ID,
+			&t.ReservationID,
+			&t.PaymentIntentID,
+			&t.ChargeID,
+			&t.Kind,
+			&t.Amount,
+			&t.Currency,
+			&t.Provider,
+			&t.ProviderRef,
+			&t.Note,
+			&t.UserID,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+		)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return entries, err
+	}
+	return entries, nil
+}
+
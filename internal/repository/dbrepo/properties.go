@@ -0,0 +1,300 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/audit"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/repository"
+)
+
+// WithProperties returns a copy of the repository whose reads of reservations, rooms, occupancy
+// and the waitlist are limited to the rooms of the properties in ids. With no ids nothing is
+// limited. Writes are not checked, so callers read what they change through the copy first.
+func (m *postgresDBRepo) WithProperties(ids []int) repository.DatabaseRepo {
+	c := *m
+	c.properties = ids
+	return &c
+}
+
+// roomScope returns a condition keeping column, a room id, to the rooms of the properties the
+// repository is limited to, which is always true if it isn't limited
+func (m *postgresDBRepo) roomScope(column string) string {
+	if len(m.properties) == 0 {
+		return "true"
+	}
+	ids := make([]string, len(m.properties))
+	for i, id := range m.properties {
+		ids[i] = strconv.Itoa(id)
+	}
+	return column + " in (select id from rooms where property_id in (" + strings.Join(ids, ", ") + "))"
+}
+
+// userProperties returns the ids of the properties a user manages
+func (m *postgresDBRepo) userProperties(ctx context.Context, userID int) ([]int, error) {
+	var ids []int
+
+	rows, err := m.DB.QueryContext(ctx, "select property_id from property_users where user_id = $1 order by property_id", userID)
+	if err != nil {
+		return ids, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// AllUsers returns every user by name, without their passwords
+func (m *postgresDBRepo) AllUsers() ([]models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var users []models.User
+
+	rows, err := m.DB.QueryContext(ctx, `select id, first_name, last_name, email, access_level, created_at, updated_at
+			from users order by last_name, first_name`)
+	if err != nil {
+		return users, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u models.User
+		err := rows.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.AccessLevel, &u.CreatedAt, &u.UpdatedAt)
+		if err != nil {
+			return users, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func scanProperty(row interface{ Scan(...interface{}) error }) (models.Property, error) {
+	var p models.Property
+	err := row.Scan(&p.ID, &p.Name, &p.Email, &p.Address, &p.TimeZone, &p.Currency, &p.CancellationPolicyID,
+		&p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+const propertyColumns = `select id, name, email, address, time_zone, currency, coalesce(cancellation_policy_id, 0),
+			created_at, updated_at
+			from properties`
+
+// propertyMembers returns the rooms and the users of every property, by property id
+func (m *postgresDBRepo) propertyMembers(ctx context.Context) (map[int][]int, map[int][]int, error) {
+	rooms := make(map[int][]int)
+	users := make(map[int][]int)
+
+	for _, q := range []struct {
+		query string
+		ids   map[int][]int
+	}{
+		{"select property_id, id from rooms order by id", rooms},
+		{"select property_id, user_id from property_users order by user_id", users},
+	} {
+		rows, err := m.DB.QueryContext(ctx, q.query)
+		if err != nil {
+			return rooms, users, err
+		}
+
+		for rows.Next() {
+			var propertyID, id int
+			if err := rows.Scan(&propertyID, &id); err != nil {
+				rows.Close()
+				return rooms, users, err
+			}
+			q.ids[propertyID] = append(q.ids[propertyID], id)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return rooms, users, err
+		}
+	}
+	return rooms, users, nil
+}
+
+// AllProperties returns every property with its rooms and staff, by name
+func (m *postgresDBRepo) AllProperties() ([]models.Property, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var properties []models.Property
+
+	rows, err := m.DB.QueryContext(ctx, propertyColumns+" order by name")
+	if err != nil {
+		return properties, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanProperty(rows)
+		if err != nil {
+			return properties, err
+		}
+		properties = append(properties, p)
+	}
+	if err = rows.Err(); err != nil {
+		return properties, err
+	}
+
+	rooms, users, err := m.propertyMembers(ctx)
+	if err != nil {
+		return properties, err
+	}
+	for i := range properties {
+		properties[i].RoomIDs = rooms[properties[i].ID]
+		properties[i].UserIDs = users[properties[i].ID]
+	}
+	return properties, nil
+}
+
+// GetPropertyByID returns a property with its rooms and staff
+func (m *postgresDBRepo) GetPropertyByID(id int) (models.Property, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	p, err := scanProperty(m.DB.QueryRowContext(ctx, propertyColumns+" where id = $1", id))
+	if err != nil {
+		return p, err
+	}
+
+	rooms, users, err := m.propertyMembers(ctx)
+	p.RoomIDs = rooms[p.ID]
+	p.UserIDs = users[p.ID]
+	return p, err
+}
+
+// setPropertyMembers moves the rooms in roomIDs to the property and gives it the staff in userIDs.
+// A room is always in a property, so rooms are only ever moved in, never taken out.
+func setPropertyMembers(ctx context.Context, tx *sql.Tx, propertyID int, roomIDs, userIDs []int) error {
+	for _, roomID := range roomIDs {
+		_, err := tx.ExecContext(ctx, "update rooms set property_id = $1, updated_at = $2 where id = $3",
+			propertyID, time.Now(), roomID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, "delete from property_users where property_id = $1", propertyID)
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		_, err = tx.ExecContext(ctx, `insert into property_users (property_id, user_id, created_at, updated_at)
+				values ($1, $2, $3, $4)`, propertyID, userID, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertProperty adds a property, moves its rooms into it and gives it its staff
+func (m *postgresDBRepo) InsertProperty(p models.Property) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var newID int
+	stmt := `insert into properties (name, email, address, time_zone, currency, cancellation_policy_id,
+			created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
+	err = tx.QueryRowContext(ctx, stmt, p.Name, p.Email, p.Address, p.TimeZone, p.Currency,
+		nullInt(p.CancellationPolicyID), time.Now(), time.Now()).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = setPropertyMembers(ctx, tx, newID, p.RoomIDs, p.UserIDs); err != nil {
+		return 0, err
+	}
+
+	p.ID = newID
+	if err = m.writeAudit(ctx, tx, audit.ActionCreate, audit.EntityProperty, newID, nil, p); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// UpdateProperty saves a property, moves its rooms into it and replaces its staff
+func (m *postgresDBRepo) UpdateProperty(p models.Property) error {
+	before, err := m.GetPropertyByID(p.ID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `update properties set name = $1, email = $2, address = $3, time_zone = $4, currency = $5,
+			cancellation_policy_id = $6, updated_at = $7
+			where id = $8`
+	_, err = tx.ExecContext(ctx, stmt, p.Name, p.Email, p.Address, p.TimeZone, p.Currency,
+		nullInt(p.CancellationPolicyID), time.Now(), p.ID)
+	if err != nil {
+		return err
+	}
+
+	if err = setPropertyMembers(ctx, tx, p.ID, p.RoomIDs, p.UserIDs); err != nil {
+		return err
+	}
+
+	if err = m.writeAudit(ctx, tx, audit.ActionUpdate, audit.EntityProperty, p.ID, before, p); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteProperty deletes a property that has no rooms left, and takes it off its staff
+func (m *postgresDBRepo) DeleteProperty(id int) error {
+	before, err := m.GetPropertyByID(id)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "delete from properties where id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	if err = m.writeAudit(ctx, tx, audit.ActionDelete, audit.EntityProperty, id, before, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,123 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/audit"
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+const exchangeRateColumns = `
+		select id, currency, rate, created_at, updated_at
+		from exchange_rates`
+
+func scanExchangeRate(row interface{ Scan(...interface{}) error }) (models.ExchangeRate, error) {
+	var e models.ExchangeRate
+	err := row.Scan(
+		&e.ID,
+		&e.Currency,
+		&e.Rate,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+	)
+	return e, err
+}
+
+// AllExchangeRates returns the exchange rates from the base currency, by currency
+func (m *postgresDBRepo) AllExchangeRates() ([]models.ExchangeRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rates []models.ExchangeRate
+
+	rows, err := m.DB.QueryContext(ctx, exchangeRateColumns+" order by currency")
+	if err != nil {
+		return rates, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanExchangeRate(rows)
+		if err != nil {
+			return rates, err
+		}
+		rates = append(rates, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rates, err
+	}
+	return rates, nil
+}
+
+// SaveExchangeRates adds or updates the rates of their currencies, all or none of them
+func (m *postgresDBRepo) SaveExchangeRates(rates []models.ExchangeRate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, e := range rates {
+		before, err := scanExchangeRate(tx.QueryRowContext(ctx, exchangeRateColumns+" where currency = $1 for update", e.Currency))
+		if err == sql.ErrNoRows {
+			stmt := `insert into exchange_rates (currency, rate, created_at, updated_at)
+				values ($1, $2, $3, $4) returning id`
+			err = tx.QueryRowContext(ctx, stmt, e.Currency, e.Rate, time.Now(), time.Now()).Scan(&e.ID)
+			if err != nil {
+				return err
+			}
+			if err = m.writeAudit(ctx, tx, audit.ActionCreate, audit.EntityExchangeRate, e.ID, nil, e); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		e.ID = before.ID
+		_, err = tx.ExecContext(ctx, "update exchange_rates set rate = $1, updated_at = $2 where id = $3",
+			e.Rate, time.Now(), e.ID)
+		if err != nil {
+			return err
+		}
+		if err = m.writeAudit(ctx, tx, audit.ActionUpdate, audit.EntityExchangeRate, e.ID, before, e); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteExchangeRate deletes the rate of currency, returning sql.ErrNoRows if it has none
+func (m *postgresDBRepo) DeleteExchangeRate(currency string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := scanExchangeRate(tx.QueryRowContext(ctx, exchangeRateColumns+" where currency = $1 for update", currency))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from exchange_rates where id = $1", before.ID)
+	if err != nil {
+		return err
+	}
+
+	if err = m.writeAudit(ctx, tx, audit.ActionDelete, audit.EntityExchangeRate, before.ID, before, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
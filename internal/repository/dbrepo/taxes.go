@@ -0,0 +1,268 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/audit"
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+// chargesJSON returns the jsonb stored for a reservation's taxes and fees
+func chargesJSON(charges []models.Charge) ([]byte, error) {
+	if len(charges) == 0 {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(charges)
+}
+
+// parseCharges reads a reservation's taxes and fees from their jsonb
+func parseCharges(b []byte) ([]models.Charge, error) {
+	var charges []models.Charge
+	if len(b) == 0 {
+		return charges, nil
+	}
+	err := json.Unmarshal(b, &charges)
+	return charges, err
+}
+
+// nullDate stores a zero date as null, for dates that are optional
+func nullDate(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+const taxRuleColumns = `
+		select id, name, rule_type, amount, per_night, per_guest, valid_from, valid_to, active,
+		created_at, updated_at
+		from tax_rules`
+
+func scanTaxRule(row interface{ Scan(...interface{}) error }) (models.TaxRule, error) {
+	var t models.TaxRule
+	var validFrom, validTo sql.NullTime
+	err := row.Scan(
+		&t.ID,
+		&t.Name,
+		&t.Type,
+		&t.Amount,
+		&t.PerNight,
+		&t.PerGuest,
+		&validFrom,
+		&validTo,
+		&t.Active,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+	)
+	t.ValidFrom = validFrom.Time
+	t.ValidTo = validTo.Time
+	return t, err
+}
+
+// taxRuleRooms returns the rooms of every tax rule that is limited to some, by rule id
+func (m *postgresDBRepo) taxRuleRooms(ctx context.Context) (map[int][]int, error) {
+	rooms := make(map[int][]int)
+
+	rows, err := m.DB.QueryContext(ctx, "select tax_rule_id, room_id from tax_rule_rooms order by room_id")
+	if err != nil {
+		return rooms, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ruleID, roomID int
+		if err := rows.Scan(&ruleID, &roomID); err != nil {
+			return rooms, err
+		}
+		rooms[ruleID] = append(rooms[ruleID], roomID)
+	}
+	return rooms, rows.Err()
+}
+
+// AllTaxRules returns every tax and fee rule with its rooms, in the order they are charged
+func (m *postgresDBRepo) AllTaxRules() ([]models.TaxRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rules []models.TaxRule
+
+	rows, err := m.DB.QueryContext(ctx, taxRuleColumns+" order by rule_type desc, id")
+	if err != nil {
+		return rules, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanTaxRule(rows)
+		if err != nil {
+			return rules, err
+		}
+		rules = append(rules, t)
+	}
+	if err = rows.Err(); err != nil {
+		return rules, err
+	}
+
+	rooms, err := m.taxRuleRooms(ctx)
+	if err != nil {
+		return rules, err
+	}
+	for i := range rules {
+		rules[i].RoomIDs = rooms[rules[i].ID]
+	}
+	return rules, nil
+}
+
+// GetTaxRuleByID returns a tax or fee rule with its rooms
+func (m *postgresDBRepo) GetTaxRuleByID(id int) (models.TaxRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	t, err := scanTaxRule(m.DB.QueryRowContext(ctx, taxRuleColumns+" where id = $1", id))
+	if err != nil {
+		return t, err
+	}
+
+	rooms, err := m.taxRuleRooms(ctx)
+	t.RoomIDs = rooms[t.ID]
+	return t, err
+}
+
+// setTaxRuleRooms replaces the rooms of a tax or fee rule
+func setTaxRuleRooms(ctx context.Context, tx *sql.Tx, taxRuleID int, roomIDs []int) error {
+	_, err := tx.ExecContext(ctx, "delete from tax_rule_rooms where tax_rule_id = $1", taxRuleID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into tax_rule_rooms (tax_rule_id, room_id, created_at, updated_at) values ($1, $2, $3, $4)`
+	for _, roomID := range roomIDs {
+		_, err = tx.ExecContext(ctx, stmt, taxRuleID, roomID, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertTaxRule adds a tax or fee rule and its rooms
+func (m *postgresDBRepo) InsertTaxRule(t models.TaxRule) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var newID int
+	stmt := `insert into tax_rules (name, rule_type, amount, per_night, per_guest, valid_from, valid_to, active,
+			created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id`
+	err = tx.QueryRowContext(ctx, stmt,
+		t.Name,
+		t.Type,
+		t.Amount,
+		t.PerNight,
+		t.PerGuest,
+		nullDate(t.ValidFrom),
+		nullDate(t.ValidTo),
+		t.Active,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = setTaxRuleRooms(ctx, tx, newID, t.RoomIDs); err != nil {
+		return 0, err
+	}
+
+	t.ID = newID
+	if err = m.writeAudit(ctx, tx, audit.ActionCreate, audit.EntityTaxRule, newID, nil, t); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// UpdateTaxRule saves a tax or fee rule and its rooms. Reservations already made keep the charges
+// they were quoted.
+func (m *postgresDBRepo) UpdateTaxRule(t models.TaxRule) error {
+	before, err := m.GetTaxRuleByID(t.ID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `update tax_rules set name = $1, rule_type = $2, amount = $3, per_night = $4, per_guest = $5,
+			valid_from = $6, valid_to = $7, active = $8, updated_at = $9
+			where id = $10`
+	_, err = tx.ExecContext(ctx, stmt,
+		t.Name,
+		t.Type,
+		t.Amount,
+		t.PerNight,
+		t.PerGuest,
+		nullDate(t.ValidFrom),
+		nullDate(t.ValidTo),
+		t.Active,
+		time.Now(),
+		t.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err = setTaxRuleRooms(ctx, tx, t.ID, t.RoomIDs); err != nil {
+		return err
+	}
+
+	if err = m.writeAudit(ctx, tx, audit.ActionUpdate, audit.EntityTaxRule, t.ID, before, t); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteTaxRule deletes a tax or fee rule. Reservations already made keep the charges they were
+// quoted.
+func (m *postgresDBRepo) DeleteTaxRule(id int) error {
+	before, err := m.GetTaxRuleByID(id)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "delete from tax_rules where id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	if err = m.writeAudit(ctx, tx, audit.ActionDelete, audit.EntityTaxRule, id, before, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
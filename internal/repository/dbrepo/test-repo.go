@@ -1,10 +1,12 @@
 package dbrepo
 
 import (
+	"database/sql"
 	"errors"
 	"time"
 
 	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/repository"
 )
 
 func (m *testDBRepo) AllUser() bool {
@@ -32,7 +34,7 @@ func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roo
 	return false, nil
 }
 
-func (m *testDBRepo) SearchAvailabilityForAllRoom(start, end time.Time) ([]models.Room, error) {
+func (m *testDBRepo) SearchAvailabilityForAllRoom(start, end time.Time, propertyID int) ([]models.Room, error) {
 	var rooms []models.Room
 	layout := "2006-01-02"
 	if start.Format(layout) == "2050-10-01" && end.Format(layout) == "2050-10-02" {
@@ -40,21 +42,41 @@ func (m *testDBRepo) SearchAvailabilityForAllRoom(start, end time.Time) ([]model
 	} else if start.Format(layout) == "2050-11-11" && end.Format(layout) == "2050-11-12" {
 		return rooms, errors.New("error")
 	}
-	rooms = append(rooms,models.Room{})
+	// every room is in property 1
+	if propertyID > 1 {
+		return rooms, nil
+	}
+	rooms = append(rooms,models.Room{PropertyID: 1})
 	return rooms, nil
 }
 
 func (m *testDBRepo) GetRoomByID(id int) (models.Room, error) {
 	var room models.Room
-	if id > 2 {
+	// room 1000 exists so that holding it can fail
+	if id > 2 && id != 1000 {
 		return room, errors.New("some error")
 	}
+	if !m.inScope(1) {
+		return room, sql.ErrNoRows
+	}
+	room.ID = id
+	room.PropertyID = 1
+	room.Price = 10000
+	room.DepositPercent = 20
+	if id == 1 {
+		room.CancellationPolicyID = 2
+	}
 	return room,nil
 }
 
 // GetUserByID returns user by id
 func (m *testDBRepo) GetUserByID(id int) (models.User, error) {
 	var user models.User
+	// user 2 only manages property 2
+	if id == 2 {
+		user.ID = 2
+		user.PropertyIDs = []int{2}
+	}
 	return user,nil
 }
 
@@ -67,29 +89,710 @@ func (m *testDBRepo) Authenticate(email, testPassword string) (int, string, erro
 	return 0,"",nil
 }
 
-func (m *testDBRepo) AllReservations() ([]models.Reservation, error) {
-	var reservations []models.Reservation
-	return reservations,nil
+func (m *testDBRepo) SearchReservations(f models.ReservationFilter) ([]models.Reservation, int, error) {
+	// pretend there are three pages of 25
+	reservations := []models.Reservation{
+		{
+			ID:        1,
+			FirstName: "John",
+			LastName:  "Smith",
+			StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+			RoomID:    1,
+			Status:    models.StatusPending,
+			Source:    models.SourceWeb,
+
+			CustomFields: map[string]string{"diet": "Vegetarian"},
+		},
+	}
+	return reservations, 60, nil
+}
+
+func (m *testDBRepo) EachReservation(f models.ReservationFilter, fn func(models.Reservation) error) error {
+	reservations, _, _ := m.SearchReservations(f)
+	for _, r := range reservations {
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *testDBRepo) OccupancyByDay(start, end time.Time) ([]models.DailyOccupancy, error) {
+	// room 1 is booked every other night
+	var occupancy []models.DailyOccupancy
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		occupancy = append(occupancy,
+			models.DailyOccupancy{Date: d, RoomID: 1, RoomName: "General's Quarters", Nights: d.Day() % 2},
+			models.DailyOccupancy{Date: d, RoomID: 2, RoomName: "Major's Suite"},
+		)
+	}
+	return occupancy, nil
 }
 
-func (m *testDBRepo) AllNewReservations() ([]models.Reservation, error) {
+func (m *testDBRepo) ImportReservations(res []models.Reservation, dryRun bool) ([]error, error) {
+	// room 2 is always taken
+	conflicts := make([]error, len(res))
+	for i, r := range res {
+		if r.RoomID == 2 {
+			conflicts[i] = repository.ErrRoomUnavailable
+		}
+	}
+	return conflicts, nil
+}
+
+func (m *testDBRepo) ArrivalsOn(day time.Time) ([]models.Reservation, error) {
+	reservations := []models.Reservation{
+		{ID: 1, FirstName: "John", LastName: "Smith", StartDate: day, EndDate: day.AddDate(0, 0, 2),
+			RoomID: 1, Room: models.Room{ID: 1, RoomName: "General's Quarters"}, Status: models.StatusConfirmed},
+	}
+	return reservations, nil
+}
+
+func (m *testDBRepo) DeparturesOn(day time.Time) ([]models.Reservation, error) {
 	var reservations []models.Reservation
-	return reservations,nil
+	return reservations, nil
+}
+
+func (m *testDBRepo) OccupancySummary(start, end time.Time) (models.OccupancySummary, error) {
+	// two rooms, one of them booked every night
+	nights := int(end.Sub(start).Hours() / 24)
+	return models.OccupancySummary{NightsSold: nights, NightsAvailable: 2 * nights}, nil
+}
+
+func (m *testDBRepo) BookingsByWeek(since time.Time) ([]models.BookingVolume, error) {
+	volumes := []models.BookingVolume{
+		{Start: since, Bookings: 2, Revenue: 40000},
+		{Start: since.AddDate(0, 0, 7), Bookings: 1, Revenue: 15000},
+	}
+	return volumes, nil
+}
+
+func (m *testDBRepo) LeadTimeDistribution(since time.Time) ([]models.LeadTimeBucket, error) {
+	buckets := make([]models.LeadTimeBucket, len(models.LeadTimeBuckets))
+	copy(buckets, models.LeadTimeBuckets)
+	buckets[1].Bookings = 3
+	return buckets, nil
+}
+
+func (m *testDBRepo) ReservationsBetween(start, end time.Time) ([]models.Reservation, error) {
+	// a two night stay in room 1 at the start of the range, booked a month before
+	reservations := []models.Reservation{
+		{ID: 1, RoomID: 1, StartDate: start, EndDate: start.AddDate(0, 0, 2), NightlyRate: 10000,
+			Status: models.StatusConfirmed, CreatedAt: start.AddDate(0, -1, 0)},
+	}
+	return reservations, nil
+}
+
+func (m *testDBRepo) RestrictionsBetween(start, end time.Time) ([]models.RoomRestriction, error) {
+	restrictions := []models.RoomRestriction{
+		{ID: 1, RoomID: 1, StartDate: start, EndDate: start.AddDate(0, 0, 2), ReservationID: 1,
+			RestrictionID: models.RestrictionReservation},
+	}
+	return restrictions, nil
 }
 
 func (m *testDBRepo) GetReservationByID(id int) (models.Reservation, error) {
 	var res models.Reservation
+	res.Room.PropertyID = 1
+	// reservation 4 is at Harbour House, which charges in euros
+	if id == 4 {
+		res.Room.PropertyID = 2
+	}
+	if !m.inScope(res.Room.PropertyID) {
+		return models.Reservation{}, sql.ErrNoRows
+	}
+	res.ID = id
+	res.RoomID = 1
+	res.Room.ID = 1
+	// booked before room 1 went up to its current price
+	res.NightlyRate = 8000
+	res.GuestID = 1
+	res.Status = models.StatusPending
+	// the guest of reservation 3 has arrived
+	if id == 3 {
+		res.Status = models.StatusCheckedIn
+	}
+	// reservation 6 is in the trash
+	if id == 6 {
+		res.DeletedAt = time.Date(2049, 12, 1, 0, 0, 0, 0, time.UTC)
+	}
+	res.CustomFields = map[string]string{"arrival_time": "18:30", "parking": "yes"}
+	// reservations 1 and 4 are far off and booked under the moderate policy, so what was paid comes back
+	if id == 1 || id == 4 {
+		res.StartDate = time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+		res.EndDate = time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC)
+		res.CancellationPolicy = testPolicies[1]
+	}
 	return res,nil
 }
 
 func (m *testDBRepo) UpdateReservation(u models.Reservation) error {
+	// room 2 is always taken
+	if u.RoomID == 2 {
+		return repository.ErrRoomUnavailable
+	}
+	// a reservation moved out of room 1 has to be charged its new room's price
+	if u.RoomID != 1 && u.NightlyRate != u.Room.Price {
+		return errors.New("charged the old room's rate")
+	}
+	return nil
+}
+
+func (m *testDBRepo) DeleteReservation(id, userID int) error {
+	// reservation 2 can't be deleted
+	if id == 2 {
+		return errors.New("some error")
+	}
+	// reservation 6 is in the trash already
+	if id == 6 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (m *testDBRepo) DeletedReservations() ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	return reservations, nil
+}
+
+func (m *testDBRepo) RestoreReservation(id int) error {
+	// the dates of reservation 2 have been taken since it was deleted
+	if id == 2 {
+		return repository.ErrRoomUnavailable
+	}
+	return nil
+}
+
+func (m *testDBRepo) PurgeDeletedReservations(before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m *testDBRepo) UpdateReservationStatus(id int, from, to models.ReservationStatus, userID int) error {
+	// reservation 2 is always changed by someone else first
+	if id == 2 {
+		return repository.ErrStatusChanged
+	}
+	return nil
+}
+
+func (m *testDBRepo) ReservationStatusChanges(reservationID int) ([]models.ReservationStatusChange, error) {
+	var changes []models.ReservationStatusChange
+	return changes, nil
+}
+
+func (m *testDBRepo) ReservationNotes(reservationID int) ([]models.ReservationNote, error) {
+	notes := []models.ReservationNote{
+		{
+			ID:            1,
+			ReservationID: reservationID,
+			UserName:      "Admin User",
+			Body:          "Arriving late, after 11pm",
+			Important:     true,
+			Replies: []models.ReservationNote{
+				{ID: 2, ReservationID: reservationID, ParentID: 1, UserName: "Admin User", Body: "Key left at the night desk"},
+			},
+		},
+	}
+	return notes, nil
+}
+
+func (m *testDBRepo) InsertReservationNote(n models.ReservationNote) (int, error) {
+	// only notes 1 and 2 exist
+	if n.ParentID > 2 {
+		return 0, sql.ErrNoRows
+	}
+	return 3, nil
+}
+
+func (m *testDBRepo) SetReservationNoteImportant(id, reservationID int, important bool) error {
+	// only notes 1 and 2 exist
+	if id > 2 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (m *testDBRepo) ImportantNotesBetween(start, end time.Time) ([]models.ReservationNote, error) {
+	notes := []models.ReservationNote{
+		{
+			ID:            1,
+			ReservationID: 1,
+			Body:          "Arriving late, after 11pm",
+			Important:     true,
+			Reservation:   models.Reservation{ID: 1, FirstName: "John", LastName: "Smith", StartDate: start, EndDate: start.AddDate(0, 0, 2), Room: models.Room{RoomName: "General's Quarters"}},
+		},
+	}
+	return notes, nil
+}
+
+func (m *testDBRepo) InsertRoomHold(r models.RoomRestriction) (int, error) {
+	// rooms 3 and 1000 are always taken
+	if r.RoomID == 3 || r.RoomID == 1000 {
+		return 0, repository.ErrRoomUnavailable
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) ConvertHoldToReservation(holdID int, res models.Reservation) (int, error) {
+	// hold 2 has always run out; room 2 fails like InsertReservation
+	if holdID == 2 {
+		return 0, repository.ErrHoldExpired
+	}
+	if res.RoomID == 2 {
+		return 0, errors.New("some error")
+	}
+	// promo code 3 is used up by the time it is redeemed
+	if res.PromoCodeID == 3 {
+		return 0, repository.ErrPromoCodeUsedUp
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) ReleaseRoomHold(holdID int) error {
+	return nil
+}
+
+func (m *testDBRepo) DeleteExpiredHolds() (int64, error) {
+	return 0, nil
+}
+
+func (m *testDBRepo) AllRooms() ([]models.Room, error) {
+	rooms := []models.Room{
+		{ID: 1, RoomName: "General's Quarters", PropertyID: 1},
+		{ID: 2, RoomName: "Major's Suite", PropertyID: 1},
+	}
+	if !m.inScope(1) {
+		return nil, nil
+	}
+	return rooms, nil
+}
+
+func (m *testDBRepo) InsertWaitlistEntry(e models.WaitlistEntry) (int, error) {
+	if e.RoomID == 2 {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) WaitingEntriesForRoom(roomID int, start, end time.Time) ([]models.WaitlistEntry, error) {
+	var entries []models.WaitlistEntry
+	return entries, nil
+}
+
+func (m *testDBRepo) MarkWaitlistEntryNotified(id int, token string, expires time.Time) error {
 	return nil
 }
 
-func (m *testDBRepo) DeleteReservation(id int) error {
+func (m *testDBRepo) GetWaitlistEntryByToken(token string) (models.WaitlistEntry, error) {
+	var e models.WaitlistEntry
+	switch token {
+	case "valid":
+		e.ID = 1
+		e.RoomID = 1
+		e.StartDate = time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+		e.EndDate = time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC)
+		e.TokenExpiresAt = time.Now().Add(time.Hour)
+		return e, nil
+	case "expired":
+		e.RoomID = 1
+		e.TokenExpiresAt = time.Now().Add(-time.Hour)
+		return e, nil
+	}
+	return e, errors.New("no rows")
+}
+
+func (m *testDBRepo) WaitlistEntriesByDates(start, end time.Time) ([]models.WaitlistEntry, error) {
+	var entries []models.WaitlistEntry
+	return entries, nil
+}
+
+func (m *testDBRepo) ExpireWaitlistOffers() ([]models.WaitlistEntry, error) {
+	entries := []models.WaitlistEntry{
+		{ID: 2, RoomID: 1, StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	return entries, nil
+}
+
+func (m *testDBRepo) MarkWaitlistEntryBooked(id int) error {
 	return nil
 }
 
-func (m *testDBRepo) UpdateProcessedForReservation(id, processed int) error {
+// testCustomFields are the booking form fields of the test repository. None of the active ones is
+// required, so bookings posted without them still go through.
+var testCustomFields = []models.CustomField{
+	{ID: 1, Name: "arrival_time", Label: "Estimated arrival", Type: models.FieldTime, Active: true},
+	{ID: 2, Name: "diet", Label: "Dietary needs", Type: models.FieldSelect, Options: []string{"None", "Vegetarian"}, Active: true},
+	{ID: 3, Name: "old_question", Label: "No longer asked", Type: models.FieldText, Required: true},
+}
+
+func (m *testDBRepo) AllCustomFields() ([]models.CustomField, error) {
+	return testCustomFields, nil
+}
+
+func (m *testDBRepo) GetCustomFieldByID(id int) (models.CustomField, error) {
+	for _, f := range testCustomFields {
+		if f.ID == id {
+			return f, nil
+		}
+	}
+	return models.CustomField{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) InsertCustomField(f models.CustomField) (int, error) {
+	return 4, nil
+}
+
+func (m *testDBRepo) UpdateCustomField(f models.CustomField) error {
 	return nil
-}
\ No newline at end of file
+}
+
+func (m *testDBRepo) DeleteCustomField(id int) error {
+	if id > len(testCustomFields) {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (m *testDBRepo) AllPromoCodes() ([]models.PromoCode, error) {
+	var codes []models.PromoCode
+	return codes, nil
+}
+
+func (m *testDBRepo) GetPromoCodeByID(id int) (models.PromoCode, error) {
+	var p models.PromoCode
+	if id > 1 {
+		return p, sql.ErrNoRows
+	}
+	p.ID = id
+	return p, nil
+}
+
+func (m *testDBRepo) GetPromoCodeByCode(code string) (models.PromoCode, error) {
+	// SUMMER is 10% off any stay of two or more nights in 2050, and LASTONE is the same but
+	// gets used up while the guest books
+	if code == "SUMMER" || code == "LASTONE" {
+		id := 1
+		if code == "LASTONE" {
+			id = 3
+		}
+		return models.PromoCode{
+			ID:           id,
+			Code:         "SUMMER",
+			DiscountType: models.PromoPercent,
+			Amount:       10,
+			ValidFrom:    time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			ValidTo:      time.Date(2050, 12, 31, 0, 0, 0, 0, time.UTC),
+			MinNights:    2,
+			Active:       true,
+		}, nil
+	}
+	return models.PromoCode{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) InsertPromoCode(p models.PromoCode) (int, error) {
+	return 1, nil
+}
+
+func (m *testDBRepo) UpdatePromoCode(p models.PromoCode) error {
+	return nil
+}
+
+func (m *testDBRepo) DeletePromoCode(id int) error {
+	return nil
+}
+
+func (m *testDBRepo) PromoCodeUsage(promoCodeID int, email string) (int, int, error) {
+	// promo code 2 has been redeemed
+	if promoCodeID == 2 {
+		return 1, 0, nil
+	}
+	return 0, 0, nil
+}
+
+func (m *testDBRepo) GetPromoRedemptionByReservationID(id int) (models.PromoRedemption, error) {
+	return models.PromoRedemption{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) InsertPaymentIntent(pi models.PaymentIntent) (int, error) {
+	return 1, nil
+}
+
+func (m *testDBRepo) UpdatePaymentIntentStatus(id int, status string) error {
+	return nil
+}
+
+func (m *testDBRepo) InsertPaymentTransaction(t models.PaymentTransaction) (int, error) {
+	return 1, nil
+}
+
+func (m *testDBRepo) PaymentTransactionsByReservationID(id int) ([]models.PaymentTransaction, error) {
+	// reservation 1 has paid a 50.00 deposit, and reservation 4 the same in euros
+	var entries []models.PaymentTransaction
+	if id == 1 || id == 4 {
+		currency := "USD"
+		if id == 4 {
+			currency = "EUR"
+		}
+		entries = append(entries, models.PaymentTransaction{
+			ID:            1,
+			ReservationID: id,
+			Kind:          "charge",
+			Amount:        5000,
+			Currency:      currency,
+			Provider:      "fake",
+			ProviderRef:   "fake_ch_1",
+		})
+	}
+	return entries, nil
+}
+
+func (m *testDBRepo) GetReservationByAccessToken(token string) (models.Reservation, error) {
+	var res models.Reservation
+	if token != "valid" {
+		return res, sql.ErrNoRows
+	}
+	res.ID = 1
+	res.RoomID = 1
+	res.Room.PropertyID = 1
+	res.StartDate = time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	res.EndDate = time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC)
+	res.NightlyRate = 10000
+	res.Status = models.StatusConfirmed
+	res.CancellationPolicy = testPolicies[1]
+	res.AccessToken = token
+	return res, nil
+}
+
+func (m *testDBRepo) GetInvoiceByReservationID(id int) (models.Invoice, error) {
+	// reservation 1 has been invoiced
+	if id != 1 {
+		return models.Invoice{}, sql.ErrNoRows
+	}
+	return models.Invoice{
+		ID:            1,
+		Number:        1,
+		ReservationID: id,
+		IssuedAt:      time.Now(),
+		Total:         20000,
+		Currency:      "USD",
+		Lines:         []models.InvoiceLine{{Description: "General's Quarters", Quantity: 2, UnitPrice: 10000, Amount: 20000}},
+		Subtotal:      20000,
+	}, nil
+}
+
+func (m *testDBRepo) IssueInvoice(inv models.Invoice) (models.Invoice, error) {
+	inv.ID = 1
+	inv.Number = 1
+	inv.IssuedAt = time.Now()
+	return inv, nil
+}
+
+// testExchangeRates are the exchange rates of the test repository, from USD
+var testExchangeRates = []models.ExchangeRate{
+	{ID: 1, Currency: "EUR", Rate: 0.9},
+	{ID: 2, Currency: "JPY", Rate: 150},
+}
+
+func (m *testDBRepo) AllExchangeRates() ([]models.ExchangeRate, error) {
+	return testExchangeRates, nil
+}
+
+func (m *testDBRepo) SaveExchangeRates(rates []models.ExchangeRate) error {
+	return nil
+}
+
+func (m *testDBRepo) DeleteExchangeRate(currency string) error {
+	for _, e := range testExchangeRates {
+		if e.Currency == currency {
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// testTaxRules are the taxes and fees of the test repository: a 10% tax, a fee of 2.00 per guest
+// per night and a cleaning fee of 25.00 in room 2
+var testTaxRules = []models.TaxRule{
+	{ID: 1, Name: "Lodging tax", Type: models.TaxPercent, Amount: 1000, Active: true},
+	{ID: 2, Name: "Tourism fee", Type: models.TaxFixed, Amount: 200, PerNight: true, PerGuest: true, Active: true},
+	{ID: 3, Name: "Cleaning fee", Type: models.TaxFixed, Amount: 2500, RoomIDs: []int{2}, Active: true},
+}
+
+func (m *testDBRepo) AllTaxRules() ([]models.TaxRule, error) {
+	return testTaxRules, nil
+}
+
+func (m *testDBRepo) GetTaxRuleByID(id int) (models.TaxRule, error) {
+	for _, t := range testTaxRules {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+	return models.TaxRule{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) InsertTaxRule(t models.TaxRule) (int, error) {
+	return 4, nil
+}
+
+func (m *testDBRepo) UpdateTaxRule(t models.TaxRule) error {
+	_, err := m.GetTaxRuleByID(t.ID)
+	return err
+}
+
+func (m *testDBRepo) DeleteTaxRule(id int) error {
+	_, err := m.GetTaxRuleByID(id)
+	return err
+}
+
+// testPolicies are the cancellation policies of the test repository; room 1 is moderate
+var testPolicies = []models.CancellationPolicy{
+	{ID: 1, Name: "Flexible", Tiers: []models.RefundTier{{DaysBefore: 1, Percent: 100}}},
+	{ID: 2, Name: "Moderate", Tiers: []models.RefundTier{{DaysBefore: 7, Percent: 100}, {DaysBefore: 2, Percent: 50}}, RoomIDs: []int{1}},
+	{ID: 3, Name: "Strict", Tiers: []models.RefundTier{{DaysBefore: 14, Percent: 50}}},
+}
+
+func (m *testDBRepo) AllCancellationPolicies() ([]models.CancellationPolicy, error) {
+	return testPolicies, nil
+}
+
+func (m *testDBRepo) GetCancellationPolicyByID(id int) (models.CancellationPolicy, error) {
+	for _, p := range testPolicies {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return models.CancellationPolicy{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) InsertCancellationPolicy(p models.CancellationPolicy) (int, error) {
+	return 4, nil
+}
+
+func (m *testDBRepo) UpdateCancellationPolicy(p models.CancellationPolicy) error {
+	_, err := m.GetCancellationPolicyByID(p.ID)
+	return err
+}
+
+func (m *testDBRepo) DeleteCancellationPolicy(id int) error {
+	_, err := m.GetCancellationPolicyByID(id)
+	return err
+}
+
+func (m *testDBRepo) WithActor(a models.Actor) repository.DatabaseRepo {
+	return m
+}
+
+// testProperties are the properties of the test repository; every room is in property 1, and
+// user 2 manages property 2
+var testProperties = []models.Property{
+	{ID: 1, Name: "Fort Smythe Bed and Breakfast", Email: "owner@email.com", TimeZone: "America/Halifax",
+		Currency: "USD", RoomIDs: []int{1, 2}},
+	{ID: 2, Name: "Harbour House", Email: "harbour@email.com", Address: "1 Harbour Road", TimeZone: "Europe/Paris",
+		Currency: "EUR", CancellationPolicyID: 1, UserIDs: []int{2}},
+}
+
+func (m *testDBRepo) WithProperties(ids []int) repository.DatabaseRepo {
+	c := *m
+	c.properties = ids
+	return &c
+}
+
+// inScope reports whether the test repository may read the rooms of a property
+func (m *testDBRepo) inScope(propertyID int) bool {
+	if len(m.properties) == 0 {
+		return true
+	}
+	for _, id := range m.properties {
+		if id == propertyID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *testDBRepo) AllProperties() ([]models.Property, error) {
+	return testProperties, nil
+}
+
+func (m *testDBRepo) GetPropertyByID(id int) (models.Property, error) {
+	for _, p := range testProperties {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return models.Property{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) InsertProperty(p models.Property) (int, error) {
+	return 3, nil
+}
+
+func (m *testDBRepo) UpdateProperty(p models.Property) error {
+	_, err := m.GetPropertyByID(p.ID)
+	return err
+}
+
+func (m *testDBRepo) DeleteProperty(id int) error {
+	_, err := m.GetPropertyByID(id)
+	return err
+}
+
+func (m *testDBRepo) AllUsers() ([]models.User, error) {
+	users := []models.User{
+		{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@admin.com", AccessLevel: 3},
+		{ID: 2, FirstName: "Harbour", LastName: "Manager", Email: "harbour@email.com", AccessLevel: 1},
+	}
+	return users, nil
+}
+
+func (m *testDBRepo) AuditEntries(f models.AuditFilter) ([]models.AuditEntry, error) {
+	var entries []models.AuditEntry
+	return entries, nil
+}
+
+func (m *testDBRepo) SearchGuests(search string, limit int) ([]models.Guest, error) {
+	guests := []models.Guest{
+		{ID: 1, FirstName: "John", LastName: "Smith", Email: "john@smith.com", Tags: []string{"vip"},
+			Stays: 5, LifetimeValue: 250000},
+	}
+	return guests, nil
+}
+
+func (m *testDBRepo) GetGuestByID(id int) (models.Guest, error) {
+	// guests 1 and 2 exist
+	if id < 1 || id > 2 {
+		return models.Guest{}, sql.ErrNoRows
+	}
+	return models.Guest{ID: id, FirstName: "John", LastName: "Smith", Email: "john@smith.com", Stays: 5,
+		LifetimeValue: 250000}, nil
+}
+
+func (m *testDBRepo) GuestReservations(guestID int) ([]models.Reservation, error) {
+	reservations, _, err := m.SearchReservations(models.ReservationFilter{})
+	return reservations, err
+}
+
+func (m *testDBRepo) UpdateGuest(g models.Guest) error {
+	// jane@doe.com belongs to another guest
+	if g.Email == "jane@doe.com" {
+		return repository.ErrDuplicateGuest
+	}
+	return nil
+}
+
+func (m *testDBRepo) PossibleDuplicateGuests(g models.Guest) ([]models.Guest, error) {
+	var guests []models.Guest
+	if g.ID == 1 {
+		guests = append(guests, models.Guest{ID: 2, FirstName: "John", LastName: "Smith", Email: "js@work.com"})
+	}
+	return guests, nil
+}
+
+func (m *testDBRepo) MergeGuests(keepID, mergeID int) error {
+	if mergeID > 2 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
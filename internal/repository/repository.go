@@ -1,25 +1,126 @@
 package repository
 
 import (
+	"errors"
 	"time"
 
 	"github.com/tsawler/bookings-app/internal/models"
 )
 
+// ErrRoomUnavailable is returned when a room is already restricted for the requested dates
+var ErrRoomUnavailable = errors.New("room is not available for the requested dates")
+
+// ErrHoldExpired is returned when a room hold no longer exists or has run out
+var ErrHoldExpired = errors.New("room hold has expired")
+
+// ErrDuplicateGuest is returned when a guest is given the email address of another guest
+var ErrDuplicateGuest = errors.New("another guest has this email address")
+
+// ReservationSorts are the columns reservations can be sorted by
+var ReservationSorts = []string{"id", "last_name", "room", "start_date", "end_date", "status", "source"}
+
+// ErrStatusChanged is returned when a reservation's status was changed by someone else first
+var ErrStatusChanged = errors.New("reservation status has changed")
+
+// ErrPromoCodeUsedUp is returned when a promo code reached its limits before a booking could
+// redeem it
+var ErrPromoCodeUsedUp = errors.New("promo code has been used up")
+
 type DatabaseRepo interface {
+	// WithActor returns a copy of the repository whose writes are recorded in the audit log as made by a
+	WithActor(a models.Actor) DatabaseRepo
+	AuditEntries(f models.AuditFilter) ([]models.AuditEntry, error)
+	// WithProperties returns a copy of the repository whose reads are limited to the rooms of the
+	// properties in ids, or not limited if there are none
+	WithProperties(ids []int) DatabaseRepo
+
 	AllUser() bool
 	InsertReservation(res models.Reservation) (int, error)
 	InsertRoomRestrictions(r models.RoomRestriction) error
 	SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool ,error)
-	SearchAvailabilityForAllRoom(start, end time.Time) ([]models.Room, error)
+	SearchAvailabilityForAllRoom(start, end time.Time, propertyID int) ([]models.Room, error)
 	GetRoomByID(id int) (models.Room, error)
 	GetUserByID(id int) (models.User, error)
 	UpdateUser(u models.User) error
 	Authenticate(email, testPassword string) (int, string, error)
-	AllReservations() ([]models.Reservation, error)
-	AllNewReservations() ([]models.Reservation, error)
+	SearchReservations(f models.ReservationFilter) ([]models.Reservation, int, error)
+	EachReservation(f models.ReservationFilter, fn func(models.Reservation) error) error
+	OccupancyByDay(start, end time.Time) ([]models.DailyOccupancy, error)
+	ImportReservations(res []models.Reservation, dryRun bool) ([]error, error)
+	ArrivalsOn(day time.Time) ([]models.Reservation, error)
+	DeparturesOn(day time.Time) ([]models.Reservation, error)
+	OccupancySummary(start, end time.Time) (models.OccupancySummary, error)
+	BookingsByWeek(since time.Time) ([]models.BookingVolume, error)
+	LeadTimeDistribution(since time.Time) ([]models.LeadTimeBucket, error)
+	ReservationsBetween(start, end time.Time) ([]models.Reservation, error)
+	SearchGuests(search string, limit int) ([]models.Guest, error)
+	GetGuestByID(id int) (models.Guest, error)
+	GuestReservations(guestID int) ([]models.Reservation, error)
+	UpdateGuest(g models.Guest) error
+	PossibleDuplicateGuests(g models.Guest) ([]models.Guest, error)
+	MergeGuests(keepID, mergeID int) error
+	RestrictionsBetween(start, end time.Time) ([]models.RoomRestriction, error)
 	GetReservationByID(id int) (models.Reservation, error)
 	UpdateReservation(u models.Reservation) error
-	DeleteReservation(id int) error
-	UpdateProcessedForReservation(id, processed int) error
+	DeleteReservation(id, userID int) error
+	DeletedReservations() ([]models.Reservation, error)
+	RestoreReservation(id int) error
+	PurgeDeletedReservations(before time.Time) (int64, error)
+	UpdateReservationStatus(id int, from, to models.ReservationStatus, userID int) error
+	ReservationStatusChanges(reservationID int) ([]models.ReservationStatusChange, error)
+	ReservationNotes(reservationID int) ([]models.ReservationNote, error)
+	InsertReservationNote(n models.ReservationNote) (int, error)
+	SetReservationNoteImportant(id, reservationID int, important bool) error
+	ImportantNotesBetween(start, end time.Time) ([]models.ReservationNote, error)
+	InsertRoomHold(r models.RoomRestriction) (int, error)
+	ConvertHoldToReservation(holdID int, res models.Reservation) (int, error)
+	ReleaseRoomHold(holdID int) error
+	DeleteExpiredHolds() (int64, error)
+	AllRooms() ([]models.Room, error)
+	InsertWaitlistEntry(e models.WaitlistEntry) (int, error)
+	WaitingEntriesForRoom(roomID int, start, end time.Time) ([]models.WaitlistEntry, error)
+	MarkWaitlistEntryNotified(id int, token string, expires time.Time) error
+	GetWaitlistEntryByToken(token string) (models.WaitlistEntry, error)
+	WaitlistEntriesByDates(start, end time.Time) ([]models.WaitlistEntry, error)
+	ExpireWaitlistOffers() ([]models.WaitlistEntry, error)
+	MarkWaitlistEntryBooked(id int) error
+	AllCustomFields() ([]models.CustomField, error)
+	GetCustomFieldByID(id int) (models.CustomField, error)
+	InsertCustomField(f models.CustomField) (int, error)
+	UpdateCustomField(f models.CustomField) error
+	DeleteCustomField(id int) error
+	AllPromoCodes() ([]models.PromoCode, error)
+	GetPromoCodeByID(id int) (models.PromoCode, error)
+	GetPromoCodeByCode(code string) (models.PromoCode, error)
+	InsertPromoCode(p models.PromoCode) (int, error)
+	UpdatePromoCode(p models.PromoCode) error
+	DeletePromoCode(id int) error
+	PromoCodeUsage(promoCodeID int, email string) (int, int, error)
+	GetPromoRedemptionByReservationID(id int) (models.PromoRedemption, error)
+	InsertPaymentIntent(pi models.PaymentIntent) (int, error)
+	UpdatePaymentIntentStatus(id int, status string) error
+	InsertPaymentTransaction(t models.PaymentTransaction) (int, error)
+	PaymentTransactionsByReservationID(id int) ([]models.PaymentTransaction, error)
+	GetReservationByAccessToken(token string) (models.Reservation, error)
+	GetInvoiceByReservationID(id int) (models.Invoice, error)
+	IssueInvoice(inv models.Invoice) (models.Invoice, error)
+	AllExchangeRates() ([]models.ExchangeRate, error)
+	SaveExchangeRates(rates []models.ExchangeRate) error
+	DeleteExchangeRate(currency string) error
+	AllTaxRules() ([]models.TaxRule, error)
+	GetTaxRuleByID(id int) (models.TaxRule, error)
+	InsertTaxRule(t models.TaxRule) (int, error)
+	UpdateTaxRule(t models.TaxRule) error
+	DeleteTaxRule(id int) error
+	AllCancellationPolicies() ([]models.CancellationPolicy, error)
+	GetCancellationPolicyByID(id int) (models.CancellationPolicy, error)
+	InsertCancellationPolicy(p models.CancellationPolicy) (int, error)
+	UpdateCancellationPolicy(p models.CancellationPolicy) error
+	DeleteCancellationPolicy(id int) error
+	AllProperties() ([]models.Property, error)
+	GetPropertyByID(id int) (models.Property, error)
+	InsertProperty(p models.Property) (int, error)
+	UpdateProperty(p models.Property) error
+	DeleteProperty(id int) error
+	AllUsers() ([]models.User, error)
 }
\ No newline at end of file
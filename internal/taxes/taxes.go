@@ -0,0 +1,71 @@
+// Package taxes works out the taxes and fees on a stay from the rules admins set up, such as a
+// lodging tax on the room charge, a tourism fee per guest per night and a cleaning fee per stay.
+package taxes
+
+import (
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+// Quote returns the charges the active rules add to the stay of res, in the order of rules. A
+// rule only counts the nights it is valid on, so a rate that changes during a stay is charged at
+// the old rate before the change and at the new one after it.
+func Quote(res models.Reservation, rules []models.TaxRule) []models.Charge {
+	nights := res.Nights()
+	if nights <= 0 {
+		return nil
+	}
+	guests := res.Guests
+	if guests < 1 {
+		guests = 1
+	}
+
+	var charges []models.Charge
+	for _, rule := range rules {
+		if !rule.Active || !rule.AppliesToRoom(res.RoomID) {
+			continue
+		}
+
+		eligible := 0
+		for day := res.StartDate; day.Before(res.EndDate); day = day.AddDate(0, 0, 1) {
+			if rule.ValidOn(day) {
+				eligible++
+			}
+		}
+		if eligible == 0 {
+			continue
+		}
+
+		var amount int
+		if rule.Type == models.TaxPercent {
+			// the discount is spread evenly over the nights
+			base := (res.Subtotal() - res.Discount) * eligible / nights
+			amount = roundDiv(base*rule.Amount, 10000)
+		} else {
+			amount = rule.Amount
+			if rule.PerNight {
+				amount *= eligible
+			}
+			if rule.PerGuest {
+				amount *= guests
+			}
+		}
+		if amount <= 0 {
+			continue
+		}
+
+		charges = append(charges, models.Charge{
+			TaxRuleID:   rule.ID,
+			Description: rule.Name,
+			Amount:      amount,
+		})
+	}
+	return charges
+}
+
+// roundDiv divides a by b, which must be positive, rounding halves away from zero
+func roundDiv(a, b int) int {
+	if a < 0 {
+		return -roundDiv(-a, b)
+	}
+	return (a + b/2) / b
+}
@@ -0,0 +1,94 @@
+package taxes
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestQuote(t *testing.T) {
+	lodging := models.TaxRule{ID: 1, Name: "Lodging tax", Type: models.TaxPercent, Amount: 1350, Active: true}
+	tourism := models.TaxRule{ID: 2, Name: "Tourism fee", Type: models.TaxFixed, Amount: 250, PerNight: true, PerGuest: true, Active: true}
+	cleaning := models.TaxRule{ID: 3, Name: "Cleaning fee", Type: models.TaxFixed, Amount: 4000, Active: true}
+
+	// three nights at 100.00 for two guests in room 1
+	stay := models.Reservation{
+		RoomID:      1,
+		StartDate:   date("2050-01-01"),
+		EndDate:     date("2050-01-04"),
+		NightlyRate: 10000,
+		Guests:      2,
+	}
+
+	withDiscount := stay
+	withDiscount.Discount = 3000
+
+	noGuests := stay
+	noGuests.Guests = 0
+
+	oldRate := lodging
+	oldRate.ValidTo = date("2050-01-01")
+	newRate := lodging
+	newRate.ID, newRate.Amount, newRate.ValidFrom = 4, 1500, date("2050-01-02")
+
+	otherRoom := cleaning
+	otherRoom.RoomIDs = []int{2, 3}
+
+	inactive := cleaning
+	inactive.Active = false
+
+	expired := tourism
+	expired.ValidTo = date("2049-12-31")
+
+	var tests = []struct {
+		name     string
+		res      models.Reservation
+		rules    []models.TaxRule
+		expected []models.Charge
+	}{
+		{"all", stay, []models.TaxRule{lodging, tourism, cleaning}, []models.Charge{
+			{TaxRuleID: 1, Description: "Lodging tax", Amount: 4050},
+			{TaxRuleID: 2, Description: "Tourism fee", Amount: 1500},
+			{TaxRuleID: 3, Description: "Cleaning fee", Amount: 4000},
+		}},
+		{"percent-after-discount", withDiscount, []models.TaxRule{lodging}, []models.Charge{
+			{TaxRuleID: 1, Description: "Lodging tax", Amount: 3645},
+		}},
+		{"at-least-one-guest", noGuests, []models.TaxRule{tourism}, []models.Charge{
+			{TaxRuleID: 2, Description: "Tourism fee", Amount: 750},
+		}},
+		{"rate-change", stay, []models.TaxRule{oldRate, newRate}, []models.Charge{
+			{TaxRuleID: 1, Description: "Lodging tax", Amount: 1350},
+			{TaxRuleID: 4, Description: "Lodging tax", Amount: 3000},
+		}},
+		{"skipped", stay, []models.TaxRule{otherRoom, inactive, expired}, nil},
+		{"no-nights", models.Reservation{StartDate: date("2050-01-01"), EndDate: date("2050-01-01")}, []models.TaxRule{cleaning}, nil},
+	}
+
+	for _, e := range tests {
+		got := Quote(e.res, e.rules)
+		if !reflect.DeepEqual(got, e.expected) {
+			t.Errorf("%s: got %+v, wanted %+v", e.name, got, e.expected)
+		}
+	}
+
+	stay.Charges = Quote(stay, []models.TaxRule{lodging, tourism, cleaning})
+	if stay.Total() != 30000+4050+1500+4000 {
+		t.Errorf("the total of the stay is %d, wanted the room charge with the taxes and fees", stay.Total())
+	}
+}
+
+func TestRoundDiv(t *testing.T) {
+	for _, e := range []struct{ a, b, expected int }{{4, 10, 0}, {5, 10, 1}, {15, 10, 2}, {-5, 10, -1}} {
+		if got := roundDiv(e.a, e.b); got != e.expected {
+			t.Errorf("roundDiv(%d, %d) is %d, wanted %d", e.a, e.b, got, e.expected)
+		}
+	}
+}
@@ -0,0 +1 @@
+delete from restrictions where id = 3;
@@ -0,0 +1 @@
+UPDATE public.rooms SET price = 0;
@@ -0,0 +1,2 @@
+UPDATE public.rooms SET price = 9500 WHERE room_name = 'General''s Quarters';
+UPDATE public.rooms SET price = 12500 WHERE room_name = 'Major''s Suite';
@@ -0,0 +1 @@
+DELETE FROM public.cancellation_policies WHERE name IN ('Flexible', 'Moderate', 'Strict');
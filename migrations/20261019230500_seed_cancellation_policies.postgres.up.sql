@@ -0,0 +1,4 @@
+INSERT INTO public.cancellation_policies (name, description, tiers, created_at, updated_at) VALUES
+    ('Flexible', 'Full refund up to the day before arrival.', '[{"days_before": 1, "percent": 100}]', now(), now()),
+    ('Moderate', 'Full refund up to 7 days before arrival, half up to 2 days before.', '[{"days_before": 7, "percent": 100}, {"days_before": 2, "percent": 50}]', now(), now()),
+    ('Strict', 'Half refunded up to 14 days before arrival, nothing after that.', '[{"days_before": 14, "percent": 50}]', now(), now());